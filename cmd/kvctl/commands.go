@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"kvManager/pkg/client"
+)
+
+func newHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout}
+}
+
+func runGet(ctx context.Context, e *env, args []string) error {
+	flags := newFlags(e, "get")
+	err := parseFlags(flags, args, 1, -1)
+	if err != nil {
+		return err
+	}
+	keys := flags.Args()
+
+	if len(keys) == 1 {
+		value, err := e.client.Get(ctx, keys[0])
+		if err != nil {
+			return err
+		}
+		return printResult(e.stdout, e.output, table{
+			rows:  [][]string{{compact(value)}},
+			value: value,
+		})
+	}
+
+	values, err := e.client.MultiGet(ctx, keys)
+	if err != nil {
+		return err
+	}
+	result := table{header: []string{"KEY", "VALUE"}, value: values}
+	var missing []string
+	for _, key := range keys {
+		value, ok := values[key]
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+		result.rows = append(result.rows, []string{key, compact(value)})
+	}
+	err = printResult(e.stdout, e.output, result)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", client.ErrKeyNotFound, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func runPut(ctx context.Context, e *env, args []string) error {
+	return writeValue(ctx, e, "put", args)
+}
+
+func runAdd(ctx context.Context, e *env, args []string) error {
+	return writeValue(ctx, e, "add", args)
+}
+
+func writeValue(ctx context.Context, e *env, name string, args []string) error {
+	flags := newFlags(e, name)
+	file := flags.String("f", "", "read the value from FILE, - for stdin")
+	asString := flags.Bool("string", false, "store the input as a JSON string instead of parsing it")
+	err := parseFlags(flags, args, 1, 2)
+	if err != nil {
+		return err
+	}
+	key := flags.Arg(0)
+	if flags.NArg() == 2 && *file != "" {
+		flags.Usage()
+		return errUsage
+	}
+
+	var data []byte
+	switch {
+	case flags.NArg() == 2:
+		data = []byte(flags.Arg(1))
+	case *file == "" || *file == "-":
+		data, err = io.ReadAll(e.stdin)
+	default:
+		data, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return err
+	}
+	value, err := parseValue(data, *asString)
+	if err != nil {
+		return err
+	}
+
+	if name == "add" {
+		err = e.client.Add(ctx, key, value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stderr, "%s created\n", key)
+		return nil
+	}
+	created, err := e.client.Put(ctx, key, value)
+	if err != nil {
+		return err
+	}
+	if created {
+		fmt.Fprintf(e.stderr, "%s created\n", key)
+	} else {
+		fmt.Fprintf(e.stderr, "%s updated\n", key)
+	}
+	return nil
+}
+
+// parseValue returns data as a JSON value. Unless asString is set data
+// must be valid JSON.
+func parseValue(data []byte, asString bool) (any, error) {
+	if asString {
+		return strings.TrimSuffix(string(data), "\n"), nil
+	}
+	data = bytes.TrimSpace(data)
+	if !json.Valid(data) {
+		return nil, errors.New("value is not valid JSON, use -string to store text")
+	}
+	return json.RawMessage(data), nil
+}
+
+func runDelete(ctx context.Context, e *env, args []string) error {
+	flags := newFlags(e, "delete")
+	err := parseFlags(flags, args, 1, -1)
+	if err != nil {
+		return err
+	}
+	keys := flags.Args()
+
+	if len(keys) == 1 {
+		err = e.client.Delete(ctx, keys[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stderr, "%s deleted\n", keys[0])
+		return nil
+	}
+
+	deleted, err := e.client.MultiDelete(ctx, keys)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stderr, "%d of %d keys deleted\n", len(deleted), len(keys))
+	return nil
+}
+
+type listResult struct {
+	Items []client.Item `json:"items"`
+	Next  string        `json:"next,omitempty"`
+}
+
+func runList(ctx context.Context, e *env, args []string) error {
+	flags := newFlags(e, "list")
+	prefix := flags.String("prefix", "", "only keys starting with P")
+	after := flags.String("after", "", "start after KEY, the next cursor of the previous page")
+	limit := flags.Int("limit", 0, "page size (default chosen by the server)")
+	all := flags.Bool("all", false, "follow pages until the last one")
+	err := parseFlags(flags, args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	opts := client.ListOptions{Prefix: *prefix, After: *after, Limit: *limit}
+	var result listResult
+	if *all {
+		err = e.client.ListAll(ctx, opts, func(item client.Item) error {
+			result.Items = append(result.Items, item)
+			return nil
+		})
+	} else {
+		var page *client.Page
+		page, err = e.client.List(ctx, opts)
+		if page != nil {
+			result = listResult{Items: page.Items, Next: page.Next}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(result.Items))
+	for _, item := range result.Items {
+		rows = append(rows, []string{item.Key, compact(item.Value)})
+	}
+	err = printResult(e.stdout, e.output, table{header: []string{"KEY", "VALUE"}, rows: rows, value: result})
+	if err != nil {
+		return err
+	}
+	if result.Next != "" && e.output == OutputTable {
+		fmt.Fprintf(e.stderr, "more entries follow, continue with -after %s\n", strconv.Quote(result.Next))
+	}
+	return nil
+}
+
+// Watch events.
+const (
+	EventPut    string = "put"
+	EventDelete string = "delete"
+)
+
+type watchEvent struct {
+	Time  time.Time       `json:"time"`
+	Event string          `json:"event"`
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// runWatch polls the server and prints the entries that changed since the
+// previous poll until interrupted.
+func runWatch(ctx context.Context, e *env, args []string) error {
+	flags := newFlags(e, "watch")
+	prefix := flags.String("prefix", "", "watch every key starting with P")
+	interval := flags.Duration("interval", 2*time.Second, "poll interval")
+	err := parseFlags(flags, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	if (flags.NArg() == 1) == (*prefix != "") || *interval <= 0 {
+		flags.Usage()
+		return errUsage
+	}
+	key := flags.Arg(0)
+
+	snapshot := func() (map[string]string, error) {
+		state := make(map[string]string)
+		if *prefix == "" {
+			value, err := e.client.Get(ctx, key)
+			if errors.Is(err, client.ErrKeyNotFound) {
+				return state, nil
+			}
+			state[key] = compact(value)
+			return state, err
+		}
+		err := e.client.ListAll(ctx, client.ListOptions{Prefix: *prefix}, func(item client.Item) error {
+			state[item.Key] = compact(item.Value)
+			return nil
+		})
+		return state, err
+	}
+
+	previous, err := snapshot()
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		current, err := snapshot()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintln(e.stderr, "kvctl: watch:", err)
+			continue
+		}
+		for _, event := range diff(previous, current) {
+			err = printEvent(e.stdout, e.output, event)
+			if err != nil {
+				return err
+			}
+		}
+		previous = current
+	}
+}
+
+// diff returns the events that turn previous into current in key order.
+func diff(previous map[string]string, current map[string]string) []watchEvent {
+	now := time.Now().UTC()
+	var events []watchEvent
+	for key, value := range current {
+		if old, ok := previous[key]; !ok || old != value {
+			events = append(events, watchEvent{Time: now, Event: EventPut, Key: key, Value: json.RawMessage(value)})
+		}
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			events = append(events, watchEvent{Time: now, Event: EventDelete, Key: key})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Key < events[j].Key })
+	return events
+}
+
+// printEvent writes one event per line in the table and JSON formats and
+// one document per event in YAML.
+func printEvent(w io.Writer, format string, event watchEvent) error {
+	switch format {
+	case OutputTable:
+		_, err := fmt.Fprintf(w, "%s  %-6s  %s  %s\n", event.Time.Format(time.RFC3339),
+			event.Event, event.Key, string(event.Value))
+		return err
+	case OutputJSON:
+		return json.NewEncoder(w).Encode(event)
+	case OutputYAML:
+		_, err := io.WriteString(w, "---\n")
+		if err != nil {
+			return err
+		}
+	}
+	return printResult(w, format, table{value: event})
+}
+
+func runExport(ctx context.Context, e *env, args []string) error {
+	flags := newFlags(e, "export")
+	prefix := flags.String("prefix", "", "only keys starting with P")
+	file := flags.String("f", "", "write to FILE instead of stdout")
+	err := parseFlags(flags, args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	out := e.stdout
+	if *file != "" && *file != "-" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	buf := bufio.NewWriter(out)
+	encoder := json.NewEncoder(buf)
+	count := 0
+	err = e.client.Export(ctx, client.ExportOptions{Prefix: *prefix}, func(item client.Item) error {
+		count++
+		return encoder.Encode(item)
+	})
+	flushErr := buf.Flush()
+	if err != nil {
+		if count > 0 {
+			fmt.Fprintf(e.stderr, "export stopped after %d entries\n", count)
+		}
+		return err
+	}
+	if flushErr != nil {
+		return flushErr
+	}
+	fmt.Fprintf(e.stderr, "%d entries exported\n", count)
+	return nil
+}
+
+// importProgressEntries is how many entries the server imports between
+// two progress lines of import.
+const importProgressEntries = 10000
+
+func runImport(ctx context.Context, e *env, args []string) error {
+	flags := newFlags(e, "import")
+	file := flags.String("f", "", "read from FILE instead of stdin")
+	mode := flags.String("mode", string(client.ImportOverwrite), "existing keys: skip, overwrite or fail")
+	err := parseFlags(flags, args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	in := e.stdin
+	if *file != "" && *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var reported int64
+	summary, err := e.client.Import(ctx, in, client.ImportOptions{
+		Mode: client.ImportMode(*mode),
+		Imported: func(progress client.ImportSummary) {
+			if progress.Processed-reported >= importProgressEntries {
+				reported = progress.Processed
+				fmt.Fprintf(e.stderr, "%d entries imported\n", progress.Processed)
+			}
+		},
+	})
+	if summary != nil {
+		for _, failure := range summary.Errors {
+			fmt.Fprintf(e.stderr, "line %d: %s", failure.Line, failure.Error)
+			if failure.Key != "" {
+				fmt.Fprintf(e.stderr, " (key %q)", failure.Key)
+			}
+			fmt.Fprintln(e.stderr)
+		}
+		fmt.Fprintf(e.stderr, "%d entries processed: %d created, %d replaced, %d skipped, %d failed\n",
+			summary.Processed, summary.Created, summary.Replaced, summary.Skipped, summary.Failed)
+	}
+	return err
+}
+
+// hiddenStats are expvar variables left out of stats.
+var hiddenStats = map[string]bool{"cmdline": true, "memstats": true}
+
+func runStats(ctx context.Context, e *env, args []string) error {
+	flags := newFlags(e, "stats")
+	err := parseFlags(flags, args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() == 1 {
+		usage, err := e.client.Usage(ctx, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		return printResult(e.stdout, e.output, table{
+			header: []string{"NAMESPACE", "KEYS", "BYTES", "MAX_KEYS", "MAX_BYTES"},
+			rows: [][]string{{usage.Namespace,
+				strconv.FormatInt(usage.Usage.Keys, 10), strconv.FormatInt(usage.Usage.Bytes, 10),
+				limitString(usage.MaxKeys), limitString(usage.MaxBytes)}},
+			value: usage,
+		})
+	}
+
+	health, err := e.client.Health(ctx)
+	if err != nil {
+		return err
+	}
+	vars, err := e.client.Stats(ctx)
+	if err != nil {
+		return err
+	}
+
+	value := map[string]any{"health": health}
+	rows := [][]string{{"health", health.Status}}
+	checks := make([]string, 0, len(health.Checks))
+	for name := range health.Checks {
+		checks = append(checks, name)
+	}
+	sort.Strings(checks)
+	for _, name := range checks {
+		rows = append(rows, []string{"health." + name, compact(health.Checks[name].Status)})
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		if !hiddenStats[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value[name] = vars[name]
+		rows = flatten(rows, name, vars[name])
+	}
+	return printResult(e.stdout, e.output, table{header: []string{"NAME", "VALUE"}, rows: rows, value: value})
+}
+
+func limitString(limit int64) string {
+	if limit == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(limit, 10)
+}
+
+// flatten appends a row for every scalar in raw named by its dotted path.
+func flatten(rows [][]string, name string, raw json.RawMessage) [][]string {
+	var object map[string]json.RawMessage
+	if json.Unmarshal(raw, &object) != nil {
+		return append(rows, []string{name, compact(raw)})
+	}
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		rows = flatten(rows, name+"."+key, object[key])
+	}
+	return rows
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kvManager/internal/handlers"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+// newServer starts the HTTP API over a memory repository.
+func newServer(t *testing.T) (*httptest.Server, *storage.MemoryRepository) {
+	t.Helper()
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	repo := storage.NewMemoryRepository()
+	server := httptest.NewServer(handlers.NewRouter(&handlers.Handler{Repo: repo}))
+	t.Cleanup(server.Close)
+	t.Setenv("KVCTL_CONFIG", filepath.Join(t.TempDir(), "config.yaml"))
+	t.Setenv("KVCTL_PROFILE", "")
+	return server, repo
+}
+
+// runKvctl runs kvctl against url and returns its stdout and stderr.
+func runKvctl(t *testing.T, url string, stdin string, args ...string) (string, string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-url", url}, args...)
+	err := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), stderr.String(), err
+}
+
+func TestParseValue(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		asString bool
+		expected string
+		wantErr  bool
+	}{
+		{name: "object", data: `{"name": "Ann"}`, expected: `{"name":"Ann"}`},
+		{name: "surrounding space", data: " 42\n", expected: `42`},
+		{name: "string flag", data: "hello\n", asString: true, expected: `"hello"`},
+		{name: "string flag keeps json", data: `{"a":1}`, asString: true, expected: `"{\"a\":1}"`},
+		{name: "invalid json", data: "hello", wantErr: true},
+		{name: "empty", data: "", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			value, err := parseValue([]byte(tc.data), tc.asString)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v, got %v", tc.wantErr, err)
+			}
+			if tc.wantErr {
+				return
+			}
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				t.Fatalf("Failed to encode value: %v", err)
+			}
+			if string(encoded) != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, encoded)
+			}
+		})
+	}
+}
+
+func TestWriteValue(t *testing.T) {
+	server, repo := newServer(t)
+	file := filepath.Join(t.TempDir(), "value.json")
+	err := os.WriteFile(file, []byte("{\"from\": \"file\"}\n"), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write value file: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		stdin    string
+		args     []string
+		expected any
+		stderr   string
+		wantErr  bool
+	}{
+		{name: "argument", args: []string{"add", "k1", `[1,2]`}, expected: []any{int64(1), int64(2)}, stderr: "k1 created"},
+		{name: "file", args: []string{"put", "-f", file, "k2"}, expected: map[string]any{"from": "file"}, stderr: "k2 created"},
+		{name: "stdin", stdin: `{"from":"stdin"}`, args: []string{"put", "k2"},
+			expected: map[string]any{"from": "stdin"}, stderr: "k2 updated"},
+		{name: "stdin dash", stdin: "text\n", args: []string{"put", "-string", "-f", "-", "k3"},
+			expected: "text", stderr: "k3 created"},
+		{name: "existing key", args: []string{"add", "k1", `1`}, wantErr: true},
+		{name: "invalid json", stdin: "text", args: []string{"put", "k4"}, wantErr: true},
+		{name: "file and value", args: []string{"put", "-f", file, "k5", "1"}, wantErr: true},
+		{name: "missing file", args: []string{"put", "-f", file + ".missing", "k5"}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, stderr, err := runKvctl(t, server.URL, tc.stdin, tc.args...)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v, got %v", tc.wantErr, err)
+			}
+			if tc.wantErr {
+				return
+			}
+			if !strings.Contains(stderr, tc.stderr) {
+				t.Errorf("Expected stderr to contain %q, got %q", tc.stderr, stderr)
+			}
+			key := tc.args[len(tc.args)-1]
+			if tc.args[0] == "add" {
+				key = tc.args[1]
+			}
+			data, err := repo.GetValue(key)
+			if err != nil {
+				t.Fatalf("Failed to get %s: %v", key, err)
+			}
+			stored, _ := json.Marshal(data[0].([]any)[1])
+			expected, _ := json.Marshal(tc.expected)
+			if string(stored) != string(expected) {
+				t.Errorf("Expected %s stored, got %s", expected, stored)
+			}
+		})
+	}
+}
+
+func TestProfileCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	t.Setenv("KVCTL_CONFIG", path)
+
+	steps := []struct {
+		args    []string
+		stdout  string
+		wantErr bool
+	}{
+		{args: []string{"profile", "set", "staging", "-url", "http://kv.staging:8080"}},
+		{args: []string{"profile", "set", "prod", "-url", "https://kv.example.com", "-output", "json"}},
+		{args: []string{"profile", "use", "prod"}},
+		{args: []string{"profile", "use", "qa"}, wantErr: true},
+		{args: []string{"profile", "list"},
+			stdout: "CURRENT  NAME     URL\n*        prod     https://kv.example.com\n         staging  http://kv.staging:8080\n"},
+	}
+
+	for _, step := range steps {
+		var stdout, stderr bytes.Buffer
+		err := run(context.Background(), step.args, strings.NewReader(""), &stdout, &stderr)
+		if (err != nil) != step.wantErr {
+			t.Fatalf("%v: expected error %v, got %v", step.args, step.wantErr, err)
+		}
+		if step.stdout != "" && stdout.String() != step.stdout {
+			t.Errorf("%v: expected %q, got %q", step.args, step.stdout, stdout.String())
+		}
+	}
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.CurrentProfile != "prod" || cfg.Profiles["prod"].Output != OutputJSON {
+		t.Errorf("Unexpected config %+v", cfg)
+	}
+}
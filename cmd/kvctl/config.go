@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultURL = "http://localhost:8080"
+
+// Profile is the connection settings of one environment.
+type Profile struct {
+	URL    string `yaml:"url"`
+	APIKey string `yaml:"api_key,omitempty"`
+	Output string `yaml:"output,omitempty"`
+}
+
+// Config is the kvctl configuration file:
+//
+//	current_profile: staging
+//	profiles:
+//	  staging:
+//	    url: http://kv.staging:8080
+//	  prod:
+//	    url: https://kv.example.com
+//	    api_key: secret
+//	    output: json
+type Config struct {
+	CurrentProfile string             `yaml:"current_profile"`
+	Profiles       map[string]Profile `yaml:"profiles"`
+}
+
+// configPath returns KVCTL_CONFIG or kvctl/config.yaml in the user
+// configuration directory.
+func configPath() string {
+	if path := os.Getenv("KVCTL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "kvctl", "config.yaml")
+}
+
+// loadConfig reads the configuration file. A missing file is an empty
+// configuration.
+func loadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) save(path string) error {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	err := encoder.Encode(cfg)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o600)
+}
+
+// resolve picks the profile named by the -profile flag, KVCTL_PROFILE or
+// current_profile, in that order. Without any of them the default local
+// server is used.
+func (cfg *Config) resolve(name string) (Profile, error) {
+	if name == "" {
+		name = os.Getenv("KVCTL_PROFILE")
+	}
+	if name == "" {
+		name = cfg.CurrentProfile
+	}
+	if name == "" {
+		return Profile{URL: defaultURL}, nil
+	}
+	profile, ok := cfg.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("profile %q not found in %s", name, configPath())
+	}
+	if profile.URL == "" {
+		profile.URL = defaultURL
+	}
+	return profile, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveProfile(t *testing.T) {
+	cfg := &Config{
+		CurrentProfile: "staging",
+		Profiles: map[string]Profile{
+			"staging": {URL: "http://kv.staging:8080"},
+			"prod":    {URL: "https://kv.example.com", APIKey: "secret", Output: OutputJSON},
+			"local":   {APIKey: "dev"},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		cfg      *Config
+		flag     string
+		env      string
+		expected Profile
+		wantErr  bool
+	}{
+		{name: "current profile", cfg: cfg, expected: Profile{URL: "http://kv.staging:8080"}},
+		{name: "env over current", cfg: cfg, env: "prod",
+			expected: Profile{URL: "https://kv.example.com", APIKey: "secret", Output: OutputJSON}},
+		{name: "flag over env", cfg: cfg, flag: "staging", env: "prod", expected: Profile{URL: "http://kv.staging:8080"}},
+		{name: "default url", cfg: cfg, flag: "local", expected: Profile{URL: defaultURL, APIKey: "dev"}},
+		{name: "no profile", cfg: &Config{}, expected: Profile{URL: defaultURL}},
+		{name: "unknown profile", cfg: cfg, flag: "qa", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("KVCTL_PROFILE", tc.env)
+			profile, err := tc.cfg.resolve(tc.flag)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v, got %v", tc.wantErr, err)
+			}
+			if !tc.wantErr && profile != tc.expected {
+				t.Errorf("Expected %+v, got %+v", tc.expected, profile)
+			}
+		})
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kvctl", "config.yaml")
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load a missing config: %v", err)
+	}
+	if cfg.CurrentProfile != "" || len(cfg.Profiles) != 0 {
+		t.Errorf("Expected an empty config, got %+v", cfg)
+	}
+
+	cfg.CurrentProfile = "prod"
+	cfg.Profiles = map[string]Profile{"prod": {URL: "https://kv.example.com", APIKey: "secret"}}
+	err = cfg.save(path)
+	if err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	loaded, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, cfg) {
+		t.Errorf("Expected %+v, got %+v", cfg, loaded)
+	}
+}
@@ -0,0 +1,233 @@
+// Command kvctl manages the data of a kvStorage server from the command
+// line. It talks to the HTTP API through the pkg/client SDK.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"kvManager/pkg/client"
+)
+
+// env is the state shared by the commands.
+type env struct {
+	client *client.Client
+	output string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command struct {
+	usage string
+	help  string
+	run   func(ctx context.Context, e *env, args []string) error
+}
+
+// commands is filled in init because the commands refer back to it for
+// their usage text.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"get":     {"get KEY [KEY...]", "print values", runGet},
+		"put":     {"put [-f FILE] [-string] KEY [VALUE]", "create or replace a value", runPut},
+		"add":     {"add [-f FILE] [-string] KEY [VALUE]", "create a value, failing if the key exists", runAdd},
+		"delete":  {"delete KEY [KEY...]", "delete keys", runDelete},
+		"list":    {"list [-prefix P] [-after KEY] [-limit N] [-all]", "list entries in key order", runList},
+		"watch":   {"watch [-interval D] (-prefix P | KEY)", "print changes of a key or prefix", runWatch},
+		"export":  {"export [-prefix P] [-f FILE]", "write entries as NDJSON", runExport},
+		"import":  {"import [-f FILE] [-mode skip|overwrite|fail]", "read entries from NDJSON", runImport},
+		"stats":   {"stats [NAMESPACE]", "print server health and counters, or namespace usage (admin key)", runStats},
+		"profile": {"profile (list | use NAME | set NAME [-url U] [-api-key K] [-output F])", "manage profiles", nil},
+	}
+}
+
+// errUsage is returned for invalid arguments and exits with status 2.
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "kvctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	flags := flag.NewFlagSet("kvctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	profileName := flags.String("profile", "", "profile from the config file (default $KVCTL_PROFILE or current_profile)")
+	baseURL := flags.String("url", "", "server URL, overrides the profile")
+	apiKey := flags.String("api-key", "", "API key, overrides the profile")
+	output := flags.String("o", "", "output format: table, json or yaml")
+	timeout := flags.Duration("timeout", 30*time.Second, "timeout of each request")
+	flags.Usage = func() { usage(flags) }
+	if flags.Parse(args) != nil {
+		return errUsage
+	}
+	if flags.NArg() == 0 {
+		usage(flags)
+		return errUsage
+	}
+
+	name, args := flags.Arg(0), flags.Args()[1:]
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "kvctl: unknown command %q\n", name)
+		usage(flags)
+		return errUsage
+	}
+
+	path := configPath()
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	if name == "profile" {
+		return runProfile(cfg, path, args, stdout, stderr)
+	}
+
+	profile, err := cfg.resolve(*profileName)
+	if err != nil {
+		return err
+	}
+	if *baseURL != "" {
+		profile.URL = *baseURL
+	}
+	if *apiKey != "" {
+		profile.APIKey = *apiKey
+	}
+	if *output != "" {
+		profile.Output = *output
+	}
+	if profile.Output == "" {
+		profile.Output = OutputTable
+	}
+
+	opts := []client.Option{client.WithHTTPClient(newHTTPClient(*timeout))}
+	if profile.APIKey != "" {
+		opts = append(opts, client.WithAPIKey(profile.APIKey))
+	}
+	c, err := client.New(profile.URL, opts...)
+	if err != nil {
+		return err
+	}
+	return cmd.run(ctx, &env{client: c, output: profile.Output, stdin: stdin, stdout: stdout, stderr: stderr}, args)
+}
+
+func usage(flags *flag.FlagSet) {
+	w := flags.Output()
+	fmt.Fprintln(w, "Usage: kvctl [flags] COMMAND [args]")
+	fmt.Fprintln(w, "\nCommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%s\n", commands[name].usage, commands[name].help)
+	}
+	tw.Flush()
+	fmt.Fprintln(w, "\nFlags:")
+	flags.PrintDefaults()
+}
+
+// newFlags returns the flag set of a command. Command flags come before
+// its positional arguments.
+func newFlags(e *env, name string) *flag.FlagSet {
+	flags := flag.NewFlagSet("kvctl "+name, flag.ContinueOnError)
+	flags.SetOutput(e.stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(e.stderr, "Usage: kvctl", commands[name].usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+func parseFlags(flags *flag.FlagSet, args []string, minArgs int, maxArgs int) error {
+	if flags.Parse(args) != nil {
+		return errUsage
+	}
+	if flags.NArg() < minArgs || (maxArgs >= 0 && flags.NArg() > maxArgs) {
+		flags.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+func runProfile(cfg *Config, path string, args []string, stdout io.Writer, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "Usage: kvctl", commands["profile"].usage)
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list":
+		names := make([]string, 0, len(cfg.Profiles))
+		for name := range cfg.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		result := table{header: []string{"CURRENT", "NAME", "URL"}, value: cfg}
+		for _, name := range names {
+			current := ""
+			if name == cfg.CurrentProfile {
+				current = "*"
+			}
+			result.rows = append(result.rows, []string{current, name, cfg.Profiles[name].URL})
+		}
+		return printResult(stdout, OutputTable, result)
+	case "use":
+		if len(args) != 2 {
+			fmt.Fprintln(stderr, "Usage: kvctl profile use NAME")
+			return errUsage
+		}
+		if _, ok := cfg.Profiles[args[1]]; !ok {
+			return fmt.Errorf("profile %q not found in %s", args[1], path)
+		}
+		cfg.CurrentProfile = args[1]
+		return cfg.save(path)
+	case "set":
+		flags := flag.NewFlagSet("kvctl profile set", flag.ContinueOnError)
+		flags.SetOutput(stderr)
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			fmt.Fprintln(stderr, "Usage: kvctl profile set NAME [-url U] [-api-key K] [-output F]")
+			return errUsage
+		}
+		name := args[1]
+		profile := cfg.Profiles[name]
+		flags.StringVar(&profile.URL, "url", profile.URL, "server URL")
+		flags.StringVar(&profile.APIKey, "api-key", profile.APIKey, "API key")
+		flags.StringVar(&profile.Output, "output", profile.Output, "default output format")
+		if flags.Parse(args[2:]) != nil || flags.NArg() > 0 {
+			return errUsage
+		}
+		if cfg.Profiles == nil {
+			cfg.Profiles = make(map[string]Profile)
+		}
+		cfg.Profiles[name] = profile
+		if cfg.CurrentProfile == "" {
+			cfg.CurrentProfile = name
+		}
+		return cfg.save(path)
+	}
+	fmt.Fprintln(stderr, "Usage: kvctl", commands["profile"].usage)
+	return errUsage
+}
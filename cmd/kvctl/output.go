@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats.
+const (
+	OutputTable string = "table"
+	OutputJSON  string = "json"
+	OutputYAML  string = "yaml"
+)
+
+// table is a result with rows for the table format. Its value is written
+// as is in the JSON and YAML formats.
+type table struct {
+	header []string
+	rows   [][]string
+	value  any
+}
+
+func printResult(w io.Writer, format string, result table) error {
+	switch format {
+	case OutputTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		if len(result.header) > 0 {
+			fmt.Fprintln(tw, strings.Join(result.header, "\t"))
+		}
+		for _, row := range result.rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	case OutputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result.value)
+	case OutputYAML:
+		value, err := yamlValue(result.value)
+		if err != nil {
+			return err
+		}
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		err = encoder.Encode(value)
+		if err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+	return fmt.Errorf("unknown output format %q, use table, json or yaml", format)
+}
+
+// yamlValue converts value to plain maps, slices and numbers through its
+// JSON encoding, so that json.RawMessage and JSON tags carry over to YAML.
+func yamlValue(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var decoded any
+	err = decoder.Decode(&decoded)
+	if err != nil {
+		return nil, err
+	}
+	return convertNumbers(decoded), nil
+}
+
+// convertNumbers replaces json.Number with int64 or float64 where that
+// keeps the value exact, and leaves it as a string otherwise.
+func convertNumbers(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = convertNumbers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = convertNumbers(item)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil && json.Number(fmt.Sprint(f)) == v {
+			return f
+		}
+		return v.String()
+	}
+	return value
+}
+
+// compact renders a JSON value on one line for table cells.
+func compact(raw json.RawMessage) string {
+	var buf bytes.Buffer
+	if json.Compact(&buf, raw) != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
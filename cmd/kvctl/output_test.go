@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestOutputFormats(t *testing.T) {
+	server, repo := newServer(t)
+	for key, value := range map[string]any{"user:1": map[string]any{"name": "Ann"}, "user:2": int64(42)} {
+		err := repo.AddValue(key, value)
+		if err != nil {
+			t.Fatalf("Failed to add %s: %v", key, err)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected string
+		wantErr  bool
+	}{
+		{name: "get table", args: []string{"get", "user:1"}, expected: "{\"name\":\"Ann\"}\n"},
+		{name: "get json", args: []string{"-o", "json", "get", "user:1"}, expected: "{\n  \"name\": \"Ann\"\n}\n"},
+		{name: "get yaml", args: []string{"-o", "yaml", "get", "user:1"}, expected: "name: Ann\n"},
+		{name: "multi get table", args: []string{"get", "user:1", "user:2"},
+			expected: "KEY     VALUE\nuser:1  {\"name\":\"Ann\"}\nuser:2  42\n"},
+		{name: "multi get json", args: []string{"-o", "json", "get", "user:1", "user:2"},
+			expected: "{\n  \"user:1\": {\n    \"name\": \"Ann\"\n  },\n  \"user:2\": 42\n}\n"},
+		{name: "multi get yaml", args: []string{"-o", "yaml", "get", "user:1", "user:2"},
+			expected: "user:1:\n  name: Ann\nuser:2: 42\n"},
+		{name: "list table", args: []string{"list", "-prefix", "user:"},
+			expected: "KEY     VALUE\nuser:1  {\"name\":\"Ann\"}\nuser:2  42\n"},
+		{name: "list json", args: []string{"-o", "json", "list", "-prefix", "user:"},
+			expected: "{\n  \"items\": [\n    {\n      \"key\": \"user:1\",\n      \"value\": {\n        \"name\": \"Ann\"\n      }\n    },\n    {\n      \"key\": \"user:2\",\n      \"value\": 42\n    }\n  ]\n}\n"},
+		{name: "list yaml", args: []string{"-o", "yaml", "list", "-prefix", "user:"},
+			expected: "items:\n  - key: user:1\n    value:\n      name: Ann\n  - key: user:2\n    value: 42\n"},
+		{name: "unknown format", args: []string{"-o", "xml", "get", "user:1"}, wantErr: true},
+		{name: "missing key", args: []string{"get", "user:3"}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stdout, _, err := runKvctl(t, server.URL, "", tc.args...)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v, got %v", tc.wantErr, err)
+			}
+			if !tc.wantErr && stdout != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, stdout)
+			}
+		})
+	}
+}
+
+func TestYAMLNumbers(t *testing.T) {
+	var buf bytes.Buffer
+	value := map[string]any{"big": json.Number("123456789012345678901234567890"), "small": json.Number("1.5")}
+	err := printResult(&buf, OutputYAML, table{value: value})
+	if err != nil {
+		t.Fatalf("Failed to print: %v", err)
+	}
+	expected := "big: \"123456789012345678901234567890\"\nsmall: 1.5\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
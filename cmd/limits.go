@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"kvManager/internal/handlers"
+	log "kvManager/internal/pkg/log"
+	"kvManager/internal/pkg/ratelimit"
+)
+
+// parseOverrides parses "name=a:b,other=c:d" lists used for per client
+// rate limits and per namespace quotas.
+func parseOverrides(raw string, parse func(name, a, b string) error) error {
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, limits, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("override %q is not name=a:b", item)
+		}
+		a, b, ok := strings.Cut(limits, ":")
+		if !ok {
+			return fmt.Errorf("override %q is not name=a:b", item)
+		}
+		err := parse(strings.TrimSpace(name), a, b)
+		if err != nil {
+			return fmt.Errorf("override %q: %w", item, err)
+		}
+	}
+	return nil
+}
+
+// rateLimitConfig reads RATE_LIMIT_* variables. Overrides are keyed by
+// the client bucket name: "ip:10.0.0.1", "key:<api key>" or "ns:orders".
+func rateLimitConfig() (*handlers.RateLimit, error) {
+	if os.Getenv("RATE_LIMIT_ENABLED") != "true" {
+		return nil, nil
+	}
+
+	def := ratelimit.Limit{
+		Rate:  float64(envInt("RATE_LIMIT_RPS", 100)),
+		Burst: envInt("RATE_LIMIT_BURST", 200),
+	}
+	overrides := make(map[string]ratelimit.Limit)
+	err := parseOverrides(os.Getenv("RATE_LIMIT_OVERRIDES"), func(name, rate, burst string) error {
+		rps, err := strconv.ParseFloat(rate, 64)
+		if err != nil {
+			return err
+		}
+		b, err := strconv.Atoi(burst)
+		if err != nil {
+			return err
+		}
+		overrides[name] = ratelimit.Limit{Rate: rps, Burst: b}
+		return nil
+	})
+	if err != nil {
+		log.Logger.Errorw("Invalid RATE_LIMIT_OVERRIDES", "error", err)
+		return nil, err
+	}
+
+	by := os.Getenv("RATE_LIMIT_BY")
+	switch by {
+	case "":
+		by = handlers.RateLimitByIP
+	case handlers.RateLimitByIP, handlers.RateLimitByAPIKey, handlers.RateLimitByNamespace:
+	default:
+		err = fmt.Errorf("unknown RATE_LIMIT_BY %q", by)
+		log.Logger.Errorw("Invalid rate limit configuration", "error", err)
+		return nil, err
+	}
+
+	var apiKeys []string
+	for _, key := range strings.Split(os.Getenv("RATE_LIMIT_API_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			apiKeys = append(apiKeys, key)
+		}
+	}
+	if by == handlers.RateLimitByAPIKey && len(apiKeys) == 0 {
+		log.Logger.Warnw("RATE_LIMIT_BY=api_key without RATE_LIMIT_API_KEYS, every client is limited by IP")
+	}
+
+	return &handlers.RateLimit{
+		Limiter:    ratelimit.New(def, overrides).WithMaxClients(envInt("RATE_LIMIT_MAX_CLIENTS", ratelimit.DefaultMaxClients)),
+		By:         by,
+		APIKeys:    apiKeys,
+		TrustProxy: os.Getenv("RATE_LIMIT_TRUST_PROXY") == "true",
+	}, nil
+}
+
+// quotaConfig reads QUOTA_* variables; QUOTA_OVERRIDES is a list of
+// namespace=max_keys:max_bytes with 0 meaning unlimited.
+func quotaConfig() (*handlers.Quotas, error) {
+	quotas := &handlers.Quotas{
+		Default: handlers.Quota{
+			MaxKeys:  int64(envInt("QUOTA_MAX_KEYS", 0)),
+			MaxBytes: int64(envInt("QUOTA_MAX_BYTES", 0)),
+		},
+		Namespaces: make(map[string]handlers.Quota),
+	}
+	err := parseOverrides(os.Getenv("QUOTA_OVERRIDES"), func(name, keys, bytes string) error {
+		maxKeys, err := strconv.ParseInt(keys, 10, 64)
+		if err != nil {
+			return err
+		}
+		maxBytes, err := strconv.ParseInt(bytes, 10, 64)
+		if err != nil {
+			return err
+		}
+		quotas.Namespaces[name] = handlers.Quota{MaxKeys: maxKeys, MaxBytes: maxBytes}
+		return nil
+	})
+	if err != nil {
+		log.Logger.Errorw("Invalid QUOTA_OVERRIDES", "error", err)
+		return nil, err
+	}
+	return quotas, nil
+}
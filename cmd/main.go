@@ -3,18 +3,30 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 	tarantool "github.com/tarantool/go-tarantool/v2"
 	"go.uber.org/zap"
 
+	"kvManager/internal/audit"
+	"kvManager/internal/backup"
+	"kvManager/internal/cache"
 	"kvManager/internal/handlers"
+	"kvManager/internal/memcache"
+	"kvManager/internal/migrations"
 	log "kvManager/internal/pkg/log"
+	"kvManager/internal/pkg/resilience"
+	"kvManager/internal/resp"
+	"kvManager/internal/sharding"
 	"kvManager/internal/storage"
+	"kvManager/internal/trash"
+	"kvManager/internal/validation"
 )
 
 func loadEnv() error {
@@ -25,45 +37,406 @@ func loadEnv() error {
 	return nil
 }
 
-func connectToTarantool(addr string, user string) (*tarantool.Connection, error) {
-	log.Logger.Infow("Connecting to Tarantool", "address", addr, "user", user)
+func envInt(name string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// envList reads a comma separated list, dropping empty items.
+func envList(name string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
 
-	dialer := tarantool.NetDialer{
-		Address: addr,
-		User:    user,
+func migrate(conn tarantool.Doer, apply bool) error {
+	migrator := migrations.NewMigrator(conn, migrations.All)
+	if apply {
+		return migrator.Up()
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	err := migrator.Check()
+	if err != nil {
+		log.Logger.Errorw("Database schema check failed", "error", err)
+	}
+	return err
+}
+
+// prepare migrates the schema of a backend. With admin credentials the
+// migrations, the module push and the grants of the service user go
+// through a separate admin connection, since the service user has no
+// DDL or eval rights.
+func prepare(addrList string, b *backend, app credentials, admin credentials, apply bool) error {
+	if admin.user == "" {
+		return migrate(b.writer, apply)
+	}
 
-	opts := tarantool.Opts{
-		Timeout: 5 * time.Second,
+	adminBackend, err := connectBackend(addrList, admin, credentials{}, false,
+		envDuration("TARANTOOL_CHECK_TIMEOUT", time.Second))
+	if err != nil {
+		return err
 	}
+	defer adminBackend.close()
 
-	conn, err := tarantool.Connect(ctx, dialer, opts)
+	err = migrate(adminBackend.writer, apply)
+	if err != nil {
+		return err
+	}
+	err = storage.NewTarantoolRepository(adminBackend.writer).WithHistory(historyConfig()).EnsureModule()
 	if err != nil {
-		log.Logger.Errorw("Failed to connect to Tarantool", "error", err, "address", addr)
+		log.Logger.Errorw("Lua module handshake failed", "error", err)
+		return err
+	}
+	return migrations.GrantAccess(adminBackend.writer, app.user)
+}
+
+// newGuard configures the resilience layer in front of a Tarantool backend.
+func newGuard() *resilience.Guard {
+	return resilience.NewGuard(resilience.Config{
+		MaxInFlight:      envInt("TARANTOOL_MAX_IN_FLIGHT", 256),
+		AcquireTimeout:   envDuration("TARANTOOL_ACQUIRE_TIMEOUT", 100*time.Millisecond),
+		Retries:          envInt("TARANTOOL_RETRIES", 2),
+		RetryDelay:       envDuration("TARANTOOL_RETRY_DELAY", 50*time.Millisecond),
+		MaxRetryDelay:    envDuration("TARANTOOL_MAX_RETRY_DELAY", time.Second),
+		BreakerThreshold: envInt("TARANTOOL_BREAKER_THRESHOLD", 5),
+		BreakerTimeout:   envDuration("TARANTOOL_BREAKER_TIMEOUT", 5*time.Second),
+		Transient:        storage.IsTransient,
+	})
+}
+
+// historyConfig reads the revisions kept per key from HISTORY_REVISIONS
+// and HISTORY_RETENTION. History is off unless one of them is set.
+func historyConfig() storage.HistoryConfig {
+	return storage.HistoryConfig{
+		Revisions: envInt("HISTORY_REVISIONS", 0),
+		Retention: envDuration("HISTORY_RETENTION", 0),
+	}
+}
+
+// shardRepositories builds a repository per backend and pushes the Lua
+// module to each of them.
+func shardRepositories(backends []*backend) ([]sharding.Shard, error) {
+	shards := make([]sharding.Shard, 0, len(backends))
+	history := historyConfig()
+	trashRetention := envDuration("TRASH_RETENTION", 0)
+	for i, b := range backends {
+		st := storage.NewReplicatedRepository(b.writer, b.reader).WithGuard(b.guard).
+			WithHistory(history).WithTrash(trashRetention)
+		err := st.EnsureModule()
+		if err != nil {
+			log.Logger.Errorw("Lua module handshake failed", "shard", i, "error", err)
+			return nil, err
+		}
+		shards = append(shards, st)
+	}
+	return shards, nil
+}
+
+// storageFor returns the only shard as is and a sharded repository
+// routing keys by bucket otherwise.
+func storageFor(shards []sharding.Shard) (sharding.Shard, error) {
+	if len(shards) == 1 {
+		return shards[0], nil
+	}
+	return sharding.NewRepository(shards)
+}
+
+// auditConfig reads AUDIT_* variables. Records go to the audit space of
+// conn or to an append-only file.
+func auditConfig(conn tarantool.Doer) (*handlers.Audit, error) {
+	var sink audit.Sink
+	switch kind := os.Getenv("AUDIT_SINK"); kind {
+	case "":
+		return nil, nil
+	case "tarantool":
+		sink = audit.NewTarantoolSink(conn)
+	case "file":
+		file, err := audit.OpenFile(os.Getenv("AUDIT_FILE"))
+		if err != nil {
+			log.Logger.Errorw("Failed to open audit file", "error", err)
+			return nil, err
+		}
+		sink = file
+	default:
+		return nil, fmt.Errorf("unknown AUDIT_SINK %q", kind)
+	}
+
+	principalHeader := os.Getenv("AUDIT_PRINCIPAL_HEADER")
+	trustProxy := os.Getenv("AUDIT_TRUST_PROXY") == "true"
+	if principalHeader != "" && !trustProxy {
+		return nil, fmt.Errorf("AUDIT_PRINCIPAL_HEADER %q can be forged by any client, it requires AUDIT_TRUST_PROXY=true",
+			principalHeader)
+	}
+	return &handlers.Audit{
+		Logger:          audit.NewLogger(sink, os.Getenv("AUDIT_DIFF") == "true"),
+		PrincipalHeader: principalHeader,
+		TrustProxy:      trustProxy,
+	}, nil
+}
+
+// setupHandler initializes the storage and returns the handler shared by
+// the HTTP and gRPC APIs.
+func setupHandler(backends []*backend, logger *zap.SugaredLogger) (*handlers.Handler, error) {
+	logger.Info("Setting up handler and initializing storage")
+
+	shards, err := shardRepositories(backends)
+	if err != nil {
+		return nil, err
+	}
+	st, err := storageFor(shards)
+	if err != nil {
+		logger.Errorw("Failed to set up sharding", "error", err)
 		return nil, err
 	}
 
-	log.Logger.Info("Successfully connected to Tarantool")
-	return conn, nil
+	schemas := validation.NewRegistry(st)
+	err = schemas.Load()
+	if err != nil {
+		logger.Errorw("Failed to load schemas", "error", err)
+		return nil, err
+	}
+
+	var repo storage.KvRepository = st
+	var trashRepo storage.TrashRepository
+	var metadata storage.MetadataRepository = st
+	var versions storage.VersionRepository = st
+	var backupRepo storage.BackupRepository = st
+	if envDuration("TRASH_RETENTION", 0) > 0 {
+		trashRepo = st
+	}
+	if os.Getenv("CACHE_ENABLED") == "true" {
+		cached := cache.NewRepository(st, cache.Config{
+			Size:        envInt("CACHE_SIZE", 10000),
+			TTL:         envDuration("CACHE_TTL", 30*time.Second),
+			NegativeTTL: envDuration("CACHE_NEGATIVE_TTL", 5*time.Second),
+		})
+		repo = cached
+		if trashRepo != nil {
+			trashRepo = cached.Trash(trashRepo)
+		}
+		metadata = cached.Metadata(metadata)
+		versions = cached.Versions(versions)
+		backupRepo = cached.Backups(backupRepo)
+	}
+
+	healthChecks := make(map[string]handlers.HealthReporter, 2*len(backends))
+	for _, b := range backends {
+		healthChecks[b.name] = b.health
+		healthChecks[b.name+"_breaker"] = b.guard
+	}
+
+	rateLimit, err := rateLimitConfig()
+	if err != nil {
+		return nil, err
+	}
+	quotas, err := quotaConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	auditCfg, err := auditConfig(backends[0].writer)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups *backup.Manager
+	if dir := os.Getenv("BACKUP_DIR"); dir != "" {
+		snapshotters := make([]backup.Snapshotter, 0, len(shards))
+		for _, shard := range shards {
+			snapshotters = append(snapshotters, shard.(backup.Snapshotter))
+		}
+		backups = backup.NewManager(repo, backupRepo, backup.Config{Dir: dir, Snapshotters: snapshotters})
+	}
+	adminKeys := envList("ADMIN_API_KEYS")
+	if len(adminKeys) == 0 && (backups != nil || auditCfg != nil) {
+		logger.Warn("ADMIN_API_KEYS is not set, the /admin routes refuse every request")
+	}
+
+	var history storage.HistoryRepository
+	if historyConfig().Enabled() {
+		history = st
+	}
+
+	h := &handlers.Handler{
+		Repo:         repo,
+		Schemas:      schemas,
+		Indexes:      st,
+		HealthChecks: healthChecks,
+		RateLimit:    rateLimit,
+		Quotas:       quotas,
+		Usage:        st,
+		Limits: handlers.Limits{
+			MaxBodyBytes:  int64(envInt("MAX_BODY_BYTES", 0)),
+			MaxValueBytes: int64(envInt("MAX_VALUE_BYTES", 0)),
+			MaxKeyLength:  envInt("MAX_KEY_LENGTH", 0),
+			MaxDepth:      envInt("MAX_VALUE_DEPTH", 0),
+		},
+		History:   history,
+		Trash:     trashRepo,
+		Metadata:  metadata,
+		Versions:  versions,
+		Backups:   backups,
+		Audit:     auditCfg,
+		AdminKeys: adminKeys,
+	}
+	logger.Info("Handler setup completed")
+	return h, nil
 }
 
-func setupRouter(conn *tarantool.Connection, logger *zap.SugaredLogger) *mux.Router {
-	logger.Info("Setting up router and initializing storage")
+// serveGRPC starts the gRPC API in the background when GRPC_ADDRESS is set.
+func serveGRPC(h *handlers.Handler) error {
+	address := os.Getenv("GRPC_ADDRESS")
+	if address == "" {
+		return nil
+	}
+	apiKeys := envList("GRPC_API_KEYS")
 
-	st := storage.NewTarantoolRepository(conn)
-	h := handlers.Handler{Repo: st}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Logger.Errorw("Failed to listen for gRPC", "address", address, "error", err)
+		return err
+	}
+	server := handlers.NewGRPCServer(h, handlers.GRPCConfig{
+		APIKeys:         apiKeys,
+		WatchInterval:   envDuration("GRPC_WATCH_INTERVAL", handlers.DefaultWatchInterval),
+		MaxWatchEntries: envInt("GRPC_WATCH_MAX_ENTRIES", handlers.DefaultMaxWatchEntries),
+		MaxWatchStreams: envInt("GRPC_WATCH_MAX_STREAMS", handlers.DefaultMaxWatchStreams),
+	})
+	log.Logger.Infow("Starting gRPC server", "address", address, "auth", len(apiKeys) > 0)
+	go func() {
+		err := server.Serve(listener)
+		if err != nil {
+			log.Logger.Errorw("gRPC server error", "error", err)
+		}
+	}()
+	return nil
+}
+
+// serveRESP starts the Redis protocol server in the background when
+// RESP_ADDRESS is set.
+func serveRESP(h *handlers.Handler) error {
+	address := os.Getenv("RESP_ADDRESS")
+	if address == "" {
+		return nil
+	}
+	password := os.Getenv("RESP_PASSWORD")
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Logger.Errorw("Failed to listen for RESP", "address", address, "error", err)
+		return err
+	}
+	server := resp.NewServer(h.Repo, h.Writes(), resp.Config{
+		Password:      password,
+		MaxValueBytes: envInt("MAX_VALUE_BYTES", 0),
+		MaxKeyLength:  envInt("MAX_KEY_LENGTH", 0),
+	})
+	log.Logger.Infow("Starting RESP server", "address", address, "auth", password != "")
+	go func() {
+		err := server.Serve(listener)
+		if err != nil {
+			log.Logger.Errorw("RESP server error", "error", err)
+		}
+	}()
+	return nil
+}
+
+// serveMemcached starts the memcached text protocol server in the
+// background when MEMCACHED_ADDRESS is set.
+func serveMemcached(h *handlers.Handler) error {
+	address := os.Getenv("MEMCACHED_ADDRESS")
+	if address == "" {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Logger.Errorw("Failed to listen for memcached", "address", address, "error", err)
+		return err
+	}
+	username := os.Getenv("MEMCACHED_USERNAME")
+	if username == "" {
+		username = "default"
+	}
+	password := os.Getenv("MEMCACHED_PASSWORD")
+	server := memcache.NewServer(h.Repo, h.Writes(), memcache.Config{
+		MaxValueBytes: envInt("MAX_VALUE_BYTES", 0),
+		Username:      username,
+		Password:      password,
+	})
+	log.Logger.Infow("Starting memcached server", "address", address, "auth", password != "")
+	go func() {
+		err := server.Serve(listener)
+		if err != nil {
+			log.Logger.Errorw("Memcached server error", "error", err)
+		}
+	}()
+	return nil
+}
+
+// purgeTrash starts the trash purge job in the background when soft
+// delete is enabled.
+func purgeTrash(h *handlers.Handler) {
+	if h.Trash == nil {
+		return
+	}
+	interval := envDuration("TRASH_PURGE_INTERVAL", time.Minute)
+	log.Logger.Infow("Starting trash purge", "interval", interval)
+	go trash.NewPurger(h.Trash, interval).Run(context.Background())
+}
+
+// reloadSchemas starts reloading the schemas in the background so changes
+// made through other instances apply here too.
+func reloadSchemas(h *handlers.Handler) {
+	interval := envDuration("SCHEMA_RELOAD_INTERVAL", 30*time.Second)
+	if interval <= 0 {
+		return
+	}
+	log.Logger.Infow("Starting schema reload", "interval", interval)
+	go h.Schemas.Run(context.Background(), interval)
+}
 
-	r := mux.NewRouter()
-	r.HandleFunc("/kv", h.Add).Methods("POST")
-	r.HandleFunc("/kv/{id}", h.Get).Methods("GET")
-	r.HandleFunc("/kv/{id}", h.Update).Methods("PUT")
-	r.HandleFunc("/kv/{id}", h.Delete).Methods("DELETE")
+// rebalance moves keys after the shard count changed from the one given
+// on the command line to the number of configured shards.
+func rebalance(backends []*backend, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: rebalance <previous shard count>")
+	}
+	from, err := strconv.Atoi(args[0])
+	if err != nil {
+		return err
+	}
+	shards, err := shardRepositories(backends)
+	if err != nil {
+		return err
+	}
 
-	logger.Info("Router setup completed")
-	return r
+	rebalancer := sharding.Rebalancer{
+		Shards: shards,
+		From:   from,
+		To:     len(shards),
+	}
+	log.Logger.Infow("Starting rebalance", "from", from, "to", len(shards),
+		"moved_buckets", rebalancer.MovedBuckets())
+	stats, err := rebalancer.Run()
+	log.Logger.Infow("Rebalance finished", "scanned", stats.Scanned, "moved", stats.Moved,
+		"conflicts", stats.Conflicts)
+	return err
 }
 
 func main() {
@@ -80,23 +453,80 @@ func main() {
 	}
 
 	appPort := os.Getenv("APP_PORT")
-	tarantoolAddr := os.Getenv("TARANTOOL_ADDRESS")
-	tarantoolUser := os.Getenv("TARANTOOL_USER")
+	app := credentials{user: os.Getenv("TARANTOOL_USER"), password: os.Getenv("TARANTOOL_PASSWORD")}
+	admin := credentials{user: os.Getenv("TARANTOOL_ADMIN_USER"), password: os.Getenv("TARANTOOL_ADMIN_PASSWORD")}
+	autoMigrate := os.Getenv("AUTO_MIGRATE") == "true"
+	command := ""
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
 
-	log.Logger.Info("Starting app")
-	conn, err := connectToTarantool(tarantoolAddr, tarantoolUser)
-	if err != nil {
-		return
+	shardAddrs := os.Getenv("TARANTOOL_SHARDS")
+	if shardAddrs == "" {
+		shardAddrs = os.Getenv("TARANTOOL_ADDRESS")
 	}
 
+	log.Logger.Info("Starting app")
+	var backends []*backend
 	defer func() {
-		err := conn.Close()
-		if err != nil {
-			log.Logger.Errorw("Connection to tarantool is not closed", err)
+		for _, b := range backends {
+			b.close()
 		}
 	}()
+	shardList := strings.Split(shardAddrs, ";")
+	for i, addrList := range shardList {
+		b, err := connectBackend(addrList, app, admin,
+			os.Getenv("TARANTOOL_READ_REPLICAS") == "true",
+			envDuration("TARANTOOL_CHECK_TIMEOUT", time.Second))
+		if err != nil {
+			return
+		}
+		b.name = "tarantool"
+		if len(shardList) > 1 {
+			b.name = fmt.Sprintf("tarantool_shard_%d", i)
+		}
+		b.guard = newGuard()
+		resilience.Publish(b.name, b.guard)
+		backends = append(backends, b)
+	}
 
-	r := setupRouter(conn, log.Logger)
+	for i, b := range backends {
+		err = prepare(shardList[i], b, app, admin, autoMigrate || command == "migrate")
+		if err != nil {
+			return
+		}
+	}
+	switch command {
+	case "migrate":
+		log.Logger.Info("Migrations applied")
+		return
+	case "rebalance":
+		err = rebalance(backends, os.Args[2:])
+		if err != nil {
+			log.Logger.Errorw("Rebalance failed", "error", err)
+		}
+		return
+	}
+
+	h, err := setupHandler(backends, log.Logger)
+	if err != nil {
+		return
+	}
+	err = serveGRPC(h)
+	if err != nil {
+		return
+	}
+	err = serveRESP(h)
+	if err != nil {
+		return
+	}
+	err = serveMemcached(h)
+	if err != nil {
+		return
+	}
+	purgeTrash(h)
+	reloadSchemas(h)
+	r := handlers.NewRouter(h)
 
 	log.Logger.Infow("Starting HTTP server", "address", appPort)
 	err = http.ListenAndServe(appPort, r)
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	tarantool "github.com/tarantool/go-tarantool/v2"
+	"github.com/tarantool/go-tarantool/v2/pool"
+
+	"kvManager/internal/handlers"
+	log "kvManager/internal/pkg/log"
+	"kvManager/internal/pkg/resilience"
+	"kvManager/internal/storage"
+)
+
+// credentials authenticate a connection to Tarantool.
+type credentials struct {
+	user     string
+	password string
+}
+
+// backend is the set of Tarantool connectors the service works with.
+type backend struct {
+	// name identifies the backend in health checks and metrics.
+	name string
+	// writer receives writes, migrations and admin requests.
+	writer tarantool.Doer
+	// reader receives read-only requests.
+	reader tarantool.Doer
+	health handlers.HealthReporter
+	guard  *resilience.Guard
+	close  func()
+}
+
+// moduleLoader pushes the kv_api Lua module and its history
+// configuration to every instance the pool discovers, including replicas
+// and instances that were restarted, since Lua globals are not replicated.
+// Pushing the module needs eval, so it goes through a separate admin
+// connection when admin credentials are configured.
+type moduleLoader struct {
+	history storage.HistoryConfig
+	admin   credentials
+}
+
+func (loader moduleLoader) Discovered(name string, conn *tarantool.Connection, role pool.Role) error {
+	log.Logger.Infow("Tarantool instance discovered", "name", name, "role", role.String())
+	if loader.admin.user == "" {
+		return storage.NewTarantoolRepository(conn).WithHistory(loader.history).EnsureModule()
+	}
+
+	adminConn, err := connectToTarantool(name, loader.admin)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := adminConn.Close()
+		if err != nil {
+			log.Logger.Errorw("Admin connection to tarantool is not closed", "error", err)
+		}
+	}()
+	return storage.NewTarantoolRepository(adminConn).WithHistory(loader.history).EnsureModule()
+}
+
+func (moduleLoader) Deactivated(name string, conn *tarantool.Connection, role pool.Role) error {
+	log.Logger.Warnw("Tarantool instance deactivated", "name", name, "role", role.String())
+	return nil
+}
+
+func connectToTarantool(addr string, creds credentials) (*tarantool.Connection, error) {
+	log.Logger.Infow("Connecting to Tarantool", "address", addr, "user", creds.user)
+
+	dialer := tarantool.NetDialer{
+		Address:  addr,
+		User:     creds.user,
+		Password: creds.password,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := tarantool.Opts{
+		Timeout: 5 * time.Second,
+	}
+
+	conn, err := tarantool.Connect(ctx, dialer, opts)
+	if err != nil {
+		log.Logger.Errorw("Failed to connect to Tarantool", "error", err, "address", addr)
+		return nil, err
+	}
+
+	log.Logger.Info("Successfully connected to Tarantool")
+	return conn, nil
+}
+
+// connectToPool connects to every address and lets the pool discover the
+// master. The pool re-checks roles every checkTimeout, reconnects lost
+// instances and moves writes to a new master after failover.
+func connectToPool(addrs []string, creds credentials, admin credentials,
+	checkTimeout time.Duration) (*pool.ConnectionPool, error) {
+	log.Logger.Infow("Connecting to Tarantool pool", "addresses", addrs, "user", creds.user)
+
+	instances := make([]pool.Instance, 0, len(addrs))
+	for _, addr := range addrs {
+		instances = append(instances, pool.Instance{
+			Name: addr,
+			Dialer: tarantool.NetDialer{
+				Address:  addr,
+				User:     creds.user,
+				Password: creds.password,
+			},
+			Opts: tarantool.Opts{
+				Timeout: 5 * time.Second,
+			},
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	connPool, err := pool.ConnectWithOpts(ctx, instances, pool.Opts{
+		CheckTimeout:      checkTimeout,
+		ConnectionHandler: moduleLoader{history: historyConfig(), admin: admin},
+	})
+	if err != nil {
+		log.Logger.Errorw("Failed to connect to Tarantool pool", "error", err, "addresses", addrs)
+		return nil, err
+	}
+
+	log.Logger.Info("Successfully connected to Tarantool pool")
+	return connPool, nil
+}
+
+// connectBackend uses a single connection for one address and a pool for
+// a comma separated list of addresses. admin is used by the pool to push
+// the Lua module to the instances it discovers.
+func connectBackend(addrList string, creds credentials, admin credentials, readReplicas bool,
+	checkTimeout time.Duration) (*backend, error) {
+	addrs := strings.Split(addrList, ",")
+	for i := range addrs {
+		addrs[i] = strings.TrimSpace(addrs[i])
+	}
+
+	if len(addrs) == 1 {
+		conn, err := connectToTarantool(addrs[0], creds)
+		if err != nil {
+			return nil, err
+		}
+		return &backend{
+			writer: conn,
+			reader: conn,
+			health: storage.ConnectionHealth{Conn: conn},
+			close: func() {
+				err := conn.Close()
+				if err != nil {
+					log.Logger.Errorw("Connection to tarantool is not closed", "error", err)
+				}
+			},
+		}, nil
+	}
+
+	connPool, err := connectToPool(addrs, creds, admin, checkTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	readMode := pool.RW
+	if readReplicas {
+		readMode = pool.PreferRO
+	}
+	return &backend{
+		writer: pool.NewConnectorAdapter(connPool, pool.RW),
+		reader: pool.NewConnectorAdapter(connPool, readMode),
+		health: storage.PoolHealth{Pool: connPool},
+		close: func() {
+			for _, err := range connPool.Close() {
+				log.Logger.Errorw("Connection to tarantool is not closed", "error", err)
+			}
+		},
+	}, nil
+}
@@ -2,13 +2,35 @@ box.cfg {
     listen = '0.0.0.0:3301',
 }
 
-box.once('init', function()
-    box.schema.space.create('json_data', {
-        format = {
-            {name = 'key', type = 'string'},
-            {name = 'value', type = 'any'}
-        }
-    })
-    box.space.json_data:create_index('primary',
-        { type = 'TREE', parts = {'key'}})
-end)
\ No newline at end of file
+-- The service connects as TARANTOOL_USER and only gets the rights it needs
+-- on its spaces and on kv_api.*, granted by the Go service after the
+-- migrations (migrations.GrantAccess). Migrations, the Lua module push and
+-- the grants run as TARANTOOL_ADMIN_USER.
+local function required(name)
+    local value = os.getenv(name)
+    if value == nil or value == '' then
+        error(name .. ' must be set')
+    end
+    return value
+end
+
+local user = required('TARANTOOL_USER')
+local password = required('TARANTOOL_PASSWORD')
+local admin_user = required('TARANTOOL_ADMIN_USER')
+local admin_password = required('TARANTOOL_ADMIN_PASSWORD')
+
+if not box.info.ro then
+    -- Earlier versions let guest do anything.
+    box.schema.user.revoke('guest', 'read,write,execute,create,alter,drop',
+        'universe', nil, {if_exists = true})
+
+    box.schema.user.create(admin_user, {if_not_exists = true})
+    box.schema.user.passwd(admin_user, admin_password)
+    box.schema.user.grant(admin_user, 'super', nil, nil, {if_not_exists = true})
+
+    box.schema.user.create(user, {if_not_exists = true})
+    box.schema.user.passwd(user, password)
+end
+
+-- Spaces and indexes are created by the Go service migrations
+-- (internal/migrations), see the `migrate` subcommand.
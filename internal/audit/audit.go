@@ -0,0 +1,133 @@
+// Package audit records who changed which key and when.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"kvManager/internal/pkg/log"
+)
+
+// DefaultQueryLimit is used when a Query does not set Limit.
+const DefaultQueryLimit = 100
+
+// Operation is the kind of an audited mutation.
+type Operation string
+
+const (
+	OpAdd    Operation = "add"
+	OpUpdate Operation = "update"
+	OpDelete Operation = "delete"
+)
+
+// Record is one audited mutation. The hashes are the SHA-256 of the JSON
+// encoding of the value before and after the change and are empty when the
+// key did not exist or was deleted. Before and After hold the values
+// themselves when the Logger keeps diffs.
+type Record struct {
+	ID         uint64          `json:"id"`
+	Time       time.Time       `json:"time"`
+	Principal  string          `json:"principal"`
+	RequestID  string          `json:"request_id,omitempty"`
+	ClientIP   string          `json:"client_ip,omitempty"`
+	Key        string          `json:"key"`
+	Operation  Operation       `json:"operation"`
+	BeforeHash string          `json:"before_hash,omitempty"`
+	AfterHash  string          `json:"after_hash,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+}
+
+// Query selects records in ID order. Empty fields match every record;
+// To is exclusive.
+type Query struct {
+	Key       string
+	Principal string
+	From      time.Time
+	To        time.Time
+	// After resumes a query after the last ID received.
+	After uint64
+	Limit int
+}
+
+func (query Query) limit() int {
+	if query.Limit <= 0 {
+		return DefaultQueryLimit
+	}
+	return query.Limit
+}
+
+func (query Query) matches(record *Record) bool {
+	return record.ID > query.After &&
+		(query.Key == "" || record.Key == query.Key) &&
+		(query.Principal == "" || record.Principal == query.Principal) &&
+		(query.From.IsZero() || !record.Time.Before(query.From)) &&
+		(query.To.IsZero() || record.Time.Before(query.To))
+}
+
+// Sink stores records. Append assigns the ID of the record.
+type Sink interface {
+	Append(record *Record) error
+	Query(query Query) ([]Record, error)
+}
+
+// Actor is the client a mutation is attributed to.
+type Actor struct {
+	Principal string
+	RequestID string
+	ClientIP  string
+}
+
+// Logger turns mutations into records written to a Sink.
+type Logger struct {
+	sink Sink
+	diff bool
+	now  func() time.Time
+}
+
+// NewLogger writes records to sink. With diff, records also hold the
+// values before and after each change.
+func NewLogger(sink Sink, diff bool) *Logger {
+	return &Logger{sink: sink, diff: diff, now: time.Now}
+}
+
+// Log records a mutation of key. before and after are the JSON encoded
+// values, nil when the key did not exist before or after the change.
+func (l *Logger) Log(actor Actor, op Operation, key string, before []byte, after []byte) error {
+	record := &Record{
+		Time:       l.now().UTC(),
+		Principal:  actor.Principal,
+		RequestID:  actor.RequestID,
+		ClientIP:   actor.ClientIP,
+		Key:        key,
+		Operation:  op,
+		BeforeHash: hash(before),
+		AfterHash:  hash(after),
+	}
+	if l.diff {
+		record.Before, record.After = before, after
+	}
+
+	err := l.sink.Append(record)
+	if err != nil {
+		log.Logger.Errorw("Failed to write audit record", "key", key, "operation", op,
+			"principal", actor.Principal, "request_id", actor.RequestID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// Query returns the records matching query.
+func (l *Logger) Query(query Query) ([]Record, error) {
+	return l.sink.Query(query)
+}
+
+func hash(value []byte) string {
+	if value == nil {
+		return ""
+	}
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
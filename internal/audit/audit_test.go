@@ -0,0 +1,134 @@
+package audit_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kvManager/internal/audit"
+	"kvManager/internal/pkg/log"
+)
+
+func TestFileSink(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := audit.OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	logger := audit.NewLogger(sink, false)
+
+	start := time.Now().UTC()
+	changes := []struct {
+		principal string
+		op        audit.Operation
+		key       string
+		before    []byte
+		after     []byte
+	}{
+		{"ann", audit.OpAdd, "user:1", nil, []byte(`{"a":1}`)},
+		{"bob", audit.OpUpdate, "user:1", []byte(`{"a":1}`), []byte(`{"a":2}`)},
+		{"ann", audit.OpAdd, "user:2", nil, []byte(`2`)},
+	}
+	for _, change := range changes {
+		err = logger.Log(audit.Actor{Principal: change.principal, RequestID: "req", ClientIP: "10.0.0.1"},
+			change.op, change.key, change.before, change.after)
+		if err != nil {
+			t.Fatalf("Log: %v", err)
+		}
+	}
+	err = sink.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	sink, err = audit.OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer sink.Close()
+	logger = audit.NewLogger(sink, true)
+	err = logger.Log(audit.Actor{Principal: "bob"}, audit.OpDelete, "user:2", []byte(`2`), nil)
+	if err != nil {
+		t.Fatalf("Log: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	_, err = file.WriteString(`{"id":5,"key":"user:`)
+	file.Close()
+	if err != nil {
+		t.Fatalf("WriteString: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		query    audit.Query
+		expected []uint64
+	}{
+		{name: "all", query: audit.Query{}, expected: []uint64{1, 2, 3, 4}},
+		{name: "key", query: audit.Query{Key: "user:1"}, expected: []uint64{1, 2}},
+		{name: "principal", query: audit.Query{Principal: "bob"}, expected: []uint64{2, 4}},
+		{name: "key and principal", query: audit.Query{Key: "user:2", Principal: "bob"}, expected: []uint64{4}},
+		{name: "after and limit", query: audit.Query{After: 1, Limit: 2}, expected: []uint64{2, 3}},
+		{name: "from", query: audit.Query{From: start.Add(-time.Minute)}, expected: []uint64{1, 2, 3, 4}},
+		{name: "to", query: audit.Query{To: start.Add(-time.Minute)}, expected: []uint64{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			records, err := sink.Query(tc.query)
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			ids := make([]uint64, 0, len(records))
+			for _, record := range records {
+				ids = append(ids, record.ID)
+			}
+			if len(ids) != len(tc.expected) {
+				t.Fatalf("Expected %v, got %v", tc.expected, ids)
+			}
+			for i := range ids {
+				if ids[i] != tc.expected[i] {
+					t.Fatalf("Expected %v, got %v", tc.expected, ids)
+				}
+			}
+		})
+	}
+
+	records, err := sink.Query(audit.Query{Key: "user:1"})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	update := records[1]
+	if update.BeforeHash != records[0].AfterHash || update.AfterHash == update.BeforeHash ||
+		update.RequestID != "req" || update.ClientIP != "10.0.0.1" || update.Before != nil {
+		t.Errorf("Unexpected record %+v after %+v", update, records[0])
+	}
+	records, err = sink.Query(audit.Query{After: 3})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if deleted := records[0]; string(deleted.Before) != "2" || deleted.After != nil || deleted.AfterHash != "" {
+		t.Errorf("Expected a diff of the delete, got %+v", deleted)
+	}
+
+	reopened, err := audit.OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer reopened.Close()
+	err = audit.NewLogger(reopened, false).Log(audit.Actor{Principal: "ann"}, audit.OpAdd, "user:3", nil, []byte(`3`))
+	if err != nil {
+		t.Fatalf("Log: %v", err)
+	}
+	records, err = reopened.Query(audit.Query{Key: "user:3"})
+	if err != nil || len(records) != 1 || records[0].ID != 6 {
+		t.Errorf("Expected record 6 after the torn line, got %+v, %v", records, err)
+	}
+}
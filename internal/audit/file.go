@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"kvManager/internal/pkg/log"
+)
+
+// FileSink appends records to a file as JSON lines. IDs are line numbers,
+// so the file must only ever be appended to. Queries read the whole file.
+type FileSink struct {
+	path   string
+	mu     sync.Mutex
+	file   *os.File
+	nextID uint64
+}
+
+// OpenFile opens or creates the audit file at path. A last line cut short
+// by a crash is terminated so that new records start on their own line.
+func OpenFile(path string) (*FileSink, error) {
+	lines, torn, err := countLines(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if torn {
+		log.Logger.Warnw("Terminating torn audit record", "path", path, "line", lines+1)
+		_, err = file.Write([]byte("\n"))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		lines++
+	}
+	return &FileSink{path: path, file: file, nextID: lines + 1}, nil
+}
+
+// countLines returns the number of complete lines in path and whether a
+// line without its newline follows them.
+func countLines(path string) (uint64, bool, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	defer file.Close()
+
+	var lines uint64
+	reader := bufio.NewReader(file)
+	partial := false
+	for {
+		data, err := reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			partial = true
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return lines, partial || len(data) > 0, nil
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		lines++
+		partial = false
+	}
+}
+
+func (sink *FileSink) Append(record *Record) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	record.ID = sink.nextID
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = sink.file.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+	sink.nextID++
+	return nil
+}
+
+func (sink *FileSink) Query(query Query) ([]Record, error) {
+	file, err := os.Open(sink.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := make([]Record, 0)
+	reader := bufio.NewReader(file)
+	for line := 1; len(records) < query.limit(); line++ {
+		data, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// A line without its newline is still being appended.
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var record Record
+		err = json.Unmarshal(data, &record)
+		if err != nil {
+			log.Logger.Warnw("Skipping unreadable audit record", "path", sink.path,
+				"line", line, "error", err)
+			continue
+		}
+		if query.matches(&record) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (sink *FileSink) Close() error {
+	return sink.file.Close()
+}
@@ -0,0 +1,200 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/tarantool/go-tarantool/v2"
+
+	"kvManager/internal/storage"
+)
+
+// Fields of an audit_log tuple.
+const (
+	fieldID = iota
+	fieldTime
+	fieldPrincipal
+	fieldRequestID
+	fieldClientIP
+	fieldKey
+	fieldOperation
+	fieldBeforeHash
+	fieldAfterHash
+	fieldBefore
+	fieldAfter
+	fieldCount
+)
+
+// TarantoolSink stores records in storage.AuditSpace, which numbers them
+// with a sequence. Queries by key or principal use the matching index;
+// time ranges are filtered while reading.
+type TarantoolSink struct {
+	conn tarantool.Doer
+}
+
+func NewTarantoolSink(conn tarantool.Doer) *TarantoolSink {
+	return &TarantoolSink{conn: conn}
+}
+
+func (sink *TarantoolSink) Append(record *Record) error {
+	tuple := []any{
+		nil,
+		float64(record.Time.UnixNano()) / float64(time.Second),
+		record.Principal,
+		record.RequestID,
+		record.ClientIP,
+		record.Key,
+		string(record.Operation),
+		record.BeforeHash,
+		record.AfterHash,
+		rawString(record.Before),
+		rawString(record.After),
+	}
+	data, err := sink.conn.Do(tarantool.NewInsertRequest(storage.AuditSpace).Tuple(tuple)).Get()
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("audit insert returned no tuple")
+	}
+	inserted, ok := data[0].([]any)
+	if !ok || len(inserted) == 0 {
+		return fmt.Errorf("unexpected audit tuple: %v", data[0])
+	}
+	id, ok := toUint(inserted[fieldID])
+	if !ok {
+		return fmt.Errorf("unexpected audit id: %v", inserted[fieldID])
+	}
+	record.ID = id
+	return nil
+}
+
+func rawString(raw json.RawMessage) any {
+	if raw == nil {
+		return nil
+	}
+	return string(raw)
+}
+
+func (sink *TarantoolSink) Query(query Query) ([]Record, error) {
+	// Secondary indexes are scanned from (value, After) until field
+	// holds another value.
+	index, key, field, value := storage.PrimaryIndex, []any{query.After}, -1, ""
+	switch {
+	case query.Key != "":
+		index, field, value = storage.KeyIndex, fieldKey, query.Key
+	case query.Principal != "":
+		index, field, value = storage.PrincipalIndex, fieldPrincipal, query.Principal
+	}
+	if field >= 0 {
+		key = []any{value, query.After}
+	}
+
+	limit := uint32(query.limit())
+	records := make([]Record, 0)
+	for {
+		req := tarantool.NewSelectRequest(storage.AuditSpace).Index(index).
+			Iterator(tarantool.IterGt).Key(key).Limit(limit)
+		data, err := sink.conn.Do(req).Get()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range data {
+			record, err := tupleRecord(item)
+			if err != nil {
+				return nil, err
+			}
+			if field >= 0 {
+				if item.([]any)[field] != value {
+					return records, nil
+				}
+				key = []any{value, record.ID}
+			} else {
+				key = []any{record.ID}
+			}
+			if query.matches(&record) {
+				records = append(records, record)
+				if len(records) == query.limit() {
+					return records, nil
+				}
+			}
+		}
+		if uint32(len(data)) < limit {
+			return records, nil
+		}
+	}
+}
+
+func tupleRecord(item any) (Record, error) {
+	tuple, ok := item.([]any)
+	if !ok || len(tuple) < fieldCount {
+		return Record{}, fmt.Errorf("unexpected audit tuple: %v", item)
+	}
+	id, ok := toUint(tuple[fieldID])
+	if !ok {
+		return Record{}, fmt.Errorf("unexpected audit id: %v", tuple[fieldID])
+	}
+	seconds, ok := toFloat(tuple[fieldTime])
+	if !ok {
+		return Record{}, fmt.Errorf("unexpected audit time: %v", tuple[fieldTime])
+	}
+
+	record := Record{
+		ID:   id,
+		Time: time.Unix(0, int64(seconds*float64(time.Second))).UTC(),
+	}
+	record.Principal, _ = tuple[fieldPrincipal].(string)
+	record.RequestID, _ = tuple[fieldRequestID].(string)
+	record.ClientIP, _ = tuple[fieldClientIP].(string)
+	record.Key, _ = tuple[fieldKey].(string)
+	operation, _ := tuple[fieldOperation].(string)
+	record.Operation = Operation(operation)
+	record.BeforeHash, _ = tuple[fieldBeforeHash].(string)
+	record.AfterHash, _ = tuple[fieldAfterHash].(string)
+	if before, ok := tuple[fieldBefore].(string); ok {
+		record.Before = json.RawMessage(before)
+	}
+	if after, ok := tuple[fieldAfter].(string); ok {
+		record.After = json.RawMessage(after)
+	}
+	return record, nil
+}
+
+func toUint(v any) (uint64, bool) {
+	switch n := v.(type) {
+	case uint64:
+		return n, true
+	case uint32:
+		return uint64(n), true
+	case uint16:
+		return uint64(n), true
+	case uint8:
+		return uint64(n), true
+	case int64:
+		return uint64(n), n >= 0
+	case int32:
+		return uint64(n), n >= 0
+	case int16:
+		return uint64(n), n >= 0
+	case int8:
+		return uint64(n), n >= 0
+	case int:
+		return uint64(n), n >= 0
+	}
+	return 0, false
+}
+
+func toFloat(v any) (float64, bool) {
+	if n, ok := toUint(v); ok {
+		return float64(n), true
+	}
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,517 @@
+// Package backup writes the stored entries to compressed archives and
+// restores them.
+//
+// A backup is a directory named after its ID holding data.ndjson.gz, one
+// object per line in key order with the key, the value, the TTL deadline
+// and the metadata of an entry, and manifest.json, which records the
+// number of entries and the SHA-256 of the archive. Before the export each
+// Tarantool instance writes a checkpoint with box.snapshot(); the manifest
+// names the .snap files. The archive is read from a copy of the entries
+// made in one transaction per shard, so it holds them as they were at that
+// point in time.
+//
+// A restore stages the entries next to the data and moves them in one
+// transaction per shard, so a restore that fails leaves the storage empty
+// and can be run again.
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+// Format identifies the layout of the archive.
+const Format = "ndjson+gzip/2"
+
+// formatV1 is the layout of archives written before the metadata was kept
+// in them. They are still restored, without metadata.
+const formatV1 = "ndjson+gzip/1"
+
+const (
+	dataFile     = "data.ndjson.gz"
+	manifestFile = "manifest.json"
+	idLayout     = "20060102T150405.000Z"
+)
+
+// exportPageSize is the number of entries read per scan.
+const exportPageSize uint32 = 1000
+
+var (
+	ErrNotFound         = errors.New("backup not found")
+	ErrInProgress       = errors.New("another backup or restore is running")
+	ErrNotEmpty         = storage.ErrNotEmpty
+	ErrChecksumMismatch = errors.New("backup checksum mismatch")
+)
+
+// Snapshotter makes a storage instance write a consistent checkpoint of
+// its data and returns the name of the checkpoint.
+type Snapshotter interface {
+	Snapshot() (string, error)
+}
+
+// Manifest describes a backup.
+type Manifest struct {
+	ID        string    `json:"id"`
+	Format    string    `json:"format"`
+	CreatedAt time.Time `json:"created_at"`
+	Snapshots []string  `json:"snapshots,omitempty"`
+	Entries   int64     `json:"entries"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+}
+
+// RestoreResult counts the entries written by Restore. Entries whose TTL
+// passed since the backup are not restored.
+type RestoreResult struct {
+	ID       string `json:"id"`
+	Restored int64  `json:"restored"`
+	Expired  int64  `json:"expired"`
+}
+
+// entry is one line of the archive.
+type entry struct {
+	Key       string            `json:"key"`
+	Value     json.RawMessage   `json:"value"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+	CreatedAt *time.Time        `json:"created_at,omitempty"`
+	UpdatedAt *time.Time        `json:"updated_at,omitempty"`
+	Writer    string            `json:"writer,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Version   uint64            `json:"version,omitempty"`
+}
+
+// Config configures a Manager.
+type Config struct {
+	// Dir holds one directory per backup.
+	Dir string
+	// Snapshotters are asked for a checkpoint before every backup, one per
+	// shard. Without any, backups only hold the archive.
+	Snapshotters []Snapshotter
+}
+
+// Manager creates, lists and restores backups of repo through backups,
+// its BackupRepository. It runs one backup or restore at a time.
+type Manager struct {
+	repo    storage.KvRepository
+	backups storage.BackupRepository
+	cfg     Config
+	mu      sync.Mutex
+	now     func() time.Time
+}
+
+func NewManager(repo storage.KvRepository, backups storage.BackupRepository, cfg Config) *Manager {
+	return &Manager{repo: repo, backups: backups, cfg: cfg, now: time.Now}
+}
+
+// Create snapshots the storage, copies every entry to the backup space and
+// exports the copy to a new backup. The backup only appears in List once
+// it is complete.
+func (m *Manager) Create() (Manifest, error) {
+	if !m.mu.TryLock() {
+		return Manifest{}, ErrInProgress
+	}
+	defer m.mu.Unlock()
+
+	manifest := Manifest{Format: Format, CreatedAt: m.now().UTC()}
+	manifest.ID = manifest.CreatedAt.Format(idLayout)
+	log.Logger.Infow("Backup started", "id", manifest.ID)
+
+	for _, snapshotter := range m.cfg.Snapshotters {
+		name, err := snapshotter.Snapshot()
+		if err != nil {
+			log.Logger.Errorw("Snapshot failed", "id", manifest.ID, "error", err)
+			return Manifest{}, err
+		}
+		manifest.Snapshots = append(manifest.Snapshots, name)
+	}
+
+	err := os.MkdirAll(m.cfg.Dir, 0o755)
+	if err != nil {
+		return Manifest{}, err
+	}
+	frozen, err := m.backups.FreezeBackup()
+	if err != nil {
+		log.Logger.Errorw("Backup freeze failed", "id", manifest.ID, "error", err)
+		return Manifest{}, err
+	}
+	defer m.clear(manifest.ID)
+	log.Logger.Infow("Backup frozen", "id", manifest.ID, "entries", frozen)
+	tmpDir, err := os.MkdirTemp(m.cfg.Dir, ".tmp-"+manifest.ID+"-")
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	err = m.export(filepath.Join(tmpDir, dataFile), &manifest)
+	if err != nil {
+		log.Logger.Errorw("Backup export failed", "id", manifest.ID, "error", err)
+		return Manifest{}, err
+	}
+	err = writeManifest(filepath.Join(tmpDir, manifestFile), manifest)
+	if err != nil {
+		return Manifest{}, err
+	}
+	err = os.Rename(tmpDir, filepath.Join(m.cfg.Dir, manifest.ID))
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	log.Logger.Infow("Backup finished", "id", manifest.ID, "entries", manifest.Entries,
+		"size", manifest.Size, "snapshots", manifest.Snapshots)
+	return manifest, nil
+}
+
+// export writes the archive to path and fills the counters and checksum
+// of manifest.
+func (m *Manager) export(path string, manifest *Manifest) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(file, hash)}
+	buffered := bufio.NewWriter(counter)
+	zw := gzip.NewWriter(buffered)
+	encoder := json.NewEncoder(zw)
+
+	query := storage.ScanQuery{Limit: exportPageSize}
+	for {
+		tuples, err := m.backups.ScanBackup(query)
+		if err != nil {
+			return err
+		}
+		for _, data := range tuples {
+			line, err := tupleEntry(data)
+			if err != nil {
+				return err
+			}
+			err = encoder.Encode(line)
+			if err != nil {
+				return err
+			}
+			manifest.Entries++
+			query.After = line.Key
+		}
+		if uint32(len(tuples)) < exportPageSize {
+			break
+		}
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return err
+	}
+	err = buffered.Flush()
+	if err != nil {
+		return err
+	}
+	err = file.Sync()
+	if err != nil {
+		return err
+	}
+	manifest.Size = counter.n
+	manifest.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
+
+func tupleEntry(data any) (entry, error) {
+	tuple, ok := data.([]any)
+	if !ok || len(tuple) < 2 {
+		return entry{}, fmt.Errorf("unexpected tuple: %v", data)
+	}
+	key, _ := tuple[0].(string)
+	value, err := storage.JSONValue(tuple[1])
+	if err != nil {
+		return entry{}, fmt.Errorf("key %q: %w", key, err)
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return entry{}, fmt.Errorf("key %q: %w", key, err)
+	}
+
+	meta := storage.TupleMetadata(tuple)
+	line := entry{
+		Key:       key,
+		Value:     raw,
+		ExpiresAt: timeRef(meta.ExpiresAt),
+		CreatedAt: timeRef(meta.CreatedAt),
+		UpdatedAt: timeRef(meta.UpdatedAt),
+		Writer:    meta.Writer,
+		Labels:    meta.Labels,
+		Version:   storage.TupleVersion(tuple),
+	}
+	return line, nil
+}
+
+// timeRef returns nil for the zero time, which the metadata uses for a
+// missing timestamp.
+func timeRef(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+// entryTuple lays out line with its decoded value like a json_data tuple.
+// The size is left for the storage to fill in.
+func entryTuple(line entry, value any) []any {
+	var writer, labels, version any
+	if line.Writer != "" {
+		writer = line.Writer
+	}
+	if line.Labels != nil {
+		tupleLabels := make(map[string]any, len(line.Labels))
+		for name, label := range line.Labels {
+			tupleLabels[name] = label
+		}
+		labels = tupleLabels
+	}
+	if line.Version != 0 {
+		version = line.Version
+	}
+	return []any{line.Key, value, seconds(line.ExpiresAt), seconds(line.CreatedAt),
+		seconds(line.UpdatedAt), nil, writer, labels, version}
+}
+
+// seconds converts t to the Unix seconds stored in tuples, nil to nil.
+func seconds(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// clear empties the backup space after a backup or restore of id.
+func (m *Manager) clear(id string) {
+	err := m.backups.ClearBackup()
+	if err != nil {
+		log.Logger.Warnw("Failed to clear backup space", "id", id, "error", err)
+	}
+}
+
+func writeManifest(path string, manifest Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// List returns the complete backups, oldest first.
+func (m *Manager) List() ([]Manifest, error) {
+	dirs, err := os.ReadDir(m.cfg.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Manifest{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := make([]Manifest, 0, len(dirs))
+	for _, dir := range dirs {
+		if !dir.IsDir() || strings.HasPrefix(dir.Name(), ".") {
+			continue
+		}
+		manifest, err := m.Get(dir.Name())
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, manifest)
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].ID < manifests[j].ID })
+	return manifests, nil
+}
+
+// Get returns the manifest of the backup id.
+func (m *Manager) Get(id string) (Manifest, error) {
+	if !validID(id) {
+		return Manifest{}, ErrNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(m.cfg.Dir, id, manifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return Manifest{}, ErrNotFound
+	}
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	var manifest Manifest
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("backup %s: manifest: %w", id, err)
+	}
+	return manifest, nil
+}
+
+// validID rejects names that would leave the backup directory.
+func validID(id string) bool {
+	return id != "" && !strings.HasPrefix(id, ".") && !strings.ContainsAny(id, `/\`)
+}
+
+// Restore verifies the checksum of the backup id, stages its entries and
+// moves them with their TTL and metadata into the storage, which must be
+// empty. Nothing is written to the storage when a restore fails.
+func (m *Manager) Restore(id string) (RestoreResult, error) {
+	if !m.mu.TryLock() {
+		return RestoreResult{}, ErrInProgress
+	}
+	defer m.mu.Unlock()
+
+	manifest, err := m.Get(id)
+	if err != nil {
+		return RestoreResult{}, err
+	}
+	if manifest.Format != Format && manifest.Format != formatV1 {
+		return RestoreResult{}, fmt.Errorf("backup %s: unsupported format %q", id, manifest.Format)
+	}
+	path := filepath.Join(m.cfg.Dir, id, dataFile)
+	err = verify(path, manifest.SHA256)
+	if err != nil {
+		return RestoreResult{}, err
+	}
+
+	tuples, err := m.repo.ScanValues(storage.ScanQuery{Limit: 1})
+	if err != nil {
+		return RestoreResult{}, err
+	}
+	if len(tuples) > 0 {
+		return RestoreResult{}, ErrNotEmpty
+	}
+
+	log.Logger.Infow("Restore started", "id", id, "entries", manifest.Entries)
+	defer m.clear(id)
+	result, err := m.restore(path)
+	result.ID = id
+	if err != nil {
+		log.Logger.Errorw("Restore failed", "id", id, "restored", result.Restored, "error", err)
+		return result, err
+	}
+	log.Logger.Infow("Restore finished", "id", id, "restored", result.Restored,
+		"expired", result.Expired)
+	return result, nil
+}
+
+func verify(path string, expected string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, expected, actual)
+	}
+	return nil
+}
+
+// restore stages the entries of the archive at path that did not expire
+// and commits them.
+func (m *Manager) restore(path string) (RestoreResult, error) {
+	var result RestoreResult
+	err := m.backups.ClearBackup()
+	if err != nil {
+		return result, err
+	}
+	staged, err := m.stage(path, &result)
+	if err != nil {
+		return result, err
+	}
+	result.Restored, err = m.backups.CommitBackup()
+	if err != nil {
+		return result, err
+	}
+	result.Expired += staged - result.Restored
+	return result, nil
+}
+
+// stage writes the entries of the archive at path to the backup space in
+// batches and returns their number. Expired entries are counted in result.
+func (m *Manager) stage(path string, result *RestoreResult) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return 0, err
+	}
+	defer zr.Close()
+
+	var staged int64
+	batch := make([]any, 0, exportPageSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := m.backups.StageBackup(batch)
+		staged += int64(len(batch))
+		batch = batch[:0]
+		return err
+	}
+
+	decoder := json.NewDecoder(zr)
+	for {
+		var line entry
+		err = decoder.Decode(&line)
+		if errors.Is(err, io.EOF) {
+			return staged, flush()
+		}
+		if err != nil {
+			return staged, err
+		}
+
+		if line.ExpiresAt != nil && !line.ExpiresAt.After(m.now()) {
+			result.Expired++
+			continue
+		}
+		value, err := storage.DecodeJSON(line.Value)
+		if err != nil {
+			return staged, fmt.Errorf("key %q: %w", line.Key, err)
+		}
+		batch = append(batch, entryTuple(line, value))
+		if uint32(len(batch)) == exportPageSize {
+			err = flush()
+			if err != nil {
+				return staged, err
+			}
+		}
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
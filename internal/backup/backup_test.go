@@ -0,0 +1,268 @@
+package backup_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tarantool/go-tarantool/v2/decimal"
+
+	"kvManager/internal/backup"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+type snapshotter struct {
+	name string
+	err  error
+}
+
+func (s snapshotter) Snapshot() (string, error) { return s.name, s.err }
+
+func setup(t *testing.T) *storage.MemoryRepository {
+	t.Helper()
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	mem := storage.NewMemoryRepository()
+	for i := 0; i < 1500; i++ {
+		err = mem.AddValue(fmt.Sprintf("user:%04d", i), map[string]any{"n": int64(i)})
+		if err != nil {
+			t.Fatalf("AddValue: %v", err)
+		}
+	}
+	price, err := decimal.MakeDecimalFromString("12.345")
+	if err != nil {
+		t.Fatalf("MakeDecimalFromString: %v", err)
+	}
+	err = mem.AddValue("price", price)
+	if err != nil {
+		t.Fatalf("AddValue: %v", err)
+	}
+	err = mem.AddValue("session", "s")
+	if err != nil {
+		t.Fatalf("AddValue: %v", err)
+	}
+	err = mem.ExpireValue("session", time.Hour)
+	if err != nil {
+		t.Fatalf("ExpireValue: %v", err)
+	}
+	err = mem.Annotate("user:0000", "ann", map[string]string{"team": "billing"})
+	if err != nil {
+		t.Fatalf("Annotate: %v", err)
+	}
+	return mem
+}
+
+// writingRepository writes key to the storage while the backup space is
+// scanned for the first time.
+type writingRepository struct {
+	*storage.MemoryRepository
+	key     string
+	written bool
+}
+
+func (repo *writingRepository) ScanBackup(query storage.ScanQuery) ([]any, error) {
+	if !repo.written {
+		repo.written = true
+		err := repo.AddValue(repo.key, "late")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return repo.MemoryRepository.ScanBackup(query)
+}
+
+// failingRepository fails to stage after the first batch.
+type failingRepository struct {
+	*storage.MemoryRepository
+	batches int
+}
+
+func (repo *failingRepository) StageBackup(tuples []any) error {
+	repo.batches++
+	if repo.batches > 1 {
+		return errors.New("connection lost")
+	}
+	return repo.MemoryRepository.StageBackup(tuples)
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	source := setup(t)
+	dir := t.TempDir()
+	manager := backup.NewManager(source, source, backup.Config{
+		Dir:          dir,
+		Snapshotters: []backup.Snapshotter{snapshotter{name: "00000000000000000042.snap"}},
+	})
+
+	manifest, err := manager.Create()
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if manifest.Entries != 1502 || manifest.Format != backup.Format || manifest.SHA256 == "" ||
+		!reflect.DeepEqual(manifest.Snapshots, []string{"00000000000000000042.snap"}) {
+		t.Errorf("Unexpected manifest %+v", manifest)
+	}
+
+	manifests, err := manager.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if !reflect.DeepEqual(manifests, []backup.Manifest{manifest}) {
+		t.Errorf("Expected %+v, got %+v", manifest, manifests)
+	}
+
+	target := storage.NewMemoryRepository()
+	result, err := backup.NewManager(target, target, backup.Config{Dir: dir}).Restore(manifest.ID)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if result.Restored != 1502 {
+		t.Errorf("Expected 1502 restored entries, got %+v", result)
+	}
+
+	for _, key := range []string{"user:0000", "user:1499", "price", "session"} {
+		expected, err := source.GetValue(key)
+		if err != nil {
+			t.Fatalf("GetValue: %v", err)
+		}
+		actual, err := target.GetValue(key)
+		if err != nil {
+			t.Fatalf("GetValue %s: %v", key, err)
+		}
+		if fmt.Sprint(actual[0].([]any)[1]) != fmt.Sprint(expected[0].([]any)[1]) {
+			t.Errorf("Key %s: expected %v, got %v", key, expected, actual)
+		}
+	}
+	price, _ := target.GetValue("price")
+	if _, ok := price[0].([]any)[1].(decimal.Decimal); !ok {
+		t.Errorf("Expected a decimal, got %T", price[0].([]any)[1])
+	}
+	session, _ := target.GetValue("session")
+	expiresAt, ok := storage.TupleExpiry(session[0].([]any))
+	if ttl := time.Until(expiresAt); !ok || ttl < 59*time.Minute || ttl > time.Hour {
+		t.Errorf("Expected the TTL to be restored, got %v", ttl)
+	}
+
+	expected, _ := source.GetValue("user:0000")
+	actual, _ := target.GetValue("user:0000")
+	expectedMeta, actualMeta := storage.TupleMetadata(expected[0].([]any)), storage.TupleMetadata(actual[0].([]any))
+	if actualMeta.Writer != "ann" || !reflect.DeepEqual(actualMeta.Labels, map[string]string{"team": "billing"}) ||
+		!actualMeta.CreatedAt.Equal(expectedMeta.CreatedAt) || !actualMeta.UpdatedAt.Equal(expectedMeta.UpdatedAt) ||
+		actualMeta.Size != expectedMeta.Size {
+		t.Errorf("Expected metadata %+v, got %+v", expectedMeta, actualMeta)
+	}
+	if storage.TupleVersion(actual[0].([]any)) != storage.TupleVersion(expected[0].([]any)) {
+		t.Errorf("Expected version %d, got %d", storage.TupleVersion(expected[0].([]any)),
+			storage.TupleVersion(actual[0].([]any)))
+	}
+}
+
+func TestBackupConsistentExport(t *testing.T) {
+	source := &writingRepository{MemoryRepository: setup(t), key: "user:late"}
+	dir := t.TempDir()
+	manifest, err := backup.NewManager(source, source, backup.Config{Dir: dir}).Create()
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !source.written || manifest.Entries != 1502 {
+		t.Errorf("Expected the write made during the export to be left out, got %d entries", manifest.Entries)
+	}
+
+	tuples, err := source.ScanBackup(storage.ScanQuery{})
+	if err != nil || len(tuples) != 0 {
+		t.Errorf("Expected the backup space to be cleared, got %d tuples, %v", len(tuples), err)
+	}
+}
+
+func TestBackupRestoreRetry(t *testing.T) {
+	source := setup(t)
+	dir := t.TempDir()
+	manifest, err := backup.NewManager(source, source, backup.Config{Dir: dir}).Create()
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	target := &failingRepository{MemoryRepository: storage.NewMemoryRepository()}
+	_, err = backup.NewManager(target, target, backup.Config{Dir: dir}).Restore(manifest.ID)
+	if err == nil {
+		t.Fatalf("Expected the stage error")
+	}
+	tuples, err := target.ScanValues(storage.ScanQuery{})
+	if err != nil || len(tuples) != 0 {
+		t.Fatalf("Expected nothing restored after the failure, got %d tuples, %v", len(tuples), err)
+	}
+
+	result, err := backup.NewManager(target.MemoryRepository, target.MemoryRepository,
+		backup.Config{Dir: dir}).Restore(manifest.ID)
+	if err != nil || result.Restored != 1502 {
+		t.Errorf("Expected the retry to restore 1502 entries, got %+v, %v", result, err)
+	}
+}
+
+func TestBackupFailures(t *testing.T) {
+	source := setup(t)
+	dir := t.TempDir()
+	manager := backup.NewManager(source, source, backup.Config{Dir: dir})
+	manifest, err := manager.Create()
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	_, err = backup.NewManager(source, source, backup.Config{
+		Dir:          dir,
+		Snapshotters: []backup.Snapshotter{snapshotter{err: errors.New("snapshot is already in progress")}},
+	}).Create()
+	if err == nil {
+		t.Errorf("Expected the snapshot error")
+	}
+
+	testCases := []struct {
+		name     string
+		id       string
+		prepare  func()
+		expected error
+	}{
+		{name: "not empty", id: manifest.ID, expected: backup.ErrNotEmpty},
+		{name: "unknown", id: "20200101T000000.000Z", expected: backup.ErrNotFound},
+		{name: "outside directory", id: "..", expected: backup.ErrNotFound},
+		{name: "corrupt", id: manifest.ID, prepare: func() {
+			path := filepath.Join(dir, manifest.ID, "data.ndjson.gz")
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			data[len(data)/2] ^= 0xff
+			err = os.WriteFile(path, data, 0o644)
+			if err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+		}, expected: backup.ErrChecksumMismatch},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.prepare != nil {
+				tc.prepare()
+			}
+			target := source
+			if tc.expected != backup.ErrNotEmpty {
+				target = storage.NewMemoryRepository()
+			}
+			_, err := backup.NewManager(target, target, backup.Config{Dir: dir}).Restore(tc.id)
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+
+	manifests, err := manager.List()
+	if err != nil || len(manifests) != 1 {
+		t.Errorf("Expected only the complete backup, got %+v, %v", manifests, err)
+	}
+}
@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	key       string
+	tuples    []any
+	found     bool
+	expiresAt time.Time
+}
+
+// fill tracks the reads of a key from the backend that are in flight.
+// gen grows on every remove, so a fill that started before it does not
+// store a value read before the write that caused the remove.
+type fill struct {
+	gen     uint64
+	pending int
+}
+
+// lru is a size bounded least recently used map with per-entry expiry.
+type lru struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[string]*list.Element
+	fills map[string]*fill
+	now   func() time.Time
+}
+
+func newLRU(size int) *lru {
+	return &lru{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element, size),
+		fills: make(map[string]*fill),
+		now:   time.Now,
+	}
+}
+
+// begin registers a fill of key and returns the generation to pass to
+// set. Every begin must be followed by done.
+func (c *lru) begin(key string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, ok := c.fills[key]
+	if !ok {
+		f = &fill{}
+		c.fills[key] = f
+	}
+	f.pending++
+	return f.gen
+}
+
+// done ends a fill registered by begin.
+func (c *lru) done(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if f, ok := c.fills[key]; ok {
+		f.pending--
+		if f.pending == 0 {
+			delete(c.fills, key)
+		}
+	}
+}
+
+func (c *lru) get(key string) (*entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := elem.Value.(*entry)
+	if !c.now().Before(e.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return e, true
+}
+
+// set stores the entry read by the fill of generation gen and reports
+// whether another entry was evicted. The entry is dropped when key was
+// removed since the fill began.
+func (c *lru) set(key string, gen uint64, tuples []any, found bool, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if f, ok := c.fills[key]; !ok || f.gen != gen {
+		return false
+	}
+	e := &entry{key: key, tuples: tuples, found: found, expiresAt: c.now().Add(ttl)}
+	if elem, ok := c.items[key]; ok {
+		elem.Value = e
+		c.order.MoveToFront(elem)
+		return false
+	}
+
+	c.items[key] = c.order.PushFront(e)
+	if c.order.Len() <= c.size {
+		return false
+	}
+	oldest := c.order.Back()
+	c.order.Remove(oldest)
+	delete(c.items, oldest.Value.(*entry).key)
+	return true
+}
+
+// remove drops key and invalidates the fills of key in flight.
+func (c *lru) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if f, ok := c.fills[key]; ok {
+		f.gen++
+	}
+	if elem, ok := c.items[key]; ok {
+		c.order.Remove(elem)
+		delete(c.items, key)
+	}
+}
+
+// clear drops every key and invalidates every fill in flight.
+func (c *lru) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, f := range c.fills {
+		f.gen++
+	}
+	c.order.Init()
+	clear(c.items)
+}
+
+func (c *lru) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
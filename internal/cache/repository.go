@@ -0,0 +1,283 @@
+package cache
+
+import (
+	"errors"
+	"expvar"
+	"time"
+
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+// stats is published at /debug/vars as "kv_cache".
+var stats = expvar.NewMap("kv_cache")
+
+type Config struct {
+	// Size is the maximum number of cached keys.
+	Size int
+	// TTL bounds how long a value is served from the cache.
+	TTL time.Duration
+	// NegativeTTL is how long a missing key is remembered; zero disables
+	// negative caching.
+	NegativeTTL time.Duration
+}
+
+// Repository is a read-through cache in front of another KvRepository.
+// Writes made through it invalidate the affected keys; writes made by
+// other processes become visible after TTL unless Invalidate is called.
+// A value is never cached past its own expiry, but an expiry set by
+// another process is only seen once the cache entry ages out.
+type Repository struct {
+	storage.KvRepository
+	cfg   Config
+	cache *lru
+}
+
+var _ storage.KvRepository = (*Repository)(nil)
+
+func NewRepository(repo storage.KvRepository, cfg Config) *Repository {
+	log.Logger.Infow("Cache enabled", "size", cfg.Size, "ttl", cfg.TTL,
+		"negative_ttl", cfg.NegativeTTL)
+	return &Repository{KvRepository: repo, cfg: cfg, cache: newLRU(cfg.Size)}
+}
+
+// Invalidate drops keys from the cache, e.g. when a remote write is seen.
+func (repo *Repository) Invalidate(keys ...string) {
+	for _, key := range keys {
+		repo.cache.remove(key)
+	}
+	stats.Add("invalidations", int64(len(keys)))
+}
+
+// InvalidateAll drops every key from the cache.
+func (repo *Repository) InvalidateAll() {
+	n := repo.cache.len()
+	repo.cache.clear()
+	stats.Add("invalidations", int64(n))
+}
+
+func (repo *Repository) Len() int {
+	return repo.cache.len()
+}
+
+func (repo *Repository) GetValue(key string) ([]any, error) {
+	if e, ok := repo.cache.get(key); ok {
+		if !e.found {
+			stats.Add("negative_hits", 1)
+			return nil, storage.ErrKeyNotFound
+		}
+		stats.Add("hits", 1)
+		return e.tuples, nil
+	}
+	stats.Add("misses", 1)
+
+	gen := repo.cache.begin(key)
+	defer repo.cache.done(key)
+	data, err := repo.KvRepository.GetValue(key)
+	switch {
+	case err == nil:
+		repo.store(key, gen, data, true)
+	case errors.Is(err, storage.ErrKeyNotFound):
+		repo.store(key, gen, nil, false)
+	}
+	return data, err
+}
+
+func (repo *Repository) GetValues(keys []string) ([]any, error) {
+	result := make([]any, 0, len(keys))
+	missing := make([]string, 0, len(keys))
+	for _, key := range keys {
+		e, ok := repo.cache.get(key)
+		switch {
+		case !ok:
+			missing = append(missing, key)
+		case e.found:
+			stats.Add("hits", 1)
+			result = append(result, e.tuples[0])
+		default:
+			stats.Add("negative_hits", 1)
+		}
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+	stats.Add("misses", int64(len(missing)))
+
+	gens := make(map[string]uint64, len(missing))
+	for _, key := range missing {
+		gens[key] = repo.cache.begin(key)
+		defer repo.cache.done(key)
+	}
+	tuples, err := repo.KvRepository.GetValues(missing)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]struct{}, len(tuples))
+	for _, data := range tuples {
+		tuple, ok := data.([]any)
+		if !ok || len(tuple) == 0 {
+			continue
+		}
+		key, _ := tuple[0].(string)
+		found[key] = struct{}{}
+		if gen, ok := gens[key]; ok {
+			repo.store(key, gen, []any{tuple}, true)
+		}
+	}
+	for _, key := range missing {
+		if _, ok := found[key]; !ok {
+			repo.store(key, gens[key], nil, false)
+		}
+	}
+	return append(result, tuples...), nil
+}
+
+// store caches what a fill of generation gen read for key, for no longer
+// than the value itself lives.
+func (repo *Repository) store(key string, gen uint64, tuples []any, found bool) {
+	ttl := repo.cfg.TTL
+	if !found {
+		ttl = repo.cfg.NegativeTTL
+	} else if tuple, ok := tuples[0].([]any); ok {
+		if expiresAt, ok := storage.TupleExpiry(tuple); ok {
+			ttl = min(ttl, time.Until(expiresAt))
+		}
+	}
+	if ttl <= 0 {
+		return
+	}
+	if repo.cache.set(key, gen, tuples, found, ttl) {
+		stats.Add("evictions", 1)
+	}
+}
+
+func (repo *Repository) AddValue(key string, value any) error {
+	defer repo.Invalidate(key)
+	return repo.KvRepository.AddValue(key, value)
+}
+
+func (repo *Repository) UpdateValue(key string, value any) error {
+	defer repo.Invalidate(key)
+	return repo.KvRepository.UpdateValue(key, value)
+}
+
+func (repo *Repository) DeleteValue(key string) error {
+	defer repo.Invalidate(key)
+	return repo.KvRepository.DeleteValue(key)
+}
+
+func (repo *Repository) PutValue(key string, value any) (bool, error) {
+	defer repo.Invalidate(key)
+	return repo.KvRepository.PutValue(key, value)
+}
+
+func (repo *Repository) CompareAndSet(key string, expected any, value any) error {
+	defer repo.Invalidate(key)
+	return repo.KvRepository.CompareAndSet(key, expected, value)
+}
+
+func (repo *Repository) MergeValue(key string, patch any) ([]any, error) {
+	defer repo.Invalidate(key)
+	return repo.KvRepository.MergeValue(key, patch)
+}
+
+func (repo *Repository) ExpireValue(key string, ttl time.Duration) error {
+	defer repo.Invalidate(key)
+	return repo.KvRepository.ExpireValue(key, ttl)
+}
+
+func (repo *Repository) DeleteValues(keys []string) ([]string, error) {
+	defer repo.Invalidate(keys...)
+	return repo.KvRepository.DeleteValues(keys)
+}
+
+// trashRepository drops undeleted keys from the cache, which may still
+// remember them as missing.
+type trashRepository struct {
+	storage.TrashRepository
+	cache *Repository
+}
+
+// Trash wraps trash, the TrashRepository of the backend, so keys it
+// undeletes are invalidated.
+func (repo *Repository) Trash(trash storage.TrashRepository) storage.TrashRepository {
+	return &trashRepository{TrashRepository: trash, cache: repo}
+}
+
+func (trash *trashRepository) Undelete(key string) error {
+	defer trash.cache.Invalidate(key)
+	return trash.TrashRepository.Undelete(key)
+}
+
+// metadataRepository drops annotated keys from the cache, which holds
+// their tuples along with the metadata.
+type metadataRepository struct {
+	storage.MetadataRepository
+	cache *Repository
+}
+
+// Metadata wraps meta, the MetadataRepository of the backend, so keys it
+// annotates are invalidated.
+func (repo *Repository) Metadata(meta storage.MetadataRepository) storage.MetadataRepository {
+	return &metadataRepository{MetadataRepository: meta, cache: repo}
+}
+
+func (meta *metadataRepository) Annotate(key string, writer string, labels map[string]string) error {
+	defer meta.cache.Invalidate(key)
+	return meta.MetadataRepository.Annotate(key, writer, labels)
+}
+
+// Annotated returns the annotated view of the backend behind the cache,
+// so the keys it writes are invalidated like the ones written through it.
+func (meta *metadataRepository) Annotated(annotation storage.Annotation) storage.AnnotatedRepository {
+	view := meta.MetadataRepository.Annotated(annotation)
+	cached := &Repository{KvRepository: view, cfg: meta.cache.cfg, cache: meta.cache.cache}
+	return &annotatedRepository{Repository: cached, versions: cached.Versions(view)}
+}
+
+// annotatedRepository is a Repository over an annotated view, which also
+// writes by version.
+type annotatedRepository struct {
+	*Repository
+	versions storage.VersionRepository
+}
+
+func (repo *annotatedRepository) CompareVersionAndSet(key string, version uint64, value any) error {
+	return repo.versions.CompareVersionAndSet(key, version, value)
+}
+
+// versionRepository drops keys written by version from the cache.
+type versionRepository struct {
+	storage.VersionRepository
+	cache *Repository
+}
+
+// Versions wraps versions, the VersionRepository of the backend, so keys
+// it writes are invalidated.
+func (repo *Repository) Versions(versions storage.VersionRepository) storage.VersionRepository {
+	return &versionRepository{VersionRepository: versions, cache: repo}
+}
+
+func (versions *versionRepository) CompareVersionAndSet(key string, version uint64, value any) error {
+	defer versions.cache.Invalidate(key)
+	return versions.VersionRepository.CompareVersionAndSet(key, version, value)
+}
+
+// backupRepository drops every key from the cache once a backup is
+// committed, since the cache may remember the restored keys as missing.
+type backupRepository struct {
+	storage.BackupRepository
+	cache *Repository
+}
+
+// Backups wraps backups, the BackupRepository of the backend, so the
+// cache is emptied by the restores it commits.
+func (repo *Repository) Backups(backups storage.BackupRepository) storage.BackupRepository {
+	return &backupRepository{BackupRepository: backups, cache: repo}
+}
+
+func (backups *backupRepository) CommitBackup() (int64, error) {
+	defer backups.cache.InvalidateAll()
+	return backups.BackupRepository.CommitBackup()
+}
@@ -0,0 +1,170 @@
+package cache_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/mock/gomock"
+
+	"kvManager/internal/cache"
+	"kvManager/internal/mocks"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+func tuple(key string, value any) []any {
+	return []any{[]any{key, value}}
+}
+
+func TestCachedRepository(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Errorf("failed to initialize logger: %v", err)
+		return
+	}
+
+	cases := []struct {
+		name string
+		cfg  cache.Config
+		run  func(t *testing.T, mockRepo *mocks.MockKvRepository, repo *cache.Repository)
+	}{
+		{
+			name: "read through",
+			cfg:  cache.Config{Size: 10, TTL: time.Minute},
+			run: func(t *testing.T, mockRepo *mocks.MockKvRepository, repo *cache.Repository) {
+				mockRepo.EXPECT().GetValue("k").Return(tuple("k", "v"), nil).Times(1)
+				for i := 0; i < 3; i++ {
+					data, err := repo.GetValue("k")
+					if err != nil || len(data) != 1 {
+						t.Fatalf("Expected cached tuple, got %v, %v", data, err)
+					}
+				}
+			},
+		},
+		{
+			name: "negative caching",
+			cfg:  cache.Config{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute},
+			run: func(t *testing.T, mockRepo *mocks.MockKvRepository, repo *cache.Repository) {
+				mockRepo.EXPECT().GetValue("k").Return(nil, storage.ErrKeyNotFound).Times(1)
+				for i := 0; i < 2; i++ {
+					_, err := repo.GetValue("k")
+					if !errors.Is(err, storage.ErrKeyNotFound) {
+						t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+					}
+				}
+			},
+		},
+		{
+			name: "negative caching disabled",
+			cfg:  cache.Config{Size: 10, TTL: time.Minute},
+			run: func(t *testing.T, mockRepo *mocks.MockKvRepository, repo *cache.Repository) {
+				mockRepo.EXPECT().GetValue("k").Return(nil, storage.ErrKeyNotFound).Times(2)
+				for i := 0; i < 2; i++ {
+					_, _ = repo.GetValue("k")
+				}
+			},
+		},
+		{
+			name: "writes invalidate",
+			cfg:  cache.Config{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute},
+			run: func(t *testing.T, mockRepo *mocks.MockKvRepository, repo *cache.Repository) {
+				gomock.InOrder(
+					mockRepo.EXPECT().GetValue("k").Return(nil, storage.ErrKeyNotFound),
+					mockRepo.EXPECT().AddValue("k", "v").Return(nil),
+					mockRepo.EXPECT().GetValue("k").Return(tuple("k", "v"), nil),
+					mockRepo.EXPECT().UpdateValue("k", "v2").Return(nil),
+					mockRepo.EXPECT().GetValue("k").Return(tuple("k", "v2"), nil),
+				)
+				_, _ = repo.GetValue("k")
+				_ = repo.AddValue("k", "v")
+				_, _ = repo.GetValue("k")
+				_ = repo.UpdateValue("k", "v2")
+				data, _ := repo.GetValue("k")
+				if data[0].([]any)[1] != "v2" {
+					t.Errorf("Expected updated value, got %v", data)
+				}
+			},
+		},
+		{
+			name: "eviction",
+			cfg:  cache.Config{Size: 1, TTL: time.Minute},
+			run: func(t *testing.T, mockRepo *mocks.MockKvRepository, repo *cache.Repository) {
+				mockRepo.EXPECT().GetValue("a").Return(tuple("a", 1), nil).Times(2)
+				mockRepo.EXPECT().GetValue("b").Return(tuple("b", 2), nil).Times(1)
+				_, _ = repo.GetValue("a")
+				_, _ = repo.GetValue("b")
+				_, _ = repo.GetValue("a")
+				if repo.Len() != 1 {
+					t.Errorf("Expected 1 cached key, got %d", repo.Len())
+				}
+			},
+		},
+		{
+			name: "ttl",
+			cfg:  cache.Config{Size: 10, TTL: 10 * time.Millisecond},
+			run: func(t *testing.T, mockRepo *mocks.MockKvRepository, repo *cache.Repository) {
+				mockRepo.EXPECT().GetValue("k").Return(tuple("k", "v"), nil).Times(2)
+				_, _ = repo.GetValue("k")
+				time.Sleep(20 * time.Millisecond)
+				_, _ = repo.GetValue("k")
+			},
+		},
+		{
+			name: "ttl capped by expiry",
+			cfg:  cache.Config{Size: 10, TTL: time.Minute},
+			run: func(t *testing.T, mockRepo *mocks.MockKvRepository, repo *cache.Repository) {
+				expiresAt := float64(time.Now().Add(10*time.Millisecond).UnixNano()) / float64(time.Second)
+				mockRepo.EXPECT().GetValue("k").Return([]any{[]any{"k", "v", expiresAt}}, nil).Times(2)
+				_, _ = repo.GetValue("k")
+				time.Sleep(20 * time.Millisecond)
+				_, _ = repo.GetValue("k")
+			},
+		},
+		{
+			name: "fill invalidated by a write",
+			cfg:  cache.Config{Size: 10, TTL: time.Minute},
+			run: func(t *testing.T, mockRepo *mocks.MockKvRepository, repo *cache.Repository) {
+				gomock.InOrder(
+					mockRepo.EXPECT().GetValue("k").DoAndReturn(func(key string) ([]any, error) {
+						// A write lands after the read, before the fill.
+						repo.Invalidate(key)
+						return tuple("k", "old"), nil
+					}),
+					mockRepo.EXPECT().GetValue("k").Return(tuple("k", "new"), nil),
+				)
+				_, _ = repo.GetValue("k")
+				data, _ := repo.GetValue("k")
+				if data[0].([]any)[1] != "new" {
+					t.Errorf("Expected the new value, got %v", data)
+				}
+			},
+		},
+		{
+			name: "multi get",
+			cfg:  cache.Config{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute},
+			run: func(t *testing.T, mockRepo *mocks.MockKvRepository, repo *cache.Repository) {
+				mockRepo.EXPECT().GetValue("a").Return(tuple("a", 1), nil).Times(1)
+				mockRepo.EXPECT().GetValues([]string{"b", "c"}).
+					Return(tuple("b", 2), nil).Times(1)
+				_, _ = repo.GetValue("a")
+
+				for i := 0; i < 2; i++ {
+					data, err := repo.GetValues([]string{"a", "b", "c"})
+					if err != nil || len(data) != 2 {
+						t.Fatalf("Expected 2 tuples, got %v, %v", data, err)
+					}
+				}
+			},
+		},
+	}
+
+	for _, q := range cases {
+		t.Run(q.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockRepo := mocks.NewMockKvRepository(ctrl)
+			q.run(t, mockRepo, cache.NewRepository(mockRepo, q.cfg))
+		})
+	}
+}
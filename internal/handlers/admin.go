@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+	"kvManager/internal/validation"
+)
+
+type SchemasResponse struct {
+	Schemas map[string]json.RawMessage `json:"schemas"`
+}
+
+func (handler *Handler) PutSchema(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("Put schema request started", "method", r.Method, "path", r.URL.Path)
+	prefix, ok := pathVar(w, r, "prefix")
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if handler.checkBodyTooLarge(w, err) {
+		return
+	}
+	if err != nil {
+		log.Logger.Errorw("Failed to read request body",
+			"error", err,
+			"http_status", http.StatusInternalServerError)
+		http.Error(w, ErrReadReqBody, http.StatusInternalServerError)
+		return
+	}
+
+	err = handler.Schemas.Set(prefix, string(body))
+	var compileErr *validation.CompileError
+	if errors.As(err, &compileErr) {
+		log.Logger.Warnw("Failed to register schema", "prefix", prefix,
+			"error", err.Error(), "http_status", http.StatusBadRequest)
+		handler.writeJSON(w, http.StatusBadRequest,
+			ErrorResponse{Error: ErrInvalidSchema, Details: []string{err.Error()}})
+		return
+	}
+	if handler.checkError(w, err) {
+		return
+	}
+
+	log.Logger.Infow("Schema registered successfully", "prefix", prefix,
+		"http_status", http.StatusOK)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (handler *Handler) ListSchemas(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("List schemas request started", "method", r.Method, "path", r.URL.Path)
+
+	schemas := make(map[string]json.RawMessage)
+	for prefix, raw := range handler.Schemas.List() {
+		schemas[prefix] = json.RawMessage(raw)
+	}
+
+	handler.writeJSON(w, http.StatusOK, SchemasResponse{Schemas: schemas})
+}
+
+func (handler *Handler) DeleteSchema(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("Delete schema request started", "method", r.Method, "path", r.URL.Path)
+	prefix, ok := pathVar(w, r, "prefix")
+	if !ok {
+		return
+	}
+
+	err := handler.Schemas.Delete(prefix)
+	if errors.Is(err, validation.ErrSchemaNotFound) {
+		log.Logger.Warnw("Schema not found", "prefix", prefix,
+			"http_status", http.StatusNotFound)
+		http.Error(w, ErrSchemaNotFound, http.StatusNotFound)
+		return
+	}
+	if handler.checkError(w, err) {
+		return
+	}
+
+	log.Logger.Infow("Schema deleted successfully", "prefix", prefix,
+		"http_status", http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type IndexesResponse struct {
+	Indexes []storage.IndexDefinition `json:"indexes"`
+}
+
+func (handler *Handler) CreateIndex(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("Create index request started", "method", r.Method, "path", r.URL.Path)
+
+	var def storage.IndexDefinition
+	err := json.NewDecoder(r.Body).Decode(&def)
+	if handler.checkBodyTooLarge(w, err) {
+		return
+	}
+	if err != nil {
+		log.Logger.Warnw("Failed to unmarshal index definition",
+			"error", err, "http_status", http.StatusBadRequest)
+		http.Error(w, ErrIncorrectBody, http.StatusBadRequest)
+		return
+	}
+
+	err = handler.Indexes.CreateIndex(def)
+	if errors.Is(err, storage.ErrInvalidIndex) {
+		log.Logger.Warnw("Invalid index definition", "error", err.Error(),
+			"http_status", http.StatusBadRequest)
+		handler.writeJSON(w, http.StatusBadRequest,
+			ErrorResponse{Error: ErrInvalidIndex, Details: []string{err.Error()}})
+		return
+	}
+	if handler.checkError(w, err) {
+		return
+	}
+
+	log.Logger.Infow("Index created successfully", "name", def.Name,
+		"http_status", http.StatusCreated)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (handler *Handler) ListIndexes(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("List indexes request started", "method", r.Method, "path", r.URL.Path)
+
+	defs, err := handler.Indexes.ListIndexes()
+	if handler.checkError(w, err) {
+		return
+	}
+
+	handler.writeJSON(w, http.StatusOK, IndexesResponse{Indexes: defs})
+}
+
+func (handler *Handler) DropIndex(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("Drop index request started", "method", r.Method, "path", r.URL.Path)
+	name, ok := pathVar(w, r, "name")
+	if !ok {
+		return
+	}
+
+	err := handler.Indexes.DropIndex(name)
+	if errors.Is(err, storage.ErrIndexNotFound) {
+		log.Logger.Warnw("Index not found", "name", name,
+			"http_status", http.StatusNotFound)
+		http.Error(w, ErrIndexNotFound, http.StatusNotFound)
+		return
+	}
+	if handler.checkError(w, err) {
+		return
+	}
+
+	log.Logger.Infow("Index dropped successfully", "name", name,
+		"http_status", http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UsageResponse reports the storage used by a namespace and its quota.
+type UsageResponse struct {
+	Namespace string        `json:"namespace"`
+	Usage     storage.Usage `json:"usage"`
+	MaxKeys   int64         `json:"max_keys,omitempty"`
+	MaxBytes  int64         `json:"max_bytes,omitempty"`
+}
+
+// GetUsage answers GET /admin/usage/{namespace}. The namespace of keys
+// without ':' is available as /admin/usage/ with an empty name.
+func (handler *Handler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("Get usage request started", "method", r.Method, "path", r.URL.Path)
+	namespace, ok := pathVar(w, r, "namespace")
+	if !ok {
+		return
+	}
+
+	usage, err := handler.Usage.GetUsage(namespace)
+	if handler.checkError(w, err) {
+		return
+	}
+
+	resp := UsageResponse{Namespace: namespace, Usage: usage}
+	if handler.Quotas != nil {
+		quota := handler.Quotas.For(namespace)
+		resp.MaxKeys, resp.MaxBytes = quota.MaxKeys, quota.MaxBytes
+	}
+	handler.writeJSON(w, http.StatusOK, resp)
+}
+
+// adminOnly serves next only to requests whose X-API-Key is one of
+// AdminKeys. Without AdminKeys every request is refused, so backups and
+// the audit log are never open to anyone who can reach the port.
+func (handler *Handler) adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKey := r.Header.Get(APIKeyHeader)
+		if apiKey != "" {
+			for _, valid := range handler.AdminKeys {
+				if subtle.ConstantTimeCompare([]byte(apiKey), []byte(valid)) == 1 {
+					next(w, r)
+					return
+				}
+			}
+		}
+		log.Logger.Warnw("Admin request rejected", "method", r.Method, "path", r.URL.Path,
+			"http_status", http.StatusUnauthorized)
+		http.Error(w, ErrAdminRequired, http.StatusUnauthorized)
+	}
+}
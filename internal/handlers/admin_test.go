@@ -0,0 +1,441 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+
+	"kvManager/internal/handlers"
+	"kvManager/internal/mocks"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+	"kvManager/internal/validation"
+)
+
+const userSchema = `{
+	"type": "object",
+	"required": ["name"],
+	"properties": {
+		"name": {"type": "string"},
+		"age": {"type": "integer", "minimum": 0}
+	}
+}`
+
+func TestSchemaValidation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	err := log.SetupLogger()
+	if err != nil {
+		t.Errorf("failed to initialize logger: %v", err)
+		return
+	}
+	mockRepo := mocks.NewMockKvRepository(ctrl)
+	mockSchemas := mocks.NewMockSchemaRepository(ctrl)
+
+	mockSchemas.EXPECT().GetSchemas().Return(map[string]string{}, nil).Times(1)
+	schemas := validation.NewRegistry(mockSchemas)
+	err = schemas.Load()
+	if err != nil {
+		t.Fatalf("Failed to load schemas: %v", err)
+	}
+
+	handler := handlers.Handler{Repo: mockRepo, Schemas: schemas, AdminKeys: []string{"admin"}}
+	router := handlers.NewRouter(&handler)
+
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		apiKey         string
+		mockSetup      func()
+		expectedStatus int
+		expectedErrors int
+	}{
+		{
+			name:           "register schema without admin key",
+			method:         "PUT",
+			path:           "/admin/schemas/user:",
+			body:           userSchema,
+			apiKey:         "secret",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   "register schema",
+			method: "PUT",
+			path:   "/admin/schemas/user:",
+			apiKey: "admin",
+			body:   userSchema,
+			mockSetup: func() {
+				mockSchemas.EXPECT().PutSchema("user:", userSchema).Return(nil).Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "register schema storage failure",
+			method: "PUT",
+			path:   "/admin/schemas/order:",
+			apiKey: "admin",
+			body:   userSchema,
+			mockSetup: func() {
+				mockSchemas.EXPECT().PutSchema("order:", userSchema).Return(errors.New("space is read only")).Times(1)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "register invalid schema",
+			method:         "PUT",
+			path:           "/admin/schemas/bad:",
+			apiKey:         "admin",
+			body:           `{"type": 12}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "add valid value",
+			method: "POST",
+			path:   "/kv",
+			body:   `{"key":"user:1", "value":{"name":"Ann", "age":30}}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().AddValue("user:1", gomock.Any()).Return(nil).Times(1)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "add invalid value",
+			method:         "POST",
+			path:           "/kv",
+			body:           `{"key":"user:2", "value":{"age":-1}}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedErrors: 2,
+		},
+		{
+			name:           "update invalid value",
+			method:         "PUT",
+			path:           "/kv/user:1",
+			body:           `{"value":{"name":1}}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedErrors: 1,
+		},
+		{
+			name:   "value outside prefix is not validated",
+			method: "POST",
+			path:   "/kv",
+			body:   `{"key":"order:1", "value":42}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().AddValue("order:1", int64(42)).Return(nil).Times(1)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "list schemas",
+			method:         "GET",
+			path:           "/admin/schemas",
+			apiKey:         "admin",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "delete schema without admin key",
+			method:         "DELETE",
+			path:           "/admin/schemas/user:",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   "delete schema",
+			method: "DELETE",
+			path:   "/admin/schemas/user:",
+			apiKey: "admin",
+			mockSetup: func() {
+				mockSchemas.EXPECT().DeleteSchema("user:").Return(nil).Times(1)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:   "delete missing schema",
+			method: "DELETE",
+			path:   "/admin/schemas/user:",
+			apiKey: "admin",
+			mockSetup: func() {
+				mockSchemas.EXPECT().DeleteSchema("user:").Return(storage.ErrKeyNotFound).Times(1)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "value accepted after schema removal",
+			method: "POST",
+			path:   "/kv",
+			body:   `{"key":"user:3", "value":{"age":-1}}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().AddValue("user:3", gomock.Any()).Return(nil).Times(1)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.mockSetup != nil {
+				tc.mockSetup()
+			}
+
+			req := httptest.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			if tc.apiKey != "" {
+				req.Header.Set(handlers.APIKeyHeader, tc.apiKey)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedErrors == 0 {
+				return
+			}
+
+			var resp handlers.ErrorResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &resp)
+			if err != nil {
+				t.Fatalf("Failed to decode error response: %v", err)
+			}
+			if len(resp.Details) != tc.expectedErrors {
+				t.Errorf("Expected %d validation errors, got %v", tc.expectedErrors, resp.Details)
+			}
+		})
+	}
+}
+
+func TestIndexes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	err := log.SetupLogger()
+	if err != nil {
+		t.Errorf("failed to initialize logger: %v", err)
+		return
+	}
+	mockRepo := mocks.NewMockKvRepository(ctrl)
+	mockIndexes := mocks.NewMockIndexRepository(ctrl)
+
+	handler := handlers.Handler{Repo: mockRepo, Indexes: mockIndexes, AdminKeys: []string{"admin"}}
+	router := handlers.NewRouter(&handler)
+
+	eq := "42"
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		apiKey         string
+		mockSetup      func()
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "create index without admin key",
+			method:         "POST",
+			path:           "/admin/indexes",
+			body:           `{"name":"by_user","path":"value.user_id","type":"unsigned"}`,
+			apiKey:         "secret",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   handlers.ErrAdminRequired + "\n",
+		},
+		{
+			name:           "list indexes without admin key",
+			method:         "GET",
+			path:           "/admin/indexes",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "drop index without admin key",
+			method:         "DELETE",
+			path:           "/admin/indexes/by_user",
+			apiKey:         "secret",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   "create index",
+			method: "POST",
+			path:   "/admin/indexes",
+			apiKey: "admin",
+			body:   `{"name":"by_user","path":"value.user_id","type":"unsigned"}`,
+			mockSetup: func() {
+				mockIndexes.EXPECT().
+					CreateIndex(storage.IndexDefinition{Name: "by_user", Path: "value.user_id", Type: "unsigned"}).
+					Return(nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:   "create invalid index",
+			method: "POST",
+			path:   "/admin/indexes",
+			apiKey: "admin",
+			body:   `{"name":"by_user","path":"user_id","type":"map"}`,
+			mockSetup: func() {
+				mockIndexes.EXPECT().CreateIndex(gomock.Any()).Return(storage.ErrInvalidIndex).Times(1)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "list indexes",
+			method: "GET",
+			path:   "/admin/indexes",
+			apiKey: "admin",
+			mockSetup: func() {
+				mockIndexes.EXPECT().ListIndexes().
+					Return([]storage.IndexDefinition{{Name: "by_user", Path: "user_id", Type: "unsigned"}}, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"indexes":[{"name":"by_user","path":"user_id","type":"unsigned","unique":false}]}`,
+		},
+		{
+			name:   "drop missing index",
+			method: "DELETE",
+			path:   "/admin/indexes/none",
+			apiKey: "admin",
+			mockSetup: func() {
+				mockIndexes.EXPECT().DropIndex("none").Return(storage.ErrIndexNotFound).Times(1)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "query by eq",
+			method: "GET",
+			path:   "/kv/_query?index=by_user&eq=42",
+			mockSetup: func() {
+				mockRepo.EXPECT().
+					QueryIndex(storage.IndexQuery{Index: "by_user", Eq: &eq}).
+					Return([]any{[]any{"order:1", map[any]any{"user_id": uint64(42)}}}, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"items":[{"key":"order:1","value":{"user_id":42}}]}`,
+		},
+		{
+			name:   "query by range",
+			method: "GET",
+			path:   "/kv/_query?index=by_age&ge=18&lt=65&limit=10",
+			mockSetup: func() {
+				mockRepo.EXPECT().
+					QueryIndex(storage.IndexQuery{
+						Index: "by_age",
+						From:  &storage.Bound{Value: "18", Inclusive: true},
+						To:    &storage.Bound{Value: "65"},
+						Limit: 10,
+					}).
+					Return([]any{}, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"items":[]}`,
+		},
+		{
+			name:           "query without index",
+			method:         "GET",
+			path:           "/kv/_query?eq=1",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "query unknown index",
+			method: "GET",
+			path:   "/kv/_query?index=none&eq=1",
+			mockSetup: func() {
+				mockRepo.EXPECT().QueryIndex(gomock.Any()).Return(nil, storage.ErrIndexNotFound).Times(1)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "query with bad key",
+			method: "GET",
+			path:   "/kv/_query?index=by_user&eq=abc",
+			mockSetup: func() {
+				mockRepo.EXPECT().QueryIndex(gomock.Any()).Return(nil, storage.ErrInvalidIndexKey).Times(1)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.mockSetup != nil {
+				tc.mockSetup()
+			}
+
+			req := httptest.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			if tc.apiKey != "" {
+				req.Header.Set(handlers.APIKeyHeader, tc.apiKey)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedBody != "" && rr.Body.String() != tc.expectedBody {
+				t.Errorf("Expected body %s, got %s", tc.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestQueryDecimals(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	repo := storage.NewMemoryRepository()
+	router := handlers.NewRouter(&handlers.Handler{Repo: repo, Indexes: repo})
+	err = repo.CreateIndex(storage.IndexDefinition{Name: "by_price", Path: "price", Type: "number"})
+	if err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	values := map[string]string{
+		"item:a": `{"price":1.5}`, "item:b": `{"price":2}`, "item:c": `{"price":2.25}`, "item:d": `{"price":3.5}`,
+	}
+	for key, value := range values {
+		req := httptest.NewRequest(http.MethodPost, "/kv/"+key, bytes.NewBufferString(`{"value":`+value+`}`))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Failed to add %s: %d", value, rr.Code)
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		query         string
+		expectedItems int
+	}{
+		{name: "le", query: "le=2.25", expectedItems: 3},
+		{name: "lt", query: "lt=2.25", expectedItems: 2},
+		{name: "ge and lt", query: "ge=1.5&lt=3", expectedItems: 3},
+		{name: "gt", query: "gt=2", expectedItems: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/kv/_query?index=by_price&"+tc.query, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+			var resp struct {
+				Items []json.RawMessage `json:"items"`
+			}
+			err := json.Unmarshal(rr.Body.Bytes(), &resp)
+			if err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(resp.Items) != tc.expectedItems {
+				t.Errorf("Expected %d items, got %s", tc.expectedItems, rr.Body.String())
+			}
+		})
+	}
+}
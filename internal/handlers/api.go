@@ -3,17 +3,41 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
-	"github.com/gorilla/mux"
-
+	"kvManager/internal/audit"
+	"kvManager/internal/backup"
 	"kvManager/internal/pkg/log"
 	"kvManager/internal/storage"
+	"kvManager/internal/validation"
 )
 
 type Handler struct {
-	Repo storage.KvRepository
+	Repo    storage.KvRepository
+	Schemas *validation.Registry
+	Indexes storage.IndexRepository
+
+	HealthChecks map[string]HealthReporter
+
+	RateLimit *RateLimit
+	Quotas    *Quotas
+	Usage     storage.UsageRepository
+	Limits    Limits
+
+	History  storage.HistoryRepository
+	Trash    storage.TrashRepository
+	Metadata storage.MetadataRepository
+	Versions storage.VersionRepository
+
+	Backups *backup.Manager
+	Audit   *Audit
+	// AdminKeys are the API keys allowed to use backups and read the audit
+	// log. Those routes refuse every request when it is empty.
+	AdminKeys []string
 }
 
+// Add creates a value. The key comes from the {id} path variable when the
+// route has one (POST /kv/{id}) and from the body otherwise (POST /kv).
 func (handler *Handler) Add(w http.ResponseWriter, r *http.Request) {
 	log.Logger.Infow("Add request started", "method", r.Method, "path", r.URL.Path)
 	data, ok := handler.parseReqBody(w, r)
@@ -21,8 +45,37 @@ func (handler *Handler) Add(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	pathKey, hasKey, err := routeVar(r, "id")
+	if err != nil {
+		http.Error(w, ErrInvalidPath, http.StatusBadRequest)
+		return
+	}
+	if hasKey {
+		if data.Key != "" && data.Key != pathKey {
+			log.Logger.Warnw("Key in body does not match path", "path_key", pathKey,
+				"body_key", data.Key, "http_status", http.StatusBadRequest)
+			http.Error(w, ErrKeyMismatch, http.StatusBadRequest)
+			return
+		}
+		data.Key = pathKey
+	}
+	if !handler.checkKey(w, data.Key) {
+		return
+	}
+
+	if !handler.validateValue(w, data.Key, data.Value) {
+		return
+	}
+	if !handler.checkQuota(w, data.Key, data.Value, false) {
+		return
+	}
+
 	log.Logger.Debugw("Try to add value", "key", data.Key, "value", data.Value)
-	err := handler.Repo.AddValue(data.Key, data.Value)
+	writer := handler.httpActor(r).Principal
+	err = handler.writeRepo(storage.Annotation{Writer: writer, Labels: data.Labels}).AddValue(data.Key, data.Value)
+	if handler.checkUnavailable(w, err) {
+		return
+	}
 	if err != nil {
 		log.Logger.Warnw("Falied to add value", "key", data.Key, "value", data.Value,
 			"error", err.Error(), "http_status", http.StatusConflict)
@@ -30,15 +83,25 @@ func (handler *Handler) Add(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	handler.auditHTTP(r, audit.OpAdd, data.Key, nil, data.Value)
 	log.Logger.Infow("Value added successfully", "key", data.Key,
 		"http_status", http.StatusCreated)
 	w.WriteHeader(http.StatusCreated)
 }
 
+// Get answers with the current value of the key, or a past one when the
+// revision or at query parameter is set. It also serves HEAD, and answers
+// 304 when the value did not change since If-Modified-Since.
 func (handler *Handler) Get(w http.ResponseWriter, r *http.Request) {
 	log.Logger.Infow("Get request started", "method", r.Method, "path", r.URL.Path)
-	routeVars := mux.Vars(r)
-	key := routeVars["id"]
+	key, ok := handler.routeKey(w, r)
+	if !ok {
+		return
+	}
+	if isRevisionRead(r.URL.Query()) {
+		handler.getRevision(w, r, key)
+		return
+	}
 
 	log.Logger.Debugw("Try to get value", "key", key)
 	data, err := handler.Repo.GetValue(key)
@@ -46,17 +109,19 @@ func (handler *Handler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dataValue := data[0].([]any)[1]
-	if _, ok := dataValue.(map[any]any); ok {
-		log.Logger.Debugw("Try to converting map",
-			"map", dataValue.(map[any]any))
-		dataValue, err = handler.convertMap(dataValue.(map[any]any))
-		if err != nil {
-			log.Logger.Errorw("Converting map failed", "data", dataValue,
-				"error", err.Error())
-			http.Error(w, ErrKeyIsNotAString, http.StatusInternalServerError)
-			return
-		}
+	tuple := data[0].([]any)
+	if notModified(w, r, storage.TupleMetadata(tuple)) {
+		return
+	}
+
+	dataValue := tuple[1]
+	log.Logger.Debugw("Try to convert value", "value", dataValue)
+	dataValue, err = handler.convertValue(dataValue)
+	if err != nil {
+		log.Logger.Errorw("Converting value failed", "data", dataValue,
+			"error", err.Error())
+		http.Error(w, ErrKeyIsNotAString, http.StatusInternalServerError)
+		return
 	}
 
 	resp, err := json.Marshal(ResponseData{dataValue})
@@ -69,7 +134,11 @@ func (handler *Handler) Get(w http.ResponseWriter, r *http.Request) {
 	log.Logger.Infow("Get value successful", "key", key,
 		"response", string(resp), "http_status", http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(resp)))
 	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
 	_, err = w.Write(resp)
 	if err != nil {
 		log.Logger.Errorw("Internal server error", "error", err.Error())
@@ -78,35 +147,79 @@ func (handler *Handler) Get(w http.ResponseWriter, r *http.Request) {
 
 func (handler *Handler) Update(w http.ResponseWriter, r *http.Request) {
 	log.Logger.Infow("Update request started", "method", r.Method, "path", r.URL.Path)
-	routeVars := mux.Vars(r)
-	key := routeVars["id"]
+	key, ok := handler.routeKey(w, r)
+	if !ok {
+		return
+	}
 
 	data, ok := handler.parseReqBody(w, r)
 	if !ok {
 		return
 	}
 
-	log.Logger.Debugw("Try to get value", "key", key)
-	err := handler.Repo.UpdateValue(key, data.Value)
+	if !handler.validateValue(w, key, data.Value) {
+		return
+	}
+	if !handler.checkQuota(w, key, data.Value, true) {
+		return
+	}
+
+	before := handler.auditBefore(key)
+	if r.URL.Query().Get("upsert") == "true" {
+		handler.upsert(w, r, key, data.Value, data.Labels, before)
+		return
+	}
+
+	log.Logger.Debugw("Try to update value", "key", key)
+	writer := handler.httpActor(r).Principal
+	err := handler.writeRepo(storage.Annotation{Writer: writer, Labels: data.Labels}).UpdateValue(key, data.Value)
 	if handler.checkError(w, err) {
 		return
 	}
 
+	handler.auditHTTP(r, audit.OpUpdate, key, before, data.Value)
 	log.Logger.Infow("Update value successful", "key", key, "http_status", http.StatusOK)
 	w.WriteHeader(http.StatusOK)
 }
 
+// upsert stores value under key whether or not it exists and answers
+// 201 when the key was created and 200 when it was replaced. Nil labels
+// keep the current ones. before is the audited value ahead of the change.
+func (handler *Handler) upsert(w http.ResponseWriter, r *http.Request, key string, value any,
+	labels map[string]string, before []byte) {
+	log.Logger.Debugw("Try to upsert value", "key", key)
+	writer := handler.httpActor(r).Principal
+	created, err := handler.writeRepo(storage.Annotation{Writer: writer, Labels: labels}).PutValue(key, value)
+	if handler.checkError(w, err) {
+		return
+	}
+
+	status, op := http.StatusOK, audit.OpUpdate
+	if created {
+		status, op, before = http.StatusCreated, audit.OpAdd, nil
+	}
+	handler.auditHTTP(r, op, key, before, value)
+	log.Logger.Infow("Upsert value successful", "key", key, "created", created,
+		"http_status", status)
+	w.WriteHeader(status)
+}
+
 func (handler *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	log.Logger.Infow("Delete request started", "method", r.Method, "path", r.URL.Path)
-	routeVars := mux.Vars(r)
-	key := routeVars["id"]
+	key, ok := handler.routeKey(w, r)
+	if !ok {
+		return
+	}
 
+	before := handler.auditBefore(key)
 	log.Logger.Debugw("Try to delete value", "key", key)
 	err := handler.Repo.DeleteValue(key)
 	if handler.checkError(w, err) {
 		return
 	}
 
+	handler.auditHTTP(r, audit.OpDelete, key, before, nil)
+
 	log.Logger.Infow("Delete value successful", "key", key, "http_status", http.StatusNoContent)
 	w.WriteHeader(http.StatusNoContent)
 }
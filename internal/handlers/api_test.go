@@ -5,14 +5,19 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/tarantool/go-tarantool/v2/decimal"
 	"go.uber.org/mock/gomock"
 
 	"kvManager/internal/handlers"
 	"kvManager/internal/mocks"
 	"kvManager/internal/pkg/log"
+	"kvManager/internal/pkg/resilience"
 	"kvManager/internal/storage"
 )
 
@@ -37,6 +42,7 @@ func TestAPIHandlers(t *testing.T) {
 
 	router := mux.NewRouter()
 	router.HandleFunc("/kv", handler.Add).Methods("POST")
+	router.HandleFunc("/kv/{id}", handler.Add).Methods("POST")
 	router.HandleFunc("/kv/{id}", handler.Get).Methods("GET")
 	router.HandleFunc("/kv/{id}", handler.Update).Methods("PUT")
 	router.HandleFunc("/kv/{id}", handler.Delete).Methods("DELETE")
@@ -54,7 +60,7 @@ func TestAPIHandlers(t *testing.T) {
 			body:   `{"key":"test1", "value":{"k1":123, "k2":true}}`,
 			mockSetup: func() {
 				mockRepo.EXPECT().
-					AddValue("test1", map[string]any{"k1": float64(123), "k2": true}).
+					AddValue("test1", map[string]any{"k1": int64(123), "k2": true}).
 					Return(nil).
 					Times(1)
 			},
@@ -106,6 +112,30 @@ func TestAPIHandlers(t *testing.T) {
 			},
 			expectedStatus: http.StatusOK,
 		},
+		{
+			method: "PUT",
+			path:   "/kv/test3?upsert=true",
+			body:   `{"value":"created"}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().
+					PutValue("test3", "created").
+					Return(true, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			method: "PUT",
+			path:   "/kv/test1?upsert=true",
+			body:   `{"value":"replaced"}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().
+					PutValue("test1", "replaced").
+					Return(false, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
 		{
 			method: "DELETE",
 			path:   "/kv/test1",
@@ -117,6 +147,29 @@ func TestAPIHandlers(t *testing.T) {
 			},
 			expectedStatus: http.StatusNoContent,
 		},
+		{
+			method: "GET",
+			path:   "/kv/stalled",
+			mockSetup: func() {
+				mockRepo.EXPECT().
+					GetValue("stalled").
+					Return(nil, resilience.ErrCircuitOpen).
+					Times(1)
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			method: "POST",
+			path:   "/kv/overloaded",
+			body:   `{"value":1}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().
+					AddValue("overloaded", int64(1)).
+					Return(resilience.ErrOverloaded).
+					Times(1)
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
 		{
 			method: "POST",
 			path:   "/kv",
@@ -156,3 +209,381 @@ func TestAPIHandlers(t *testing.T) {
 		})
 	}
 }
+
+func TestNumberPrecision(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	err := log.SetupLogger()
+	if err != nil {
+		t.Errorf("failed to initialize logger: %v", err)
+		return
+	}
+	mockRepo := mocks.NewMockKvRepository(ctrl)
+
+	handler := handlers.Handler{Repo: mockRepo}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/kv", handler.Add).Methods("POST")
+	router.HandleFunc("/kv/{id}", handler.Get).Methods("GET")
+
+	testCases := []struct {
+		name   string
+		body   string
+		stored any
+		resp   string
+	}{
+		{
+			name:   "int64 beyond 2^53",
+			body:   `{"key":"n","value":9007199254740993}`,
+			stored: int64(9007199254740993),
+			resp:   `{"value":9007199254740993}`,
+		},
+		{
+			name:   "negative int64",
+			body:   `{"key":"n","value":-9223372036854775808}`,
+			stored: int64(-9223372036854775808),
+			resp:   `{"value":-9223372036854775808}`,
+		},
+		{
+			name:   "uint64",
+			body:   `{"key":"n","value":18446744073709551615}`,
+			stored: uint64(18446744073709551615),
+			resp:   `{"value":18446744073709551615}`,
+		},
+		{
+			name:   "nested ids",
+			body:   `{"key":"n","value":{"ids":[9007199254740993,1]}}`,
+			stored: map[string]any{"ids": []any{int64(9007199254740993), int64(1)}},
+			resp:   `{"value":{"ids":[9007199254740993,1]}}`,
+		},
+		{
+			name:   "big integer",
+			body:   `{"key":"n","value":123456789012345678901234567890}`,
+			stored: mustDecimal(t, "123456789012345678901234567890"),
+			resp:   `{"value":123456789012345678901234567890}`,
+		},
+		{
+			name:   "decimal",
+			body:   `{"key":"n","value":0.12345678901234567890123}`,
+			stored: mustDecimal(t, "0.12345678901234567890123"),
+			resp:   `{"value":0.12345678901234567890123}`,
+		},
+		{
+			name:   "double",
+			body:   `{"key":"n","value":1e50}`,
+			stored: 1e50,
+			resp:   `{"value":1e+50}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var stored any
+			mockRepo.EXPECT().
+				AddValue("n", gomock.Any()).
+				DoAndReturn(func(key string, value any) error {
+					stored = value
+					return nil
+				}).
+				Times(1)
+
+			req := httptest.NewRequest("POST", "/kv", bytes.NewBufferString(tc.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != http.StatusCreated {
+				t.Fatalf("Expected status %d, got %d", http.StatusCreated, rr.Code)
+			}
+			if !reflect.DeepEqual(normalizeDecimals(stored), normalizeDecimals(tc.stored)) {
+				t.Fatalf("Expected stored value %#v, got %#v", tc.stored, stored)
+			}
+
+			mockRepo.EXPECT().
+				GetValue("n").
+				Return([]any{[]any{"n", stored}}, nil).
+				Times(1)
+
+			req = httptest.NewRequest("GET", "/kv/n", nil)
+			rr = httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+			}
+			if rr.Body.String() != tc.resp {
+				t.Errorf("Expected body %s, got %s", tc.resp, rr.Body.String())
+			}
+		})
+	}
+
+	for _, body := range []string{
+		`{"key":"n","value":1e400}`,
+		`{"key":"n","value":1e-400}`,
+		`{"key":"n","value":[1234567890123456789012345678901234567890]}`,
+	} {
+		t.Run("reject "+body, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/kv", bytes.NewBufferString(body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
+
+func mustDecimal(t *testing.T, str string) decimal.Decimal {
+	dec, err := decimal.MakeDecimalFromString(str)
+	if err != nil {
+		t.Fatalf("Failed to parse decimal %s: %v", str, err)
+	}
+	return dec
+}
+
+func normalizeDecimals(val any) any {
+	if dec, ok := val.(decimal.Decimal); ok {
+		return dec.String()
+	}
+	return val
+}
+
+func TestKeysInPath(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	err := log.SetupLogger()
+	if err != nil {
+		t.Errorf("failed to initialize logger: %v", err)
+		return
+	}
+	mockRepo := mocks.NewMockKvRepository(ctrl)
+
+	handler := handlers.Handler{Repo: mockRepo}
+	router := handlers.NewRouter(&handler)
+
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		mockSetup      func()
+		expectedStatus int
+	}{
+		{
+			name:   "add by path with encoded slash and space",
+			method: "POST",
+			path:   "/kv/users%2F1%20a",
+			body:   `{"value":1}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().AddValue("users/1 a", int64(1)).Return(nil).Times(1)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:   "add by path with matching body key",
+			method: "POST",
+			path:   "/kv/k1",
+			body:   `{"key":"k1","value":1}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().AddValue("k1", int64(1)).Return(nil).Times(1)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "add by path with different body key",
+			method:         "POST",
+			path:           "/kv/k1",
+			body:           `{"key":"k2","value":1}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "add with empty key",
+			method:         "POST",
+			path:           "/kv",
+			body:           `{"value":1}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "add with too long key",
+			method:         "POST",
+			path:           "/kv",
+			body:           `{"key":"` + strings.Repeat("k", handlers.MaxKeyLength+1) + `","value":1}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "get unicode key",
+			method: "GET",
+			path:   "/kv/%E2%9C%93",
+			mockSetup: func() {
+				mockRepo.EXPECT().GetValue("✓").Return([]any{[]any{"✓", "v"}}, nil).Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "update key with slash",
+			method: "PUT",
+			path:   "/kv/a%2Fb",
+			body:   `{"value":2}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().UpdateValue("a/b", int64(2)).Return(nil).Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "delete key with slash",
+			method: "DELETE",
+			path:   "/kv/a%2Fb",
+			mockSetup: func() {
+				mockRepo.EXPECT().DeleteValue("a/b").Return(nil).Times(1)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "get key with control character",
+			method:         "GET",
+			path:           "/kv/a%01b",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "update reserved key",
+			method:         "PUT",
+			path:           "/kv/_export",
+			body:           `{"value":2}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "add key with underscore prefix",
+			method: "POST",
+			path:   "/kv/_internal",
+			body:   `{"value":2}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().AddValue("_internal", int64(2)).Return(nil).Times(1)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.mockSetup != nil {
+				tc.mockSetup()
+			}
+
+			req := httptest.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	t.Run("invalid escape", func(t *testing.T) {
+		req := mux.SetURLVars(httptest.NewRequest("GET", "/kv/x", nil), map[string]string{"id": "%zz"})
+		rr := httptest.NewRecorder()
+		handler.Get(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+		}
+	})
+}
+
+func TestList(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	err := log.SetupLogger()
+	if err != nil {
+		t.Errorf("failed to initialize logger: %v", err)
+		return
+	}
+	mockRepo := mocks.NewMockKvRepository(ctrl)
+	router := handlers.NewRouter(&handlers.Handler{Repo: mockRepo})
+
+	testCases := []struct {
+		name           string
+		path           string
+		mockSetup      func()
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "full page has cursor",
+			path: "/kv?prefix=user:&limit=2",
+			mockSetup: func() {
+				mockRepo.EXPECT().ScanValues(storage.ScanQuery{Prefix: "user:", Limit: 2}).
+					Return([]any{[]any{"user:1", "a"}, []any{"user:2", "b"}}, nil).Times(1)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"items":[{"key":"user:1","value":"a"},{"key":"user:2","value":"b"}],"next":"user:2"}`,
+		},
+		{
+			name: "last page",
+			path: "/kv?prefix=user:&after=user:2&limit=2",
+			mockSetup: func() {
+				mockRepo.EXPECT().ScanValues(storage.ScanQuery{After: "user:2", Prefix: "user:", Limit: 2}).
+					Return([]any{[]any{"user:3", "c"}}, nil).Times(1)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"items":[{"key":"user:3","value":"c"}]}`,
+		},
+		{
+			name:           "bad limit",
+			path:           "/kv?limit=0",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.mockSetup != nil {
+				tc.mockSetup()
+			}
+
+			req := httptest.NewRequest("GET", tc.path, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedBody != "" && rr.Body.String() != tc.expectedBody {
+				t.Errorf("Expected body %s, got %s", tc.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestExpiredKeys(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	repo := storage.NewMemoryRepository()
+	router := handlers.NewRouter(&handlers.Handler{Repo: repo})
+
+	for _, key := range []string{"add", "update", "delete"} {
+		if err := repo.AddValue(key, 1); err != nil {
+			t.Fatalf("failed to add %s: %v", key, err)
+		}
+		if err := repo.ExpireValue(key, time.Millisecond); err != nil {
+			t.Fatalf("failed to expire %s: %v", key, err)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	testCases := []Case{
+		{Path: "/kv", Body: `{"key":"add","value":2}`, Method: http.MethodPost, ExpectedStatus: http.StatusCreated},
+		{Path: "/kv/add", Method: http.MethodGet, ExpectedStatus: http.StatusOK},
+		{Path: "/kv/update", Body: `{"value":2}`, Method: http.MethodPut, ExpectedStatus: http.StatusNotFound},
+		{Path: "/kv/delete", Method: http.MethodDelete, ExpectedStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.Method, tc.Path, strings.NewReader(tc.Body))
+		router.ServeHTTP(w, req)
+
+		if w.Code != tc.ExpectedStatus {
+			t.Errorf("%s %s: expected status %d, got %d", tc.Method, tc.Path, tc.ExpectedStatus, w.Code)
+		}
+	}
+}
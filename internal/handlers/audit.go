@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	"kvManager/internal/audit"
+	"kvManager/internal/pkg/log"
+)
+
+// RequestIDHeader carries the ID a request is audited under. Requests
+// without one get a random ID, which is returned in the response.
+const RequestIDHeader = "X-Request-Id"
+
+// anonymousPrincipal is the principal of requests without identity.
+const anonymousPrincipal = "anonymous"
+
+// Audit is the audit configuration of a Handler.
+type Audit struct {
+	Logger *audit.Logger
+	// PrincipalHeader names a header set by an authenticating proxy. Any
+	// client can send it, so it is only read with TrustProxy, when every
+	// request comes through a proxy that overwrites it. Without it, or when
+	// it is missing, the principal is derived from the API key.
+	PrincipalHeader string
+	// TrustProxy takes the client IP from X-Forwarded-For and the principal
+	// from PrincipalHeader.
+	TrustProxy bool
+}
+
+type AuditResponse struct {
+	Records []audit.Record `json:"records"`
+	Next    uint64         `json:"next,omitempty"`
+}
+
+// requestIDMiddleware makes sure every request has a request ID.
+func (handler *Handler) requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" {
+			id = newRequestID()
+			r.Header.Set(RequestIDHeader, id)
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// apiKeyPrincipal names a client by a fingerprint of its API key, so
+// records never hold the key itself.
+func apiKeyPrincipal(apiKey string) string {
+	if apiKey == "" {
+		return anonymousPrincipal
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return "api_key:" + hex.EncodeToString(sum[:6])
+}
+
+// principalHeader returns the header the principal is read from, empty
+// unless the proxy setting it is trusted.
+func (cfg *Audit) principalHeader() string {
+	if !cfg.TrustProxy {
+		return ""
+	}
+	return cfg.PrincipalHeader
+}
+
+func (cfg *Audit) httpActor(r *http.Request) audit.Actor {
+	principal := ""
+	if header := cfg.principalHeader(); header != "" {
+		principal = r.Header.Get(header)
+	}
+	if principal == "" {
+		principal = apiKeyPrincipal(r.Header.Get(APIKeyHeader))
+	}
+	return audit.Actor{
+		Principal: principal,
+		RequestID: r.Header.Get(RequestIDHeader),
+		ClientIP:  clientIP(r, cfg.TrustProxy),
+	}
+}
+
+func (cfg *Audit) grpcActor(ctx context.Context) audit.Actor {
+	md, _ := metadata.FromIncomingContext(ctx)
+	actor := audit.Actor{ClientIP: peerIP(ctx)}
+	if header := cfg.principalHeader(); header != "" {
+		if values := md.Get(strings.ToLower(header)); len(values) > 0 {
+			actor.Principal = values[0]
+		}
+	}
+	if actor.Principal == "" {
+		actor.Principal = apiKeyPrincipal(apiKeyFromContext(ctx))
+	}
+	if values := md.Get(strings.ToLower(RequestIDHeader)); len(values) > 0 {
+		actor.RequestID = values[0]
+	}
+	return actor
+}
+
+// auditBefore returns the JSON encoded value of key ahead of a change, or
+// nil when the key does not exist or auditing is off. A failed read is
+// logged and leaves the before hash empty.
+func (handler *Handler) auditBefore(key string) []byte {
+	if handler.Audit == nil {
+		return nil
+	}
+	data, err := handler.Repo.GetValue(key)
+	if err != nil {
+		log.Logger.Debugw("No value before change", "key", key, "error", err.Error())
+		return nil
+	}
+	before, err := handler.encodeValue(data[0].([]any)[1])
+	if err != nil {
+		log.Logger.Warnw("Failed to encode value before change", "key", key, "error", err.Error())
+		return nil
+	}
+	return before
+}
+
+// auditHTTP records a successful change of key made by r.
+func (handler *Handler) auditHTTP(r *http.Request, op audit.Operation, key string, before []byte, after any) {
+	if handler.Audit == nil {
+		return
+	}
+	handler.audit(handler.Audit.httpActor(r), op, key, before, after)
+}
+
+// auditGRPC records a successful change of key made by a gRPC call.
+func (handler *Handler) auditGRPC(ctx context.Context, op audit.Operation, key string, before []byte, after any) {
+	if handler.Audit == nil {
+		return
+	}
+	handler.audit(handler.Audit.grpcActor(ctx), op, key, before, after)
+}
+
+// audit writes the record of a change. The change already happened, so a
+// failure to record it is only logged.
+func (handler *Handler) audit(actor audit.Actor, op audit.Operation, key string, before []byte, after any) {
+	var afterJSON []byte
+	if op != audit.OpDelete {
+		var err error
+		afterJSON, err = handler.encodeValue(after)
+		if err != nil {
+			log.Logger.Warnw("Failed to encode value after change", "key", key, "error", err.Error())
+		}
+	}
+	_ = handler.Audit.Logger.Log(actor, op, key, before, afterJSON)
+}
+
+// AuditLog answers GET /admin/audit?key=&principal=&from=&to=&after=&limit=
+// with the matching records in ID order. from and to are RFC 3339 times;
+// next is the after of the following page.
+func (handler *Handler) AuditLog(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("Audit log request started", "method", r.Method, "path", r.URL.Path)
+	params := r.URL.Query()
+
+	query := audit.Query{Key: params.Get("key"), Principal: params.Get("principal")}
+	var details []string
+	for _, bound := range []struct {
+		name  string
+		value *time.Time
+	}{{"from", &query.From}, {"to", &query.To}} {
+		if !params.Has(bound.name) {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339Nano, params.Get(bound.name))
+		if err != nil {
+			details = append(details, bound.name+" must be an RFC 3339 time")
+		}
+		*bound.value = parsed
+	}
+	if params.Has("after") {
+		after, err := strconv.ParseUint(params.Get("after"), 10, 64)
+		if err != nil {
+			details = append(details, "after must be a record id")
+		}
+		query.After = after
+	}
+	query.Limit = audit.DefaultQueryLimit
+	if params.Has("limit") {
+		limit, err := strconv.Atoi(params.Get("limit"))
+		if err != nil || limit <= 0 || limit > maxQueryLimit {
+			details = append(details, "limit must be between 1 and "+strconv.Itoa(maxQueryLimit))
+		}
+		query.Limit = limit
+	}
+	if len(details) > 0 {
+		log.Logger.Warnw("Invalid audit query", "errors", details, "http_status", http.StatusBadRequest)
+		handler.writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: ErrInvalidQuery, Details: details})
+		return
+	}
+
+	records, err := handler.Audit.Logger.Query(query)
+	if handler.checkError(w, err) {
+		return
+	}
+
+	resp := AuditResponse{Records: records}
+	if len(records) == query.Limit {
+		resp.Next = records[len(records)-1].ID
+	}
+	handler.writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,176 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+
+	"kvManager/internal/audit"
+	"kvManager/internal/handlers"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+	"kvManager/pkg/kvpb"
+)
+
+func TestAudit(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	sink, err := audit.OpenFile(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer sink.Close()
+	handler := &handlers.Handler{
+		Repo:      storage.NewMemoryRepository(),
+		Audit:     &handlers.Audit{Logger: audit.NewLogger(sink, true), PrincipalHeader: "X-User", TrustProxy: true},
+		AdminKeys: []string{"admin"},
+	}
+	router := handlers.NewRouter(handler)
+
+	requests := []struct {
+		method         string
+		path           string
+		body           string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{method: http.MethodPost, path: "/kv", body: `{"key":"user:1","value":{"a":1}}`, headers: map[string]string{"X-User": "ann", handlers.RequestIDHeader: "req-1"}, expectedStatus: http.StatusCreated},
+		{method: http.MethodPost, path: "/kv", body: `{"key":"user:1","value":{"a":1}}`, headers: map[string]string{"X-User": "ann"}, expectedStatus: http.StatusConflict},
+		{method: http.MethodPut, path: "/kv/user:1", body: `{"value":{"a":2}}`, headers: map[string]string{handlers.APIKeyHeader: "secret"}, expectedStatus: http.StatusOK},
+		{method: http.MethodPut, path: "/kv/user:2?upsert=true", body: `{"value":2}`, expectedStatus: http.StatusCreated},
+		{method: http.MethodDelete, path: "/kv/user:2", headers: map[string]string{"X-User": "bob"}, expectedStatus: http.StatusNoContent},
+		{method: http.MethodDelete, path: "/kv/user:2", headers: map[string]string{"X-User": "bob"}, expectedStatus: http.StatusNotFound},
+		{method: http.MethodPost, path: "/kv", body: `{"key":"user:3","value":3}`, headers: map[string]string{"X-User": "dave"}, expectedStatus: http.StatusCreated},
+		{method: http.MethodPost, path: "/kv/_mdelete", body: `{"keys":["user:3","user:4"]}`, headers: map[string]string{"X-User": "dave"}, expectedStatus: http.StatusOK},
+	}
+	for _, req := range requests {
+		r := httptest.NewRequest(req.method, req.path, strings.NewReader(req.body))
+		for name, value := range req.headers {
+			r.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != req.expectedStatus {
+			t.Fatalf("%s %s: expected status %d, got %d", req.method, req.path, req.expectedStatus, w.Code)
+		}
+		if w.Header().Get(handlers.RequestIDHeader) == "" {
+			t.Errorf("%s %s: expected a request ID", req.method, req.path)
+		}
+	}
+
+	client := dialGRPC(t, handler, handlers.GRPCConfig{})
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-user", "carol", "x-request-id", "grpc-1")
+	_, err = client.Update(ctx, &kvpb.UpdateRequest{Key: "user:1", Value: []byte(`{"a":3}`)})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	testCases := []struct {
+		name           string
+		query          string
+		apiKey         string
+		expectedStatus int
+		expected       []string
+	}{
+		{name: "all", apiKey: "admin", query: "", expectedStatus: http.StatusOK, expected: []string{
+			"1 ann user:1 add",
+			"2 api_key:2bb80d537b1d user:1 update",
+			"3 anonymous user:2 add",
+			"4 bob user:2 delete",
+			"5 dave user:3 add",
+			"6 dave user:3 delete",
+			"7 carol user:1 update",
+		}},
+		{name: "by key", apiKey: "admin", query: "?key=user:2", expectedStatus: http.StatusOK, expected: []string{"3 anonymous user:2 add", "4 bob user:2 delete"}},
+		{name: "by principal", apiKey: "admin", query: "?principal=ann", expectedStatus: http.StatusOK, expected: []string{"1 ann user:1 add"}},
+		{name: "page", apiKey: "admin", query: "?after=1&limit=1", expectedStatus: http.StatusOK, expected: []string{"2 api_key:2bb80d537b1d user:1 update"}},
+		{name: "time range", apiKey: "admin", query: "?from=2000-01-01T00:00:00Z&to=2001-01-01T00:00:00Z", expectedStatus: http.StatusOK, expected: []string{}},
+		{name: "without admin key", query: "", expectedStatus: http.StatusUnauthorized},
+		{name: "wrong admin key", apiKey: "secret", query: "", expectedStatus: http.StatusUnauthorized},
+		{name: "invalid", apiKey: "admin", query: "?from=yesterday&limit=0", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/admin/audit"+tc.query, nil)
+			if tc.apiKey != "" {
+				r.Header.Set(handlers.APIKeyHeader, tc.apiKey)
+			}
+			router.ServeHTTP(w, r)
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d %s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+			if tc.expected == nil {
+				return
+			}
+
+			var resp handlers.AuditResponse
+			err := json.Unmarshal(w.Body.Bytes(), &resp)
+			if err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			actual := make([]string, 0, len(resp.Records))
+			for _, record := range resp.Records {
+				actual = append(actual, fmt.Sprintf("%d %s %s %s", record.ID, record.Principal,
+					record.Key, record.Operation))
+			}
+			if strings.Join(actual, "\n") != strings.Join(tc.expected, "\n") {
+				t.Errorf("Expected\n%s\ngot\n%s", strings.Join(tc.expected, "\n"), strings.Join(actual, "\n"))
+			}
+		})
+	}
+
+	records, err := sink.Query(audit.Query{Key: "user:1"})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if records[0].RequestID != "req-1" || records[2].RequestID != "grpc-1" || records[0].ClientIP != "192.0.2.1" ||
+		records[1].BeforeHash != records[0].AfterHash || string(records[2].Before) != `{"a":2}` ||
+		string(records[2].After) != `{"a":3}` {
+		t.Errorf("Unexpected records %+v", records)
+	}
+}
+
+func TestAuditUntrustedPrincipal(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	sink, err := audit.OpenFile(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer sink.Close()
+	router := handlers.NewRouter(&handlers.Handler{
+		Repo:  storage.NewMemoryRepository(),
+		Audit: &handlers.Audit{Logger: audit.NewLogger(sink, false), PrincipalHeader: "X-User"},
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/kv", strings.NewReader(`{"key":"user:1","value":1}`))
+	r.Header.Set("X-User", "admin")
+	r.Header.Set("X-Forwarded-For", "198.51.100.7")
+	r.Header.Set(handlers.APIKeyHeader, "secret")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", w.Code)
+	}
+
+	records, err := sink.Query(audit.Query{Key: "user:1"})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(records) != 1 || records[0].Principal != "api_key:2bb80d537b1d" || records[0].ClientIP != "192.0.2.1" {
+		t.Errorf("Expected the principal header to be ignored without a trusted proxy, got %+v", records)
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"kvManager/internal/backup"
+	"kvManager/internal/pkg/log"
+)
+
+type BackupsResponse struct {
+	Backups []backup.Manifest `json:"backups"`
+}
+
+// CreateBackup answers POST /admin/backups with the manifest of a new
+// backup. The request lasts until the whole storage is exported.
+func (handler *Handler) CreateBackup(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("Create backup request started", "method", r.Method, "path", r.URL.Path)
+
+	manifest, err := handler.Backups.Create()
+	if handler.checkBackupError(w, err) {
+		return
+	}
+
+	log.Logger.Infow("Backup created successfully", "id", manifest.ID,
+		"entries", manifest.Entries, "http_status", http.StatusCreated)
+	handler.writeJSON(w, http.StatusCreated, manifest)
+}
+
+func (handler *Handler) ListBackups(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("List backups request started", "method", r.Method, "path", r.URL.Path)
+
+	manifests, err := handler.Backups.List()
+	if handler.checkBackupError(w, err) {
+		return
+	}
+
+	handler.writeJSON(w, http.StatusOK, BackupsResponse{Backups: manifests})
+}
+
+func (handler *Handler) GetBackup(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("Get backup request started", "method", r.Method, "path", r.URL.Path)
+	id, ok := pathVar(w, r, "id")
+	if !ok {
+		return
+	}
+
+	manifest, err := handler.Backups.Get(id)
+	if handler.checkBackupError(w, err) {
+		return
+	}
+
+	handler.writeJSON(w, http.StatusOK, manifest)
+}
+
+// RestoreBackup answers POST /admin/backups/{id}/restore. The storage must
+// be empty; entries are written with the TTL they have left.
+func (handler *Handler) RestoreBackup(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("Restore backup request started", "method", r.Method, "path", r.URL.Path)
+	id, ok := pathVar(w, r, "id")
+	if !ok {
+		return
+	}
+
+	result, err := handler.Backups.Restore(id)
+	if handler.checkBackupError(w, err) {
+		return
+	}
+
+	log.Logger.Infow("Backup restored successfully", "id", id, "restored", result.Restored,
+		"http_status", http.StatusOK)
+	handler.writeJSON(w, http.StatusOK, result)
+}
+
+func (handler *Handler) checkBackupError(w http.ResponseWriter, err error) bool {
+	var status int
+	var message string
+	switch {
+	case errors.Is(err, backup.ErrNotFound):
+		status, message = http.StatusNotFound, ErrBackupNotFound
+	case errors.Is(err, backup.ErrInProgress):
+		status, message = http.StatusConflict, ErrBackupInProgress
+	case errors.Is(err, backup.ErrNotEmpty):
+		status, message = http.StatusConflict, ErrRestoreNotEmpty
+	case errors.Is(err, backup.ErrChecksumMismatch):
+		status, message = http.StatusUnprocessableEntity, ErrBackupCorrupt
+	default:
+		return handler.checkError(w, err)
+	}
+
+	log.Logger.Warnw("Backup request rejected", "error", err.Error(), "http_status", status)
+	http.Error(w, message, status)
+	return true
+}
@@ -0,0 +1,82 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"kvManager/internal/backup"
+	"kvManager/internal/handlers"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+func TestBackups(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	dir := t.TempDir()
+	source := storage.NewMemoryRepository()
+	err = source.AddValue("user:1", map[string]any{"name": "Ann"})
+	if err != nil {
+		t.Fatalf("AddValue: %v", err)
+	}
+	sourceRouter := handlers.NewRouter(&handlers.Handler{Repo: source, Backups: backup.NewManager(source, source, backup.Config{Dir: dir}),
+		AdminKeys: []string{"admin"}})
+	target := storage.NewMemoryRepository()
+	targetRouter := handlers.NewRouter(&handlers.Handler{Repo: target, Backups: backup.NewManager(target, target, backup.Config{Dir: dir}),
+		AdminKeys: []string{"admin"}})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/admin/backups", nil)
+	r.Header.Set(handlers.APIKeyHeader, "admin")
+	sourceRouter.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d %s", w.Code, w.Body.String())
+	}
+	var manifest backup.Manifest
+	err = json.Unmarshal(w.Body.Bytes(), &manifest)
+	if err != nil || manifest.Entries != 1 {
+		t.Fatalf("Unexpected manifest %s, %v", w.Body.String(), err)
+	}
+
+	testCases := []struct {
+		name           string
+		router         http.Handler
+		method         string
+		path           string
+		apiKey         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "without admin key", router: sourceRouter, method: http.MethodGet, path: "/admin/backups", expectedStatus: http.StatusUnauthorized, expectedBody: handlers.ErrAdminRequired},
+		{name: "restore without admin key", router: targetRouter, method: http.MethodPost, path: "/admin/backups/" + manifest.ID + "/restore", apiKey: "secret", expectedStatus: http.StatusUnauthorized, expectedBody: handlers.ErrAdminRequired},
+		{name: "list", apiKey: "admin", router: sourceRouter, method: http.MethodGet, path: "/admin/backups", expectedStatus: http.StatusOK, expectedBody: `"id":"` + manifest.ID + `"`},
+		{name: "get", apiKey: "admin", router: sourceRouter, method: http.MethodGet, path: "/admin/backups/" + manifest.ID, expectedStatus: http.StatusOK, expectedBody: `"entries":1`},
+		{name: "get unknown", apiKey: "admin", router: sourceRouter, method: http.MethodGet, path: "/admin/backups/unknown", expectedStatus: http.StatusNotFound, expectedBody: handlers.ErrBackupNotFound},
+		{name: "restore not empty", apiKey: "admin", router: sourceRouter, method: http.MethodPost, path: "/admin/backups/" + manifest.ID + "/restore", expectedStatus: http.StatusConflict, expectedBody: handlers.ErrRestoreNotEmpty},
+		{name: "restore", apiKey: "admin", router: targetRouter, method: http.MethodPost, path: "/admin/backups/" + manifest.ID + "/restore", expectedStatus: http.StatusOK, expectedBody: `"restored":1`},
+		{name: "get restored", router: targetRouter, method: http.MethodGet, path: "/kv/user:1", expectedStatus: http.StatusOK, expectedBody: `{"value":{"name":"Ann"}}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.apiKey != "" {
+				r.Header.Set(handlers.APIKeyHeader, tc.apiKey)
+			}
+			tc.router.ServeHTTP(w, r)
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tc.expectedStatus, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tc.expectedBody) {
+				t.Errorf("Expected body to contain %s, got %s", tc.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"kvManager/internal/pkg/log"
+)
+
+const maxBatchKeys = 1000
+
+type BatchRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// BatchItem is the per-key result of a batch operation. Value is only
+// set by _mget for keys that were found.
+type BatchItem struct {
+	Found bool `json:"found"`
+	Value any  `json:"value,omitempty"`
+}
+
+type BatchResponse struct {
+	Items map[string]BatchItem `json:"items"`
+}
+
+func (handler *Handler) parseBatchRequest(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	var req BatchRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if handler.checkBodyTooLarge(w, err) {
+		return nil, false
+	}
+	if err != nil {
+		log.Logger.Warnw("Failed to unmarshal batch request",
+			"error", err, "http_status", http.StatusBadRequest)
+		http.Error(w, ErrIncorrectBody, http.StatusBadRequest)
+		return nil, false
+	}
+	if len(req.Keys) == 0 || len(req.Keys) > maxBatchKeys {
+		log.Logger.Warnw("Invalid batch size", "keys_count", len(req.Keys),
+			"http_status", http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("%s: 1 to %d keys expected", ErrBatchSize, maxBatchKeys),
+			http.StatusBadRequest)
+		return nil, false
+	}
+
+	seen := make(map[string]struct{}, len(req.Keys))
+	keys := make([]string, 0, len(req.Keys))
+	for _, key := range req.Keys {
+		if !handler.checkKey(w, key) {
+			return nil, false
+		}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+	return keys, true
+}
+
+// MultiGet returns the values of up to maxBatchKeys keys in one request:
+// POST /kv/_mget {"keys": ["k1", "k2"]}.
+func (handler *Handler) MultiGet(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("MultiGet request started", "method", r.Method, "path", r.URL.Path)
+	keys, ok := handler.parseBatchRequest(w, r)
+	if !ok {
+		return
+	}
+
+	log.Logger.Debugw("Try to get values", "keys_count", len(keys))
+	tuples, err := handler.Repo.GetValues(keys)
+	if handler.checkError(w, err) {
+		return
+	}
+	found, err := handler.tuplesToItems(tuples)
+	if err != nil {
+		log.Logger.Errorw("Converting values failed", "error", err.Error())
+		http.Error(w, ErrInternalServer, http.StatusInternalServerError)
+		return
+	}
+
+	items := make(map[string]BatchItem, len(keys))
+	for _, key := range keys {
+		items[key] = BatchItem{Found: false}
+	}
+	for _, item := range found {
+		items[item.Key] = BatchItem{Found: true, Value: item.Value}
+	}
+
+	log.Logger.Infow("MultiGet successful", "keys_count", len(keys),
+		"found_count", len(found), "http_status", http.StatusOK)
+	handler.writeJSON(w, http.StatusOK, BatchResponse{Items: items})
+}
+
+// MultiDelete deletes up to maxBatchKeys keys in one request:
+// POST /kv/_mdelete {"keys": ["k1", "k2"]}. Every deleted key is audited.
+func (handler *Handler) MultiDelete(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("MultiDelete request started", "method", r.Method, "path", r.URL.Path)
+	keys, ok := handler.parseBatchRequest(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := handler.Writes().Delete(handler.httpActor(r), keys)
+	if handler.checkError(w, err) {
+		return
+	}
+
+	items := make(map[string]BatchItem, len(keys))
+	for _, key := range keys {
+		items[key] = BatchItem{Found: false}
+	}
+	for _, key := range deleted {
+		items[key] = BatchItem{Found: true}
+	}
+
+	log.Logger.Infow("MultiDelete successful", "keys_count", len(keys),
+		"deleted_count", len(deleted), "http_status", http.StatusOK)
+	handler.writeJSON(w, http.StatusOK, BatchResponse{Items: items})
+}
@@ -0,0 +1,101 @@
+package handlers_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+
+	"kvManager/internal/handlers"
+	"kvManager/internal/mocks"
+	"kvManager/internal/pkg/log"
+)
+
+func TestBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	err := log.SetupLogger()
+	if err != nil {
+		t.Errorf("failed to initialize logger: %v", err)
+		return
+	}
+	mockRepo := mocks.NewMockKvRepository(ctrl)
+
+	handler := handlers.Handler{Repo: mockRepo}
+	router := handlers.NewRouter(&handler)
+
+	testCases := []struct {
+		name           string
+		path           string
+		body           string
+		mockSetup      func()
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "mget",
+			path: "/kv/_mget",
+			body: `{"keys":["k1","k2","k1"]}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().
+					GetValues([]string{"k1", "k2"}).
+					Return([]any{[]any{"k1", map[any]any{"a": int8(1)}}}, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"items":{"k1":{"found":true,"value":{"a":1}},"k2":{"found":false}}}`,
+		},
+		{
+			name: "mdelete",
+			path: "/kv/_mdelete",
+			body: `{"keys":["k1","k2"]}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().
+					DeleteValues([]string{"k1", "k2"}).
+					Return([]string{"k2"}, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"items":{"k1":{"found":false},"k2":{"found":true}}}`,
+		},
+		{
+			name:           "mget without keys",
+			path:           "/kv/_mget",
+			body:           `{"keys":[]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "mget with invalid key",
+			path:           "/kv/_mget",
+			body:           `{"keys":["k1",""]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "mdelete with malformed body",
+			path:           "/kv/_mdelete",
+			body:           `{"keys":`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.mockSetup != nil {
+				tc.mockSetup()
+			}
+
+			req := httptest.NewRequest("POST", tc.path, bytes.NewBufferString(tc.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedBody != "" && rr.Body.String() != tc.expectedBody {
+				t.Errorf("Expected body %s, got %s", tc.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
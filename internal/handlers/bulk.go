@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"kvManager/internal/audit"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+// exportPageSize is the number of entries read from the primary index per
+// scan while exporting.
+const exportPageSize uint32 = 1000
+
+// importProgressInterval is how many entries are imported between two
+// progress log lines.
+const importProgressInterval = 10000
+
+// importStreamInterval is how many entries are imported between two
+// progress lines of a streamed import response.
+const importStreamInterval = 1000
+
+// maxImportErrors bounds the line errors returned in an ImportSummary.
+const maxImportErrors = 100
+
+// NDJSONContentType is the media type of export and import bodies.
+const NDJSONContentType = "application/x-ndjson"
+
+// How POST /kv/_import handles keys that already exist.
+const (
+	ImportModeSkip      string = "skip"
+	ImportModeOverwrite string = "overwrite"
+	ImportModeFail      string = "fail"
+)
+
+// ImportError describes a line that was not imported.
+type ImportError struct {
+	Line    int64    `json:"line"`
+	Key     string   `json:"key,omitempty"`
+	Error   string   `json:"error"`
+	Details []string `json:"details,omitempty"`
+}
+
+// ImportSummary is the result of POST /kv/_import. Error is set when the
+// import stopped before the end of the body.
+type ImportSummary struct {
+	Processed int64         `json:"processed"`
+	Created   int64         `json:"created"`
+	Replaced  int64         `json:"replaced"`
+	Skipped   int64         `json:"skipped"`
+	Failed    int64         `json:"failed"`
+	Errors    []ImportError `json:"errors,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// ImportProgress is a line of a streamed import response. Progress lines
+// carry the counts so far. The last line has Done set, the final summary
+// with its errors and the status the import would have been answered
+// with, since the response status is sent before the import starts.
+type ImportProgress struct {
+	ImportSummary
+	Done   bool `json:"done"`
+	Status int  `json:"status,omitempty"`
+}
+
+func (summary *ImportSummary) fail(line int64, key string, err *apiError) {
+	summary.Failed++
+	if len(summary.Errors) < maxImportErrors {
+		summary.Errors = append(summary.Errors, ImportError{
+			Line: line, Key: key, Error: err.Message, Details: err.Details,
+		})
+	}
+}
+
+// Export streams the entries in key order as NDJSON, one {"key", "value"}
+// object per line: GET /kv/_export?prefix=user:&after=user:10. Entries
+// are read in pages, so the export never holds more than a page in
+// memory. A storage failure after the first page aborts the response,
+// which clients see as a truncated body.
+func (handler *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("Export request started", "method", r.Method, "path", r.URL.Path)
+	params := r.URL.Query()
+	query := storage.ScanQuery{After: params.Get("after"), Prefix: params.Get("prefix"), Limit: exportPageSize}
+
+	log.Logger.Debugw("Try to scan values", "after", query.After, "prefix", query.Prefix)
+	tuples, err := handler.Repo.ScanValues(query)
+	if handler.checkError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", NDJSONContentType)
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	count := 0
+	for {
+		items, err := handler.tuplesToItems(tuples)
+		if err != nil {
+			handler.abortExport(count, err)
+		}
+		for _, item := range items {
+			err = encoder.Encode(item)
+			if err != nil {
+				log.Logger.Warnw("Export interrupted", "exported", count, "error", err.Error())
+				return
+			}
+		}
+		count += len(items)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if uint32(len(items)) < exportPageSize {
+			break
+		}
+
+		query.After = items[len(items)-1].Key
+		tuples, err = handler.Repo.ScanValues(query)
+		if err != nil {
+			handler.abortExport(count, err)
+		}
+	}
+
+	log.Logger.Infow("Export successful", "count", count, "http_status", http.StatusOK)
+}
+
+// abortExport ends an export whose status was already sent. The server
+// closes the connection without terminating the body.
+func (handler *Handler) abortExport(count int, err error) {
+	log.Logger.Errorw("Export failed", "exported", count, "error", err.Error())
+	panic(http.ErrAbortHandler)
+}
+
+// Import stores the NDJSON {"key", "value"} lines of the body: POST
+// /kv/_import?mode=skip|overwrite|fail. Each entry goes through the same
+// checks as Add, is annotated and audited like it, and each line may be up
+// to MaxBodyBytes long; the body as a whole is not limited. Existing keys
+// are left as they are with skip and replaced with overwrite. Rejected
+// lines are counted and reported in the summary. With fail, the default,
+// the first existing key or rejected line stops the import and its
+// status, such as 409, is the response status. Entries written before a
+// stop are kept.
+//
+// Clients accepting NDJSON get the progress of the import as it runs
+// instead: ImportProgress lines every importStreamInterval entries and a
+// last one with the summary and status.
+func (handler *Handler) Import(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("Import request started", "method", r.Method, "path", r.URL.Path)
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = ImportModeFail
+	}
+	if mode != ImportModeSkip && mode != ImportModeOverwrite && mode != ImportModeFail {
+		log.Logger.Warnw("Invalid import mode", "mode", mode, "http_status", http.StatusBadRequest)
+		http.Error(w, ErrInvalidImportMode, http.StatusBadRequest)
+		return
+	}
+
+	summary := &ImportSummary{}
+	var progress func()
+	stream := strings.Contains(r.Header.Get("Accept"), NDJSONContentType)
+	if stream {
+		progress = handler.streamImport(w, summary)
+	}
+	status := handler.importLines(r.Body, mode, handler.httpActor(r), summary, progress)
+
+	log.Logger.Infow("Import finished", "mode", mode, "processed", summary.Processed,
+		"created", summary.Created, "replaced", summary.Replaced, "skipped", summary.Skipped,
+		"failed", summary.Failed, "http_status", status)
+	if stream {
+		handler.writeImportProgress(w, ImportProgress{ImportSummary: *summary, Done: true, Status: status})
+		return
+	}
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
+	handler.writeJSON(w, status, summary)
+}
+
+// streamImport starts a streamed import response and returns the function
+// writing a progress line. The body is still read while the response is
+// written, which HTTP/1.1 connections must allow explicitly.
+func (handler *Handler) streamImport(w http.ResponseWriter, summary *ImportSummary) func() {
+	err := http.NewResponseController(w).EnableFullDuplex()
+	if err != nil {
+		log.Logger.Debugw("Full duplex not enabled", "error", err.Error())
+	}
+	w.Header().Set("Content-Type", NDJSONContentType)
+	w.WriteHeader(http.StatusOK)
+	return func() {
+		progress := ImportProgress{ImportSummary: *summary}
+		progress.Errors = nil
+		handler.writeImportProgress(w, progress)
+	}
+}
+
+// writeImportProgress writes and flushes a line of a streamed import. A
+// client that went away is noticed when the body can not be read.
+func (handler *Handler) writeImportProgress(w http.ResponseWriter, progress ImportProgress) {
+	err := json.NewEncoder(w).Encode(progress)
+	if err == nil {
+		err = http.NewResponseController(w).Flush()
+	}
+	if err != nil {
+		log.Logger.Warnw("Failed to write import progress", "processed", progress.Processed,
+			"error", err.Error())
+	}
+}
+
+// importLines imports body into summary and returns the response status.
+// progress, when set, is called every importStreamInterval entries.
+func (handler *Handler) importLines(body io.Reader, mode string, actor audit.Actor, summary *ImportSummary, progress func()) int {
+	writes := handler.Writes()
+	reader := bufio.NewReader(body)
+	maxLine := handler.limits().MaxBodyBytes
+	var line int64
+	for {
+		data, tooLong, err := readLine(reader, maxLine)
+		if errors.Is(err, io.EOF) && len(data) == 0 && !tooLong {
+			return http.StatusOK
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			log.Logger.Warnw("Failed to read import body", "line", line, "error", err)
+			summary.Error = ErrReadReqBody
+			return http.StatusBadRequest
+		}
+		line++
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 && !tooLong {
+			continue
+		}
+		summary.Processed++
+
+		var stop *apiError
+		if tooLong {
+			stop = &apiError{
+				Status:  http.StatusRequestEntityTooLarge,
+				Message: ErrBodyTooLarge,
+				Details: []string{fmt.Sprintf("line is longer than %d bytes", maxLine)},
+			}
+			summary.fail(line, "", stop)
+		} else {
+			stop, err = handler.importEntry(writes, actor, data, line, mode, summary)
+			if err != nil {
+				return handler.importStorageError(err, summary)
+			}
+		}
+		if stop != nil && mode == ImportModeFail {
+			summary.Error = fmt.Sprintf("line %d: %s", line, stop.Message)
+			return stop.Status
+		}
+		if summary.Processed%importProgressInterval == 0 {
+			log.Logger.Infow("Import progress", "processed", summary.Processed,
+				"created", summary.Created, "replaced", summary.Replaced,
+				"skipped", summary.Skipped, "failed", summary.Failed)
+		}
+		if progress != nil && summary.Processed%importStreamInterval == 0 {
+			progress()
+		}
+	}
+}
+
+// importEntry imports one line through writes on behalf of actor. It
+// returns the rejection of the line, already counted in summary, or the
+// storage error that stops the import.
+func (handler *Handler) importEntry(writes *Writes, actor audit.Actor, data []byte, line int64, mode string, summary *ImportSummary) (*apiError, error) {
+	var entry struct {
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}
+	err := json.Unmarshal(data, &entry)
+	if err != nil || len(entry.Value) == 0 {
+		rejected := &apiError{Status: http.StatusBadRequest, Message: ErrIncorrectBody}
+		summary.fail(line, entry.Key, rejected)
+		return rejected, nil
+	}
+
+	var rejected *apiError
+	if mode == ImportModeOverwrite {
+		created, err := writes.Put(actor, entry.Key, entry.Value)
+		if errors.As(err, &rejected) {
+			summary.fail(line, entry.Key, rejected)
+			return rejected, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			summary.Created++
+		} else {
+			summary.Replaced++
+		}
+		return nil, nil
+	}
+
+	err = writes.Add(actor, entry.Key, entry.Value)
+	if errors.As(err, &rejected) {
+		summary.fail(line, entry.Key, rejected)
+		return rejected, nil
+	}
+	if errors.Is(err, storage.ErrKeyExists) {
+		log.Logger.Debugw("Import found existing key", "key", entry.Key)
+		if mode == ImportModeSkip {
+			summary.Skipped++
+			return nil, nil
+		}
+		rejected = &apiError{Status: http.StatusConflict, Message: ErrKeyExists}
+		summary.fail(line, entry.Key, rejected)
+		return rejected, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	summary.Created++
+	return nil, nil
+}
+
+// importStorageError records the storage error that stopped an import
+// and returns the response status.
+func (handler *Handler) importStorageError(err error, summary *ImportSummary) int {
+	if isUnavailable(err) {
+		log.Logger.Warnw("Storage unavailable during import", "error", err.Error())
+		summary.Error = ErrUnavailable
+		return http.StatusServiceUnavailable
+	}
+	log.Logger.Errorw("Import failed", "error", err.Error())
+	summary.Error = ErrInternalServer
+	return http.StatusInternalServerError
+}
+
+// readLine returns the next line of r without its terminator. Lines
+// longer than max are skipped and reported with tooLong.
+func readLine(r *bufio.Reader, max int64) ([]byte, bool, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLong {
+			line = append(line, chunk...)
+			if int64(len(line)) > max+1 {
+				tooLong = true
+				line = nil
+			}
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		return bytes.TrimSuffix(line, []byte("\n")), tooLong, err
+	}
+}
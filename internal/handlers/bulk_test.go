@@ -0,0 +1,378 @@
+package handlers_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+
+	"kvManager/internal/audit"
+	"kvManager/internal/handlers"
+	"kvManager/internal/mocks"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/pkg/resilience"
+	"kvManager/internal/storage"
+)
+
+func TestExport(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	mem := storage.NewMemoryRepository()
+	var expected strings.Builder
+	for i := 0; i < 2500; i++ {
+		key := fmt.Sprintf("user:%04d", i)
+		err = mem.AddValue(key, map[string]any{"n": int64(i)})
+		if err != nil {
+			t.Fatalf("AddValue: %v", err)
+		}
+		fmt.Fprintf(&expected, "{\"key\":%q,\"value\":{\"n\":%d}}\n", key, i)
+	}
+	err = mem.AddValue("zone:1", "z")
+	if err != nil {
+		t.Fatalf("AddValue: %v", err)
+	}
+	router := handlers.NewRouter(&handlers.Handler{Repo: mem})
+
+	testCases := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{name: "prefix across pages", query: "?prefix=user:", expected: expected.String()},
+		{name: "after", query: "?prefix=user:&after=user:2497", expected: expected.String()[strings.Index(expected.String(), `{"key":"user:2498"`):]},
+		{name: "everything", query: "", expected: expected.String() + "{\"key\":\"zone:1\",\"value\":\"z\"}\n"},
+		{name: "empty", query: "?prefix=none:", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/kv/_export"+tc.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != handlers.NDJSONContentType {
+				t.Errorf("Expected %s, got %s", handlers.NDJSONContentType, ct)
+			}
+			if w.Body.String() != tc.expected {
+				t.Errorf("Unexpected body of %d bytes, expected %d", w.Body.Len(), len(tc.expected))
+			}
+		})
+	}
+}
+
+func TestExportFailures(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	mockRepo := mocks.NewMockKvRepository(ctrl)
+	server := httptest.NewServer(handlers.NewRouter(&handlers.Handler{Repo: mockRepo}))
+	defer server.Close()
+
+	mockRepo.EXPECT().ScanValues(gomock.Any()).Return(nil, resilience.ErrCircuitOpen).Times(1)
+	resp, err := http.Get(server.URL + "/kv/_export")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before streaming, got %d", resp.StatusCode)
+	}
+
+	page := make([]any, 1000)
+	for i := range page {
+		page[i] = []any{fmt.Sprintf("k%04d", i), "v"}
+	}
+	gomock.InOrder(
+		mockRepo.EXPECT().ScanValues(gomock.Any()).Return(page, nil),
+		mockRepo.EXPECT().ScanValues(storage.ScanQuery{After: "k0999", Limit: 1000}).Return(nil, resilience.ErrCircuitOpen),
+	)
+	resp, err = http.Get(server.URL + "/kv/_export")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer resp.Body.Close()
+	_, err = io.ReadAll(resp.Body)
+	if err == nil {
+		t.Errorf("Expected a truncated body after a failure while streaming")
+	}
+}
+
+func TestImport(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+
+	body := strings.Join([]string{
+		`{"key":"user:1","value":{"name":"new"}}`,
+		``,
+		`{"key":"user:2","value":2}`,
+		`not json`,
+		`{"key":"_import","value":1}`,
+		`{"key":"user:3"}`,
+		`{"key":"user:4","value":"` + strings.Repeat("a", 200) + `"}`,
+		`{"key":"user:5","value":5}`,
+	}, "\n")
+
+	testCases := []struct {
+		name           string
+		mode           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+		expectedUser1  string
+	}{
+		{
+			name:           "skip",
+			mode:           "skip",
+			body:           body,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"processed":7,"created":2,"replaced":0,"skipped":1,"failed":4,"errors":[{"line":4,"error":"Incorrect body"},{"line":5,"key":"_import","error":"Key is reserved for an API endpoint"},{"line":6,"key":"user:3","error":"Incorrect body"},{"line":7,"error":"Request body too large","details":["line is longer than 128 bytes"]}]}`,
+			expectedUser1:  `old`,
+		},
+		{
+			name:           "overwrite",
+			mode:           "overwrite",
+			body:           body,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"processed":7,"created":2,"replaced":1,"skipped":0,"failed":4,"errors":[{"line":4,"error":"Incorrect body"},{"line":5,"key":"_import","error":"Key is reserved for an API endpoint"},{"line":6,"key":"user:3","error":"Incorrect body"},{"line":7,"error":"Request body too large","details":["line is longer than 128 bytes"]}]}`,
+			expectedUser1:  `map[name:new]`,
+		},
+		{
+			name:           "fail on existing key",
+			mode:           "",
+			body:           body,
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"processed":1,"created":0,"replaced":0,"skipped":0,"failed":1,"errors":[{"line":1,"key":"user:1","error":"Key already exists"}],"error":"line 1: Key already exists"}`,
+			expectedUser1:  `old`,
+		},
+		{
+			name:           "fail on invalid line",
+			mode:           "fail",
+			body:           "{\"key\":\"user:2\",\"value\":2}\r\nnot json\n{\"key\":\"user:5\",\"value\":5}",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"processed":2,"created":1,"replaced":0,"skipped":0,"failed":1,"errors":[{"line":2,"error":"Incorrect body"}],"error":"line 2: Incorrect body"}`,
+			expectedUser1:  `old`,
+		},
+		{
+			name:           "invalid mode",
+			mode:           "merge",
+			body:           body,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   handlers.ErrInvalidImportMode + "\n",
+			expectedUser1:  `old`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mem := storage.NewMemoryRepository()
+			err := mem.AddValue("user:1", "old")
+			if err != nil {
+				t.Fatalf("AddValue: %v", err)
+			}
+			router := handlers.NewRouter(&handlers.Handler{
+				Repo:   mem,
+				Limits: handlers.Limits{MaxBodyBytes: 128},
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/kv/_import?mode="+tc.mode, strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tc.expectedStatus, w.Code)
+			}
+			if strings.TrimSpace(w.Body.String()) != strings.TrimSpace(tc.expectedBody) {
+				t.Errorf("Expected body %s, got %s", tc.expectedBody, w.Body.String())
+			}
+			data, err := mem.GetValue("user:1")
+			if err != nil {
+				t.Fatalf("GetValue: %v", err)
+			}
+			if user1 := fmt.Sprint(data[0].([]any)[1]); user1 != tc.expectedUser1 {
+				t.Errorf("Expected user:1 to be %s, got %s", tc.expectedUser1, user1)
+			}
+		})
+	}
+}
+
+func TestImportLargeBody(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	mem := storage.NewMemoryRepository()
+	router := handlers.NewRouter(&handlers.Handler{Repo: mem, Limits: handlers.Limits{MaxBodyBytes: 128}})
+
+	var body strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&body, "{\"key\":\"k%03d\",\"value\":%d}\n", i, i)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/kv/_import", strings.NewReader(body.String()))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	expected := `{"processed":100,"created":100,"replaced":0,"skipped":0,"failed":0}`
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != expected {
+		t.Errorf("Expected 200 %s, got %d %s", expected, w.Code, w.Body.String())
+	}
+}
+
+func TestImportUnavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	mockRepo := mocks.NewMockKvRepository(ctrl)
+	router := handlers.NewRouter(&handlers.Handler{Repo: mockRepo})
+
+	gomock.InOrder(
+		mockRepo.EXPECT().PutValue("k1", int64(1)).Return(true, nil),
+		mockRepo.EXPECT().PutValue("k2", int64(2)).Return(false, resilience.ErrCircuitOpen),
+	)
+	body := "{\"key\":\"k1\",\"value\":1}\n{\"key\":\"k2\",\"value\":2}\n{\"key\":\"k3\",\"value\":3}\n"
+	req := httptest.NewRequest(http.MethodPost, "/kv/_import?mode=overwrite", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	expected := `{"processed":2,"created":1,"replaced":0,"skipped":0,"failed":0,"error":"Storage is temporarily unavailable"}`
+	if w.Code != http.StatusServiceUnavailable || strings.TrimSpace(w.Body.String()) != expected {
+		t.Errorf("Expected 503 %s, got %d %s", expected, w.Code, w.Body.String())
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected Retry-After")
+	}
+}
+
+func TestImportStream(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		mode     string
+		existing string
+		expected []string
+	}{
+		{
+			name: "progress and summary",
+			mode: "skip",
+			expected: []string{
+				`{"processed":1000,"created":1000,"replaced":0,"skipped":0,"failed":0,"done":false}`,
+				`{"processed":2000,"created":2000,"replaced":0,"skipped":0,"failed":0,"done":false}`,
+				`{"processed":2500,"created":2500,"replaced":0,"skipped":0,"failed":0,"done":true,"status":200}`,
+			},
+		},
+		{
+			name:     "status of a stopped import",
+			mode:     "fail",
+			existing: "k1500",
+			expected: []string{
+				`{"processed":1000,"created":1000,"replaced":0,"skipped":0,"failed":0,"done":false}`,
+				`{"processed":1501,"created":1500,"replaced":0,"skipped":0,"failed":1,"errors":[{"line":1501,"key":"k1500","error":"Key already exists"}],"error":"line 1501: Key already exists","done":true,"status":409}`,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mem := storage.NewMemoryRepository()
+			if tc.existing != "" {
+				err := mem.AddValue(tc.existing, "old")
+				if err != nil {
+					t.Fatalf("AddValue: %v", err)
+				}
+			}
+			router := handlers.NewRouter(&handlers.Handler{Repo: mem})
+
+			var body strings.Builder
+			for i := 0; i < 2500; i++ {
+				fmt.Fprintf(&body, "{\"key\":\"k%04d\",\"value\":%d}\n", i, i)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/kv/_import?mode="+tc.mode, strings.NewReader(body.String()))
+			req.Header.Set("Accept", handlers.NDJSONContentType)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK || w.Header().Get("Content-Type") != handlers.NDJSONContentType {
+				t.Errorf("Expected a 200 NDJSON stream, got %d %s", w.Code, w.Header().Get("Content-Type"))
+			}
+			lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+			if strings.Join(lines, "\n") != strings.Join(tc.expected, "\n") {
+				t.Errorf("Expected lines\n%s\ngot\n%s", strings.Join(tc.expected, "\n"), strings.Join(lines, "\n"))
+			}
+		})
+	}
+}
+
+func TestImportAudit(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	sink, err := audit.OpenFile(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer sink.Close()
+	mem := storage.NewMemoryRepository()
+	err = mem.AddValue("k1", "old")
+	if err != nil {
+		t.Fatalf("AddValue: %v", err)
+	}
+	router := handlers.NewRouter(&handlers.Handler{
+		Repo:     mem,
+		Metadata: mem,
+		Audit:    &handlers.Audit{Logger: audit.NewLogger(sink, true)},
+	})
+
+	body := "{\"key\":\"k1\",\"value\":1}\n{\"key\":\"k2\",\"value\":2}\n"
+	req := httptest.NewRequest(http.MethodPost, "/kv/_import?mode=overwrite", strings.NewReader(body))
+	req.Header.Set(handlers.RequestIDHeader, "import-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", w.Code, w.Body.String())
+	}
+
+	records, err := sink.Query(audit.Query{})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var actual []string
+	for _, record := range records {
+		actual = append(actual, fmt.Sprintf("%s %s %s %s>%s", record.RequestID, record.Operation,
+			record.Key, string(record.Before), string(record.After)))
+	}
+	expected := []string{`import-1 update k1 "old">1`, `import-1 add k2 >2`}
+	if strings.Join(actual, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Expected records %v, got %v", expected, actual)
+	}
+	for _, key := range []string{"k1", "k2"} {
+		data, err := mem.GetValue(key)
+		if err != nil {
+			t.Fatalf("GetValue: %v", err)
+		}
+		meta := storage.TupleMetadata(data[0].([]any))
+		if meta.Writer != records[0].Principal {
+			t.Errorf("Expected %s to be written by %q, got %q", key, records[0].Principal, meta.Writer)
+		}
+	}
+}
@@ -1,9 +1,40 @@
 package handlers
 
 const (
-	ErrIncorrectBody   string = "Incorrect body"
-	ErrKeyExists       string = "Key already exists"
-	ErrInternalServer  string = "Internal server error"
-	ErrKeyIsNotAString string = "Key is not a string"
-	ErrReadReqBody     string = "Failed to read request body"
+	ErrIncorrectBody     string = "Incorrect body"
+	ErrKeyExists         string = "Key already exists"
+	ErrInternalServer    string = "Internal server error"
+	ErrKeyIsNotAString   string = "Key is not a string"
+	ErrReadReqBody       string = "Failed to read request body"
+	ErrEmptyKey          string = "Key is empty"
+	ErrKeyTooLong        string = "Key is too long"
+	ErrInvalidKey        string = "Key must be valid UTF-8 without control characters"
+	ErrReservedKey       string = "Key is reserved for an API endpoint"
+	ErrInvalidPath       string = "Invalid escape in path"
+	ErrKeyMismatch       string = "Key in body does not match key in path"
+	ErrBatchSize         string = "Invalid number of keys"
+	ErrSchemaMismatch    string = "Value does not match schema"
+	ErrInvalidSchema     string = "Invalid schema"
+	ErrSchemaNotFound    string = "Schema not found"
+	ErrIndexNotFound     string = "Index not found"
+	ErrInvalidIndex      string = "Invalid index definition"
+	ErrInvalidQuery      string = "Invalid query"
+	ErrUnavailable       string = "Storage is temporarily unavailable"
+	ErrRateLimited       string = "Too many requests"
+	ErrQuotaExceeded     string = "Namespace quota exceeded"
+	ErrBodyTooLarge      string = "Request body too large"
+	ErrValueTooLarge     string = "Value too large"
+	ErrValueTooDeep      string = "Value nested too deep"
+	ErrUnauthenticated   string = "Missing or invalid API key"
+	ErrAdminRequired     string = "Missing or invalid admin API key"
+	ErrInvalidWatch      string = "Exactly one of key and prefix must be set"
+	ErrWatchTooLarge     string = "Too many entries under the watched prefix"
+	ErrTooManyWatches    string = "Too many watch streams"
+	ErrInvalidImportMode string = "Import mode must be skip, overwrite or fail"
+	ErrBackupNotFound    string = "Backup not found"
+	ErrBackupInProgress  string = "Another backup or restore is running"
+	ErrRestoreNotEmpty   string = "Restore requires empty storage"
+	ErrBackupCorrupt     string = "Backup checksum mismatch"
+	ErrRevisionNotFound  string = "Revision not found"
+	ErrRevisionDeleted   string = "Revision records a deletion"
 )
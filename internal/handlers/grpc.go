@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"kvManager/internal/audit"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+	"kvManager/pkg/kvpb"
+)
+
+// DefaultWatchInterval is how often Watch polls the storage when
+// GRPCConfig does not set WatchInterval.
+const DefaultWatchInterval = time.Second
+
+// Defaults of the Watch bounds in GRPCConfig. Every watch rescans its
+// entries each interval, so they bound the load watches put on storage.
+const (
+	DefaultMaxWatchEntries = 10000
+	DefaultMaxWatchStreams = 100
+)
+
+// watchPageSize is the number of entries read per scan while watching a
+// prefix.
+const watchPageSize uint32 = 1000
+
+// GRPCConfig configures the gRPC API.
+type GRPCConfig struct {
+	// APIKeys are accepted in the x-api-key or authorization metadata.
+	// Authentication is disabled when empty.
+	APIKeys []string
+	// WatchInterval is how often Watch polls the storage for changes.
+	WatchInterval time.Duration
+	// MaxWatchEntries ends a watch whose prefix holds more entries.
+	MaxWatchEntries int
+	// MaxWatchStreams is how many watches may run at once.
+	MaxWatchStreams int
+}
+
+// NewGRPCServer returns a gRPC server exposing the key-value operations
+// of handler. It applies the same key checks, limits, schemas, quotas and
+// rate limits as the HTTP API.
+func NewGRPCServer(handler *Handler, cfg GRPCConfig, opts ...grpc.ServerOption) *grpc.Server {
+	interceptors := newGRPCInterceptors(handler, cfg)
+	opts = append([]grpc.ServerOption{
+		grpc.MaxRecvMsgSize(int(handler.limits().MaxBodyBytes)),
+		grpc.ChainUnaryInterceptor(interceptors.unary...),
+		grpc.ChainStreamInterceptor(interceptors.stream...),
+	}, opts...)
+
+	if cfg.MaxWatchEntries <= 0 {
+		cfg.MaxWatchEntries = DefaultMaxWatchEntries
+	}
+	if cfg.MaxWatchStreams <= 0 {
+		cfg.MaxWatchStreams = DefaultMaxWatchStreams
+	}
+
+	server := grpc.NewServer(opts...)
+	kvpb.RegisterKVServer(server, &kvService{
+		handler: handler,
+		cfg:     cfg,
+		watches: make(chan struct{}, cfg.MaxWatchStreams),
+	})
+	return server
+}
+
+type kvService struct {
+	kvpb.UnimplementedKVServer
+	handler *Handler
+	cfg     GRPCConfig
+	// watches holds a token for every running Watch.
+	watches chan struct{}
+}
+
+func (svc *kvService) Get(ctx context.Context, req *kvpb.GetRequest) (*kvpb.GetResponse, error) {
+	if err := svc.handler.keyError(req.GetKey()); err != nil {
+		return nil, grpcError(err)
+	}
+
+	log.Logger.Debugw("Try to get value", "key", req.GetKey())
+	data, err := svc.handler.Repo.GetValue(req.GetKey())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	value, err := svc.handler.encodeValue(data[0].([]any)[1])
+	if err != nil {
+		log.Logger.Errorw("Converting value failed", "key", req.GetKey(), "error", err.Error())
+		return nil, status.Error(codes.Internal, ErrKeyIsNotAString)
+	}
+	return &kvpb.GetResponse{Value: value}, nil
+}
+
+func (svc *kvService) Add(ctx context.Context, req *kvpb.AddRequest) (*kvpb.AddResponse, error) {
+	value, err := svc.handler.parseGRPCValue(req.GetKey(), req.GetValue(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Logger.Debugw("Try to add value", "key", req.GetKey())
+	writer := svc.handler.grpcWriter(ctx)
+	err = svc.handler.writeRepo(storage.Annotation{Writer: writer}).AddValue(req.GetKey(), value)
+	if isUnavailable(err) {
+		return nil, grpcError(err)
+	}
+	if err != nil {
+		log.Logger.Warnw("Falied to add value", "key", req.GetKey(), "error", err.Error())
+		return nil, status.Error(codes.AlreadyExists, ErrKeyExists)
+	}
+	svc.handler.auditGRPC(ctx, audit.OpAdd, req.GetKey(), nil, value)
+	return &kvpb.AddResponse{}, nil
+}
+
+func (svc *kvService) Update(ctx context.Context, req *kvpb.UpdateRequest) (*kvpb.UpdateResponse, error) {
+	value, err := svc.handler.parseGRPCValue(req.GetKey(), req.GetValue(), true)
+	if err != nil {
+		return nil, err
+	}
+
+	before := svc.handler.auditBefore(req.GetKey())
+	writer := svc.handler.grpcWriter(ctx)
+	if req.GetUpsert() {
+		log.Logger.Debugw("Try to upsert value", "key", req.GetKey())
+		created, err := svc.handler.writeRepo(storage.Annotation{Writer: writer}).PutValue(req.GetKey(), value)
+		if err != nil {
+			return nil, grpcError(err)
+		}
+		op := audit.OpUpdate
+		if created {
+			op, before = audit.OpAdd, nil
+		}
+		svc.handler.auditGRPC(ctx, op, req.GetKey(), before, value)
+		return &kvpb.UpdateResponse{Created: created}, nil
+	}
+
+	log.Logger.Debugw("Try to update value", "key", req.GetKey())
+	err = svc.handler.writeRepo(storage.Annotation{Writer: writer}).UpdateValue(req.GetKey(), value)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	svc.handler.auditGRPC(ctx, audit.OpUpdate, req.GetKey(), before, value)
+	return &kvpb.UpdateResponse{}, nil
+}
+
+func (svc *kvService) Delete(ctx context.Context, req *kvpb.DeleteRequest) (*kvpb.DeleteResponse, error) {
+	if err := svc.handler.keyError(req.GetKey()); err != nil {
+		return nil, grpcError(err)
+	}
+
+	before := svc.handler.auditBefore(req.GetKey())
+	log.Logger.Debugw("Try to delete value", "key", req.GetKey())
+	err := svc.handler.Repo.DeleteValue(req.GetKey())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	svc.handler.auditGRPC(ctx, audit.OpDelete, req.GetKey(), before, nil)
+	return &kvpb.DeleteResponse{}, nil
+}
+
+// parseGRPCValue runs the checks the HTTP API applies to a written value
+// and decodes it.
+func (handler *Handler) parseGRPCValue(key string, raw []byte, replace bool) (any, error) {
+	value, err := handler.checkedValue(key, raw, replace)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return value, nil
+}
+
+// Watch polls the watched key or prefix every WatchInterval and sends an
+// event for every entry that appeared, changed or disappeared since the
+// previous poll. Storage errors and prefixes that grow past
+// MaxWatchEntries end the stream; watches over MaxWatchStreams are
+// refused with RESOURCE_EXHAUSTED.
+func (svc *kvService) Watch(req *kvpb.WatchRequest, stream kvpb.KV_WatchServer) error {
+	if (req.GetKey() == "") == (req.GetPrefix() == "") {
+		return status.Error(codes.InvalidArgument, ErrInvalidWatch)
+	}
+	if req.GetKey() != "" {
+		if err := svc.handler.keyError(req.GetKey()); err != nil {
+			return grpcError(err)
+		}
+	}
+	select {
+	case svc.watches <- struct{}{}:
+		defer func() { <-svc.watches }()
+	default:
+		log.Logger.Warnw("Too many watch streams", "max", svc.cfg.MaxWatchStreams)
+		return status.Error(codes.ResourceExhausted, ErrTooManyWatches)
+	}
+	interval := svc.cfg.WatchInterval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	previous := map[string][]byte{}
+	if !req.GetSendInitial() {
+		var err error
+		previous, err = svc.snapshot(req)
+		if err != nil {
+			return grpcError(err)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	wait := !req.GetSendInitial()
+	for {
+		if wait {
+			select {
+			case <-stream.Context().Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+		wait = true
+
+		current, err := svc.snapshot(req)
+		if err != nil {
+			return grpcError(err)
+		}
+		for _, event := range watchEvents(previous, current) {
+			err = stream.Send(event)
+			if err != nil {
+				return err
+			}
+		}
+		previous = current
+	}
+}
+
+// snapshot returns the JSON encoded values of the watched entries.
+func (svc *kvService) snapshot(req *kvpb.WatchRequest) (map[string][]byte, error) {
+	entries := make(map[string][]byte)
+	if req.GetKey() != "" {
+		data, err := svc.handler.Repo.GetValue(req.GetKey())
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries[req.GetKey()], err = svc.handler.encodeValue(data[0].([]any)[1])
+		return entries, err
+	}
+
+	query := storage.ScanQuery{Prefix: req.GetPrefix(), Limit: watchPageSize}
+	for {
+		tuples, err := svc.handler.Repo.ScanValues(query)
+		if err != nil {
+			return nil, err
+		}
+		items, err := svc.handler.tuplesToItems(tuples)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries)+len(items) > svc.cfg.MaxWatchEntries {
+			log.Logger.Warnw("Watched prefix too large", "prefix", req.GetPrefix(),
+				"max", svc.cfg.MaxWatchEntries)
+			return nil, &apiError{Status: http.StatusForbidden, Message: ErrWatchTooLarge}
+		}
+		for _, item := range items {
+			entries[item.Key], err = svc.handler.encodeValue(item.Value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if uint32(len(items)) < watchPageSize {
+			return entries, nil
+		}
+		query.After = items[len(items)-1].Key
+	}
+}
+
+// watchEvents returns the events turning previous into current in key
+// order.
+func watchEvents(previous map[string][]byte, current map[string][]byte) []*kvpb.WatchEvent {
+	var events []*kvpb.WatchEvent
+	for key, value := range current {
+		if old, ok := previous[key]; !ok || !bytes.Equal(old, value) {
+			events = append(events, &kvpb.WatchEvent{Type: kvpb.WatchEvent_TYPE_PUT, Key: key, Value: value})
+		}
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			events = append(events, &kvpb.WatchEvent{Type: kvpb.WatchEvent_TYPE_DELETE, Key: key})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Key < events[j].Key })
+	return events
+}
+
+// grpcError converts request and storage errors into gRPC status errors
+// with the codes matching the HTTP statuses of the same failures.
+func grpcError(err error) error {
+	var reqErr *apiError
+	switch {
+	case errors.As(err, &reqErr):
+		return status.Error(grpcCode(reqErr.Status), reqErr.Error())
+	case isUnavailable(err):
+		return status.Error(codes.Unavailable, ErrUnavailable)
+	case errors.Is(err, storage.ErrKeyNotFound):
+		return status.Error(codes.NotFound, storage.ErrKeyNotFound.Error())
+	}
+	log.Logger.Errorw("Internal server error", "error", err.Error())
+	return status.Error(codes.Internal, ErrInternalServer)
+}
+
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
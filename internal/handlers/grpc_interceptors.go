@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"kvManager/internal/pkg/log"
+)
+
+type grpcInterceptors struct {
+	unary  []grpc.UnaryServerInterceptor
+	stream []grpc.StreamServerInterceptor
+}
+
+// newGRPCInterceptors returns the logging, authentication and rate limit
+// interceptors, in that order, for both unary and streaming calls.
+func newGRPCInterceptors(handler *Handler, cfg GRPCConfig) grpcInterceptors {
+	checks := []func(ctx context.Context, req any) error{}
+	if len(cfg.APIKeys) > 0 {
+		checks = append(checks, func(ctx context.Context, _ any) error {
+			return authenticate(ctx, cfg.APIKeys)
+		})
+	}
+	if handler.RateLimit != nil {
+		checks = append(checks, handler.RateLimit.allowGRPC)
+	}
+
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		log.Logger.Infow("gRPC request started", "method", info.FullMethod)
+		for _, check := range checks {
+			if err := check(ctx, req); err != nil {
+				logGRPCResult(info.FullMethod, start, err)
+				return nil, err
+			}
+		}
+		resp, err := next(ctx, req)
+		logGRPCResult(info.FullMethod, start, err)
+		return resp, err
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, next grpc.StreamHandler) error {
+		start := time.Now()
+		log.Logger.Infow("gRPC stream started", "method", info.FullMethod)
+		for _, check := range checks {
+			if err := check(ss.Context(), nil); err != nil {
+				logGRPCResult(info.FullMethod, start, err)
+				return err
+			}
+		}
+		err := next(srv, ss)
+		logGRPCResult(info.FullMethod, start, err)
+		return err
+	}
+	return grpcInterceptors{
+		unary:  []grpc.UnaryServerInterceptor{unary},
+		stream: []grpc.StreamServerInterceptor{stream},
+	}
+}
+
+func logGRPCResult(method string, start time.Time, err error) {
+	code := status.Code(err)
+	fields := []any{"method", method, "grpc_code", code.String(), "duration", time.Since(start)}
+	switch code {
+	case codes.OK, codes.Canceled:
+		log.Logger.Infow("gRPC request finished", fields...)
+	case codes.Internal, codes.Unknown:
+		log.Logger.Errorw("gRPC request failed", append(fields, "error", err.Error())...)
+	default:
+		log.Logger.Warnw("gRPC request failed", append(fields, "error", err.Error())...)
+	}
+}
+
+// apiKeyFromContext returns the key from the x-api-key metadata or from a
+// bearer authorization.
+func apiKeyFromContext(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(strings.ToLower(APIKeyHeader)); len(values) > 0 {
+		return values[0]
+	}
+	if values := md.Get("authorization"); len(values) > 0 {
+		if token, ok := strings.CutPrefix(values[0], "Bearer "); ok {
+			return token
+		}
+	}
+	return ""
+}
+
+func authenticate(ctx context.Context, apiKeys []string) error {
+	apiKey := apiKeyFromContext(ctx)
+	if apiKey != "" {
+		for _, valid := range apiKeys {
+			if subtle.ConstantTimeCompare([]byte(apiKey), []byte(valid)) == 1 {
+				return nil
+			}
+		}
+	}
+	return status.Error(codes.Unauthenticated, ErrUnauthenticated)
+}
+
+// allowGRPC applies the rate limit of the client. Streams are limited when
+// they start, before their request is read, so they count by API key or IP.
+func (cfg *RateLimit) allowGRPC(ctx context.Context, req any) error {
+	keyReq, hasKey := req.(interface{ GetKey() string })
+	key := ""
+	if hasKey {
+		key = keyReq.GetKey()
+	}
+	client := cfg.clientName(apiKeyFromContext(ctx), key, hasKey, func() string { return peerIP(ctx) })
+
+	result := cfg.Limiter.Allow(client)
+	if result.Allowed {
+		return nil
+	}
+	log.Logger.Warnw("Rate limit exceeded", "client", client)
+	err := grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(ceilSeconds(result.RetryAfter))))
+	if err != nil {
+		log.Logger.Warnw("Failed to set retry-after header", "error", err)
+	}
+	return status.Error(codes.ResourceExhausted, ErrRateLimited)
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,349 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"kvManager/internal/handlers"
+	"kvManager/internal/mocks"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/pkg/resilience"
+	"kvManager/internal/storage"
+	"kvManager/pkg/kvpb"
+)
+
+// dialGRPC serves handler over an in-memory listener and returns a client
+// connected to it.
+func dialGRPC(t *testing.T, handler *handlers.Handler, cfg handlers.GRPCConfig) kvpb.KVClient {
+	t.Helper()
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	server := handlers.NewGRPCServer(handler, cfg)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return kvpb.NewKVClient(conn)
+}
+
+func TestGRPCAPI(t *testing.T) {
+	mem := storage.NewMemoryRepository()
+	client := dialGRPC(t, &handlers.Handler{
+		Repo:   mem,
+		Usage:  mem,
+		Quotas: &handlers.Quotas{Namespaces: map[string]handlers.Quota{"small": {MaxKeys: 1}}},
+		Limits: handlers.Limits{MaxValueBytes: 64, MaxDepth: 2},
+	}, handlers.GRPCConfig{})
+	ctx := context.Background()
+
+	testCases := []struct {
+		name         string
+		call         func() (any, error)
+		expectedCode codes.Code
+		expected     string
+	}{
+		{
+			name: "add",
+			call: func() (any, error) {
+				return client.Add(ctx, &kvpb.AddRequest{Key: "user:1", Value: []byte(`{"n":12345678901234567890}`)})
+			},
+			expectedCode: codes.OK,
+		},
+		{
+			name: "add existing",
+			call: func() (any, error) {
+				return client.Add(ctx, &kvpb.AddRequest{Key: "user:1", Value: []byte(`1`)})
+			},
+			expectedCode: codes.AlreadyExists,
+		},
+		{
+			name: "get keeps number precision",
+			call: func() (any, error) {
+				resp, err := client.Get(ctx, &kvpb.GetRequest{Key: "user:1"})
+				return string(resp.GetValue()), err
+			},
+			expectedCode: codes.OK,
+			expected:     `{"n":12345678901234567890}`,
+		},
+		{
+			name: "update",
+			call: func() (any, error) {
+				return client.Update(ctx, &kvpb.UpdateRequest{Key: "user:1", Value: []byte(`"x"`)})
+			},
+			expectedCode: codes.OK,
+		},
+		{
+			name: "update missing",
+			call: func() (any, error) {
+				return client.Update(ctx, &kvpb.UpdateRequest{Key: "user:2", Value: []byte(`"x"`)})
+			},
+			expectedCode: codes.NotFound,
+		},
+		{
+			name: "upsert creates",
+			call: func() (any, error) {
+				resp, err := client.Update(ctx, &kvpb.UpdateRequest{Key: "user:2", Value: []byte(`2`), Upsert: true})
+				return resp.GetCreated(), err
+			},
+			expectedCode: codes.OK,
+			expected:     "true",
+		},
+		{
+			name: "delete",
+			call: func() (any, error) {
+				return client.Delete(ctx, &kvpb.DeleteRequest{Key: "user:2"})
+			},
+			expectedCode: codes.OK,
+		},
+		{
+			name: "get deleted",
+			call: func() (any, error) {
+				return client.Get(ctx, &kvpb.GetRequest{Key: "user:2"})
+			},
+			expectedCode: codes.NotFound,
+		},
+		{
+			name: "reserved key",
+			call: func() (any, error) {
+				return client.Add(ctx, &kvpb.AddRequest{Key: "_query", Value: []byte(`1`)})
+			},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name: "invalid json",
+			call: func() (any, error) {
+				return client.Add(ctx, &kvpb.AddRequest{Key: "user:3", Value: []byte(`{"a":`)})
+			},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name: "trailing data",
+			call: func() (any, error) {
+				return client.Add(ctx, &kvpb.AddRequest{Key: "user:3", Value: []byte(`1 2`)})
+			},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name: "value too large",
+			call: func() (any, error) {
+				return client.Add(ctx, &kvpb.AddRequest{Key: "user:3", Value: []byte(`"` + strings.Repeat("a", 100) + `"`)})
+			},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name: "value too deep",
+			call: func() (any, error) {
+				return client.Add(ctx, &kvpb.AddRequest{Key: "user:3", Value: []byte(`[[[1]]]`)})
+			},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name: "quota",
+			call: func() (any, error) {
+				_, err := client.Add(ctx, &kvpb.AddRequest{Key: "small:1", Value: []byte(`1`)})
+				if err != nil {
+					return nil, err
+				}
+				return client.Add(ctx, &kvpb.AddRequest{Key: "small:2", Value: []byte(`1`)})
+			},
+			expectedCode: codes.ResourceExhausted,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := tc.call()
+			if status.Code(err) != tc.expectedCode {
+				t.Fatalf("Expected code %s, got %v", tc.expectedCode, err)
+			}
+			if tc.expected != "" && fmt.Sprint(result) != tc.expected {
+				t.Errorf("Expected %s, got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestGRPCUnavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockKvRepository(ctrl)
+	client := dialGRPC(t, &handlers.Handler{Repo: mockRepo}, handlers.GRPCConfig{})
+
+	mockRepo.EXPECT().GetValue("k").Return(nil, resilience.ErrCircuitOpen).Times(1)
+	_, err := client.Get(context.Background(), &kvpb.GetRequest{Key: "k"})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected Unavailable, got %v", err)
+	}
+}
+
+func TestGRPCAuth(t *testing.T) {
+	mem := storage.NewMemoryRepository()
+	client := dialGRPC(t, &handlers.Handler{Repo: mem}, handlers.GRPCConfig{APIKeys: []string{"secret"}})
+
+	testCases := []struct {
+		name         string
+		md           metadata.MD
+		expectedCode codes.Code
+	}{
+		{name: "no key", md: metadata.MD{}, expectedCode: codes.Unauthenticated},
+		{name: "wrong key", md: metadata.Pairs("x-api-key", "wrong"), expectedCode: codes.Unauthenticated},
+		{name: "api key", md: metadata.Pairs("x-api-key", "secret"), expectedCode: codes.NotFound},
+		{name: "bearer", md: metadata.Pairs("authorization", "Bearer secret"), expectedCode: codes.NotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := metadata.NewOutgoingContext(context.Background(), tc.md)
+			_, err := client.Get(ctx, &kvpb.GetRequest{Key: "missing"})
+			if status.Code(err) != tc.expectedCode {
+				t.Errorf("Get: expected %s, got %v", tc.expectedCode, err)
+			}
+
+			if tc.expectedCode != codes.Unauthenticated {
+				return
+			}
+			stream, err := client.Watch(ctx, &kvpb.WatchRequest{Key: "missing"})
+			if err == nil {
+				_, err = stream.Recv()
+			}
+			if status.Code(err) != codes.Unauthenticated {
+				t.Errorf("Watch: expected Unauthenticated, got %v", err)
+			}
+		})
+	}
+}
+
+func TestGRPCWatch(t *testing.T) {
+	mem := storage.NewMemoryRepository()
+	client := dialGRPC(t, &handlers.Handler{Repo: mem}, handlers.GRPCConfig{WatchInterval: 10 * time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := mem.AddValue("user:1", "a")
+	if err != nil {
+		t.Fatalf("AddValue: %v", err)
+	}
+	err = mem.AddValue("zone:1", "z")
+	if err != nil {
+		t.Fatalf("AddValue: %v", err)
+	}
+
+	invalid, err := client.Watch(ctx, &kvpb.WatchRequest{Key: "a", Prefix: "b"})
+	if err == nil {
+		_, err = invalid.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Watch with key and prefix: expected InvalidArgument, got %v", err)
+	}
+
+	stream, err := client.Watch(ctx, &kvpb.WatchRequest{Prefix: "user:", SendInitial: true})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	expectEvent := func(eventType kvpb.WatchEvent_Type, key string, value string) {
+		t.Helper()
+		event, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		if event.GetType() != eventType || event.GetKey() != key || string(event.GetValue()) != value {
+			t.Fatalf("Expected %s %s %s, got %v", eventType, key, value, event)
+		}
+	}
+
+	expectEvent(kvpb.WatchEvent_TYPE_PUT, "user:1", `"a"`)
+	err = mem.UpdateValue("user:1", "b")
+	if err != nil {
+		t.Fatalf("UpdateValue: %v", err)
+	}
+	expectEvent(kvpb.WatchEvent_TYPE_PUT, "user:1", `"b"`)
+	err = mem.UpdateValue("zone:1", "y")
+	if err != nil {
+		t.Fatalf("UpdateValue: %v", err)
+	}
+	err = mem.DeleteValue("user:1")
+	if err != nil {
+		t.Fatalf("DeleteValue: %v", err)
+	}
+	expectEvent(kvpb.WatchEvent_TYPE_DELETE, "user:1", "")
+}
+
+func TestGRPCWatchLimits(t *testing.T) {
+	mem := storage.NewMemoryRepository()
+	client := dialGRPC(t, &handlers.Handler{Repo: mem}, handlers.GRPCConfig{
+		WatchInterval:   10 * time.Millisecond,
+		MaxWatchEntries: 2,
+		MaxWatchStreams: 1,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, key := range []string{"user:1", "user:2", "zone:1"} {
+		err := mem.AddValue(key, 1)
+		if err != nil {
+			t.Fatalf("AddValue: %v", err)
+		}
+	}
+
+	watchCtx, stop := context.WithCancel(ctx)
+	stream, err := client.Watch(watchCtx, &kvpb.WatchRequest{Prefix: "user:", SendInitial: true})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err = stream.Recv(); err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+	}
+
+	second, err := client.Watch(ctx, &kvpb.WatchRequest{Key: "zone:1"})
+	if err == nil {
+		_, err = second.Recv()
+	}
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Second watch: expected ResourceExhausted, got %v", err)
+	}
+
+	err = mem.AddValue("user:3", 1)
+	if err != nil {
+		t.Fatalf("AddValue: %v", err)
+	}
+	_, err = stream.Recv()
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Grown prefix: expected ResourceExhausted, got %v", err)
+	}
+	stop()
+
+	// The ended watch frees its slot.
+	third, err := client.Watch(ctx, &kvpb.WatchRequest{Prefix: "zone:", SendInitial: true})
+	if err == nil {
+		_, err = third.Recv()
+	}
+	if err != nil {
+		t.Errorf("Watch after the first ended: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+
+	"kvManager/internal/pkg/log"
+)
+
+// HealthReporter describes the state of a dependency for GET /health.
+type HealthReporter interface {
+	Health() (status any, healthy bool)
+}
+
+type HealthCheck struct {
+	Healthy bool `json:"healthy"`
+	Status  any  `json:"status"`
+}
+
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+// Health answers 200 when every reporter is healthy and 503 otherwise.
+func (handler *Handler) Health(w http.ResponseWriter, r *http.Request) {
+	resp := HealthResponse{Status: "ok", Checks: make(map[string]HealthCheck)}
+	status := http.StatusOK
+	for name, reporter := range handler.HealthChecks {
+		checkStatus, healthy := reporter.Health()
+		resp.Checks[name] = HealthCheck{Healthy: healthy, Status: checkStatus}
+		if !healthy {
+			resp.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	if status != http.StatusOK {
+		log.Logger.Warnw("Health check failed", "checks", resp.Checks,
+			"http_status", status)
+	}
+	handler.writeJSON(w, status, resp)
+}
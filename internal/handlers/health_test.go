@@ -0,0 +1,69 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kvManager/internal/handlers"
+	"kvManager/internal/pkg/log"
+)
+
+type staticHealth struct {
+	status  any
+	healthy bool
+}
+
+func (h staticHealth) Health() (any, bool) {
+	return h.status, h.healthy
+}
+
+func TestHealth(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Errorf("failed to initialize logger: %v", err)
+		return
+	}
+
+	testCases := []struct {
+		name           string
+		checks         map[string]handlers.HealthReporter
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "healthy",
+			checks: map[string]handlers.HealthReporter{
+				"tarantool": staticHealth{status: map[string]bool{"connected": true}, healthy: true},
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"ok","checks":{"tarantool":{"healthy":true,"status":{"connected":true}}}}`,
+		},
+		{
+			name: "master lost",
+			checks: map[string]handlers.HealthReporter{
+				"tarantool": staticHealth{status: "no master", healthy: false},
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   `{"status":"unavailable","checks":{"tarantool":{"healthy":false,"status":"no master"}}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := handlers.Handler{HealthChecks: tc.checks}
+			router := handlers.NewRouter(&handler)
+
+			req := httptest.NewRequest("GET", "/health", nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tc.expectedStatus, rr.Code)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("Expected body %s, got %s", tc.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+// RevisionResponse is a value a key had. Deleted revisions record the
+// removal of the key and have a null value.
+type RevisionResponse struct {
+	Revision  uint64    `json:"revision"`
+	Value     any       `json:"value"`
+	ChangedAt time.Time `json:"changed_at"`
+	Deleted   bool      `json:"deleted,omitempty"`
+}
+
+type HistoryResponse struct {
+	Revisions []RevisionResponse `json:"revisions"`
+	Next      uint64             `json:"next,omitempty"`
+}
+
+// GetHistory answers GET /kv/{id}/history?before=&limit= with the revisions
+// of the key newest first. next is the before of the following page.
+func (handler *Handler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("History request started", "method", r.Method, "path", r.URL.Path)
+	key, ok := handler.routeKey(w, r)
+	if !ok {
+		return
+	}
+	params := r.URL.Query()
+
+	query := storage.HistoryQuery{Key: key, Limit: storage.DefaultHistoryLimit}
+	var details []string
+	if params.Has("before") {
+		before, err := strconv.ParseUint(params.Get("before"), 10, 64)
+		if err != nil {
+			details = append(details, "before must be a revision")
+		}
+		query.Before = before
+	}
+	if params.Has("limit") {
+		limit, err := strconv.ParseUint(params.Get("limit"), 10, 32)
+		if err != nil || limit == 0 || limit > maxQueryLimit {
+			details = append(details, "limit must be between 1 and "+strconv.Itoa(maxQueryLimit))
+		}
+		query.Limit = uint32(limit)
+	}
+	if len(details) > 0 {
+		log.Logger.Warnw("Invalid history query", "errors", details, "http_status", http.StatusBadRequest)
+		handler.writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: ErrInvalidQuery, Details: details})
+		return
+	}
+
+	log.Logger.Debugw("Try to get history", "key", key, "before", query.Before)
+	revisions, err := handler.History.GetHistory(query)
+	if handler.checkError(w, err) {
+		return
+	}
+
+	resp := HistoryResponse{Revisions: make([]RevisionResponse, 0, len(revisions))}
+	for _, revision := range revisions {
+		converted, err := handler.revisionResponse(revision)
+		if err != nil {
+			log.Logger.Errorw("Converting revision failed", "key", key, "error", err.Error())
+			http.Error(w, ErrInternalServer, http.StatusInternalServerError)
+			return
+		}
+		resp.Revisions = append(resp.Revisions, converted)
+	}
+	if len(revisions) == int(query.Limit) {
+		resp.Next = revisions[len(revisions)-1].Revision
+	}
+	handler.writeJSON(w, http.StatusOK, resp)
+}
+
+// isRevisionRead reports whether a GET /kv/{id} asks for a past value.
+func isRevisionRead(params url.Values) bool {
+	return params.Has("revision") || params.Has("at")
+}
+
+// getRevision answers GET /kv/{id}?revision=N with revision N of the key
+// and GET /kv/{id}?at=TIME with the value it had at an RFC 3339 time.
+func (handler *Handler) getRevision(w http.ResponseWriter, r *http.Request, key string) {
+	revision, ok := handler.lookupRevision(w, r, key)
+	if !ok {
+		return
+	}
+	if revision.Deleted && r.URL.Query().Has("at") {
+		log.Logger.Warnw("Key was deleted at the given time", "key", key,
+			"revision", revision.Revision, "http_status", http.StatusNotFound)
+		http.Error(w, storage.ErrKeyNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	resp, err := handler.revisionResponse(revision)
+	if err != nil {
+		log.Logger.Errorw("Converting revision failed", "key", key, "error", err.Error())
+		http.Error(w, ErrInternalServer, http.StatusInternalServerError)
+		return
+	}
+	log.Logger.Infow("Get revision successful", "key", key, "revision", revision.Revision,
+		"http_status", http.StatusOK)
+	handler.writeJSON(w, http.StatusOK, resp)
+}
+
+// RestoreRevision answers POST /kv/{id}/restore?revision=N by writing the
+// value of revision N back as the current value, which drops any TTL and
+// becomes a new revision. The write goes through the schema and quota
+// checks like an upsert and answers 201 when the key was recreated.
+func (handler *Handler) RestoreRevision(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("Restore revision request started", "method", r.Method, "path", r.URL.Path)
+	key, ok := handler.routeKey(w, r)
+	if !ok {
+		return
+	}
+	if !r.URL.Query().Has("revision") {
+		log.Logger.Warnw("Restore without revision", "http_status", http.StatusBadRequest)
+		handler.writeJSON(w, http.StatusBadRequest,
+			ErrorResponse{Error: ErrInvalidQuery, Details: []string{"revision is required"}})
+		return
+	}
+	revision, ok := handler.lookupRevision(w, r, key)
+	if !ok {
+		return
+	}
+	if revision.Deleted {
+		log.Logger.Warnw("Revision records a deletion", "key", key, "revision", revision.Revision,
+			"http_status", http.StatusUnprocessableEntity)
+		http.Error(w, ErrRevisionDeleted, http.StatusUnprocessableEntity)
+		return
+	}
+
+	if !handler.validateValue(w, key, revision.Value) {
+		return
+	}
+	if !handler.checkQuota(w, key, revision.Value, true) {
+		return
+	}
+	handler.upsert(w, r, key, revision.Value, nil, handler.auditBefore(key))
+}
+
+// lookupRevision reads the revision selected by the revision or at query
+// parameter and answers 400 or 404 when there is none.
+func (handler *Handler) lookupRevision(w http.ResponseWriter, r *http.Request, key string) (storage.Revision, bool) {
+	params := r.URL.Query()
+	var details []string
+	var number uint64
+	var at time.Time
+	switch {
+	case handler.History == nil:
+		details = append(details, "history is not enabled")
+	case params.Has("revision") && params.Has("at"):
+		details = append(details, "revision and at are mutually exclusive")
+	case params.Has("revision"):
+		var err error
+		number, err = strconv.ParseUint(params.Get("revision"), 10, 64)
+		if err != nil || number == 0 {
+			details = append(details, "revision must be a positive number")
+		}
+	default:
+		var err error
+		at, err = time.Parse(time.RFC3339Nano, params.Get("at"))
+		if err != nil {
+			details = append(details, "at must be an RFC 3339 time")
+		}
+	}
+	if len(details) > 0 {
+		log.Logger.Warnw("Invalid revision query", "errors", details, "http_status", http.StatusBadRequest)
+		handler.writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: ErrInvalidQuery, Details: details})
+		return storage.Revision{}, false
+	}
+
+	var revision storage.Revision
+	var err error
+	if params.Has("revision") {
+		log.Logger.Debugw("Try to get revision", "key", key, "revision", number)
+		revision, err = handler.History.GetRevision(key, number)
+	} else {
+		log.Logger.Debugw("Try to get revision at time", "key", key, "at", at)
+		revision, err = handler.History.GetRevisionAt(key, at)
+	}
+	if errors.Is(err, storage.ErrRevisionNotFound) {
+		log.Logger.Warnw("Revision not found", "key", key, "http_status", http.StatusNotFound)
+		http.Error(w, ErrRevisionNotFound, http.StatusNotFound)
+		return storage.Revision{}, false
+	}
+	if handler.checkError(w, err) {
+		return storage.Revision{}, false
+	}
+	return revision, true
+}
+
+func (handler *Handler) revisionResponse(revision storage.Revision) (RevisionResponse, error) {
+	resp := RevisionResponse{
+		Revision:  revision.Revision,
+		ChangedAt: revision.ChangedAt,
+		Deleted:   revision.Deleted,
+	}
+	if revision.Deleted {
+		return resp, nil
+	}
+	value, err := handler.convertValue(revision.Value)
+	if err != nil {
+		return RevisionResponse{}, err
+	}
+	resp.Value = value
+	return resp, nil
+}
@@ -0,0 +1,100 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"kvManager/internal/handlers"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+func TestHistory(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	repo := storage.NewMemoryRepository().WithHistory(storage.HistoryConfig{Revisions: 3})
+	router := handlers.NewRouter(&handlers.Handler{Repo: repo, History: repo})
+	disabledRouter := handlers.NewRouter(&handlers.Handler{Repo: repo})
+
+	var between time.Time
+	changes := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{method: http.MethodPost, path: "/kv", body: `{"key":"user:1","value":1}`},
+		{method: http.MethodPut, path: "/kv/user:1", body: `{"value":2}`},
+		{method: http.MethodPut, path: "/kv/user:1", body: `{"value":3}`},
+		{method: http.MethodPut, path: "/kv/user:1", body: `{"value":3}`},
+		{method: http.MethodPut, path: "/kv/user:1", body: `{"value":4}`},
+		{method: http.MethodDelete, path: "/kv/user:1"},
+	}
+	for i, change := range changes {
+		if i == 4 {
+			time.Sleep(time.Millisecond)
+			between = time.Now()
+			time.Sleep(time.Millisecond)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(change.method, change.path, strings.NewReader(change.body)))
+		if w.Code >= http.StatusBadRequest {
+			t.Fatalf("%s %s: unexpected status %d", change.method, change.path, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/kv/user:1/history", nil))
+	var history handlers.HistoryResponse
+	err = json.Unmarshal(w.Body.Bytes(), &history)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(history.Revisions) != 3 || !history.Revisions[0].Deleted || history.Revisions[1].Revision != 4 ||
+		history.Revisions[2].Revision != 3 || history.Next != 0 {
+		t.Fatalf("Unexpected history %s", w.Body.String())
+	}
+
+	at := url.QueryEscape(between.Format(time.RFC3339Nano))
+	testCases := []struct {
+		name           string
+		router         http.Handler
+		method         string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "page", router: router, method: http.MethodGet, path: "/kv/user:1/history?before=5&limit=1", expectedStatus: http.StatusOK, expectedBody: `"next":4`},
+		{name: "invalid page", router: router, method: http.MethodGet, path: "/kv/user:1/history?limit=0", expectedStatus: http.StatusBadRequest, expectedBody: handlers.ErrInvalidQuery},
+		{name: "revision", router: router, method: http.MethodGet, path: "/kv/user:1?revision=3", expectedStatus: http.StatusOK, expectedBody: `"revision":3,"value":3`},
+		{name: "pruned revision", router: router, method: http.MethodGet, path: "/kv/user:1?revision=2", expectedStatus: http.StatusNotFound, expectedBody: handlers.ErrRevisionNotFound},
+		{name: "at", router: router, method: http.MethodGet, path: "/kv/user:1?at=" + at, expectedStatus: http.StatusOK, expectedBody: `"revision":3,"value":3`},
+		{name: "at after delete", router: router, method: http.MethodGet, path: "/kv/user:1?at=" + url.QueryEscape(time.Now().Format(time.RFC3339Nano)), expectedStatus: http.StatusNotFound, expectedBody: storage.ErrKeyNotFound.Error()},
+		{name: "revision and at", router: router, method: http.MethodGet, path: "/kv/user:1?revision=3&at=" + at, expectedStatus: http.StatusBadRequest, expectedBody: "mutually exclusive"},
+		{name: "restore deletion", router: router, method: http.MethodPost, path: "/kv/user:1/restore?revision=5", expectedStatus: http.StatusUnprocessableEntity, expectedBody: handlers.ErrRevisionDeleted},
+		{name: "restore", router: router, method: http.MethodPost, path: "/kv/user:1/restore?revision=4", expectedStatus: http.StatusCreated},
+		{name: "get restored", router: router, method: http.MethodGet, path: "/kv/user:1", expectedStatus: http.StatusOK, expectedBody: `{"value":4}`},
+		{name: "restore recorded", router: router, method: http.MethodGet, path: "/kv/user:1/history?limit=1", expectedStatus: http.StatusOK, expectedBody: `"revision":6,"value":4`},
+		{name: "disabled", router: disabledRouter, method: http.MethodGet, path: "/kv/user:1?revision=3", expectedStatus: http.StatusBadRequest, expectedBody: "history is not enabled"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tc.router.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tc.expectedStatus, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tc.expectedBody) {
+				t.Errorf("Expected body to contain %s, got %s", tc.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
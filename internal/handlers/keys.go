@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+
+	"kvManager/internal/pkg/log"
+)
+
+// MaxKeyLength is the default maximum key length in bytes.
+const MaxKeyLength = 1024
+
+// reservedKeys are the names of API endpoints under /kv, such as
+// /kv/_query, so they can not be used as keys. Other keys starting with
+// '_' are accepted.
+var reservedKeys = map[string]bool{
+	"_query":   true,
+	"_mget":    true,
+	"_mdelete": true,
+	"_export":  true,
+	"_import":  true,
+	"_trash":   true,
+}
+
+// validateKey returns a client facing message describing why key can not
+// be stored, or an empty string when it is acceptable.
+func validateKey(key string, maxLength int) string {
+	switch {
+	case key == "":
+		return ErrEmptyKey
+	case len(key) > maxLength:
+		return fmt.Sprintf("%s: maximum is %d bytes", ErrKeyTooLong, maxLength)
+	case !utf8.ValidString(key):
+		return ErrInvalidKey
+	case reservedKeys[key]:
+		return ErrReservedKey
+	}
+	for _, r := range key {
+		if unicode.IsControl(r) {
+			return ErrInvalidKey
+		}
+	}
+	return ""
+}
+
+// checkKey writes a 400 response when key is not acceptable.
+func (handler *Handler) checkKey(w http.ResponseWriter, key string) bool {
+	if err := handler.keyError(key); err != nil {
+		handler.writeAPIError(w, err)
+		return false
+	}
+	return true
+}
+
+// keyError returns a 400 error when key is not acceptable.
+func (handler *Handler) keyError(key string) *apiError {
+	msg := validateKey(key, handler.limits().MaxKeyLength)
+	if msg == "" {
+		return nil
+	}
+
+	log.Logger.Warnw("Invalid key", "key", key, "reason", msg)
+	return &apiError{Status: http.StatusBadRequest, Message: msg}
+}
+
+// routeVar returns the unescaped value of a path variable and whether the
+// route has it. The router matches on the encoded path, so keys may
+// contain '/', spaces or any other URL-encoded character.
+func routeVar(r *http.Request, name string) (string, bool, error) {
+	raw, ok := mux.Vars(r)[name]
+	if !ok {
+		return "", false, nil
+	}
+	value, err := url.PathUnescape(raw)
+	if err != nil {
+		log.Logger.Warnw("Failed to unescape path variable", "name", name,
+			"value", raw, "error", err)
+		return "", true, err
+	}
+	return value, true, nil
+}
+
+// pathVar returns the unescaped value of a path variable and writes a 400
+// response when it is not validly escaped.
+func pathVar(w http.ResponseWriter, r *http.Request, name string) (string, bool) {
+	value, _, err := routeVar(r, name)
+	if err != nil {
+		log.Logger.Warnw("Invalid path", "path", r.URL.Path, "http_status", http.StatusBadRequest)
+		http.Error(w, ErrInvalidPath, http.StatusBadRequest)
+		return "", false
+	}
+	return value, true
+}
+
+// routeKey extracts the key from the {id} path variable and validates it.
+func (handler *Handler) routeKey(w http.ResponseWriter, r *http.Request) (string, bool) {
+	key, ok := pathVar(w, r, "id")
+	if !ok || !handler.checkKey(w, key) {
+		return "", false
+	}
+	return key, true
+}
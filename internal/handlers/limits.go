@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"kvManager/internal/pkg/log"
+)
+
+// Limits bounds the size of requests. Zero fields take the defaults.
+type Limits struct {
+	// MaxBodyBytes is the largest request body read from a client.
+	MaxBodyBytes int64
+	// MaxValueBytes is the largest JSON encoded value.
+	MaxValueBytes int64
+	// MaxKeyLength is the longest key in bytes.
+	MaxKeyLength int
+	// MaxDepth is the deepest nesting of arrays and objects in a value.
+	MaxDepth int
+}
+
+// Default request limits.
+const (
+	DefaultMaxBodyBytes  int64 = 1 << 20
+	DefaultMaxValueBytes int64 = 1 << 20
+	DefaultMaxDepth      int   = 32
+)
+
+func (handler *Handler) limits() Limits {
+	limits := handler.Limits
+	if limits.MaxBodyBytes <= 0 {
+		limits.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if limits.MaxValueBytes <= 0 {
+		limits.MaxValueBytes = DefaultMaxValueBytes
+	}
+	if limits.MaxKeyLength <= 0 {
+		limits.MaxKeyLength = MaxKeyLength
+	}
+	if limits.MaxDepth <= 0 {
+		limits.MaxDepth = DefaultMaxDepth
+	}
+	return limits
+}
+
+// importPath streams bodies of any size, limiting each line instead.
+const importPath = "/kv/_import"
+
+// bodyLimitMiddleware stops reading request bodies after MaxBodyBytes.
+func (handler *Handler) bodyLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil && r.URL.Path != importPath {
+			r.Body = http.MaxBytesReader(w, r.Body, handler.limits().MaxBodyBytes)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkBodyTooLarge answers 413 when err comes from reading past the
+// body limit.
+func (handler *Handler) checkBodyTooLarge(w http.ResponseWriter, err error) bool {
+	var maxErr *http.MaxBytesError
+	if !errors.As(err, &maxErr) {
+		return false
+	}
+	log.Logger.Warnw("Request body too large", "limit", maxErr.Limit,
+		"http_status", http.StatusRequestEntityTooLarge)
+	handler.writeJSON(w, http.StatusRequestEntityTooLarge, ErrorResponse{
+		Error:   ErrBodyTooLarge,
+		Details: []string{fmt.Sprintf("maximum body size is %d bytes", maxErr.Limit)},
+	})
+	return true
+}
+
+// checkValueLimits answers 413 for values over MaxValueBytes and 422 for
+// values nested deeper than MaxDepth. raw is the JSON encoded value.
+func (handler *Handler) checkValueLimits(w http.ResponseWriter, raw []byte) bool {
+	if err := handler.valueLimitsError(raw); err != nil {
+		handler.writeAPIError(w, err)
+		return false
+	}
+	return true
+}
+
+// valueLimitsError returns the error checkValueLimits answers with.
+func (handler *Handler) valueLimitsError(raw []byte) *apiError {
+	limits := handler.limits()
+	if int64(len(raw)) > limits.MaxValueBytes {
+		log.Logger.Warnw("Value too large", "size", len(raw), "limit", limits.MaxValueBytes)
+		return &apiError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: ErrValueTooLarge,
+			Details: []string{fmt.Sprintf("value is %d bytes, maximum is %d",
+				len(raw), limits.MaxValueBytes)},
+		}
+	}
+	if jsonDepthExceeds(raw, limits.MaxDepth) {
+		log.Logger.Warnw("Value nested too deep", "limit", limits.MaxDepth)
+		return &apiError{
+			Status:  http.StatusUnprocessableEntity,
+			Message: ErrValueTooDeep,
+			Details: []string{fmt.Sprintf("maximum nesting depth is %d", limits.MaxDepth)},
+		}
+	}
+	return nil
+}
+
+// jsonDepthExceeds reports whether arrays and objects in data are nested
+// deeper than max. It scans the raw bytes, so the check happens before the
+// decoder recurses into the value.
+func jsonDepthExceeds(data []byte, max int) bool {
+	depth := 0
+	inString := false
+	escaped := false
+	for _, c := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '[', '{':
+			depth++
+			if depth > max {
+				return true
+			}
+		case ']', '}':
+			depth--
+		}
+	}
+	return false
+}
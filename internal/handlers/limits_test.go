@@ -0,0 +1,131 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+
+	"kvManager/internal/handlers"
+	"kvManager/internal/mocks"
+	"kvManager/internal/pkg/log"
+)
+
+func TestRequestLimits(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	err := log.SetupLogger()
+	if err != nil {
+		t.Errorf("failed to initialize logger: %v", err)
+		return
+	}
+	mockRepo := mocks.NewMockKvRepository(ctrl)
+
+	router := handlers.NewRouter(&handlers.Handler{
+		Repo: mockRepo,
+		Limits: handlers.Limits{
+			MaxBodyBytes:  200,
+			MaxValueBytes: 50,
+			MaxKeyLength:  8,
+			MaxDepth:      3,
+		},
+	})
+
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		mockSetup      func()
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:   "value within limits",
+			method: "POST",
+			path:   "/kv/ok",
+			body:   `{"value":{"a":[{"b":"` + strings.Repeat("x", 30) + `"}]}}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().AddValue("ok", gomock.Any()).Return(nil).Times(1)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "body too large",
+			method:         "POST",
+			path:           "/kv/big",
+			body:           `{"value":"` + strings.Repeat("x", 300) + `"}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedError:  handlers.ErrBodyTooLarge,
+		},
+		{
+			name:           "value too large",
+			method:         "PUT",
+			path:           "/kv/big",
+			body:           `{"value":"` + strings.Repeat("x", 60) + `"}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedError:  handlers.ErrValueTooLarge,
+		},
+		{
+			name:           "value nested too deep",
+			method:         "POST",
+			path:           "/kv/deep",
+			body:           `{"value":[[[["x"]]]]}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedError:  handlers.ErrValueTooDeep,
+		},
+		{
+			name:   "brackets inside strings are not nesting",
+			method: "POST",
+			path:   "/kv/str",
+			body:   `{"value":["[[[[{{{{\"]]"]}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().AddValue("str", []any{`[[[[{{{{"]]`}).Return(nil).Times(1)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "key too long",
+			method:         "POST",
+			path:           "/kv",
+			body:           `{"key":"longer_than_8","value":1}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "batch body too large",
+			method:         "POST",
+			path:           "/kv/_mget",
+			body:           `{"keys":["` + strings.Repeat("k", 300) + `"]}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedError:  handlers.ErrBodyTooLarge,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.mockSetup != nil {
+				tc.mockSetup()
+			}
+
+			req := httptest.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedError == "" {
+				return
+			}
+			var resp handlers.ErrorResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &resp)
+			if err != nil || resp.Error != tc.expectedError || len(resp.Details) == 0 {
+				t.Errorf("Unexpected error response %s", rr.Body.String())
+			}
+		})
+	}
+}
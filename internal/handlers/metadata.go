@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"kvManager/internal/audit"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+// MetaResponse describes a stored entry. Times that are not known, like
+// the creation of keys written before metadata was kept, are omitted.
+type MetaResponse struct {
+	Key       string            `json:"key"`
+	CreatedAt *time.Time        `json:"created_at,omitempty"`
+	UpdatedAt *time.Time        `json:"updated_at,omitempty"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+	Size      int64             `json:"size"`
+	Writer    string            `json:"writer,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// GetMeta answers GET /kv/{id}/meta with the metadata of the key.
+func (handler *Handler) GetMeta(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("Get metadata request started", "method", r.Method, "path", r.URL.Path)
+	key, ok := handler.routeKey(w, r)
+	if !ok {
+		return
+	}
+
+	log.Logger.Debugw("Try to get metadata", "key", key)
+	data, err := handler.Repo.GetValue(key)
+	if handler.checkError(w, err) {
+		return
+	}
+
+	meta := storage.TupleMetadata(data[0].([]any))
+	resp := MetaResponse{
+		Key:       key,
+		CreatedAt: optionalTime(meta.CreatedAt),
+		UpdatedAt: optionalTime(meta.UpdatedAt),
+		ExpiresAt: optionalTime(meta.ExpiresAt),
+		Size:      meta.Size,
+		Writer:    meta.Writer,
+		Labels:    meta.Labels,
+	}
+	log.Logger.Infow("Get metadata successful", "key", key, "http_status", http.StatusOK)
+	handler.writeJSON(w, http.StatusOK, resp)
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// notModified sets Last-Modified from meta and answers 304 when the value
+// did not change since If-Modified-Since.
+func notModified(w http.ResponseWriter, r *http.Request, meta storage.Metadata) bool {
+	if meta.UpdatedAt.IsZero() {
+		return false
+	}
+	modified := meta.UpdatedAt.Truncate(time.Second)
+	w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modified.After(since) {
+		return false
+	}
+	log.Logger.Infow("Value not modified", "path", r.URL.Path, "http_status", http.StatusNotModified)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// writeRepo returns the repository a write goes through: the view of
+// Metadata that stores annotation along with the value, or Repo when the
+// storage keeps no metadata.
+func (handler *Handler) writeRepo(annotation storage.Annotation) storage.KvRepository {
+	if handler.Metadata == nil {
+		return handler.Repo
+	}
+	return handler.Metadata.Annotated(annotation)
+}
+
+// writeVersions is writeRepo for writes by version.
+func (handler *Handler) writeVersions(annotation storage.Annotation) storage.VersionRepository {
+	if handler.Metadata == nil {
+		return handler.Versions
+	}
+	return handler.Metadata.Annotated(annotation)
+}
+
+// httpActor returns who the writes of r are annotated and audited as.
+func (handler *Handler) httpActor(r *http.Request) audit.Actor {
+	if handler.Audit != nil {
+		return handler.Audit.httpActor(r)
+	}
+	return audit.Actor{Principal: apiKeyPrincipal(r.Header.Get(APIKeyHeader))}
+}
+
+// grpcWriter returns the principal of a gRPC call, the writer of the
+// values it stores.
+func (handler *Handler) grpcWriter(ctx context.Context) string {
+	if handler.Audit != nil {
+		return handler.Audit.grpcActor(ctx).Principal
+	}
+	return apiKeyPrincipal(apiKeyFromContext(ctx))
+}
@@ -0,0 +1,132 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"kvManager/internal/handlers"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+func TestMetadata(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	repo := storage.NewMemoryRepository()
+	router := handlers.NewRouter(&handlers.Handler{Repo: repo, Metadata: repo})
+
+	later := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	earlier := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		header         http.Header
+		expectedStatus int
+		expectedBody   string
+		expectedHeader string
+	}{
+		{name: "add with labels", method: http.MethodPost, path: "/kv/user:1", body: `{"value":{"id":1},"labels":{"team":"core"}}`,
+			header: http.Header{handlers.APIKeyHeader: {"secret"}}, expectedStatus: http.StatusCreated},
+		{name: "meta", method: http.MethodGet, path: "/kv/user:1/meta", expectedStatus: http.StatusOK,
+			expectedBody: `"size":5,"writer":"api_key:`},
+		{name: "update keeps labels", method: http.MethodPut, path: "/kv/user:1", body: `{"value":{"id":2}}`, expectedStatus: http.StatusOK},
+		{name: "meta after update", method: http.MethodGet, path: "/kv/user:1/meta", expectedStatus: http.StatusOK,
+			expectedBody: `"writer":"anonymous","labels":{"team":"core"}`},
+		{name: "invalid labels", method: http.MethodPut, path: "/kv/user:1", body: `{"value":1,"labels":{"team":1}}`,
+			expectedStatus: http.StatusBadRequest, expectedBody: handlers.ErrIncorrectBody},
+		{name: "head", method: http.MethodHead, path: "/kv/user:1", expectedStatus: http.StatusOK, expectedHeader: "Content-Length"},
+		{name: "last modified", method: http.MethodGet, path: "/kv/user:1", expectedStatus: http.StatusOK,
+			expectedBody: `{"value":{"id":2}}`, expectedHeader: "Last-Modified"},
+		{name: "not modified", method: http.MethodGet, path: "/kv/user:1", header: http.Header{"If-Modified-Since": {later}},
+			expectedStatus: http.StatusNotModified},
+		{name: "modified", method: http.MethodGet, path: "/kv/user:1", header: http.Header{"If-Modified-Since": {earlier}},
+			expectedStatus: http.StatusOK, expectedBody: `{"value":{"id":2}}`},
+		{name: "meta not found", method: http.MethodGet, path: "/kv/user:2/meta", expectedStatus: http.StatusNotFound,
+			expectedBody: storage.ErrKeyNotFound.Error()},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			for name, values := range tc.header {
+				for _, value := range values {
+					req.Header.Add(name, value)
+				}
+			}
+			router.ServeHTTP(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tc.expectedStatus, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tc.expectedBody) {
+				t.Errorf("Expected body to contain %s, got %s", tc.expectedBody, w.Body.String())
+			}
+			if tc.expectedHeader != "" && w.Header().Get(tc.expectedHeader) == "" {
+				t.Errorf("Expected header %s to be set", tc.expectedHeader)
+			}
+			if tc.method == http.MethodHead && w.Body.Len() > 0 {
+				t.Errorf("Expected an empty body, got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMetadataWriter(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	repo := storage.NewMemoryRepository()
+	router := handlers.NewRouter(&handlers.Handler{Repo: repo, Metadata: repo})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/kv/user:1", strings.NewReader(`{"value":"a","labels":{"team":"core"}}`))
+	req.Header.Set(handlers.APIKeyHeader, "secret")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	testCases := []struct {
+		name           string
+		write          func() error
+		expectedWriter string
+	}{
+		{name: "ttl keeps writer", write: func() error { return repo.ExpireValue("user:1", time.Hour) },
+			expectedWriter: "api_key:"},
+		{name: "same value keeps writer", write: func() error { return repo.UpdateValue("user:1", "a") },
+			expectedWriter: "api_key:"},
+		{name: "new value drops writer", write: func() error { return repo.UpdateValue("user:1", "b") }},
+		{name: "annotated write sets writer", write: func() error {
+			_, err := repo.Annotated(storage.Annotation{Writer: "bob"}).PutValue("user:1", "c")
+			return err
+		}, expectedWriter: "bob"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.write(); err != nil {
+				t.Fatalf("Failed to write: %v", err)
+			}
+			data, err := repo.GetValue("user:1")
+			if err != nil {
+				t.Fatalf("Failed to get value: %v", err)
+			}
+			meta := storage.TupleMetadata(data[0].([]any))
+			if !strings.HasPrefix(meta.Writer, tc.expectedWriter) || tc.expectedWriter == "" && meta.Writer != "" {
+				t.Errorf("Expected writer %q, got %q", tc.expectedWriter, meta.Writer)
+			}
+			if meta.Labels["team"] != "core" {
+				t.Errorf("Expected labels to be kept, got %v", meta.Labels)
+			}
+		})
+	}
+}
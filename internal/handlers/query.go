@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+const maxQueryLimit = 1000
+
+// Query looks up entries through a secondary index:
+// GET /kv/_query?index=by_user&eq=42 or ?index=by_age&ge=18&lt=65&limit=10.
+func (handler *Handler) Query(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("Query request started", "method", r.Method, "path", r.URL.Path)
+	params := r.URL.Query()
+
+	query := storage.IndexQuery{Index: params.Get("index")}
+	if query.Index == "" {
+		log.Logger.Warnw("Query without index", "http_status", http.StatusBadRequest)
+		http.Error(w, ErrInvalidQuery, http.StatusBadRequest)
+		return
+	}
+	if params.Has("eq") {
+		eq := params.Get("eq")
+		query.Eq = &eq
+	}
+	for _, op := range []struct {
+		name      string
+		lower     bool
+		inclusive bool
+	}{{"gt", true, false}, {"ge", true, true}, {"lt", false, false}, {"le", false, true}} {
+		if !params.Has(op.name) {
+			continue
+		}
+		bound := &storage.Bound{Value: params.Get(op.name), Inclusive: op.inclusive}
+		if op.lower {
+			query.From = bound
+		} else {
+			query.To = bound
+		}
+	}
+	if params.Has("limit") {
+		limit, err := strconv.ParseUint(params.Get("limit"), 10, 32)
+		if err != nil || limit == 0 || limit > maxQueryLimit {
+			log.Logger.Warnw("Invalid query limit", "limit", params.Get("limit"),
+				"http_status", http.StatusBadRequest)
+			http.Error(w, ErrInvalidQuery, http.StatusBadRequest)
+			return
+		}
+		query.Limit = uint32(limit)
+	}
+
+	log.Logger.Debugw("Try to query index", "index", query.Index)
+	tuples, err := handler.Repo.QueryIndex(query)
+	if errors.Is(err, storage.ErrIndexNotFound) {
+		log.Logger.Warnw("Index not found", "index", query.Index,
+			"http_status", http.StatusNotFound)
+		http.Error(w, ErrIndexNotFound, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, storage.ErrInvalidIndexKey) || errors.Is(err, storage.ErrInvalidIndexCond) {
+		log.Logger.Warnw("Invalid query", "index", query.Index, "error", err.Error(),
+			"http_status", http.StatusBadRequest)
+		handler.writeJSON(w, http.StatusBadRequest,
+			ErrorResponse{Error: ErrInvalidQuery, Details: []string{err.Error()}})
+		return
+	}
+	if handler.checkError(w, err) {
+		return
+	}
+
+	items, err := handler.tuplesToItems(tuples)
+	if err != nil {
+		log.Logger.Errorw("Converting query result failed", "error", err.Error())
+		http.Error(w, ErrInternalServer, http.StatusInternalServerError)
+		return
+	}
+
+	log.Logger.Infow("Query successful", "index", query.Index, "count", len(items),
+		"http_status", http.StatusOK)
+	handler.writeJSON(w, http.StatusOK, ItemsResponse{Items: items})
+}
+
+// ListResponse is a page of entries in key order. Next is the cursor to
+// pass as ?after= for the following page and is empty on the last one.
+type ListResponse struct {
+	Items []Item `json:"items"`
+	Next  string `json:"next,omitempty"`
+}
+
+// List pages through entries in key order:
+// GET /kv?prefix=user:&after=user:10&limit=50.
+func (handler *Handler) List(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("List request started", "method", r.Method, "path", r.URL.Path)
+	params := r.URL.Query()
+
+	query := storage.ScanQuery{After: params.Get("after"), Prefix: params.Get("prefix")}
+	if params.Has("limit") {
+		limit, err := strconv.ParseUint(params.Get("limit"), 10, 32)
+		if err != nil || limit == 0 || limit > maxQueryLimit {
+			log.Logger.Warnw("Invalid list limit", "limit", params.Get("limit"),
+				"http_status", http.StatusBadRequest)
+			http.Error(w, ErrInvalidQuery, http.StatusBadRequest)
+			return
+		}
+		query.Limit = uint32(limit)
+	}
+
+	log.Logger.Debugw("Try to scan values", "after", query.After, "prefix", query.Prefix)
+	tuples, err := handler.Repo.ScanValues(query)
+	if handler.checkError(w, err) {
+		return
+	}
+
+	items, err := handler.tuplesToItems(tuples)
+	if err != nil {
+		log.Logger.Errorw("Converting list result failed", "error", err.Error())
+		http.Error(w, ErrInternalServer, http.StatusInternalServerError)
+		return
+	}
+
+	resp := ListResponse{Items: items}
+	limit := query.Limit
+	if limit == 0 {
+		limit = storage.DefaultScanLimit
+	}
+	if len(items) > 0 && uint32(len(items)) == limit {
+		resp.Next = items[len(items)-1].Key
+	}
+
+	log.Logger.Infow("List successful", "count", len(items), "http_status", http.StatusOK)
+	handler.writeJSON(w, http.StatusOK, resp)
+}
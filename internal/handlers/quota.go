@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+// Quota limits the storage used by a namespace. Zero fields are unlimited.
+type Quota struct {
+	MaxKeys  int64
+	MaxBytes int64
+}
+
+// Quotas holds the default quota and per namespace overrides.
+type Quotas struct {
+	Default    Quota
+	Namespaces map[string]Quota
+}
+
+func (quotas *Quotas) For(namespace string) Quota {
+	if quota, ok := quotas.Namespaces[namespace]; ok {
+		return quota
+	}
+	return quotas.Default
+}
+
+// checkQuota answers 403 when writing value under key would take the
+// namespace over its quota. With replace set the key may already exist
+// and its current value is not counted twice. The check reads the usage
+// before the write, so concurrent writers may overshoot slightly.
+func (handler *Handler) checkQuota(w http.ResponseWriter, key string, value any, replace bool) bool {
+	quotaErr, err := handler.quotaError(key, value, replace)
+	if handler.checkError(w, err) {
+		return false
+	}
+	if quotaErr != nil {
+		handler.writeAPIError(w, quotaErr)
+		return false
+	}
+	return true
+}
+
+// quotaError returns a 403 error when the write is over quota, or the
+// storage error that prevented the check.
+func (handler *Handler) quotaError(key string, value any, replace bool) (*apiError, error) {
+	if handler.Quotas == nil || handler.Usage == nil {
+		return nil, nil
+	}
+	namespace := storage.Namespace(key)
+	quota := handler.Quotas.For(namespace)
+	if quota.MaxKeys == 0 && quota.MaxBytes == 0 {
+		return nil, nil
+	}
+
+	usage, err := handler.Usage.GetUsage(namespace)
+	if err != nil {
+		return nil, err
+	}
+	size, err := storage.ValueSize(value)
+	if err != nil {
+		return nil, err
+	}
+
+	usage.Keys++
+	usage.Bytes += size
+	if replace {
+		oldSize, exists, err := handler.storedSize(key)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			usage.Keys--
+			usage.Bytes -= oldSize
+		}
+	}
+
+	var details []string
+	if quota.MaxKeys > 0 && usage.Keys > quota.MaxKeys {
+		details = append(details, fmt.Sprintf("namespace %q: %d keys exceed the limit of %d",
+			namespace, usage.Keys, quota.MaxKeys))
+	}
+	if quota.MaxBytes > 0 && usage.Bytes > quota.MaxBytes {
+		details = append(details, fmt.Sprintf("namespace %q: %d bytes exceed the limit of %d",
+			namespace, usage.Bytes, quota.MaxBytes))
+	}
+	if len(details) == 0 {
+		return nil, nil
+	}
+
+	log.Logger.Warnw("Quota exceeded", "key", key, "namespace", namespace, "details", details)
+	return &apiError{Status: http.StatusForbidden, Message: ErrQuotaExceeded, Details: details}, nil
+}
+
+// storedSize returns the accounted size of the value stored under key.
+func (handler *Handler) storedSize(key string) (int64, bool, error) {
+	data, err := handler.Repo.GetValue(key)
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	size, err := storage.ValueSize(data[0].([]any)[1])
+	return size, true, err
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/pkg/ratelimit"
+	"kvManager/internal/storage"
+)
+
+// Ways to tell clients apart for rate limiting.
+const (
+	RateLimitByIP        string = "ip"
+	RateLimitByAPIKey    string = "api_key"
+	RateLimitByNamespace string = "namespace"
+)
+
+// APIKeyHeader carries the client API key.
+const APIKeyHeader = "X-API-Key"
+
+// RateLimit is the rate limiting configuration of a Handler.
+type RateLimit struct {
+	Limiter *ratelimit.Limiter
+	// By is one of the RateLimitBy* constants. Requests without an API
+	// key or a namespace fall back to the client IP.
+	By string
+	// APIKeys are the API keys that get a bucket of their own with
+	// RateLimitByAPIKey. Other keys are limited by the client IP, so
+	// clients can not escape their limit by making up keys.
+	APIKeys []string
+	// TrustProxy takes the client IP from X-Forwarded-For.
+	TrustProxy bool
+}
+
+// rateLimitMiddleware answers 429 once the client has used up its
+// bucket and sets RateLimit-* headers on every limited response.
+func (handler *Handler) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/kv") && !strings.HasPrefix(r.URL.Path, "/admin") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client := handler.RateLimit.client(r)
+		result := handler.RateLimit.Limiter.Allow(client)
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			log.Logger.Warnw("Rate limit exceeded", "client", client,
+				"method", r.Method, "path", r.URL.Path, "http_status", http.StatusTooManyRequests)
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			http.Error(w, ErrRateLimited, http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// client returns the rate limit bucket name of the request.
+func (cfg *RateLimit) client(r *http.Request) string {
+	key, hasKey, err := routeVar(r, "id")
+	hasKey = hasKey && err == nil
+	return cfg.clientName(r.Header.Get(APIKeyHeader), key, hasKey, func() string { return cfg.clientIP(r) })
+}
+
+// clientName returns the bucket name from the API key or the namespace of
+// the requested key, falling back to the client IP.
+func (cfg *RateLimit) clientName(apiKey string, key string, hasKey bool, ip func() string) string {
+	switch cfg.By {
+	case RateLimitByAPIKey:
+		if apiKey != "" && slices.Contains(cfg.APIKeys, apiKey) {
+			return "key:" + apiKey
+		}
+	case RateLimitByNamespace:
+		if hasKey {
+			return "ns:" + storage.Namespace(key)
+		}
+	}
+	return "ip:" + ip()
+}
+
+func (cfg *RateLimit) clientIP(r *http.Request) string {
+	return clientIP(r, cfg.TrustProxy)
+}
+
+// clientIP returns the address of the client, taken from X-Forwarded-For
+// when the service runs behind a trusted proxy.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d >= time.Duration(math.MaxInt64) {
+		return math.MaxInt32
+	}
+	return int(math.Ceil(d.Seconds()))
+}
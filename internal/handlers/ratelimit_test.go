@@ -0,0 +1,245 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+
+	"kvManager/internal/handlers"
+	"kvManager/internal/mocks"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/pkg/ratelimit"
+	"kvManager/internal/storage"
+)
+
+func TestRateLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	err := log.SetupLogger()
+	if err != nil {
+		t.Errorf("failed to initialize logger: %v", err)
+		return
+	}
+	mockRepo := mocks.NewMockKvRepository(ctrl)
+	mockRepo.EXPECT().GetValue(gomock.Any()).Return(nil, storage.ErrKeyNotFound).AnyTimes()
+
+	cases := []struct {
+		name     string
+		by       string
+		apiKeys  []string
+		requests []*http.Request
+		expected []int
+	}{
+		{
+			name: "by ip",
+			by:   handlers.RateLimitByIP,
+			requests: []*http.Request{
+				httptest.NewRequest("GET", "/kv/a", nil),
+				httptest.NewRequest("GET", "/kv/b", nil),
+				httptest.NewRequest("GET", "/kv/c", nil),
+				httptest.NewRequest("GET", "/health", nil),
+			},
+			expected: []int{http.StatusNotFound, http.StatusNotFound, http.StatusTooManyRequests, http.StatusOK},
+		},
+		{
+			name:    "by api key",
+			by:      handlers.RateLimitByAPIKey,
+			apiKeys: []string{"one", "two"},
+			requests: []*http.Request{
+				withAPIKey(httptest.NewRequest("GET", "/kv/a", nil), "one"),
+				withAPIKey(httptest.NewRequest("GET", "/kv/a", nil), "one"),
+				withAPIKey(httptest.NewRequest("GET", "/kv/a", nil), "two"),
+				withAPIKey(httptest.NewRequest("GET", "/kv/a", nil), "one"),
+			},
+			expected: []int{http.StatusNotFound, http.StatusNotFound, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			name:    "unknown api keys share the ip bucket",
+			by:      handlers.RateLimitByAPIKey,
+			apiKeys: []string{"one"},
+			requests: []*http.Request{
+				withAPIKey(httptest.NewRequest("GET", "/kv/a", nil), "made-up-1"),
+				withAPIKey(httptest.NewRequest("GET", "/kv/a", nil), "made-up-2"),
+				withAPIKey(httptest.NewRequest("GET", "/kv/a", nil), "made-up-3"),
+				withAPIKey(httptest.NewRequest("GET", "/kv/a", nil), "one"),
+			},
+			expected: []int{http.StatusNotFound, http.StatusNotFound, http.StatusTooManyRequests, http.StatusNotFound},
+		},
+		{
+			name: "by namespace",
+			by:   handlers.RateLimitByNamespace,
+			requests: []*http.Request{
+				httptest.NewRequest("GET", "/kv/user:1", nil),
+				httptest.NewRequest("GET", "/kv/user:2", nil),
+				httptest.NewRequest("GET", "/kv/order:1", nil),
+				httptest.NewRequest("GET", "/kv/user:3", nil),
+			},
+			expected: []int{http.StatusNotFound, http.StatusNotFound, http.StatusNotFound, http.StatusTooManyRequests},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := handlers.NewRouter(&handlers.Handler{
+				Repo: mockRepo,
+				RateLimit: &handlers.RateLimit{
+					Limiter: ratelimit.New(ratelimit.Limit{Rate: 0.001, Burst: 2}, nil),
+					By:      tc.by,
+					APIKeys: tc.apiKeys,
+				},
+			})
+			for i, req := range tc.requests {
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+				if rr.Code != tc.expected[i] {
+					t.Fatalf("Request %d: expected status %d, got %d", i, tc.expected[i], rr.Code)
+				}
+				if rr.Code == http.StatusTooManyRequests {
+					if rr.Header().Get("Retry-After") == "" || rr.Header().Get("RateLimit-Remaining") != "0" {
+						t.Errorf("Missing rate limit headers: %v", rr.Header())
+					}
+				}
+			}
+		})
+	}
+}
+
+func withAPIKey(r *http.Request, key string) *http.Request {
+	r.Header.Set(handlers.APIKeyHeader, key)
+	return r
+}
+
+func TestQuotas(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	err := log.SetupLogger()
+	if err != nil {
+		t.Errorf("failed to initialize logger: %v", err)
+		return
+	}
+	mockRepo := mocks.NewMockKvRepository(ctrl)
+	mockUsage := mocks.NewMockUsageRepository(ctrl)
+
+	router := handlers.NewRouter(&handlers.Handler{
+		Repo:      mockRepo,
+		Usage:     mockUsage,
+		AdminKeys: []string{"admin"},
+		Quotas: &handlers.Quotas{
+			Default:    handlers.Quota{MaxKeys: 2},
+			Namespaces: map[string]handlers.Quota{"big": {}, "small": {MaxBytes: 10}},
+		},
+	})
+
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		apiKey         string
+		mockSetup      func()
+		expectedStatus int
+	}{
+		{
+			name:   "add under quota",
+			method: "POST",
+			path:   "/kv/user:2",
+			body:   `{"value":1}`,
+			mockSetup: func() {
+				mockUsage.EXPECT().GetUsage("user").Return(storage.Usage{Keys: 1}, nil).Times(1)
+				mockRepo.EXPECT().AddValue("user:2", int64(1)).Return(nil).Times(1)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:   "add over key quota",
+			method: "POST",
+			path:   "/kv/user:3",
+			body:   `{"value":1}`,
+			mockSetup: func() {
+				mockUsage.EXPECT().GetUsage("user").Return(storage.Usage{Keys: 2}, nil).Times(1)
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:   "replacing a key does not count it twice",
+			method: "PUT",
+			path:   "/kv/user:1",
+			body:   `{"value":2}`,
+			mockSetup: func() {
+				mockUsage.EXPECT().GetUsage("user").Return(storage.Usage{Keys: 2}, nil).Times(1)
+				mockRepo.EXPECT().GetValue("user:1").Return([]any{[]any{"user:1", int64(1)}}, nil).Times(1)
+				mockRepo.EXPECT().UpdateValue("user:1", int64(2)).Return(nil).Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "over byte quota",
+			method: "PUT",
+			path:   "/kv/small:1?upsert=true",
+			body:   `{"value":"a long string value"}`,
+			mockSetup: func() {
+				mockUsage.EXPECT().GetUsage("small").Return(storage.Usage{}, nil).Times(1)
+				mockRepo.EXPECT().GetValue("small:1").Return(nil, storage.ErrKeyNotFound).Times(1)
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:   "unlimited namespace",
+			method: "POST",
+			path:   "/kv/big:1",
+			body:   `{"value":1}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().AddValue("big:1", int64(1)).Return(nil).Times(1)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "usage endpoint without admin key",
+			method:         "GET",
+			path:           "/admin/usage/user",
+			apiKey:         "secret",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   "usage endpoint",
+			method: "GET",
+			path:   "/admin/usage/user",
+			apiKey: "admin",
+			mockSetup: func() {
+				mockUsage.EXPECT().GetUsage("user").Return(storage.Usage{Keys: 2, Bytes: 4}, nil).Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.mockSetup != nil {
+				tc.mockSetup()
+			}
+
+			req := httptest.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			if tc.apiKey != "" {
+				req.Header.Set(handlers.APIKeyHeader, tc.apiKey)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if rr.Code != http.StatusForbidden {
+				return
+			}
+			var resp handlers.ErrorResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &resp)
+			if err != nil || resp.Error != handlers.ErrQuotaExceeded || len(resp.Details) != 1 {
+				t.Errorf("Unexpected error response %s", rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"expvar"
+
+	"github.com/gorilla/mux"
+)
+
+// NewRouter registers every route served by handler. Routes match the
+// encoded path so keys may contain URL-encoded '/' and other characters.
+func NewRouter(handler *Handler) *mux.Router {
+	r := mux.NewRouter().UseEncodedPath()
+	r.Use(handler.bodyLimitMiddleware)
+	if handler.Audit != nil {
+		r.Use(handler.requestIDMiddleware)
+	}
+	if handler.RateLimit != nil {
+		r.Use(handler.rateLimitMiddleware)
+	}
+	r.HandleFunc("/kv", handler.List).Methods("GET")
+	r.HandleFunc("/kv", handler.Add).Methods("POST")
+	r.HandleFunc("/kv/_query", handler.Query).Methods("GET")
+	r.HandleFunc("/kv/_mget", handler.MultiGet).Methods("POST")
+	r.HandleFunc("/kv/_mdelete", handler.MultiDelete).Methods("POST")
+	r.HandleFunc("/kv/_export", handler.Export).Methods("GET")
+	r.HandleFunc(importPath, handler.Import).Methods("POST")
+	if handler.Trash != nil {
+		r.HandleFunc("/kv/_trash", handler.ListTrash).Methods("GET")
+		r.HandleFunc("/kv/{id}/undelete", handler.Undelete).Methods("POST")
+	}
+	r.HandleFunc("/kv/{id}", handler.Add).Methods("POST")
+	r.HandleFunc("/kv/{id}", handler.Get).Methods("GET", "HEAD")
+	r.HandleFunc("/kv/{id}", handler.Update).Methods("PUT")
+	r.HandleFunc("/kv/{id}", handler.Delete).Methods("DELETE")
+	r.HandleFunc("/kv/{id}/meta", handler.GetMeta).Methods("GET")
+
+	r.Handle("/debug/vars", expvar.Handler()).Methods("GET")
+	r.HandleFunc("/health", handler.Health).Methods("GET")
+
+	if handler.Schemas != nil {
+		r.HandleFunc("/admin/schemas", handler.adminOnly(handler.ListSchemas)).Methods("GET")
+		r.HandleFunc("/admin/schemas/{prefix:.+}", handler.adminOnly(handler.PutSchema)).Methods("PUT")
+		r.HandleFunc("/admin/schemas/{prefix:.+}", handler.adminOnly(handler.DeleteSchema)).Methods("DELETE")
+	}
+	if handler.Indexes != nil {
+		r.HandleFunc("/admin/indexes", handler.adminOnly(handler.ListIndexes)).Methods("GET")
+		r.HandleFunc("/admin/indexes", handler.adminOnly(handler.CreateIndex)).Methods("POST")
+		r.HandleFunc("/admin/indexes/{name}", handler.adminOnly(handler.DropIndex)).Methods("DELETE")
+	}
+	if handler.Usage != nil {
+		r.HandleFunc("/admin/usage/{namespace:.*}", handler.adminOnly(handler.GetUsage)).Methods("GET")
+	}
+	if handler.History != nil {
+		r.HandleFunc("/kv/{id}/history", handler.GetHistory).Methods("GET")
+		r.HandleFunc("/kv/{id}/restore", handler.RestoreRevision).Methods("POST")
+	}
+	if handler.Audit != nil {
+		r.HandleFunc("/admin/audit", handler.adminOnly(handler.AuditLog)).Methods("GET")
+	}
+	if handler.Backups != nil {
+		r.HandleFunc("/admin/backups", handler.adminOnly(handler.ListBackups)).Methods("GET")
+		r.HandleFunc("/admin/backups", handler.adminOnly(handler.CreateBackup)).Methods("POST")
+		r.HandleFunc("/admin/backups/{id}", handler.adminOnly(handler.GetBackup)).Methods("GET")
+		r.HandleFunc("/admin/backups/{id}/restore", handler.adminOnly(handler.RestoreBackup)).Methods("POST")
+	}
+	return r
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kvManager/internal/audit"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+// TrashItem is a deleted key that can still be undeleted.
+type TrashItem struct {
+	Key       string    `json:"key"`
+	Value     any       `json:"value"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// TrashResponse is a page of deleted keys in key order. Next is the
+// cursor to pass as ?after= for the following page.
+type TrashResponse struct {
+	Items []TrashItem `json:"items"`
+	Next  string      `json:"next,omitempty"`
+}
+
+// ListTrash pages through deleted keys like List:
+// GET /kv/_trash?prefix=user:&after=user:10&limit=50.
+func (handler *Handler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("List trash request started", "method", r.Method, "path", r.URL.Path)
+	params := r.URL.Query()
+
+	query := storage.ScanQuery{After: params.Get("after"), Prefix: params.Get("prefix"),
+		Limit: storage.DefaultScanLimit}
+	if params.Has("limit") {
+		limit, err := strconv.ParseUint(params.Get("limit"), 10, 32)
+		if err != nil || limit == 0 || limit > maxQueryLimit {
+			log.Logger.Warnw("Invalid trash limit", "limit", params.Get("limit"),
+				"http_status", http.StatusBadRequest)
+			http.Error(w, ErrInvalidQuery, http.StatusBadRequest)
+			return
+		}
+		query.Limit = uint32(limit)
+	}
+
+	log.Logger.Debugw("Try to list trash", "after", query.After, "prefix", query.Prefix)
+	entries, err := handler.Trash.ListTrash(query)
+	if handler.checkError(w, err) {
+		return
+	}
+
+	resp := TrashResponse{Items: make([]TrashItem, 0, len(entries))}
+	for _, entry := range entries {
+		value, err := handler.convertValue(entry.Value)
+		if err != nil {
+			log.Logger.Errorw("Converting trash entry failed", "key", entry.Key, "error", err.Error())
+			http.Error(w, ErrInternalServer, http.StatusInternalServerError)
+			return
+		}
+		resp.Items = append(resp.Items, TrashItem{
+			Key:       entry.Key,
+			Value:     value,
+			DeletedAt: entry.DeletedAt,
+			PurgeAt:   entry.PurgeAt,
+		})
+	}
+	if len(entries) > 0 && uint32(len(entries)) == query.Limit {
+		resp.Next = entries[len(entries)-1].Key
+	}
+
+	log.Logger.Infow("List trash successful", "count", len(entries), "http_status", http.StatusOK)
+	handler.writeJSON(w, http.StatusOK, resp)
+}
+
+// Undelete answers POST /kv/{id}/undelete by moving the key back from the
+// trash as it was deleted, with its TTL and metadata. It answers 403 when
+// the key does not fit the namespace quota and 409 when the key was
+// written again since it was deleted.
+func (handler *Handler) Undelete(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Infow("Undelete request started", "method", r.Method, "path", r.URL.Path)
+	key, ok := handler.routeKey(w, r)
+	if !ok {
+		return
+	}
+
+	value, err := handler.trashedValue(key)
+	if handler.checkError(w, err) {
+		return
+	}
+	if !handler.checkQuota(w, key, value, false) {
+		return
+	}
+
+	log.Logger.Debugw("Try to undelete value", "key", key)
+	err = handler.Trash.Undelete(key)
+	if errors.Is(err, storage.ErrKeyExists) {
+		log.Logger.Warnw("Undeleted key exists", "key", key, "http_status", http.StatusConflict)
+		http.Error(w, ErrKeyExists, http.StatusConflict)
+		return
+	}
+	if handler.checkError(w, err) {
+		return
+	}
+
+	handler.auditHTTP(r, audit.OpAdd, key, nil, value)
+	log.Logger.Infow("Undelete value successful", "key", key, "http_status", http.StatusOK)
+	w.WriteHeader(http.StatusOK)
+}
+
+// trashedValue returns the value of key in the trash, checked against the
+// quota before it is undeleted, or storage.ErrKeyNotFound.
+func (handler *Handler) trashedValue(key string) (any, error) {
+	entries, err := handler.Trash.ListTrash(storage.ScanQuery{Prefix: key, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 || entries[0].Key != key {
+		return nil, storage.ErrKeyNotFound
+	}
+	return entries[0].Value, nil
+}
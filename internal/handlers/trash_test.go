@@ -0,0 +1,136 @@
+package handlers_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"kvManager/internal/handlers"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+func TestTrash(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	repo := storage.NewMemoryRepository().WithTrash(time.Hour)
+	for _, key := range []string{"user:1", "user:2", "user:3"} {
+		err = repo.AddValue(key, map[string]any{"id": key})
+		if err != nil {
+			t.Fatalf("AddValue: %v", err)
+		}
+	}
+	router := handlers.NewRouter(&handlers.Handler{Repo: repo, Trash: repo})
+
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "delete", method: http.MethodDelete, path: "/kv/user:1", expectedStatus: http.StatusNoContent},
+		{name: "get deleted", method: http.MethodGet, path: "/kv/user:1", expectedStatus: http.StatusNotFound, expectedBody: storage.ErrKeyNotFound.Error()},
+		{name: "delete batch", method: http.MethodPost, path: "/kv/_mdelete", body: `{"keys":["user:2","user:3"]}`, expectedStatus: http.StatusOK},
+		{name: "list", method: http.MethodGet, path: "/kv/_trash?prefix=user:&limit=2", expectedStatus: http.StatusOK, expectedBody: `"next":"user:2"`},
+		{name: "list next page", method: http.MethodGet, path: "/kv/_trash?prefix=user:&after=user:2", expectedStatus: http.StatusOK, expectedBody: `"items":[{"key":"user:3","value":{"id":"user:3"}`},
+		{name: "list invalid", method: http.MethodGet, path: "/kv/_trash?limit=0", expectedStatus: http.StatusBadRequest, expectedBody: handlers.ErrInvalidQuery},
+		{name: "undelete", method: http.MethodPost, path: "/kv/user:1/undelete", expectedStatus: http.StatusOK},
+		{name: "get undeleted", method: http.MethodGet, path: "/kv/user:1", expectedStatus: http.StatusOK, expectedBody: `{"value":{"id":"user:1"}}`},
+		{name: "undelete again", method: http.MethodPost, path: "/kv/user:1/undelete", expectedStatus: http.StatusNotFound, expectedBody: storage.ErrKeyNotFound.Error()},
+		{name: "recreate", method: http.MethodPost, path: "/kv/user:2", body: `{"value":{"id":"new"}}`, expectedStatus: http.StatusCreated},
+		{name: "undelete recreated", method: http.MethodPost, path: "/kv/user:2/undelete", expectedStatus: http.StatusConflict, expectedBody: handlers.ErrKeyExists},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tc.expectedStatus, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tc.expectedBody) {
+				t.Errorf("Expected body to contain %s, got %s", tc.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUndeleteKeepsEntry(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	repo := storage.NewMemoryRepository().WithTrash(time.Hour)
+	router := handlers.NewRouter(&handlers.Handler{
+		Repo:     repo,
+		Trash:    repo,
+		Metadata: repo,
+		Usage:    repo,
+		Quotas:   &handlers.Quotas{Namespaces: map[string]handlers.Quota{"small": {MaxKeys: 1}}},
+	})
+
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		apiKey         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "add", method: http.MethodPost, path: "/kv/user:1", body: `{"value":1,"labels":{"team":"billing"}}`, apiKey: "secret", expectedStatus: http.StatusCreated},
+		{name: "expire", method: http.MethodPut, path: "/kv/user:1?ttl=1h", body: `{"value":1}`, apiKey: "secret", expectedStatus: http.StatusOK},
+		{name: "delete", method: http.MethodDelete, path: "/kv/user:1", expectedStatus: http.StatusNoContent},
+		{name: "undelete", method: http.MethodPost, path: "/kv/user:1/undelete", apiKey: "other", expectedStatus: http.StatusOK},
+		{name: "add small", method: http.MethodPost, path: "/kv/small:1", body: `{"value":1}`, expectedStatus: http.StatusCreated},
+		{name: "delete small", method: http.MethodDelete, path: "/kv/small:1", expectedStatus: http.StatusNoContent},
+		{name: "add other small", method: http.MethodPost, path: "/kv/small:2", body: `{"value":2}`, expectedStatus: http.StatusCreated},
+		{name: "undelete over quota", method: http.MethodPost, path: "/kv/small:1/undelete", expectedStatus: http.StatusForbidden, expectedBody: handlers.ErrQuotaExceeded},
+	}
+
+	var before []any
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.name == "delete" {
+				data, err := repo.GetValue("user:1")
+				if err != nil {
+					t.Fatalf("GetValue: %v", err)
+				}
+				before = data[0].([]any)
+			}
+			r := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if tc.apiKey != "" {
+				r.Header.Set(handlers.APIKeyHeader, tc.apiKey)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d %s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tc.expectedBody) {
+				t.Errorf("Expected body to contain %s, got %s", tc.expectedBody, w.Body.String())
+			}
+		})
+	}
+
+	data, err := repo.GetValue("user:1")
+	if err != nil {
+		t.Fatalf("GetValue: %v", err)
+	}
+	if after := data[0].([]any); !reflect.DeepEqual(after, before) {
+		t.Errorf("Expected the undeleted tuple %v, got %v", before, after)
+	}
+	if _, err := repo.GetValue("small:1"); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Errorf("Expected small:1 to stay deleted, got %v", err)
+	}
+}
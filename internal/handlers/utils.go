@@ -6,21 +6,134 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
 	"kvManager/internal/pkg/log"
+	"kvManager/internal/pkg/resilience"
 	"kvManager/internal/storage"
 )
 
 type RequestData struct {
-	Key   string `json:"key"`
-	Value any    `json:"value"`
+	Key    string            `json:"key"`
+	Value  any               `json:"value"`
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 type ResponseData struct {
 	Value any `json:"value"`
 }
 
+type Item struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+type ItemsResponse struct {
+	Items []Item `json:"items"`
+}
+
+type ErrorResponse struct {
+	Error   string   `json:"error"`
+	Details []string `json:"details,omitempty"`
+}
+
+// apiError is a rejected request shared by the HTTP and gRPC APIs. Status
+// is the HTTP status, which the gRPC API maps to a code.
+type apiError struct {
+	Status  int
+	Message string
+	Details []string
+}
+
+func (err *apiError) Error() string {
+	if len(err.Details) == 0 {
+		return err.Message
+	}
+	return err.Message + ": " + strings.Join(err.Details, "; ")
+}
+
+// writeAPIError answers with err, as an ErrorResponse when it has details
+// and as plain text otherwise.
+func (handler *Handler) writeAPIError(w http.ResponseWriter, err *apiError) {
+	if len(err.Details) > 0 {
+		handler.writeJSON(w, err.Status, ErrorResponse{Error: err.Message, Details: err.Details})
+		return
+	}
+	http.Error(w, err.Message, err.Status)
+}
+
+func (handler *Handler) writeJSON(w http.ResponseWriter, status int, payload any) {
+	resp, err := json.Marshal(payload)
+	if err != nil {
+		log.Logger.Errorw("Response marshaling failed", "error", err.Error())
+		http.Error(w, ErrInternalServer, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(resp)
+	if err != nil {
+		log.Logger.Errorw("Internal server error", "error", err.Error())
+	}
+}
+
+// tuplesToItems converts Tarantool tuples into key/value pairs ready for
+// JSON encoding.
+func (handler *Handler) tuplesToItems(tuples []any) ([]Item, error) {
+	items := make([]Item, 0, len(tuples))
+	for _, data := range tuples {
+		tuple, ok := data.([]any)
+		if !ok || len(tuple) < 2 {
+			return nil, fmt.Errorf("unexpected tuple: %v", data)
+		}
+		key, _ := tuple[0].(string)
+		value, err := handler.convertValue(tuple[1])
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, Item{Key: key, Value: value})
+	}
+	return items, nil
+}
+
+// validateValue checks value against the schema registered for key and
+// writes a 422 response listing the violations when it does not match.
+func (handler *Handler) validateValue(w http.ResponseWriter, key string, value any) bool {
+	if err := handler.schemaError(key, value); err != nil {
+		handler.writeAPIError(w, err)
+		return false
+	}
+	return true
+}
+
+// schemaError returns a 422 error listing the violations when value does
+// not match the schema registered for key.
+func (handler *Handler) schemaError(key string, value any) *apiError {
+	if handler.Schemas == nil {
+		return nil
+	}
+
+	jsonValue, err := handler.convertValue(value)
+	if err != nil {
+		log.Logger.Errorw("Converting value for validation failed", "key", key,
+			"error", err.Error())
+		return &apiError{Status: http.StatusInternalServerError, Message: ErrInternalServer}
+	}
+
+	details := handler.Schemas.Validate(key, jsonValue)
+	if len(details) == 0 {
+		return nil
+	}
+
+	log.Logger.Warnw("Value rejected by schema", "key", key, "errors", details)
+	return &apiError{Status: http.StatusUnprocessableEntity, Message: ErrSchemaMismatch, Details: details}
+}
+
 func (handler *Handler) checkError(w http.ResponseWriter, err error) bool {
+	if handler.checkUnavailable(w, err) {
+		return true
+	}
 	if err != nil && errors.Is(err, storage.ErrKeyNotFound) {
 		http.Error(w, storage.ErrKeyNotFound.Error(), http.StatusNotFound)
 		log.Logger.Warnw("Key not found error",
@@ -36,37 +149,70 @@ func (handler *Handler) checkError(w http.ResponseWriter, err error) bool {
 	return false
 }
 
-func (handler *Handler) convertMap(oldMap map[any]any) (map[string]any, error) {
-	newMap := make(map[string]any)
-	log.Logger.Debugw("Starting map conversion", "map_size", len(oldMap))
-	for key, val := range oldMap {
-		strKey, ok := key.(string)
-		if !ok {
-			log.Logger.Errorw("Map conversion failed", "error", ErrKeyIsNotAString)
-			return nil, fmt.Errorf("%s", ErrKeyIsNotAString)
-		}
+// checkedValue decodes a JSON encoded value written under key after the
+// key, limit, schema and quota checks. It returns an *apiError for a
+// rejected value and the storage error that prevented a check otherwise.
+func (handler *Handler) checkedValue(key string, raw []byte, replace bool) (any, error) {
+	if err := handler.keyError(key); err != nil {
+		return nil, err
+	}
+	if err := handler.valueLimitsError(raw); err != nil {
+		return nil, err
+	}
+	value, err := handler.decodeValue(raw)
+	if err != nil {
+		log.Logger.Warnw("Failed to unmarshal value", "key", key, "error", err)
+		return nil, &apiError{Status: http.StatusBadRequest, Message: ErrIncorrectBody}
+	}
+	if err := handler.schemaError(key, value); err != nil {
+		return nil, err
+	}
+	quotaErr, err := handler.quotaError(key, value, replace)
+	if err != nil {
+		return nil, err
+	}
+	if quotaErr != nil {
+		return nil, quotaErr
+	}
+	return value, nil
+}
 
-		if nestedMap, ok := val.(map[any]any); ok {
-			log.Logger.Debugw("Converting nested map", "key", strKey)
-			convertedNested, err := handler.convertMap(nestedMap)
-			if err != nil {
-				log.Logger.Errorw("Nested map conversion failed",
-					"key", strKey,
-					"error", err)
-				return nil, err
-			}
-			newMap[strKey] = convertedNested
-		} else {
-			newMap[strKey] = val
-		}
+// isUnavailable reports whether the storage rejected the request without
+// trying it because it is failing or overloaded.
+func isUnavailable(err error) bool {
+	return errors.Is(err, resilience.ErrCircuitOpen) || errors.Is(err, resilience.ErrOverloaded)
+}
+
+// checkUnavailable answers 503 when the storage rejected the request
+// without trying it because it is failing or overloaded.
+func (handler *Handler) checkUnavailable(w http.ResponseWriter, err error) bool {
+	if !isUnavailable(err) {
+		return false
 	}
-	log.Logger.Debugw("Map conversion completed", "converted_size", len(newMap))
-	return newMap, nil
+	log.Logger.Warnw("Storage unavailable", "error", err.Error(),
+		"http_status", http.StatusServiceUnavailable)
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, ErrUnavailable, http.StatusServiceUnavailable)
+	return true
+}
 
+// convertValue turns a value decoded from Tarantool into one that
+// encoding/json can marshal without losing precision.
+func (handler *Handler) convertValue(val any) (any, error) {
+	converted, err := storage.JSONValue(val)
+	if err != nil {
+		log.Logger.Errorw("Value conversion failed", "error", err)
+		return nil, fmt.Errorf("%s: %w", ErrKeyIsNotAString, err)
+	}
+	return converted, nil
 }
+
 func (handler *Handler) parseReqBody(w http.ResponseWriter, r *http.Request) (*RequestData, bool) {
 	log.Logger.Debugw("Parsing request body")
 	body, err := io.ReadAll(r.Body)
+	if handler.checkBodyTooLarge(w, err) {
+		return nil, false
+	}
 	if err != nil {
 		log.Logger.Errorw("Failed to read request body",
 			"error", err,
@@ -81,8 +227,12 @@ func (handler *Handler) parseReqBody(w http.ResponseWriter, r *http.Request) (*R
 		}
 	}()
 
-	var data RequestData
-	err = json.Unmarshal(body, &data)
+	var raw struct {
+		Key    string            `json:"key"`
+		Value  json.RawMessage   `json:"value"`
+		Labels map[string]string `json:"labels"`
+	}
+	err = json.Unmarshal(body, &raw)
 	if err != nil {
 		log.Logger.Warnw("Failed to unmarshal request body",
 			"error", err,
@@ -91,7 +241,36 @@ func (handler *Handler) parseReqBody(w http.ResponseWriter, r *http.Request) (*R
 		http.Error(w, ErrIncorrectBody, http.StatusBadRequest)
 		return nil, false
 	}
+	if !handler.checkValueLimits(w, raw.Value) {
+		return nil, false
+	}
+
+	data := RequestData{Key: raw.Key, Labels: raw.Labels}
+	data.Value, err = handler.decodeValue(raw.Value)
+	if err != nil {
+		log.Logger.Warnw("Failed to unmarshal value",
+			"error", err,
+			"http_status", http.StatusBadRequest)
+		http.Error(w, ErrIncorrectBody, http.StatusBadRequest)
+		return nil, false
+	}
+
 	log.Logger.Debugw("Request body parsed successfully",
 		"data_key", data.Key)
 	return &data, true
 }
+
+// decodeValue parses a JSON encoded value into types that keep their
+// precision in Tarantool. An empty raw value decodes to nil.
+func (handler *Handler) decodeValue(raw []byte) (any, error) {
+	return storage.DecodeJSON(raw)
+}
+
+// encodeValue returns the JSON encoding of a value read from Tarantool.
+func (handler *Handler) encodeValue(value any) ([]byte, error) {
+	converted, err := handler.convertValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(converted)
+}
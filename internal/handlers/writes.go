@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"kvManager/internal/audit"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+// errNoVersions is returned by versioned writes on a handler without a
+// VersionRepository.
+var errNoVersions = errors.New("versioned writes are not supported by the storage")
+
+// Writes is the write path of the protocols served outside this package,
+// such as RESP and memcache. It applies the same key, limit, schema and
+// quota checks as the HTTP API, records the writer in the metadata and
+// audits every change, so those protocols can not store what HTTP would
+// refuse.
+type Writes struct {
+	handler *Handler
+	ttl     *time.Duration
+}
+
+// Writes returns the checked write path of handler.
+func (handler *Handler) Writes() *Writes {
+	return &Writes{handler: handler}
+}
+
+// WithTTL returns the write path that sets the TTL of the values it
+// writes to ttl in the same storage call as the value. A zero ttl removes
+// the TTL, also on Update and CompareAndSet that keep it otherwise, and a
+// negative one stores values already expired.
+func (w *Writes) WithTTL(ttl time.Duration) *Writes {
+	return &Writes{handler: w.handler, ttl: &ttl}
+}
+
+// annotation is what the writes of actor store along with the value.
+func (w *Writes) annotation(actor audit.Actor) storage.Annotation {
+	return storage.Annotation{Writer: actor.Principal, TTL: w.ttl}
+}
+
+// expire sets the TTL of key after a write when the storage keeps no
+// metadata, since only the annotated writes carry it.
+func (w *Writes) expire(key string) error {
+	if w.ttl == nil || w.handler.Metadata != nil {
+		return nil
+	}
+	if *w.ttl < 0 {
+		return w.handler.Repo.DeleteValue(key)
+	}
+	return w.handler.Repo.ExpireValue(key, *w.ttl)
+}
+
+// Rejection returns the client facing reason when err is a write refused
+// by a check rather than a storage failure.
+func Rejection(err error) (string, bool) {
+	var reqErr *apiError
+	if !errors.As(err, &reqErr) {
+		return "", false
+	}
+	return reqErr.Error(), true
+}
+
+// CheckKey returns the rejection of a key that can not be written.
+func (w *Writes) CheckKey(key string) error {
+	if err := w.handler.keyError(key); err != nil {
+		return err
+	}
+	return nil
+}
+
+// check runs the checks of a value written under key. Values are checked
+// in their JSON form, as HTTP receives them. Strings are stored as given,
+// since JSON would replace the bytes of binary items that are not UTF-8.
+func (w *Writes) check(key string, value any, replace bool) (any, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	checked, err := w.handler.checkedValue(key, raw, replace)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := value.(string); ok {
+		return value, nil
+	}
+	return checked, nil
+}
+
+// record audits a change of key.
+func (w *Writes) record(actor audit.Actor, op audit.Operation, key string, before []byte, after any) {
+	if w.handler.Audit == nil {
+		return
+	}
+	if actor.RequestID == "" {
+		actor.RequestID = newRequestID()
+	}
+	w.handler.audit(actor, op, key, before, after)
+}
+
+// Add creates key and fails with storage.ErrKeyExists when it exists.
+func (w *Writes) Add(actor audit.Actor, key string, value any) error {
+	value, err := w.check(key, value, false)
+	if err != nil {
+		return err
+	}
+	log.Logger.Debugw("Try to add value", "key", key, "principal", actor.Principal)
+	err = w.handler.writeRepo(w.annotation(actor)).AddValue(key, value)
+	if err != nil {
+		return err
+	}
+	w.record(actor, audit.OpAdd, key, nil, value)
+	return w.expire(key)
+}
+
+// Put creates or replaces key and reports whether it was created.
+func (w *Writes) Put(actor audit.Actor, key string, value any) (bool, error) {
+	value, err := w.check(key, value, true)
+	if err != nil {
+		return false, err
+	}
+	before := w.handler.auditBefore(key)
+	log.Logger.Debugw("Try to put value", "key", key, "principal", actor.Principal)
+	created, err := w.handler.writeRepo(w.annotation(actor)).PutValue(key, value)
+	if err != nil {
+		return false, err
+	}
+	op := audit.OpUpdate
+	if created {
+		op, before = audit.OpAdd, nil
+	}
+	w.record(actor, op, key, before, value)
+	return created, w.expire(key)
+}
+
+// Update replaces the value of key and fails with storage.ErrKeyNotFound
+// when it is missing.
+func (w *Writes) Update(actor audit.Actor, key string, value any) error {
+	value, err := w.check(key, value, true)
+	if err != nil {
+		return err
+	}
+	before := w.handler.auditBefore(key)
+	log.Logger.Debugw("Try to update value", "key", key, "principal", actor.Principal)
+	err = w.handler.writeRepo(w.annotation(actor)).UpdateValue(key, value)
+	if err != nil {
+		return err
+	}
+	w.record(actor, audit.OpUpdate, key, before, value)
+	return w.expire(key)
+}
+
+// CompareAndSet replaces the value of key only when it equals expected.
+func (w *Writes) CompareAndSet(actor audit.Actor, key string, expected any, value any) error {
+	value, err := w.check(key, value, true)
+	if err != nil {
+		return err
+	}
+	log.Logger.Debugw("Try to compare and set value", "key", key, "principal", actor.Principal)
+	err = w.handler.writeRepo(w.annotation(actor)).CompareAndSet(key, expected, value)
+	if err != nil {
+		return err
+	}
+	var before []byte
+	if w.handler.Audit != nil {
+		before, _ = w.handler.encodeValue(expected)
+	}
+	w.record(actor, audit.OpUpdate, key, before, value)
+	return w.expire(key)
+}
+
+// CompareVersionAndSet replaces the value of key only when its version,
+// read with storage.TupleVersion, is still version.
+func (w *Writes) CompareVersionAndSet(actor audit.Actor, key string, version uint64, value any) error {
+	if w.handler.Versions == nil {
+		return errNoVersions
+	}
+	value, err := w.check(key, value, true)
+	if err != nil {
+		return err
+	}
+	before := w.handler.auditBefore(key)
+	log.Logger.Debugw("Try to compare version and set value", "key", key, "version", version,
+		"principal", actor.Principal)
+	err = w.handler.writeVersions(w.annotation(actor)).CompareVersionAndSet(key, version, value)
+	if err != nil {
+		return err
+	}
+	w.record(actor, audit.OpUpdate, key, before, value)
+	return w.expire(key)
+}
+
+// Delete removes keys and returns the ones that existed.
+func (w *Writes) Delete(actor audit.Actor, keys []string) ([]string, error) {
+	for _, key := range keys {
+		if err := w.CheckKey(key); err != nil {
+			return nil, err
+		}
+	}
+	before := make(map[string][]byte, len(keys))
+	if w.handler.Audit != nil {
+		for _, key := range keys {
+			before[key] = w.handler.auditBefore(key)
+		}
+	}
+	log.Logger.Debugw("Try to delete values", "keys", len(keys), "principal", actor.Principal)
+	deleted, err := w.handler.Repo.DeleteValues(keys)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range deleted {
+		w.record(actor, audit.OpDelete, key, before[key], nil)
+	}
+	return deleted, nil
+}
+
+// Expire sets the TTL of key; a ttl that is not positive removes it.
+// TTL changes are not audited, like on HTTP.
+func (w *Writes) Expire(key string, ttl time.Duration) error {
+	if err := w.CheckKey(key); err != nil {
+		return err
+	}
+	return w.handler.Repo.ExpireValue(key, ttl)
+}
@@ -0,0 +1,547 @@
+package memcache
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"kvManager/internal/audit"
+	"kvManager/internal/handlers"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/pkg/resilience"
+	"kvManager/internal/storage"
+)
+
+// Replies of the memcached text protocol.
+const (
+	replyStored    = "STORED"
+	replyNotStored = "NOT_STORED"
+	replyExists    = "EXISTS"
+	replyNotFound  = "NOT_FOUND"
+	replyDeleted   = "DELETED"
+	replyTouched   = "TOUCHED"
+	replyEnd       = "END"
+	replyError     = "ERROR"
+	replyVersion   = "VERSION kvstorage"
+)
+
+// Error messages sent after CLIENT_ERROR and SERVER_ERROR.
+const (
+	errBadFormat    = "bad command line format"
+	errBadChunk     = "bad data chunk"
+	errKeyTooLong   = "key too long"
+	errFlags        = "flags are not supported"
+	errNonNumeric   = "cannot increment or decrement non-numeric value"
+	errTooLarge     = "object too large for cache"
+	errUnavailable  = "storage temporarily unavailable"
+	errInternal     = "internal error"
+	errContention   = "too many concurrent updates, try again"
+	errInvalidDelta = "invalid numeric delta argument"
+	errNoAuth       = "unauthenticated"
+	errAuthFailed   = "authentication failure"
+)
+
+// maxRelativeExpiration is the largest expiration time taken as seconds
+// from now. Larger ones are Unix timestamps, as in memcached.
+const maxRelativeExpiration = 30 * 24 * 60 * 60
+
+// maxIncrAttempts bounds the compare-and-set retries of incr and decr
+// under contention.
+const maxIncrAttempts = 16
+
+// dispatch runs the command on line and writes its reply. The returned
+// error means the connection can not be used any more.
+func (s *session) dispatch(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		s.reply(false, replyError)
+		return nil
+	}
+	name, args := fields[0], fields[1:]
+	log.Logger.Debugw("Memcached command", "client_id", s.id, "command", name)
+
+	if !s.authenticated {
+		switch name {
+		case "set":
+			return s.authenticate(args)
+		case "quit":
+			s.quit = true
+		default:
+			s.clientError(errNoAuth)
+		}
+		return nil
+	}
+
+	switch name {
+	case "get", "gets":
+		s.get(args, name == "gets")
+	case "set", "add", "replace", "cas":
+		return s.store(name, args)
+	case "delete":
+		s.delete(args)
+	case "incr", "decr":
+		s.incr(args, name == "decr")
+	case "touch":
+		s.touch(args)
+	case "version":
+		s.reply(false, replyVersion)
+	case "quit":
+		s.quit = true
+	default:
+		s.reply(false, replyError)
+	}
+	return nil
+}
+
+// reply writes a line unless the client asked for noreply.
+func (s *session) reply(noreply bool, line string) {
+	if noreply {
+		return
+	}
+	s.w.WriteString(line)
+	s.w.WriteString("\r\n")
+}
+
+func (s *session) clientError(msg string) {
+	s.reply(false, "CLIENT_ERROR "+msg)
+}
+
+// storageError replies to a failed storage call.
+func (s *session) storageError(noreply bool, err error) {
+	if isUnavailable(err) {
+		log.Logger.Warnw("Storage unavailable", "client_id", s.id, "error", err.Error())
+		s.reply(noreply, "SERVER_ERROR "+errUnavailable)
+		return
+	}
+	log.Logger.Errorw("Memcached command failed", "client_id", s.id, "error", err.Error())
+	s.reply(noreply, "SERVER_ERROR "+errInternal)
+}
+
+// writeError replies to a failed write with the reason of a value
+// refused by a check, or as a storage failure.
+func (s *session) writeError(noreply bool, err error) {
+	if msg, ok := handlers.Rejection(err); ok {
+		log.Logger.Debugw("Memcached write rejected", "client_id", s.id, "reason", msg)
+		s.reply(noreply, "CLIENT_ERROR "+msg)
+		return
+	}
+	s.storageError(noreply, err)
+}
+
+func isUnavailable(err error) bool {
+	return errors.Is(err, resilience.ErrCircuitOpen) || errors.Is(err, resilience.ErrOverloaded)
+}
+
+// noreply reports whether the optional last argument of a command at
+// position i is noreply.
+func noreply(args []string, i int) bool {
+	return len(args) == i+1 && args[i] == "noreply"
+}
+
+// encodeValue returns the bytes sent for a stored value: strings as they
+// are and anything else, such as JSON documents written through the HTTP
+// API, JSON encoded.
+func encodeValue(value any) ([]byte, error) {
+	if str, ok := value.(string); ok {
+		return []byte(str), nil
+	}
+	converted, err := storage.JSONValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(converted)
+}
+
+// expiration converts a memcached expiration time. 0 never expires, up to
+// 30 days it is seconds from now and above that a Unix timestamp. expired
+// is true for times in the past, which memcached treats as immediately
+// expired.
+func expiration(exptime int64) (ttl time.Duration, expired bool) {
+	switch {
+	case exptime == 0:
+		return 0, false
+	case exptime < 0:
+		return 0, true
+	case exptime <= maxRelativeExpiration:
+		return time.Duration(exptime) * time.Second, false
+	}
+	ttl = time.Until(time.Unix(exptime, 0))
+	return ttl, ttl <= 0
+}
+
+// get implements get and gets <key>*.
+func (s *session) get(keys []string, withCas bool) {
+	if len(keys) == 0 {
+		s.reply(false, replyError)
+		return
+	}
+	for _, key := range keys {
+		if len(key) > MaxKeyLength {
+			s.clientError(errBadFormat)
+			return
+		}
+	}
+
+	tuples, err := s.srv.repo.GetValues(keys)
+	if err != nil {
+		s.storageError(false, err)
+		return
+	}
+	found := make(map[string][]any, len(tuples))
+	for _, data := range tuples {
+		tuple, ok := data.([]any)
+		if !ok || len(tuple) < 2 {
+			continue
+		}
+		key, _ := tuple[0].(string)
+		found[key] = tuple
+	}
+
+	for _, key := range keys {
+		tuple, ok := found[key]
+		if !ok {
+			continue
+		}
+		data, err := encodeValue(tuple[1])
+		if err != nil {
+			log.Logger.Errorw("Converting value failed", "key", key, "error", err.Error())
+			continue
+		}
+		s.w.WriteString("VALUE " + key + " 0 " + strconv.Itoa(len(data)))
+		if withCas {
+			// The version of the entry changes with every new value, so
+			// a value written back after a change has a new cas unique.
+			s.w.WriteString(" " + strconv.FormatUint(storage.TupleVersion(tuple), 10))
+		}
+		s.w.WriteString("\r\n")
+		s.w.Write(data)
+		s.w.WriteString("\r\n")
+	}
+	s.reply(false, replyEnd)
+}
+
+// store implements the storage commands:
+//
+//	set|add|replace <key> <flags> <exptime> <bytes> [noreply]
+//	cas <key> <flags> <exptime> <bytes> <cas unique> [noreply]
+//
+// Values are stored as strings. Flags must be 0 since they can not be
+// stored next to the value.
+func (s *session) store(name string, args []string) error {
+	want := 4
+	if name == "cas" {
+		want = 5
+	}
+	if len(args) != want && len(args) != want+1 {
+		s.reply(false, replyError)
+		return nil
+	}
+	quiet := noreply(args, want)
+
+	key := args[0]
+	flags, errFlagsArg := strconv.ParseUint(args[1], 10, 32)
+	exptime, errExp := strconv.ParseInt(args[2], 10, 64)
+	size, errSize := strconv.Atoi(args[3])
+	var unique uint64
+	var errCas error
+	if name == "cas" {
+		unique, errCas = strconv.ParseUint(args[4], 10, 64)
+	}
+	value, ok, err := s.readData(size, errSize, s.srv.cfg.MaxValueBytes, quiet)
+	if !ok {
+		return err
+	}
+
+	switch {
+	case errFlagsArg != nil || errExp != nil || errCas != nil || (len(args) == want+1 && !quiet):
+		s.clientError(errBadFormat)
+		return nil
+	case len(key) > MaxKeyLength:
+		s.clientError(errKeyTooLong)
+		return nil
+	case flags != 0:
+		s.clientError(errFlags)
+		return nil
+	}
+
+	ttl, expired := expiration(exptime)
+	reply, err := s.srv.write(s.actor(), name, key, value, unique, ttl, expired)
+	if err != nil {
+		s.writeError(quiet, err)
+		return nil
+	}
+	s.reply(quiet, reply)
+	return nil
+}
+
+// readData reads the data block of a storage command announcing size
+// bytes, limited to limit. ok is false when the command is answered
+// already, with err set when the connection can not be used any more.
+func (s *session) readData(size int, errSize error, limit int, quiet bool) (string, bool, error) {
+	if errSize != nil || size < 0 {
+		s.clientError(errBadFormat)
+		return "", false, nil
+	}
+	if size > limit {
+		_, err := io.CopyN(io.Discard, s.r, int64(size)+2)
+		s.reply(quiet, "SERVER_ERROR "+errTooLarge)
+		return "", false, err
+	}
+	data := make([]byte, size+2)
+	_, err := io.ReadFull(s.r, data)
+	if err != nil {
+		return "", false, err
+	}
+	if data[size] != '\r' || data[size+1] != '\n' {
+		s.clientError(errBadChunk)
+		return "", false, nil
+	}
+	return string(data[:size]), true, nil
+}
+
+// authenticate implements the authentication of memcached's text
+// protocol: the first set of a connection carries "username password"
+// as its data, whatever its key.
+func (s *session) authenticate(args []string) error {
+	if len(args) != 4 {
+		s.clientError(errNoAuth)
+		return nil
+	}
+	size, errSize := strconv.Atoi(args[3])
+	data, ok, err := s.readData(size, errSize, maxLineLength, false)
+	if !ok {
+		return err
+	}
+	if !s.srv.checkCredentials(data) {
+		log.Logger.Warnw("Memcached authentication failed", "client_id", s.id, "remote", s.remote)
+		s.clientError(errAuthFailed)
+		return nil
+	}
+	s.authenticated = true
+	s.reply(false, replyStored)
+	return nil
+}
+
+// write stores value with the semantics of the storage command name.
+// The expiration is written in the same call as the value: no exptime
+// drops the TTL, like in memcached, and a past one stores the value
+// already expired.
+func (srv *Server) write(actor audit.Actor, name string, key string, value string, unique uint64, ttl time.Duration, expired bool) (string, error) {
+	if expired {
+		ttl = -time.Second
+	}
+	writes := srv.writes.WithTTL(ttl)
+	var err error
+	switch name {
+	case "set":
+		_, err = writes.Put(actor, key, value)
+	case "add":
+		err = writes.Add(actor, key, value)
+		if errors.Is(err, storage.ErrKeyExists) {
+			return replyNotStored, nil
+		}
+	case "replace":
+		err = writes.Update(actor, key, value)
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			return replyNotStored, nil
+		}
+	case "cas":
+		err = writes.CompareVersionAndSet(actor, key, unique, value)
+		switch {
+		case errors.Is(err, storage.ErrValueMismatch):
+			return replyExists, nil
+		case errors.Is(err, storage.ErrKeyNotFound):
+			return replyNotFound, nil
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return replyStored, nil
+}
+
+// delete implements delete <key> [noreply].
+func (s *session) delete(args []string) {
+	if len(args) != 1 && len(args) != 2 {
+		s.reply(false, replyError)
+		return
+	}
+	quiet := noreply(args, 1)
+	if len(args) == 2 && !quiet {
+		s.clientError(errBadFormat)
+		return
+	}
+	if len(args[0]) > MaxKeyLength {
+		s.clientError(errKeyTooLong)
+		return
+	}
+
+	deleted, err := s.srv.writes.Delete(s.actor(), []string{args[0]})
+	switch {
+	case err != nil:
+		s.writeError(quiet, err)
+	case len(deleted) == 0:
+		s.reply(quiet, replyNotFound)
+	default:
+		s.reply(quiet, replyDeleted)
+	}
+}
+
+// touch implements touch <key> <exptime> [noreply].
+func (s *session) touch(args []string) {
+	if len(args) != 2 && len(args) != 3 {
+		s.reply(false, replyError)
+		return
+	}
+	quiet := noreply(args, 2)
+	exptime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || (len(args) == 3 && !quiet) {
+		s.clientError(errBadFormat)
+		return
+	}
+	if len(args[0]) > MaxKeyLength {
+		s.clientError(errKeyTooLong)
+		return
+	}
+
+	ttl, expired := expiration(exptime)
+	if expired {
+		var deleted []string
+		deleted, err = s.srv.writes.Delete(s.actor(), []string{args[0]})
+		if err == nil && len(deleted) == 0 {
+			err = storage.ErrKeyNotFound
+		}
+	} else {
+		err = s.srv.writes.Expire(args[0], ttl)
+	}
+	switch {
+	case err == nil:
+		s.reply(quiet, replyTouched)
+	case errors.Is(err, storage.ErrKeyNotFound):
+		s.reply(quiet, replyNotFound)
+	default:
+		s.writeError(quiet, err)
+	}
+}
+
+// incr implements incr|decr <key> <value> [noreply].
+func (s *session) incr(args []string, decr bool) {
+	if len(args) != 2 && len(args) != 3 {
+		s.reply(false, replyError)
+		return
+	}
+	quiet := noreply(args, 2)
+	if len(args) == 3 && !quiet {
+		s.clientError(errBadFormat)
+		return
+	}
+	delta, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		s.clientError(errInvalidDelta)
+		return
+	}
+	if len(args[0]) > MaxKeyLength {
+		s.clientError(errKeyTooLong)
+		return
+	}
+
+	result, reply, err := s.srv.incrBy(s.actor(), args[0], delta, decr)
+	switch {
+	case err != nil:
+		s.writeError(quiet, err)
+	case reply != "":
+		s.reply(quiet, reply)
+	default:
+		s.reply(quiet, strconv.FormatUint(result, 10))
+	}
+}
+
+// incrBy adds or subtracts delta with compare-and-set so concurrent
+// updates are not lost. As in memcached, incr wraps around at 2^64 and
+// decr stops at 0. String values stay strings and numbers stay numbers.
+func (srv *Server) incrBy(actor audit.Actor, key string, delta uint64, decr bool) (uint64, string, error) {
+	for attempt := 0; attempt < maxIncrAttempts; attempt++ {
+		data, err := srv.repo.GetValue(key)
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			return 0, replyNotFound, nil
+		}
+		if err != nil {
+			return 0, "", err
+		}
+
+		current := data[0].([]any)[1]
+		n, ok := unsignedValue(current)
+		if !ok {
+			return 0, "CLIENT_ERROR " + errNonNumeric, nil
+		}
+		switch {
+		case !decr:
+			n += delta
+		case delta > n:
+			n = 0
+		default:
+			n -= delta
+		}
+
+		var next any = n
+		switch {
+		case isString(current):
+			next = strconv.FormatUint(n, 10)
+		case n <= math.MaxInt64:
+			next = int64(n)
+		}
+		err = srv.writes.CompareAndSet(actor, key, current, next)
+		if err == nil {
+			return n, "", nil
+		}
+		if !errors.Is(err, storage.ErrValueMismatch) && !errors.Is(err, storage.ErrKeyNotFound) {
+			return 0, "", err
+		}
+	}
+	log.Logger.Warnw("Memcached incr gave up under contention", "key", key)
+	return 0, "SERVER_ERROR " + errContention, nil
+}
+
+func isString(value any) bool {
+	_, ok := value.(string)
+	return ok
+}
+
+// unsignedValue reads a stored value as a 64-bit unsigned integer.
+func unsignedValue(value any) (uint64, bool) {
+	switch v := value.(type) {
+	case string:
+		n, err := strconv.ParseUint(v, 10, 64)
+		return n, err == nil
+	case json.Number:
+		n, err := strconv.ParseUint(string(v), 10, 64)
+		return n, err == nil
+	case int:
+		return uint64(v), v >= 0
+	case int8:
+		return uint64(v), v >= 0
+	case int16:
+		return uint64(v), v >= 0
+	case int32:
+		return uint64(v), v >= 0
+	case int64:
+		return uint64(v), v >= 0
+	case uint:
+		return uint64(v), true
+	case uint8:
+		return uint64(v), true
+	case uint16:
+		return uint64(v), true
+	case uint32:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	case float64:
+		return uint64(v), v == math.Trunc(v) && v >= 0 && v < math.MaxUint64
+	}
+	return 0, false
+}
@@ -0,0 +1,236 @@
+// Package memcache serves the key-value storage over the memcached text
+// protocol, so legacy memcached clients can use it.
+package memcache
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"kvManager/internal/audit"
+	"kvManager/internal/handlers"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+// Defaults used when Config leaves a limit unset. They match memcached.
+const (
+	DefaultMaxValueBytes = 1 << 20
+	MaxKeyLength         = 250
+)
+
+// maxLineLength is the longest command line accepted.
+const maxLineLength = 2048
+
+// ErrServerClosed is returned by Serve after Close.
+var ErrServerClosed = errors.New("memcache: server closed")
+
+// errLineTooLong ends a connection sending a command line longer than
+// maxLineLength.
+var errLineTooLong = errors.New("line too long")
+
+// anonymousPrincipal is the principal of writes made without
+// authentication.
+const anonymousPrincipal = "anonymous"
+
+// Config configures a Server.
+type Config struct {
+	// MaxValueBytes limits the size of a stored item.
+	MaxValueBytes int
+	// Username and Password are required before any other command, sent
+	// as the data of a set as in memcached's text protocol authentication.
+	// Authentication is disabled when Password is empty.
+	Username string
+	Password string
+}
+
+// Server translates memcached commands into KvRepository calls. Writes go
+// through the checked write path of the HTTP API, so they are validated,
+// counted against quotas and audited the same way.
+type Server struct {
+	repo   storage.KvRepository
+	writes *handlers.Writes
+	cfg    Config
+
+	nextID atomic.Int64
+
+	mu       sync.Mutex
+	closed   bool
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+}
+
+func NewServer(repo storage.KvRepository, writes *handlers.Writes, cfg Config) *Server {
+	if cfg.MaxValueBytes <= 0 {
+		cfg.MaxValueBytes = DefaultMaxValueBytes
+	}
+	return &Server{
+		repo:   repo,
+		writes: writes,
+		cfg:    cfg,
+		conns:  make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts connections on listener until Close is called.
+func (srv *Server) Serve(listener net.Listener) error {
+	srv.mu.Lock()
+	if srv.closed {
+		srv.mu.Unlock()
+		return ErrServerClosed
+	}
+	srv.listener = listener
+	srv.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if srv.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if !srv.track(conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		go srv.serveConn(conn)
+	}
+}
+
+// Close stops accepting connections and closes the open ones.
+func (srv *Server) Close() error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.closed = true
+	var err error
+	if srv.listener != nil {
+		err = srv.listener.Close()
+	}
+	for conn := range srv.conns {
+		conn.Close()
+	}
+	return err
+}
+
+func (srv *Server) isClosed() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.closed
+}
+
+func (srv *Server) track(conn net.Conn) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.closed {
+		return false
+	}
+	srv.conns[conn] = struct{}{}
+	return true
+}
+
+func (srv *Server) untrack(conn net.Conn) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	delete(srv.conns, conn)
+}
+
+// session is the state of one client connection.
+type session struct {
+	srv           *Server
+	id            int64
+	remote        string
+	r             *bufio.Reader
+	w             *bufio.Writer
+	authenticated bool
+	quit          bool
+}
+
+func (srv *Server) serveConn(conn net.Conn) {
+	defer srv.untrack(conn)
+	defer conn.Close()
+
+	s := &session{
+		srv:           srv,
+		id:            srv.nextID.Add(1),
+		remote:        conn.RemoteAddr().String(),
+		r:             bufio.NewReader(conn),
+		w:             bufio.NewWriter(conn),
+		authenticated: srv.cfg.Password == "",
+	}
+	log.Logger.Debugw("Memcached connection opened", "client_id", s.id, "remote", s.remote)
+	defer log.Logger.Debugw("Memcached connection closed", "client_id", s.id, "remote", s.remote)
+
+	for !s.quit {
+		line, err := s.readLine()
+		if errors.Is(err, errLineTooLong) {
+			log.Logger.Warnw("Memcached line too long", "client_id", s.id, "remote", s.remote)
+			s.clientError("line too long")
+			s.w.Flush()
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !srv.isClosed() {
+				log.Logger.Debugw("Memcached read failed", "client_id", s.id, "error", err)
+			}
+			return
+		}
+
+		err = s.dispatch(line)
+		if err != nil {
+			log.Logger.Debugw("Memcached read failed", "client_id", s.id, "error", err)
+			return
+		}
+		// Pipelined commands are answered together once the client
+		// stops sending.
+		if s.r.Buffered() > 0 && !s.quit {
+			continue
+		}
+		if err := s.w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// actor returns who the writes of the session are audited as.
+func (s *session) actor() audit.Actor {
+	principal := anonymousPrincipal
+	if s.srv.cfg.Password != "" {
+		principal = "memcache:" + s.srv.cfg.Username
+	}
+	host, _, err := net.SplitHostPort(s.remote)
+	if err != nil {
+		host = s.remote
+	}
+	return audit.Actor{Principal: principal, ClientIP: host}
+}
+
+// checkCredentials compares the data of an authenticating set, "username
+// password", with the configured ones in constant time.
+func (srv *Server) checkCredentials(data string) bool {
+	expected := srv.cfg.Username + " " + srv.cfg.Password
+	return subtle.ConstantTimeCompare([]byte(data), []byte(expected)) == 1
+}
+
+// readLine reads a command line without its line terminator.
+func (s *session) readLine() (string, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := s.r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		line = append(line, chunk...)
+		if len(line) > maxLineLength {
+			return "", errLineTooLong
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
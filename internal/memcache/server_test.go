@@ -0,0 +1,417 @@
+package memcache_test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"go.uber.org/mock/gomock"
+
+	"kvManager/internal/audit"
+	"kvManager/internal/handlers"
+	kvmemcache "kvManager/internal/memcache"
+	"kvManager/internal/mocks"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/pkg/resilience"
+	"kvManager/internal/storage"
+)
+
+// serve starts a server on a local port and returns its address.
+func serve(t *testing.T, repo storage.KvRepository, cfg kvmemcache.Config) string {
+	t.Helper()
+	versions, _ := repo.(storage.VersionRepository)
+	meta, _ := repo.(storage.MetadataRepository)
+	return serveHandler(t, &handlers.Handler{Repo: repo, Versions: versions, Metadata: meta}, cfg)
+}
+
+// serveHandler starts a server writing through the checks of handler.
+func serveHandler(t *testing.T, handler *handlers.Handler, cfg kvmemcache.Config) string {
+	t.Helper()
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	server := kvmemcache.NewServer(handler.Repo, handler.Writes(), cfg)
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return listener.Addr().String()
+}
+
+func TestMemcacheCommands(t *testing.T) {
+	mem := storage.NewMemoryRepository()
+	err := mem.AddValue("doc", map[string]any{"a": int64(1)})
+	if err != nil {
+		t.Fatalf("AddValue: %v", err)
+	}
+	client := memcache.New(serve(t, mem, kvmemcache.Config{MaxValueBytes: 64}))
+
+	var item *memcache.Item
+	testCases := []struct {
+		name     string
+		call     func() (any, error)
+		expected string
+		err      error
+	}{
+		{name: "get missing", call: func() (any, error) { return client.Get("k") }, err: memcache.ErrCacheMiss},
+		{name: "set", call: func() (any, error) { return nil, client.Set(&memcache.Item{Key: "k", Value: []byte("v")}) }},
+		{name: "get", call: func() (any, error) { return getValue(client, "k") }, expected: "v"},
+		{name: "get json document", call: func() (any, error) { return getValue(client, "doc") }, expected: `{"a":1}`},
+		{name: "add existing", call: func() (any, error) { return nil, client.Add(&memcache.Item{Key: "k", Value: []byte("w")}) }, err: memcache.ErrNotStored},
+		{name: "add new", call: func() (any, error) { return nil, client.Add(&memcache.Item{Key: "n", Value: []byte("1")}) }},
+		{name: "replace missing", call: func() (any, error) { return nil, client.Replace(&memcache.Item{Key: "x", Value: []byte("1")}) }, err: memcache.ErrNotStored},
+		{name: "replace existing", call: func() (any, error) { return nil, client.Replace(&memcache.Item{Key: "k", Value: []byte("w")}) }},
+		{name: "get replaced", call: func() (any, error) { return getValue(client, "k") }, expected: "w"},
+		{name: "get multi", call: func() (any, error) {
+			items, err := client.GetMulti([]string{"k", "x", "n"})
+			return len(items), err
+		}, expected: "2"},
+		{name: "gets", call: func() (any, error) {
+			var err error
+			item, err = client.Get("k")
+			return nil, err
+		}},
+		{name: "cas", call: func() (any, error) {
+			item.Value = []byte("cas1")
+			return nil, client.CompareAndSwap(item)
+		}},
+		{name: "cas stale", call: func() (any, error) {
+			item.Value = []byte("cas2")
+			return nil, client.CompareAndSwap(item)
+		}, err: memcache.ErrCASConflict},
+		{name: "get after cas", call: func() (any, error) { return getValue(client, "k") }, expected: "cas1"},
+		{name: "gets before written back", call: func() (any, error) {
+			var err error
+			item, err = client.Get("k")
+			return nil, err
+		}},
+		{name: "set other value", call: func() (any, error) { return nil, client.Set(&memcache.Item{Key: "k", Value: []byte("other")}) }},
+		{name: "write back", call: func() (any, error) { return nil, client.Set(&memcache.Item{Key: "k", Value: []byte("cas1")}) }},
+		{name: "cas after written back", call: func() (any, error) {
+			item.Value = []byte("cas3")
+			return nil, client.CompareAndSwap(item)
+		}, err: memcache.ErrCASConflict},
+		{name: "cas missing", call: func() (any, error) {
+			return nil, client.CompareAndSwap(&memcache.Item{Key: "x", Value: []byte("1")})
+		}, err: memcache.ErrCacheMiss},
+		{name: "incr", call: func() (any, error) { return client.Increment("n", 5) }, expected: "6"},
+		{name: "get incremented", call: func() (any, error) { return getValue(client, "n") }, expected: "6"},
+		{name: "decr below zero", call: func() (any, error) { return client.Decrement("n", 10) }, expected: "0"},
+		{name: "incr missing", call: func() (any, error) { return client.Increment("x", 1) }, err: memcache.ErrCacheMiss},
+		{name: "incr non numeric", call: func() (any, error) { return client.Increment("k", 1) }, err: errors.New("memcache: client error: cannot increment or decrement non-numeric value")},
+		{name: "touch", call: func() (any, error) { return nil, client.Touch("k", 60) }},
+		{name: "touch missing", call: func() (any, error) { return nil, client.Touch("x", 60) }, err: memcache.ErrCacheMiss},
+		{name: "flags", call: func() (any, error) { return nil, client.Set(&memcache.Item{Key: "f", Value: []byte("1"), Flags: 1}) }, err: errors.New("CLIENT_ERROR flags are not supported")},
+		{name: "too large", call: func() (any, error) {
+			return nil, client.Set(&memcache.Item{Key: "big", Value: []byte(strings.Repeat("a", 65))})
+		}, err: errors.New("SERVER_ERROR object too large for cache")},
+		{name: "get after too large", call: func() (any, error) { return getValue(client, "k") }, expected: "cas1"},
+		{name: "delete", call: func() (any, error) { return nil, client.Delete("k") }},
+		{name: "delete missing", call: func() (any, error) { return nil, client.Delete("k") }, err: memcache.ErrCacheMiss},
+		{name: "set expired", call: func() (any, error) {
+			return nil, client.Set(&memcache.Item{Key: "e", Value: []byte("1"), Expiration: -1})
+		}},
+		{name: "get expired", call: func() (any, error) { return client.Get("e") }, err: memcache.ErrCacheMiss},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := tc.call()
+			if tc.err != nil {
+				// gomemcache quotes the reply lines it has no error for.
+				if err == nil || !strings.Contains(err.Error(), tc.err.Error()) {
+					t.Fatalf("Expected error %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.expected != "" && fmt.Sprint(result) != tc.expected {
+				t.Errorf("Expected %s, got %v", tc.expected, result)
+			}
+		})
+	}
+
+	value, err := mem.GetValue("n")
+	if err != nil {
+		t.Fatalf("GetValue: %v", err)
+	}
+	if stored := value[0].([]any)[1]; stored != "0" {
+		t.Errorf("Expected counter to stay a string, got %#v", stored)
+	}
+}
+
+func getValue(client *memcache.Client, key string) (string, error) {
+	item, err := client.Get(key)
+	if err != nil {
+		return "", err
+	}
+	return string(item.Value), nil
+}
+
+func TestMemcacheExpiration(t *testing.T) {
+	mem := storage.NewMemoryRepository()
+	client := memcache.New(serve(t, mem, kvmemcache.Config{}))
+
+	testCases := []struct {
+		name       string
+		expiration int32
+		minTTL     time.Duration
+		maxTTL     time.Duration
+	}{
+		{name: "relative", expiration: 60, minTTL: 59 * time.Second, maxTTL: time.Minute},
+		{name: "absolute", expiration: int32(time.Now().Add(time.Hour).Unix()), minTTL: 59 * time.Minute, maxTTL: time.Hour},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := client.Set(&memcache.Item{Key: tc.name, Value: []byte("v"), Expiration: tc.expiration})
+			if err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+			data, err := mem.GetValue(tc.name)
+			if err != nil {
+				t.Fatalf("GetValue: %v", err)
+			}
+			expiresAt, ok := storage.TupleExpiry(data[0].([]any))
+			if !ok {
+				t.Fatalf("Expected a TTL")
+			}
+			if ttl := time.Until(expiresAt); ttl < tc.minTTL || ttl > tc.maxTTL {
+				t.Errorf("Expected TTL between %s and %s, got %s", tc.minTTL, tc.maxTTL, ttl)
+			}
+
+			err = client.Replace(&memcache.Item{Key: tc.name, Value: []byte("w")})
+			if err != nil {
+				t.Fatalf("Replace: %v", err)
+			}
+			data, err = mem.GetValue(tc.name)
+			if err != nil {
+				t.Fatalf("GetValue: %v", err)
+			}
+			if _, ok := storage.TupleExpiry(data[0].([]any)); ok {
+				t.Errorf("Expected replace without expiration to clear the TTL")
+			}
+		})
+	}
+}
+
+func TestMemcacheIncrConcurrent(t *testing.T) {
+	mem := storage.NewMemoryRepository()
+	client := memcache.New(serve(t, mem, kvmemcache.Config{}))
+	client.MaxIdleConns = 8
+	err := client.Set(&memcache.Item{Key: "counter", Value: []byte("0")})
+	if err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8*25)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				_, err := client.Increment("counter", 1)
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Increment: %v", err)
+		}
+	}
+
+	value, err := getValue(client, "counter")
+	if err != nil || value != "200" {
+		t.Errorf("Expected 200, got %q, %v", value, err)
+	}
+}
+
+func TestMemcacheUnavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockKvRepository(ctrl)
+	client := memcache.New(serve(t, mockRepo, kvmemcache.Config{}))
+
+	mockRepo.EXPECT().DeleteValues([]string{"k"}).Return(nil, resilience.ErrCircuitOpen).Times(1)
+	err := client.Delete("k")
+	if err == nil || !strings.Contains(err.Error(), "SERVER_ERROR storage temporarily unavailable") {
+		t.Errorf("Expected unavailable error, got %v", err)
+	}
+}
+
+func TestMemcacheRawProtocol(t *testing.T) {
+	mem := storage.NewMemoryRepository()
+	conn, err := net.Dial("tcp", serve(t, mem, kvmemcache.Config{}))
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = conn.Write([]byte("set a 0 0 1 noreply\r\nx\r\nbogus\r\nset b 0 0 1\r\nyz\r\nversion\r\nget a b\r\n"))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	expected := []string{
+		"ERROR",
+		"CLIENT_ERROR bad data chunk",
+		"ERROR",
+		"VERSION kvstorage",
+		"VALUE a 0 1",
+		"x",
+		"END",
+	}
+	r := bufio.NewReader(conn)
+	for _, want := range expected {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		if got := strings.TrimRight(line, "\r\n"); got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	}
+}
+
+func TestMemcacheWriteChecks(t *testing.T) {
+	mem := storage.NewMemoryRepository()
+	sink, err := audit.OpenFile(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer sink.Close()
+	handler := &handlers.Handler{
+		Repo:     mem,
+		Versions: mem,
+		Usage:    mem,
+		Quotas:   &handlers.Quotas{Default: handlers.Quota{MaxKeys: 1}},
+		Audit:    &handlers.Audit{Logger: audit.NewLogger(sink, false)},
+	}
+	conn, err := net.Dial("tcp", serveHandler(t, handler, kvmemcache.Config{Username: "app", Password: "secret"}))
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	tests := []struct {
+		name     string
+		request  string
+		expected string
+	}{
+		{"unauthenticated", "get k\r\n", "CLIENT_ERROR unauthenticated"},
+		{"wrong password", "set auth 0 0 9\r\napp wrong\r\n", "CLIENT_ERROR authentication failure"},
+		{"authenticate", "set auth 0 0 10\r\napp secret\r\n", "STORED"},
+		{"reserved key", "set _query 0 0 1\r\nv\r\n", "CLIENT_ERROR " + handlers.ErrReservedKey},
+		{"set", "set k 0 0 1\r\nv\r\n", "STORED"},
+		{"over quota", "add other 0 0 1\r\nv\r\n", "CLIENT_ERROR " + handlers.ErrQuotaExceeded},
+		{"delete", "delete k\r\n", "DELETED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := conn.Write([]byte(tt.request))
+			if err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if !strings.HasPrefix(line, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, line)
+			}
+		})
+	}
+
+	records, err := sink.Query(audit.Query{})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var actual []string
+	for _, record := range records {
+		actual = append(actual, fmt.Sprintf("%s %s %s", record.Principal, record.Operation, record.Key))
+	}
+	expected := []string{"memcache:app add k", "memcache:app delete k"}
+	if strings.Join(actual, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Expected records %v, got %v", expected, actual)
+	}
+}
+
+func TestMemcacheAddErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockKvRepository(ctrl)
+	client := memcache.New(serve(t, mockRepo, kvmemcache.Config{}))
+
+	mockRepo.EXPECT().AddValue("k", "v").Return(storage.ErrKeyExists).Times(1)
+	mockRepo.EXPECT().AddValue("k", "v").Return(errors.New("connection reset")).Times(1)
+
+	err := client.Add(&memcache.Item{Key: "k", Value: []byte("v")})
+	if !errors.Is(err, memcache.ErrNotStored) {
+		t.Errorf("Expected not stored for an existing key, got %v", err)
+	}
+	err = client.Add(&memcache.Item{Key: "k", Value: []byte("v")})
+	if err == nil || !strings.Contains(err.Error(), "SERVER_ERROR internal error") {
+		t.Errorf("Expected internal error for a failing storage, got %v", err)
+	}
+}
+
+// TestMemcacheWriteTTL checks that storage commands write the exptime in
+// the same storage call as the value, so a failed write leaves no key
+// without its TTL.
+func TestMemcacheWriteTTL(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockKvRepository(ctrl)
+	mockMeta := mocks.NewMockMetadataRepository(ctrl)
+	mockWrites := mocks.NewMockAnnotatedRepository(ctrl)
+	handler := &handlers.Handler{Repo: mockRepo, Metadata: mockMeta}
+	client := memcache.New(serveHandler(t, handler, kvmemcache.Config{}))
+
+	minute, none, expired := time.Minute, time.Duration(0), -time.Second
+	gomock.InOrder(
+		mockMeta.EXPECT().Annotated(storage.Annotation{Writer: "anonymous", TTL: &minute}).Return(mockWrites),
+		mockWrites.EXPECT().PutValue("k", "v").Return(false, errors.New("connection reset")),
+		mockMeta.EXPECT().Annotated(storage.Annotation{Writer: "anonymous", TTL: &minute}).Return(mockWrites),
+		mockWrites.EXPECT().AddValue("k", "v").Return(nil),
+		mockMeta.EXPECT().Annotated(storage.Annotation{Writer: "anonymous", TTL: &none}).Return(mockWrites),
+		mockWrites.EXPECT().UpdateValue("k", "w").Return(nil),
+		mockMeta.EXPECT().Annotated(storage.Annotation{Writer: "anonymous", TTL: &expired}).Return(mockWrites),
+		mockWrites.EXPECT().PutValue("k", "x").Return(true, nil),
+	)
+
+	err := client.Set(&memcache.Item{Key: "k", Value: []byte("v"), Expiration: 60})
+	if err == nil || !strings.Contains(err.Error(), "SERVER_ERROR internal error") {
+		t.Errorf("Expected internal error for a failing storage, got %v", err)
+	}
+	err = client.Add(&memcache.Item{Key: "k", Value: []byte("v"), Expiration: 60})
+	if err != nil {
+		t.Errorf("Add: %v", err)
+	}
+	err = client.Replace(&memcache.Item{Key: "k", Value: []byte("w")})
+	if err != nil {
+		t.Errorf("Replace: %v", err)
+	}
+	err = client.Set(&memcache.Item{Key: "k", Value: []byte("x"), Expiration: -1})
+	if err != nil {
+		t.Errorf("Set expired: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"github.com/tarantool/go-tarantool/v2"
+
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+// grantExpr gives user what the service needs at run time: read and
+// write on the spaces it serves and their sequences, read on the
+// migration space and execute on the kv_api functions. The functions are
+// registered in _func first; the ones that run DDL or checkpoints are
+// setuid so user needs no DDL rights of its own. Triggers are not
+// granted, they run inside the writes.
+const grantExpr = `
+local user, spaces, read_spaces = ...
+for _, name in ipairs(spaces) do
+    local space = box.space[name]
+    if space ~= nil then
+        box.schema.user.grant(user, 'read,write', 'space', name, {if_not_exists = true})
+        local link = box.space._space_sequence:get(space.id)
+        if link ~= nil then
+            local sequence = box.space._sequence:get(link[2])
+            box.schema.user.grant(user, 'read,write', 'sequence', sequence[3], {if_not_exists = true})
+        end
+    end
+end
+for _, name in ipairs(read_spaces) do
+    if box.space[name] ~= nil then
+        box.schema.user.grant(user, 'read', 'space', name, {if_not_exists = true})
+    end
+end
+local setuid = {create_index = true, drop_index = true, snapshot = true}
+for name, fn in pairs(rawget(_G, 'kv_api') or {}) do
+    if type(fn) == 'function' and not name:find('_trigger$') then
+        local func_name = 'kv_api.' .. name
+        box.schema.func.create(func_name, {setuid = setuid[name] == true, if_not_exists = true})
+        box.schema.user.grant(user, 'execute', 'function', func_name, {if_not_exists = true})
+    end
+end
+return true
+`
+
+// GrantAccess gives the service user the rights it needs on the spaces
+// created by the migrations and on the kv_api functions. It runs with an
+// admin connection after the migrations and the module push, and can run
+// again at every start.
+func GrantAccess(conn tarantool.Doer, user string) error {
+	spaces := []string{storage.JsonDataSpace, storage.SchemaSpace, storage.IndexSpace,
+		storage.UsageSpace, storage.AuditSpace, storage.HistorySpace, storage.TrashSpace,
+		storage.BackupSpace}
+	readSpaces := []string{storage.MigrationSpace}
+	_, err := conn.Do(tarantool.NewEvalRequest(grantExpr).Args([]any{user, spaces, readSpaces})).Get()
+	if err != nil {
+		log.Logger.Errorw("Failed to grant access", "user", user, "error", err)
+		return err
+	}
+	log.Logger.Infow("Access granted", "user", user)
+	return nil
+}
@@ -0,0 +1,326 @@
+package migrations
+
+import (
+	"kvManager/internal/storage"
+)
+
+// Migration is a versioned schema change executed as a Lua chunk through
+// eval. Args are passed to the chunk as `...`, so space and index names
+// come from the storage constants instead of being duplicated in Lua.
+//
+// A migration and its record in storage.MigrationSpace are applied in one
+// transaction. NonAtomic migrations run DDL Tarantool refuses inside a
+// transaction, like a format check of a non-empty space; they must be
+// safe to run again, since a failure before the record re-runs them.
+type Migration struct {
+	Version   uint64
+	Name      string
+	Up        string
+	Args      []any
+	NonAtomic bool
+}
+
+// All lists the migrations shipped with this binary in ascending order.
+// Versions must never be reused or reordered once released.
+var All = []Migration{
+	{
+		Version: 1,
+		Name:    "create_json_data",
+		Up: `
+local space_name, index_name = ...
+local space = box.schema.space.create(space_name, {
+    if_not_exists = true,
+    format = {
+        {name = 'key', type = 'string'},
+        {name = 'value', type = 'any'},
+    },
+})
+space:create_index(index_name, {
+    if_not_exists = true,
+    type = 'TREE',
+    parts = {'key'},
+})
+return true
+`,
+		Args: []any{storage.JsonDataSpace, storage.PrimaryIndex},
+	},
+	{
+		Version: 2,
+		Name:    "create_json_schemas",
+		Up: `
+local space_name, index_name = ...
+local space = box.schema.space.create(space_name, {
+    if_not_exists = true,
+    format = {
+        {name = 'prefix', type = 'string'},
+        {name = 'schema', type = 'string'},
+    },
+})
+space:create_index(index_name, {
+    if_not_exists = true,
+    type = 'TREE',
+    parts = {'prefix'},
+})
+return true
+`,
+		Args: []any{storage.SchemaSpace, storage.PrimaryIndex},
+	},
+	{
+		Version: 3,
+		Name:    "create_json_indexes",
+		Up: `
+local space_name, index_name = ...
+local space = box.schema.space.create(space_name, {
+    if_not_exists = true,
+    format = {
+        {name = 'name', type = 'string'},
+        {name = 'path', type = 'string'},
+        {name = 'type', type = 'string'},
+        {name = 'unique', type = 'boolean'},
+    },
+})
+space:create_index(index_name, {
+    if_not_exists = true,
+    type = 'TREE',
+    parts = {'name'},
+})
+return true
+`,
+		Args: []any{storage.IndexSpace, storage.PrimaryIndex},
+	},
+	{
+		Version:   4,
+		Name:      "add_json_data_expires_at",
+		NonAtomic: true,
+		Up: `
+local space_name = ...
+local space = box.space[space_name]
+local format = space:format()
+for _, field in ipairs(format) do
+    if field.name == 'expires_at' then
+        return true
+    end
+end
+table.insert(format, {name = 'expires_at', type = 'number', is_nullable = true})
+space:format(format)
+return true
+`,
+		Args: []any{storage.JsonDataSpace},
+	},
+	{
+		Version: 5,
+		Name:    "create_namespace_usage",
+		Up: `
+local usage_name, index_name, data_name = ...
+local space = box.schema.space.create(usage_name, {
+    if_not_exists = true,
+    format = {
+        {name = 'namespace', type = 'string'},
+        {name = 'keys', type = 'integer'},
+        {name = 'bytes', type = 'integer'},
+    },
+})
+space:create_index(index_name, {
+    if_not_exists = true,
+    type = 'TREE',
+    parts = {'namespace'},
+})
+
+local msgpack = require('msgpack')
+local usage = {}
+for _, tuple in box.space[data_name]:pairs() do
+    local namespace = tuple[1]:match('^([^:]*):') or ''
+    local entry = usage[namespace] or {0, 0}
+    entry[1] = entry[1] + 1
+    entry[2] = entry[2] + #msgpack.encode(tuple[2])
+    usage[namespace] = entry
+end
+for namespace, entry in pairs(usage) do
+    space:replace({namespace, entry[1], entry[2]})
+end
+return true
+`,
+		Args: []any{storage.UsageSpace, storage.PrimaryIndex, storage.JsonDataSpace},
+	},
+	{
+		Version: 6,
+		Name:    "create_audit_log",
+		Up: `
+local space_name, primary_name, key_name, principal_name = ...
+local space = box.schema.space.create(space_name, {
+    if_not_exists = true,
+    format = {
+        {name = 'id', type = 'unsigned'},
+        {name = 'time', type = 'number'},
+        {name = 'principal', type = 'string'},
+        {name = 'request_id', type = 'string'},
+        {name = 'client_ip', type = 'string'},
+        {name = 'key', type = 'string'},
+        {name = 'operation', type = 'string'},
+        {name = 'before_hash', type = 'string'},
+        {name = 'after_hash', type = 'string'},
+        {name = 'before', type = 'string', is_nullable = true},
+        {name = 'after', type = 'string', is_nullable = true},
+    },
+})
+space:create_index(primary_name, {
+    if_not_exists = true,
+    type = 'TREE',
+    parts = {'id'},
+    sequence = true,
+})
+space:create_index(key_name, {
+    if_not_exists = true,
+    type = 'TREE',
+    parts = {'key', 'id'},
+})
+space:create_index(principal_name, {
+    if_not_exists = true,
+    type = 'TREE',
+    parts = {'principal', 'id'},
+})
+return true
+`,
+		Args: []any{storage.AuditSpace, storage.PrimaryIndex, storage.KeyIndex, storage.PrincipalIndex},
+	},
+	{
+		Version: 7,
+		Name:    "create_json_history",
+		Up: `
+local space_name, index_name = ...
+local space = box.schema.space.create(space_name, {
+    if_not_exists = true,
+    format = {
+        {name = 'key', type = 'string'},
+        {name = 'revision', type = 'unsigned'},
+        {name = 'value', type = 'any', is_nullable = true},
+        {name = 'changed_at', type = 'number'},
+        {name = 'deleted', type = 'boolean'},
+    },
+})
+space:create_index(index_name, {
+    if_not_exists = true,
+    type = 'TREE',
+    parts = {'key', 'revision'},
+})
+return true
+`,
+		Args: []any{storage.HistorySpace, storage.PrimaryIndex},
+	},
+	{
+		Version: 8,
+		Name:    "create_json_trash",
+		Up: `
+local space_name, primary_name, purge_name = ...
+local space = box.schema.space.create(space_name, {
+    if_not_exists = true,
+    format = {
+        {name = 'key', type = 'string'},
+        {name = 'value', type = 'any'},
+        {name = 'expires_at', type = 'number', is_nullable = true},
+        {name = 'deleted_at', type = 'number'},
+        {name = 'purge_at', type = 'number'},
+    },
+})
+space:create_index(primary_name, {
+    if_not_exists = true,
+    type = 'TREE',
+    parts = {'key'},
+})
+space:create_index(purge_name, {
+    if_not_exists = true,
+    type = 'TREE',
+    parts = {'purge_at', 'key'},
+})
+return true
+`,
+		Args: []any{storage.TrashSpace, storage.PrimaryIndex, storage.PurgeIndex},
+	},
+	{
+		Version:   9,
+		Name:      "add_json_data_metadata",
+		NonAtomic: true,
+		Up: `
+local space_name = ...
+local space = box.space[space_name]
+local format = space:format()
+local names = {}
+for _, field in ipairs(format) do
+    names[field.name] = true
+end
+for _, field in ipairs({
+    {name = 'created_at', type = 'number', is_nullable = true},
+    {name = 'updated_at', type = 'number', is_nullable = true},
+    {name = 'size', type = 'unsigned', is_nullable = true},
+    {name = 'writer', type = 'string', is_nullable = true},
+    {name = 'labels', type = 'map', is_nullable = true},
+}) do
+    if not names[field.name] then
+        table.insert(format, field)
+    end
+end
+space:format(format)
+return true
+`,
+		Args: []any{storage.JsonDataSpace},
+	},
+	{
+		Version:   10,
+		Name:      "add_json_data_version",
+		NonAtomic: true,
+		Up: `
+local space_name = ...
+local space = box.space[space_name]
+local format = space:format()
+for _, field in ipairs(format) do
+    if field.name == 'version' then
+        return true
+    end
+end
+table.insert(format, {name = 'version', type = 'unsigned', is_nullable = true})
+space:format(format)
+return true
+`,
+		Args: []any{storage.JsonDataSpace},
+	},
+	{
+		Version: 11,
+		Name:    "create_json_backup",
+		Up: `
+local space_name, index_name = ...
+local space = box.schema.space.create(space_name, {
+    if_not_exists = true,
+    format = {
+        {name = 'key', type = 'string'},
+        {name = 'value', type = 'any'},
+    },
+})
+space:create_index(index_name, {
+    if_not_exists = true,
+    type = 'TREE',
+    parts = {'key'},
+})
+return true
+`,
+		Args: []any{storage.BackupSpace, storage.PrimaryIndex},
+	},
+	{
+		Version:   12,
+		Name:      "add_json_trash_tuple",
+		NonAtomic: true,
+		Up: `
+local space_name = ...
+local space = box.space[space_name]
+local format = space:format()
+for _, field in ipairs(format) do
+    if field.name == 'tuple' then
+        return true
+    end
+end
+table.insert(format, {name = 'tuple', type = 'array', is_nullable = true})
+space:format(format)
+return true
+`,
+		Args: []any{storage.TrashSpace},
+	},
+}
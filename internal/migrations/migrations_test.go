@@ -0,0 +1,148 @@
+package migrations_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tarantool/go-iproto"
+	"github.com/tarantool/go-tarantool/v2"
+	"github.com/tarantool/go-tarantool/v2/test_helpers"
+
+	"kvManager/internal/migrations"
+	"kvManager/internal/pkg/log"
+)
+
+func TestMigrationList(t *testing.T) {
+	cases := []struct {
+		name          string
+		migrations    []migrations.Migration
+		expectedError error
+		latest        uint64
+	}{
+		{
+			name:       "shipped migrations",
+			migrations: migrations.All,
+			latest:     migrations.All[len(migrations.All)-1].Version,
+		},
+		{
+			name:       "empty",
+			migrations: nil,
+			latest:     0,
+		},
+		{
+			name:          "duplicate version",
+			migrations:    []migrations.Migration{{Version: 1}, {Version: 1}},
+			expectedError: migrations.ErrInvalidMigrationID,
+			latest:        1,
+		},
+		{
+			name:          "descending versions",
+			migrations:    []migrations.Migration{{Version: 2}, {Version: 1}},
+			expectedError: migrations.ErrInvalidMigrationID,
+			latest:        1,
+		},
+	}
+
+	for _, q := range cases {
+		t.Run(q.name, func(t *testing.T) {
+			migrator := migrations.NewMigrator(nil, q.migrations)
+			err := migrator.Validate()
+			if !errors.Is(err, q.expectedError) {
+				t.Errorf("Expected error '%v', got '%v'", q.expectedError, err)
+			}
+			if migrator.Latest() != q.latest {
+				t.Errorf("Expected latest version %d, got %d", q.latest, migrator.Latest())
+			}
+		})
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	shipped := []migrations.Migration{{Version: 1, Name: "one"}, {Version: 2, Name: "two"}}
+	ok := func(t *testing.T) any { return test_helpers.NewMockResponse(t, []any{true}) }
+	locked := func(t *testing.T) any { return test_helpers.NewMockResponse(t, []any{false}) }
+	at := func(version uint64) func(t *testing.T) any {
+		return func(t *testing.T) any {
+			return test_helpers.NewMockResponse(t, []any{[]any{version, "migration", 0.0}})
+		}
+	}
+	empty := func(t *testing.T) any { return test_helpers.NewMockResponse(t, []any{}) }
+	fail := func(err error) func(t *testing.T) any {
+		return func(t *testing.T) any { return err }
+	}
+
+	cases := []struct {
+		name          string
+		up            bool
+		responses     []func(t *testing.T) any
+		expectedError error
+	}{
+		{
+			name:          "check without migration space",
+			responses:     []func(t *testing.T) any{fail(tarantool.Error{Code: iproto.ER_NO_SUCH_SPACE})},
+			expectedError: migrations.ErrPendingMigrations,
+		},
+		{
+			name:      "check up to date",
+			responses: []func(t *testing.T) any{at(2)},
+		},
+		{
+			name:          "check newer database",
+			responses:     []func(t *testing.T) any{at(3)},
+			expectedError: migrations.ErrSchemaTooNew,
+		},
+		{
+			name: "up applies pending",
+			up:   true,
+			// bootstrap, lock, current, migration 2, unlock
+			responses: []func(t *testing.T) any{ok, ok, at(1), ok, ok},
+		},
+		{
+			name:          "up newer database",
+			up:            true,
+			responses:     []func(t *testing.T) any{ok, ok, at(3), ok},
+			expectedError: migrations.ErrSchemaTooNew,
+		},
+		{
+			name:          "up locked by another instance",
+			up:            true,
+			responses:     []func(t *testing.T) any{ok, locked},
+			expectedError: migrations.ErrMigrationLocked,
+		},
+		{
+			name: "up failed migration",
+			up:   true,
+			responses: []func(t *testing.T) any{ok, ok, empty,
+				fail(tarantool.Error{Code: iproto.ER_PROC_LUA, Msg: "boom"}), ok},
+			expectedError: tarantool.Error{Code: iproto.ER_PROC_LUA, Msg: "boom"},
+		},
+	}
+
+	for _, q := range cases {
+		t.Run(q.name, func(t *testing.T) {
+			responses := make([]any, 0, len(q.responses))
+			for _, response := range q.responses {
+				responses = append(responses, response(t))
+			}
+			doer := test_helpers.NewMockDoer(t, responses...)
+			migrator := migrations.NewMigrator(&doer, shipped)
+			migrator.LockTimeout = 0
+
+			if q.up {
+				err = migrator.Up()
+			} else {
+				err = migrator.Check()
+			}
+			if !errors.Is(err, q.expectedError) {
+				t.Errorf("Expected error '%v', got '%v'", q.expectedError, err)
+			}
+			if len(doer.Requests) != len(q.responses) {
+				t.Errorf("Expected %d requests, got %d", len(q.responses), len(doer.Requests))
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package migrations
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tarantool/go-iproto"
+	"github.com/tarantool/go-tarantool/v2"
+
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+var (
+	ErrSchemaTooNew       = errors.New("database schema is newer than this binary")
+	ErrPendingMigrations  = errors.New("database schema has pending migrations")
+	ErrInvalidMigrationID = errors.New("migration versions must be unique and ascending")
+	ErrMigrationLocked    = errors.New("another instance is applying migrations")
+)
+
+const (
+	// DefaultLockTimeout is how long Up waits for another instance to
+	// finish its migrations.
+	DefaultLockTimeout = time.Minute
+	// lockTTL bounds how long a lock left by a crashed instance blocks
+	// the others.
+	lockTTL      = 10 * time.Minute
+	lockPoll     = 500 * time.Millisecond
+	lockSpace    = "schema_migrations_lock"
+	migrationKey = "migrate"
+)
+
+const bootstrapExpr = `
+local space_name, index_name, lock_name = ...
+local space = box.schema.space.create(space_name, {
+    if_not_exists = true,
+    format = {
+        {name = 'version', type = 'unsigned'},
+        {name = 'name', type = 'string'},
+        {name = 'applied_at', type = 'number'},
+    },
+})
+space:create_index(index_name, {
+    if_not_exists = true,
+    type = 'TREE',
+    parts = {'version'},
+})
+local lock = box.schema.space.create(lock_name, {
+    if_not_exists = true,
+    format = {
+        {name = 'name', type = 'string'},
+        {name = 'owner', type = 'string'},
+        {name = 'expires_at', type = 'number'},
+    },
+})
+lock:create_index(index_name, {
+    if_not_exists = true,
+    type = 'TREE',
+    parts = {'name'},
+})
+return true
+`
+
+// lockExpr takes the migration lock for owner unless another owner holds
+// an unexpired one.
+const lockExpr = `
+local space_name, name, owner, ttl = ...
+local now = require('clock').time()
+return box.atomic(function()
+    local lock = box.space[space_name]:get(name)
+    if lock ~= nil and lock[2] ~= owner and lock[3] > now then
+        return false
+    end
+    box.space[space_name]:replace({name, owner, now + ttl})
+    return true
+end)
+`
+
+const unlockExpr = `
+local space_name, name, owner = ...
+local lock = box.space[space_name]:get(name)
+if lock ~= nil and lock[2] == owner then
+    box.space[space_name]:delete(name)
+end
+return true
+`
+
+// applyExpr runs a migration and records it in the same request, inside
+// one transaction unless the migration opts out. A version that is
+// already recorded is skipped.
+const applyExpr = `
+local space_name, version, name, up, args, atomic = ...
+local space = box.space[space_name]
+if space:get(version) ~= nil then
+    return false
+end
+local chunk = assert(loadstring(up, 'migration ' .. name))
+local function apply()
+    chunk(unpack(args))
+    space:insert({version, name, require('clock').time()})
+end
+if atomic then
+    box.atomic(apply)
+else
+    apply()
+end
+return true
+`
+
+// Migrator applies Migrations and records them in storage.MigrationSpace.
+// Instances applying migrations at the same time take turns through a
+// lock in the schema_migrations_lock space.
+type Migrator struct {
+	conn       tarantool.Doer
+	migrations []Migration
+	owner      string
+	// LockTimeout is how long Up waits for the lock.
+	LockTimeout time.Duration
+}
+
+func NewMigrator(conn tarantool.Doer, migrations []Migration) *Migrator {
+	return &Migrator{conn: conn, migrations: migrations, owner: newOwner(),
+		LockTimeout: DefaultLockTimeout}
+}
+
+// Latest returns the highest version known to this binary.
+func (m *Migrator) Latest() uint64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Current returns the highest version recorded in the database, which is
+// 0 before the first migration created storage.MigrationSpace.
+func (m *Migrator) Current() (uint64, error) {
+	req := tarantool.NewSelectRequest(storage.MigrationSpace).Index(storage.PrimaryIndex).
+		Iterator(tarantool.IterLe).Limit(1)
+	data, err := m.conn.Do(req).Get()
+	var boxErr tarantool.Error
+	if errors.As(err, &boxErr) && boxErr.Code == iproto.ER_NO_SUCH_SPACE {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	tuple, ok := data[0].([]any)
+	if !ok || len(tuple) == 0 {
+		return 0, fmt.Errorf("unexpected migration tuple: %v", data[0])
+	}
+	version, ok := toVersion(tuple[0])
+	if !ok {
+		return 0, fmt.Errorf("unexpected migration version: %v", tuple[0])
+	}
+	return version, nil
+}
+
+// Check fails when the database was migrated by a newer binary or when
+// migrations of this binary were not applied yet.
+func (m *Migrator) Check() error {
+	current, err := m.Current()
+	if err != nil {
+		return err
+	}
+	return m.compare(current)
+}
+
+// Up applies all pending migrations in order while holding the migration
+// lock.
+func (m *Migrator) Up() error {
+	err := m.Validate()
+	if err != nil {
+		return err
+	}
+	err = m.bootstrap()
+	if err != nil {
+		return err
+	}
+	err = m.lock()
+	if err != nil {
+		return err
+	}
+	defer m.unlock()
+
+	current, err := m.Current()
+	if err != nil {
+		return err
+	}
+	err = m.compare(current)
+	if err != nil && !errors.Is(err, ErrPendingMigrations) {
+		return err
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version <= current {
+			continue
+		}
+
+		log.Logger.Infow("Applying migration",
+			"version", migration.Version, "name", migration.Name)
+		args := migration.Args
+		if args == nil {
+			args = []any{}
+		}
+		req := tarantool.NewEvalRequest(applyExpr).Args([]any{storage.MigrationSpace,
+			migration.Version, migration.Name, migration.Up, args, !migration.NonAtomic})
+		_, err = m.conn.Do(req).Get()
+		if err != nil {
+			log.Logger.Errorw("Migration failed",
+				"version", migration.Version, "name", migration.Name, "error", err)
+			return fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	log.Logger.Infow("Database schema is up to date", "version", m.Latest())
+	return nil
+}
+
+func (m *Migrator) compare(current uint64) error {
+	latest := m.Latest()
+	if current > latest {
+		log.Logger.Errorw("Database schema is newer than binary",
+			"db_version", current, "binary_version", latest)
+		return fmt.Errorf("%w: database at %d, binary knows %d", ErrSchemaTooNew, current, latest)
+	}
+	if current < latest {
+		return fmt.Errorf("%w: database at %d, binary knows %d", ErrPendingMigrations, current, latest)
+	}
+	return nil
+}
+
+// Validate checks that migration versions are unique and ascending.
+func (m *Migrator) Validate() error {
+	var prev uint64
+	for _, migration := range m.migrations {
+		if migration.Version <= prev {
+			return fmt.Errorf("%w: %d after %d", ErrInvalidMigrationID, migration.Version, prev)
+		}
+		prev = migration.Version
+	}
+	return nil
+}
+
+func (m *Migrator) bootstrap() error {
+	req := tarantool.NewEvalRequest(bootstrapExpr).
+		Args([]any{storage.MigrationSpace, storage.PrimaryIndex, lockSpace})
+	_, err := m.conn.Do(req).Get()
+	return err
+}
+
+// newOwner names the lock holder so a migrator only releases its own
+// lock.
+func newOwner() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// lock waits up to LockTimeout for the migration lock.
+func (m *Migrator) lock() error {
+	deadline := time.Now().Add(m.LockTimeout)
+	for {
+		req := tarantool.NewEvalRequest(lockExpr).
+			Args([]any{lockSpace, migrationKey, m.owner, lockTTL.Seconds()})
+		data, err := m.conn.Do(req).Get()
+		if err != nil {
+			return err
+		}
+		if len(data) > 0 && data[0] == true {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return ErrMigrationLocked
+		}
+		log.Logger.Infow("Waiting for another instance to apply migrations")
+		time.Sleep(min(lockPoll, time.Until(deadline)))
+	}
+}
+
+func (m *Migrator) unlock() {
+	req := tarantool.NewEvalRequest(unlockExpr).Args([]any{lockSpace, migrationKey, m.owner})
+	_, err := m.conn.Do(req).Get()
+	if err != nil {
+		log.Logger.Warnw("Failed to release the migration lock", "error", err)
+	}
+}
+
+func toVersion(v any) (uint64, bool) {
+	switch n := v.(type) {
+	case uint8:
+		return uint64(n), true
+	case uint16:
+		return uint64(n), true
+	case uint32:
+		return uint64(n), true
+	case uint64:
+		return n, true
+	case int8:
+		return uint64(n), n >= 0
+	case int16:
+		return uint64(n), n >= 0
+	case int32:
+		return uint64(n), n >= 0
+	case int64:
+		return uint64(n), n >= 0
+	}
+	return 0, false
+}
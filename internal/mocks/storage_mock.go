@@ -1,16 +1,18 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: kvManager/internal/storage (interfaces: KvRepository)
+// Source: kvManager/internal/storage (interfaces: KvRepository,SchemaRepository,IndexRepository,UsageRepository,HistoryRepository,TrashRepository,MetadataRepository,AnnotatedRepository,MoveRepository,VersionRepository,BackupRepository)
 //
 // Generated by this command:
 //
-//	mockgen -destination=../mocks/storage_mock.go -package=mocks . KvRepository
+//	mockgen -destination=../mocks/storage_mock.go -package=mocks . KvRepository,SchemaRepository,IndexRepository,UsageRepository,HistoryRepository,TrashRepository,MetadataRepository,AnnotatedRepository,MoveRepository,VersionRepository,BackupRepository
 //
 
 // Package mocks is a generated GoMock package.
 package mocks
 
 import (
+	storage "kvManager/internal/storage"
 	reflect "reflect"
+	time "time"
 
 	gomock "go.uber.org/mock/gomock"
 )
@@ -53,6 +55,20 @@ func (mr *MockKvRepositoryMockRecorder) AddValue(key, value any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddValue", reflect.TypeOf((*MockKvRepository)(nil).AddValue), key, value)
 }
 
+// CompareAndSet mocks base method.
+func (m *MockKvRepository) CompareAndSet(key string, expected, value any) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompareAndSet", key, expected, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CompareAndSet indicates an expected call of CompareAndSet.
+func (mr *MockKvRepositoryMockRecorder) CompareAndSet(key, expected, value any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompareAndSet", reflect.TypeOf((*MockKvRepository)(nil).CompareAndSet), key, expected, value)
+}
+
 // DeleteValue mocks base method.
 func (m *MockKvRepository) DeleteValue(key string) error {
 	m.ctrl.T.Helper()
@@ -67,6 +83,35 @@ func (mr *MockKvRepositoryMockRecorder) DeleteValue(key any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteValue", reflect.TypeOf((*MockKvRepository)(nil).DeleteValue), key)
 }
 
+// DeleteValues mocks base method.
+func (m *MockKvRepository) DeleteValues(keys []string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteValues", keys)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteValues indicates an expected call of DeleteValues.
+func (mr *MockKvRepositoryMockRecorder) DeleteValues(keys any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteValues", reflect.TypeOf((*MockKvRepository)(nil).DeleteValues), keys)
+}
+
+// ExpireValue mocks base method.
+func (m *MockKvRepository) ExpireValue(key string, ttl time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpireValue", key, ttl)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExpireValue indicates an expected call of ExpireValue.
+func (mr *MockKvRepositoryMockRecorder) ExpireValue(key, ttl any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpireValue", reflect.TypeOf((*MockKvRepository)(nil).ExpireValue), key, ttl)
+}
+
 // GetValue mocks base method.
 func (m *MockKvRepository) GetValue(key string) ([]any, error) {
 	m.ctrl.T.Helper()
@@ -82,6 +127,81 @@ func (mr *MockKvRepositoryMockRecorder) GetValue(key any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetValue", reflect.TypeOf((*MockKvRepository)(nil).GetValue), key)
 }
 
+// GetValues mocks base method.
+func (m *MockKvRepository) GetValues(keys []string) ([]any, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetValues", keys)
+	ret0, _ := ret[0].([]any)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetValues indicates an expected call of GetValues.
+func (mr *MockKvRepositoryMockRecorder) GetValues(keys any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetValues", reflect.TypeOf((*MockKvRepository)(nil).GetValues), keys)
+}
+
+// MergeValue mocks base method.
+func (m *MockKvRepository) MergeValue(key string, patch any) ([]any, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MergeValue", key, patch)
+	ret0, _ := ret[0].([]any)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MergeValue indicates an expected call of MergeValue.
+func (mr *MockKvRepositoryMockRecorder) MergeValue(key, patch any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MergeValue", reflect.TypeOf((*MockKvRepository)(nil).MergeValue), key, patch)
+}
+
+// PutValue mocks base method.
+func (m *MockKvRepository) PutValue(key string, value any) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutValue", key, value)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PutValue indicates an expected call of PutValue.
+func (mr *MockKvRepositoryMockRecorder) PutValue(key, value any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutValue", reflect.TypeOf((*MockKvRepository)(nil).PutValue), key, value)
+}
+
+// QueryIndex mocks base method.
+func (m *MockKvRepository) QueryIndex(query storage.IndexQuery) ([]any, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueryIndex", query)
+	ret0, _ := ret[0].([]any)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryIndex indicates an expected call of QueryIndex.
+func (mr *MockKvRepositoryMockRecorder) QueryIndex(query any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryIndex", reflect.TypeOf((*MockKvRepository)(nil).QueryIndex), query)
+}
+
+// ScanValues mocks base method.
+func (m *MockKvRepository) ScanValues(query storage.ScanQuery) ([]any, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScanValues", query)
+	ret0, _ := ret[0].([]any)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ScanValues indicates an expected call of ScanValues.
+func (mr *MockKvRepositoryMockRecorder) ScanValues(query any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScanValues", reflect.TypeOf((*MockKvRepository)(nil).ScanValues), query)
+}
+
 // UpdateValue mocks base method.
 func (m *MockKvRepository) UpdateValue(key string, value any) error {
 	m.ctrl.T.Helper()
@@ -95,3 +215,767 @@ func (mr *MockKvRepositoryMockRecorder) UpdateValue(key, value any) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateValue", reflect.TypeOf((*MockKvRepository)(nil).UpdateValue), key, value)
 }
+
+// MockSchemaRepository is a mock of SchemaRepository interface.
+type MockSchemaRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockSchemaRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockSchemaRepositoryMockRecorder is the mock recorder for MockSchemaRepository.
+type MockSchemaRepositoryMockRecorder struct {
+	mock *MockSchemaRepository
+}
+
+// NewMockSchemaRepository creates a new mock instance.
+func NewMockSchemaRepository(ctrl *gomock.Controller) *MockSchemaRepository {
+	mock := &MockSchemaRepository{ctrl: ctrl}
+	mock.recorder = &MockSchemaRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSchemaRepository) EXPECT() *MockSchemaRepositoryMockRecorder {
+	return m.recorder
+}
+
+// DeleteSchema mocks base method.
+func (m *MockSchemaRepository) DeleteSchema(prefix string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteSchema", prefix)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteSchema indicates an expected call of DeleteSchema.
+func (mr *MockSchemaRepositoryMockRecorder) DeleteSchema(prefix any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSchema", reflect.TypeOf((*MockSchemaRepository)(nil).DeleteSchema), prefix)
+}
+
+// GetSchemas mocks base method.
+func (m *MockSchemaRepository) GetSchemas() (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSchemas")
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSchemas indicates an expected call of GetSchemas.
+func (mr *MockSchemaRepositoryMockRecorder) GetSchemas() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSchemas", reflect.TypeOf((*MockSchemaRepository)(nil).GetSchemas))
+}
+
+// PutSchema mocks base method.
+func (m *MockSchemaRepository) PutSchema(prefix, schema string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutSchema", prefix, schema)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PutSchema indicates an expected call of PutSchema.
+func (mr *MockSchemaRepositoryMockRecorder) PutSchema(prefix, schema any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutSchema", reflect.TypeOf((*MockSchemaRepository)(nil).PutSchema), prefix, schema)
+}
+
+// MockIndexRepository is a mock of IndexRepository interface.
+type MockIndexRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockIndexRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockIndexRepositoryMockRecorder is the mock recorder for MockIndexRepository.
+type MockIndexRepositoryMockRecorder struct {
+	mock *MockIndexRepository
+}
+
+// NewMockIndexRepository creates a new mock instance.
+func NewMockIndexRepository(ctrl *gomock.Controller) *MockIndexRepository {
+	mock := &MockIndexRepository{ctrl: ctrl}
+	mock.recorder = &MockIndexRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIndexRepository) EXPECT() *MockIndexRepositoryMockRecorder {
+	return m.recorder
+}
+
+// CreateIndex mocks base method.
+func (m *MockIndexRepository) CreateIndex(def storage.IndexDefinition) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateIndex", def)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateIndex indicates an expected call of CreateIndex.
+func (mr *MockIndexRepositoryMockRecorder) CreateIndex(def any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateIndex", reflect.TypeOf((*MockIndexRepository)(nil).CreateIndex), def)
+}
+
+// DropIndex mocks base method.
+func (m *MockIndexRepository) DropIndex(name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DropIndex", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DropIndex indicates an expected call of DropIndex.
+func (mr *MockIndexRepositoryMockRecorder) DropIndex(name any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DropIndex", reflect.TypeOf((*MockIndexRepository)(nil).DropIndex), name)
+}
+
+// ListIndexes mocks base method.
+func (m *MockIndexRepository) ListIndexes() ([]storage.IndexDefinition, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListIndexes")
+	ret0, _ := ret[0].([]storage.IndexDefinition)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListIndexes indicates an expected call of ListIndexes.
+func (mr *MockIndexRepositoryMockRecorder) ListIndexes() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListIndexes", reflect.TypeOf((*MockIndexRepository)(nil).ListIndexes))
+}
+
+// MockUsageRepository is a mock of UsageRepository interface.
+type MockUsageRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockUsageRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockUsageRepositoryMockRecorder is the mock recorder for MockUsageRepository.
+type MockUsageRepositoryMockRecorder struct {
+	mock *MockUsageRepository
+}
+
+// NewMockUsageRepository creates a new mock instance.
+func NewMockUsageRepository(ctrl *gomock.Controller) *MockUsageRepository {
+	mock := &MockUsageRepository{ctrl: ctrl}
+	mock.recorder = &MockUsageRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUsageRepository) EXPECT() *MockUsageRepositoryMockRecorder {
+	return m.recorder
+}
+
+// GetUsage mocks base method.
+func (m *MockUsageRepository) GetUsage(namespace string) (storage.Usage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUsage", namespace)
+	ret0, _ := ret[0].(storage.Usage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUsage indicates an expected call of GetUsage.
+func (mr *MockUsageRepositoryMockRecorder) GetUsage(namespace any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUsage", reflect.TypeOf((*MockUsageRepository)(nil).GetUsage), namespace)
+}
+
+// MockHistoryRepository is a mock of HistoryRepository interface.
+type MockHistoryRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockHistoryRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockHistoryRepositoryMockRecorder is the mock recorder for MockHistoryRepository.
+type MockHistoryRepositoryMockRecorder struct {
+	mock *MockHistoryRepository
+}
+
+// NewMockHistoryRepository creates a new mock instance.
+func NewMockHistoryRepository(ctrl *gomock.Controller) *MockHistoryRepository {
+	mock := &MockHistoryRepository{ctrl: ctrl}
+	mock.recorder = &MockHistoryRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHistoryRepository) EXPECT() *MockHistoryRepositoryMockRecorder {
+	return m.recorder
+}
+
+// GetHistory mocks base method.
+func (m *MockHistoryRepository) GetHistory(query storage.HistoryQuery) ([]storage.Revision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistory", query)
+	ret0, _ := ret[0].([]storage.Revision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHistory indicates an expected call of GetHistory.
+func (mr *MockHistoryRepositoryMockRecorder) GetHistory(query any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistory", reflect.TypeOf((*MockHistoryRepository)(nil).GetHistory), query)
+}
+
+// GetRevision mocks base method.
+func (m *MockHistoryRepository) GetRevision(key string, revision uint64) (storage.Revision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRevision", key, revision)
+	ret0, _ := ret[0].(storage.Revision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRevision indicates an expected call of GetRevision.
+func (mr *MockHistoryRepositoryMockRecorder) GetRevision(key, revision any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRevision", reflect.TypeOf((*MockHistoryRepository)(nil).GetRevision), key, revision)
+}
+
+// GetRevisionAt mocks base method.
+func (m *MockHistoryRepository) GetRevisionAt(key string, at time.Time) (storage.Revision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRevisionAt", key, at)
+	ret0, _ := ret[0].(storage.Revision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRevisionAt indicates an expected call of GetRevisionAt.
+func (mr *MockHistoryRepositoryMockRecorder) GetRevisionAt(key, at any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRevisionAt", reflect.TypeOf((*MockHistoryRepository)(nil).GetRevisionAt), key, at)
+}
+
+// MockTrashRepository is a mock of TrashRepository interface.
+type MockTrashRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockTrashRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockTrashRepositoryMockRecorder is the mock recorder for MockTrashRepository.
+type MockTrashRepositoryMockRecorder struct {
+	mock *MockTrashRepository
+}
+
+// NewMockTrashRepository creates a new mock instance.
+func NewMockTrashRepository(ctrl *gomock.Controller) *MockTrashRepository {
+	mock := &MockTrashRepository{ctrl: ctrl}
+	mock.recorder = &MockTrashRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTrashRepository) EXPECT() *MockTrashRepositoryMockRecorder {
+	return m.recorder
+}
+
+// ListTrash mocks base method.
+func (m *MockTrashRepository) ListTrash(query storage.ScanQuery) ([]storage.TrashEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTrash", query)
+	ret0, _ := ret[0].([]storage.TrashEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListTrash indicates an expected call of ListTrash.
+func (mr *MockTrashRepositoryMockRecorder) ListTrash(query any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTrash", reflect.TypeOf((*MockTrashRepository)(nil).ListTrash), query)
+}
+
+// PurgeTrash mocks base method.
+func (m *MockTrashRepository) PurgeTrash(now time.Time, limit uint32) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeTrash", now, limit)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeTrash indicates an expected call of PurgeTrash.
+func (mr *MockTrashRepositoryMockRecorder) PurgeTrash(now, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeTrash", reflect.TypeOf((*MockTrashRepository)(nil).PurgeTrash), now, limit)
+}
+
+// Undelete mocks base method.
+func (m *MockTrashRepository) Undelete(key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Undelete", key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Undelete indicates an expected call of Undelete.
+func (mr *MockTrashRepositoryMockRecorder) Undelete(key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Undelete", reflect.TypeOf((*MockTrashRepository)(nil).Undelete), key)
+}
+
+// MockMetadataRepository is a mock of MetadataRepository interface.
+type MockMetadataRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockMetadataRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockMetadataRepositoryMockRecorder is the mock recorder for MockMetadataRepository.
+type MockMetadataRepositoryMockRecorder struct {
+	mock *MockMetadataRepository
+}
+
+// NewMockMetadataRepository creates a new mock instance.
+func NewMockMetadataRepository(ctrl *gomock.Controller) *MockMetadataRepository {
+	mock := &MockMetadataRepository{ctrl: ctrl}
+	mock.recorder = &MockMetadataRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMetadataRepository) EXPECT() *MockMetadataRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Annotate mocks base method.
+func (m *MockMetadataRepository) Annotate(key, writer string, labels map[string]string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Annotate", key, writer, labels)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Annotate indicates an expected call of Annotate.
+func (mr *MockMetadataRepositoryMockRecorder) Annotate(key, writer, labels any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Annotate", reflect.TypeOf((*MockMetadataRepository)(nil).Annotate), key, writer, labels)
+}
+
+// Annotated mocks base method.
+func (m *MockMetadataRepository) Annotated(annotation storage.Annotation) storage.AnnotatedRepository {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Annotated", annotation)
+	ret0, _ := ret[0].(storage.AnnotatedRepository)
+	return ret0
+}
+
+// Annotated indicates an expected call of Annotated.
+func (mr *MockMetadataRepositoryMockRecorder) Annotated(annotation any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Annotated", reflect.TypeOf((*MockMetadataRepository)(nil).Annotated), annotation)
+}
+
+// MockAnnotatedRepository is a mock of AnnotatedRepository interface.
+type MockAnnotatedRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockAnnotatedRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockAnnotatedRepositoryMockRecorder is the mock recorder for MockAnnotatedRepository.
+type MockAnnotatedRepositoryMockRecorder struct {
+	mock *MockAnnotatedRepository
+}
+
+// NewMockAnnotatedRepository creates a new mock instance.
+func NewMockAnnotatedRepository(ctrl *gomock.Controller) *MockAnnotatedRepository {
+	mock := &MockAnnotatedRepository{ctrl: ctrl}
+	mock.recorder = &MockAnnotatedRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAnnotatedRepository) EXPECT() *MockAnnotatedRepositoryMockRecorder {
+	return m.recorder
+}
+
+// AddValue mocks base method.
+func (m *MockAnnotatedRepository) AddValue(key string, value any) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddValue", key, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddValue indicates an expected call of AddValue.
+func (mr *MockAnnotatedRepositoryMockRecorder) AddValue(key, value any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddValue", reflect.TypeOf((*MockAnnotatedRepository)(nil).AddValue), key, value)
+}
+
+// CompareAndSet mocks base method.
+func (m *MockAnnotatedRepository) CompareAndSet(key string, expected, value any) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompareAndSet", key, expected, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CompareAndSet indicates an expected call of CompareAndSet.
+func (mr *MockAnnotatedRepositoryMockRecorder) CompareAndSet(key, expected, value any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompareAndSet", reflect.TypeOf((*MockAnnotatedRepository)(nil).CompareAndSet), key, expected, value)
+}
+
+// CompareVersionAndSet mocks base method.
+func (m *MockAnnotatedRepository) CompareVersionAndSet(key string, version uint64, value any) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompareVersionAndSet", key, version, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CompareVersionAndSet indicates an expected call of CompareVersionAndSet.
+func (mr *MockAnnotatedRepositoryMockRecorder) CompareVersionAndSet(key, version, value any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompareVersionAndSet", reflect.TypeOf((*MockAnnotatedRepository)(nil).CompareVersionAndSet), key, version, value)
+}
+
+// DeleteValue mocks base method.
+func (m *MockAnnotatedRepository) DeleteValue(key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteValue", key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteValue indicates an expected call of DeleteValue.
+func (mr *MockAnnotatedRepositoryMockRecorder) DeleteValue(key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteValue", reflect.TypeOf((*MockAnnotatedRepository)(nil).DeleteValue), key)
+}
+
+// DeleteValues mocks base method.
+func (m *MockAnnotatedRepository) DeleteValues(keys []string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteValues", keys)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteValues indicates an expected call of DeleteValues.
+func (mr *MockAnnotatedRepositoryMockRecorder) DeleteValues(keys any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteValues", reflect.TypeOf((*MockAnnotatedRepository)(nil).DeleteValues), keys)
+}
+
+// ExpireValue mocks base method.
+func (m *MockAnnotatedRepository) ExpireValue(key string, ttl time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpireValue", key, ttl)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExpireValue indicates an expected call of ExpireValue.
+func (mr *MockAnnotatedRepositoryMockRecorder) ExpireValue(key, ttl any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpireValue", reflect.TypeOf((*MockAnnotatedRepository)(nil).ExpireValue), key, ttl)
+}
+
+// GetValue mocks base method.
+func (m *MockAnnotatedRepository) GetValue(key string) ([]any, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetValue", key)
+	ret0, _ := ret[0].([]any)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetValue indicates an expected call of GetValue.
+func (mr *MockAnnotatedRepositoryMockRecorder) GetValue(key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetValue", reflect.TypeOf((*MockAnnotatedRepository)(nil).GetValue), key)
+}
+
+// GetValues mocks base method.
+func (m *MockAnnotatedRepository) GetValues(keys []string) ([]any, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetValues", keys)
+	ret0, _ := ret[0].([]any)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetValues indicates an expected call of GetValues.
+func (mr *MockAnnotatedRepositoryMockRecorder) GetValues(keys any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetValues", reflect.TypeOf((*MockAnnotatedRepository)(nil).GetValues), keys)
+}
+
+// MergeValue mocks base method.
+func (m *MockAnnotatedRepository) MergeValue(key string, patch any) ([]any, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MergeValue", key, patch)
+	ret0, _ := ret[0].([]any)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MergeValue indicates an expected call of MergeValue.
+func (mr *MockAnnotatedRepositoryMockRecorder) MergeValue(key, patch any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MergeValue", reflect.TypeOf((*MockAnnotatedRepository)(nil).MergeValue), key, patch)
+}
+
+// PutValue mocks base method.
+func (m *MockAnnotatedRepository) PutValue(key string, value any) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutValue", key, value)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PutValue indicates an expected call of PutValue.
+func (mr *MockAnnotatedRepositoryMockRecorder) PutValue(key, value any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutValue", reflect.TypeOf((*MockAnnotatedRepository)(nil).PutValue), key, value)
+}
+
+// QueryIndex mocks base method.
+func (m *MockAnnotatedRepository) QueryIndex(query storage.IndexQuery) ([]any, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueryIndex", query)
+	ret0, _ := ret[0].([]any)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryIndex indicates an expected call of QueryIndex.
+func (mr *MockAnnotatedRepositoryMockRecorder) QueryIndex(query any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryIndex", reflect.TypeOf((*MockAnnotatedRepository)(nil).QueryIndex), query)
+}
+
+// ScanValues mocks base method.
+func (m *MockAnnotatedRepository) ScanValues(query storage.ScanQuery) ([]any, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScanValues", query)
+	ret0, _ := ret[0].([]any)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ScanValues indicates an expected call of ScanValues.
+func (mr *MockAnnotatedRepositoryMockRecorder) ScanValues(query any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScanValues", reflect.TypeOf((*MockAnnotatedRepository)(nil).ScanValues), query)
+}
+
+// UpdateValue mocks base method.
+func (m *MockAnnotatedRepository) UpdateValue(key string, value any) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateValue", key, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateValue indicates an expected call of UpdateValue.
+func (mr *MockAnnotatedRepositoryMockRecorder) UpdateValue(key, value any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateValue", reflect.TypeOf((*MockAnnotatedRepository)(nil).UpdateValue), key, value)
+}
+
+// MockMoveRepository is a mock of MoveRepository interface.
+type MockMoveRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockMoveRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockMoveRepositoryMockRecorder is the mock recorder for MockMoveRepository.
+type MockMoveRepositoryMockRecorder struct {
+	mock *MockMoveRepository
+}
+
+// NewMockMoveRepository creates a new mock instance.
+func NewMockMoveRepository(ctrl *gomock.Controller) *MockMoveRepository {
+	mock := &MockMoveRepository{ctrl: ctrl}
+	mock.recorder = &MockMoveRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMoveRepository) EXPECT() *MockMoveRepositoryMockRecorder {
+	return m.recorder
+}
+
+// CopyTuple mocks base method.
+func (m *MockMoveRepository) CopyTuple(tuple []any) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CopyTuple", tuple)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CopyTuple indicates an expected call of CopyTuple.
+func (mr *MockMoveRepositoryMockRecorder) CopyTuple(tuple any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CopyTuple", reflect.TypeOf((*MockMoveRepository)(nil).CopyTuple), tuple)
+}
+
+// RemoveTuple mocks base method.
+func (m *MockMoveRepository) RemoveTuple(key string, value any) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveTuple", key, value)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RemoveTuple indicates an expected call of RemoveTuple.
+func (mr *MockMoveRepositoryMockRecorder) RemoveTuple(key, value any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveTuple", reflect.TypeOf((*MockMoveRepository)(nil).RemoveTuple), key, value)
+}
+
+// MockVersionRepository is a mock of VersionRepository interface.
+type MockVersionRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockVersionRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockVersionRepositoryMockRecorder is the mock recorder for MockVersionRepository.
+type MockVersionRepositoryMockRecorder struct {
+	mock *MockVersionRepository
+}
+
+// NewMockVersionRepository creates a new mock instance.
+func NewMockVersionRepository(ctrl *gomock.Controller) *MockVersionRepository {
+	mock := &MockVersionRepository{ctrl: ctrl}
+	mock.recorder = &MockVersionRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockVersionRepository) EXPECT() *MockVersionRepositoryMockRecorder {
+	return m.recorder
+}
+
+// CompareVersionAndSet mocks base method.
+func (m *MockVersionRepository) CompareVersionAndSet(key string, version uint64, value any) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompareVersionAndSet", key, version, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CompareVersionAndSet indicates an expected call of CompareVersionAndSet.
+func (mr *MockVersionRepositoryMockRecorder) CompareVersionAndSet(key, version, value any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompareVersionAndSet", reflect.TypeOf((*MockVersionRepository)(nil).CompareVersionAndSet), key, version, value)
+}
+
+// MockBackupRepository is a mock of BackupRepository interface.
+type MockBackupRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockBackupRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockBackupRepositoryMockRecorder is the mock recorder for MockBackupRepository.
+type MockBackupRepositoryMockRecorder struct {
+	mock *MockBackupRepository
+}
+
+// NewMockBackupRepository creates a new mock instance.
+func NewMockBackupRepository(ctrl *gomock.Controller) *MockBackupRepository {
+	mock := &MockBackupRepository{ctrl: ctrl}
+	mock.recorder = &MockBackupRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBackupRepository) EXPECT() *MockBackupRepositoryMockRecorder {
+	return m.recorder
+}
+
+// ClearBackup mocks base method.
+func (m *MockBackupRepository) ClearBackup() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClearBackup")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ClearBackup indicates an expected call of ClearBackup.
+func (mr *MockBackupRepositoryMockRecorder) ClearBackup() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClearBackup", reflect.TypeOf((*MockBackupRepository)(nil).ClearBackup))
+}
+
+// CommitBackup mocks base method.
+func (m *MockBackupRepository) CommitBackup() (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CommitBackup")
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CommitBackup indicates an expected call of CommitBackup.
+func (mr *MockBackupRepositoryMockRecorder) CommitBackup() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CommitBackup", reflect.TypeOf((*MockBackupRepository)(nil).CommitBackup))
+}
+
+// FreezeBackup mocks base method.
+func (m *MockBackupRepository) FreezeBackup() (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FreezeBackup")
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FreezeBackup indicates an expected call of FreezeBackup.
+func (mr *MockBackupRepositoryMockRecorder) FreezeBackup() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FreezeBackup", reflect.TypeOf((*MockBackupRepository)(nil).FreezeBackup))
+}
+
+// ScanBackup mocks base method.
+func (m *MockBackupRepository) ScanBackup(query storage.ScanQuery) ([]any, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScanBackup", query)
+	ret0, _ := ret[0].([]any)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ScanBackup indicates an expected call of ScanBackup.
+func (mr *MockBackupRepositoryMockRecorder) ScanBackup(query any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScanBackup", reflect.TypeOf((*MockBackupRepository)(nil).ScanBackup), query)
+}
+
+// StageBackup mocks base method.
+func (m *MockBackupRepository) StageBackup(tuples []any) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StageBackup", tuples)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StageBackup indicates an expected call of StageBackup.
+func (mr *MockBackupRepositoryMockRecorder) StageBackup(tuples any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StageBackup", reflect.TypeOf((*MockBackupRepository)(nil).StageBackup), tuples)
+}
@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"container/list"
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultMaxClients is the number of buckets kept before the least
+// recently used one is dropped. A dropped bucket is equivalent to a new
+// full one.
+const DefaultMaxClients = 10000
+
+// Limit is a token bucket refilled with Rate tokens per second up to Burst.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result describes the outcome of Allow for rate limit headers.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed.
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	client  string
+	limit   Limit
+	tokens  float64
+	updated time.Time
+}
+
+// Limiter keeps a token bucket per client, up to a bounded number of the
+// most recently seen clients. Clients use the default limit unless an
+// override is configured for them.
+type Limiter struct {
+	def        Limit
+	overrides  map[string]Limit
+	maxClients int
+
+	mu      sync.Mutex
+	order   *list.List
+	buckets map[string]*list.Element
+}
+
+func New(def Limit, overrides map[string]Limit) *Limiter {
+	return &Limiter{
+		def:        def,
+		overrides:  overrides,
+		maxClients: DefaultMaxClients,
+		order:      list.New(),
+		buckets:    make(map[string]*list.Element),
+	}
+}
+
+// WithMaxClients sets how many client buckets are kept.
+func (l *Limiter) WithMaxClients(n int) *Limiter {
+	l.maxClients = n
+	return l
+}
+
+func (l *Limiter) limitFor(client string) Limit {
+	if limit, ok := l.overrides[client]; ok {
+		return limit
+	}
+	return l.def
+}
+
+// Allow takes a token from the bucket of client.
+func (l *Limiter) Allow(client string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b := l.bucket(client, now)
+	b.refill(now)
+
+	result := Result{Limit: b.limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else if b.limit.Rate > 0 {
+		result.RetryAfter = seconds((1 - b.tokens) / b.limit.Rate)
+	} else {
+		result.RetryAfter = time.Duration(math.MaxInt64)
+	}
+	result.Remaining = int(b.tokens)
+	if b.limit.Rate > 0 {
+		result.Reset = seconds((float64(b.limit.Burst) - b.tokens) / b.limit.Rate)
+	}
+	return result
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	b.updated = now
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+}
+
+// bucket returns the bucket of client, creating a full one and dropping
+// the least recently used bucket when there are too many.
+func (l *Limiter) bucket(client string, now time.Time) *bucket {
+	if elem, ok := l.buckets[client]; ok {
+		l.order.MoveToFront(elem)
+		return elem.Value.(*bucket)
+	}
+
+	if l.order.Len() >= max(l.maxClients, 1) {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.buckets, oldest.Value.(*bucket).client)
+	}
+	limit := l.limitFor(client)
+	b := &bucket{client: client, limit: limit, tokens: float64(limit.Burst), updated: now}
+	l.buckets[client] = l.order.PushFront(b)
+	return b
+}
+
+// Len returns the number of client buckets kept.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
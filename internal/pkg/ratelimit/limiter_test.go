@@ -0,0 +1,59 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"kvManager/internal/pkg/ratelimit"
+)
+
+func TestLimiter(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.Limit{Rate: 100, Burst: 2},
+		map[string]ratelimit.Limit{"vip": {Rate: 100, Burst: 5}})
+
+	for i := 0; i < 2; i++ {
+		result := limiter.Allow("a")
+		if !result.Allowed || result.Remaining != 1-i || result.Limit != 2 {
+			t.Fatalf("Request %d: unexpected result %+v", i, result)
+		}
+	}
+	result := limiter.Allow("a")
+	if result.Allowed || result.RetryAfter <= 0 || result.RetryAfter > 10*time.Millisecond {
+		t.Fatalf("Expected rejection with a short Retry-After, got %+v", result)
+	}
+
+	if !limiter.Allow("b").Allowed {
+		t.Errorf("Clients must have separate buckets")
+	}
+	for i := 0; i < 5; i++ {
+		if !limiter.Allow("vip").Allowed {
+			t.Fatalf("Override burst not applied at request %d", i)
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if !limiter.Allow("a").Allowed {
+		t.Errorf("Bucket was not refilled")
+	}
+}
+
+func TestLimiterEviction(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.Limit{Rate: 0.001, Burst: 1}, nil).WithMaxClients(2)
+
+	limiter.Allow("a")
+	limiter.Allow("b")
+	if limiter.Allow("a").Allowed {
+		t.Fatalf("Expected a to be limited")
+	}
+	// b is the least recently used bucket and makes room for c.
+	limiter.Allow("c")
+	if limiter.Len() != 2 {
+		t.Errorf("Expected 2 buckets, got %d", limiter.Len())
+	}
+	if limiter.Allow("a").Allowed {
+		t.Errorf("Expected the bucket of a to be kept")
+	}
+	if !limiter.Allow("b").Allowed {
+		t.Errorf("Expected a new bucket for b")
+	}
+}
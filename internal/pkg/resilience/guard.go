@@ -0,0 +1,208 @@
+package resilience
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+)
+
+var ErrOverloaded = errors.New("too many concurrent requests")
+
+var metrics = expvar.NewMap("resilience")
+
+// Publish exposes the guard counters at GET /debug/vars under name.
+func Publish(name string, g *Guard) {
+	metrics.Set(name, g)
+}
+
+// Config tunes a Guard. Zero values disable the corresponding feature.
+type Config struct {
+	// MaxInFlight bounds concurrent calls; a call waits up to
+	// AcquireTimeout for a slot before failing with ErrOverloaded.
+	MaxInFlight    int
+	AcquireTimeout time.Duration
+
+	// Retries is the number of extra attempts for idempotent calls.
+	// Attempt n sleeps a random duration up to RetryDelay*2^n, capped
+	// at MaxRetryDelay.
+	Retries       int
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+
+	// BreakerThreshold consecutive failures open the breaker for
+	// BreakerTimeout.
+	BreakerThreshold int
+	BreakerTimeout   time.Duration
+
+	// Transient tells failures of the backend, which count against the
+	// breaker and are retried, from regular errors. All errors are
+	// transient when it is nil.
+	Transient func(error) bool
+}
+
+// Guard protects calls to a backend with a concurrency limit, a circuit
+// breaker and retries. A nil *Guard runs calls unprotected.
+type Guard struct {
+	cfg     Config
+	slots   chan struct{}
+	breaker *Breaker
+
+	calls      atomic.Int64
+	failures   atomic.Int64
+	retries    atomic.Int64
+	rejected   atomic.Int64
+	overloaded atomic.Int64
+}
+
+func NewGuard(cfg Config) *Guard {
+	g := &Guard{cfg: cfg}
+	if cfg.MaxInFlight > 0 {
+		g.slots = make(chan struct{}, cfg.MaxInFlight)
+	}
+	if cfg.BreakerThreshold > 0 {
+		g.breaker = NewBreaker(cfg.BreakerThreshold, cfg.BreakerTimeout)
+	}
+	return g
+}
+
+// Do runs fn. Transient failures of idempotent calls are retried.
+func (g *Guard) Do(idempotent bool, fn func() error) error {
+	if g == nil {
+		return fn()
+	}
+
+	attempts := 1
+	if idempotent {
+		attempts += g.cfg.Retries
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			g.retries.Add(1)
+			time.Sleep(g.backoff(attempt))
+		}
+		var transient bool
+		transient, err = g.call(fn)
+		if !transient {
+			return err
+		}
+	}
+	return err
+}
+
+// call makes a single attempt and reports whether its error is transient.
+func (g *Guard) call(fn func() error) (bool, error) {
+	err := g.acquire()
+	if err != nil {
+		g.overloaded.Add(1)
+		return false, err
+	}
+	defer g.release()
+
+	if g.breaker != nil {
+		err = g.breaker.Allow()
+		if err != nil {
+			g.rejected.Add(1)
+			return false, err
+		}
+	}
+
+	g.calls.Add(1)
+	err = fn()
+	transient := err != nil && (g.cfg.Transient == nil || g.cfg.Transient(err))
+	if transient {
+		g.failures.Add(1)
+	}
+	if g.breaker != nil {
+		g.breaker.Record(transient)
+	}
+	return transient, err
+}
+
+func (g *Guard) acquire() error {
+	if g.slots == nil {
+		return nil
+	}
+	select {
+	case g.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if g.cfg.AcquireTimeout <= 0 {
+		return ErrOverloaded
+	}
+
+	timer := time.NewTimer(g.cfg.AcquireTimeout)
+	defer timer.Stop()
+	select {
+	case g.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrOverloaded
+	}
+}
+
+func (g *Guard) release() {
+	if g.slots != nil {
+		<-g.slots
+	}
+}
+
+func (g *Guard) backoff(attempt int) time.Duration {
+	if g.cfg.RetryDelay <= 0 {
+		return 0
+	}
+	delay := g.cfg.RetryDelay << (attempt - 1)
+	if g.cfg.MaxRetryDelay > 0 && (delay > g.cfg.MaxRetryDelay || delay <= 0) {
+		delay = g.cfg.MaxRetryDelay
+	}
+	return rand.N(delay) + 1
+}
+
+// State returns the breaker state, StateClosed when it is disabled.
+func (g *Guard) State() string {
+	if g == nil || g.breaker == nil {
+		return StateClosed
+	}
+	return g.breaker.State()
+}
+
+// Stats is a snapshot of the guard counters.
+type Stats struct {
+	State      string `json:"state"`
+	InFlight   int    `json:"in_flight"`
+	Calls      int64  `json:"calls"`
+	Failures   int64  `json:"failures"`
+	Retries    int64  `json:"retries"`
+	Rejected   int64  `json:"rejected"`
+	Overloaded int64  `json:"overloaded"`
+}
+
+func (g *Guard) Stats() Stats {
+	return Stats{
+		State:      g.State(),
+		InFlight:   len(g.slots),
+		Calls:      g.calls.Load(),
+		Failures:   g.failures.Load(),
+		Retries:    g.retries.Load(),
+		Rejected:   g.rejected.Load(),
+		Overloaded: g.overloaded.Load(),
+	}
+}
+
+// String implements expvar.Var.
+func (g *Guard) String() string {
+	data, _ := json.Marshal(g.Stats())
+	return string(data)
+}
+
+// Health reports the guard for GET /health. It is unhealthy while the
+// breaker is open.
+func (g *Guard) Health() (any, bool) {
+	stats := g.Stats()
+	return stats, stats.State != StateOpen
+}
@@ -0,0 +1,163 @@
+package resilience_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"kvManager/internal/pkg/resilience"
+)
+
+var (
+	errStalled  = errors.New("stalled")
+	errRejected = errors.New("rejected by backend")
+)
+
+func transient(err error) bool {
+	return errors.Is(err, errStalled)
+}
+
+func TestGuard(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  resilience.Config
+		run  func(t *testing.T, guard *resilience.Guard)
+	}{
+		{
+			name: "idempotent calls are retried",
+			cfg:  resilience.Config{Retries: 2, RetryDelay: time.Millisecond, Transient: transient},
+			run: func(t *testing.T, guard *resilience.Guard) {
+				var calls int
+				err := guard.Do(true, func() error {
+					calls++
+					if calls < 3 {
+						return errStalled
+					}
+					return nil
+				})
+				if err != nil || calls != 3 {
+					t.Fatalf("Expected success after 3 calls, got %v after %d", err, calls)
+				}
+				if guard.Stats().Retries != 2 {
+					t.Errorf("Expected 2 retries, got %+v", guard.Stats())
+				}
+			},
+		},
+		{
+			name: "other calls are not retried",
+			cfg:  resilience.Config{Retries: 2, Transient: transient},
+			run: func(t *testing.T, guard *resilience.Guard) {
+				var calls int
+				err := guard.Do(false, func() error {
+					calls++
+					return errStalled
+				})
+				if !errors.Is(err, errStalled) || calls != 1 {
+					t.Fatalf("Expected a single failed call, got %v after %d", err, calls)
+				}
+				calls = 0
+				err = guard.Do(true, func() error {
+					calls++
+					return errRejected
+				})
+				if !errors.Is(err, errRejected) || calls != 1 {
+					t.Fatalf("Expected a non-transient error to be returned, got %v after %d", err, calls)
+				}
+			},
+		},
+		{
+			name: "breaker opens and recovers",
+			cfg: resilience.Config{
+				BreakerThreshold: 2,
+				BreakerTimeout:   20 * time.Millisecond,
+				Transient:        transient,
+			},
+			run: func(t *testing.T, guard *resilience.Guard) {
+				fail := func() error { return errStalled }
+				ok := func() error { return nil }
+
+				_ = guard.Do(false, fail)
+				_ = guard.Do(false, errRejectedCall)
+				_ = guard.Do(false, fail)
+				if guard.State() != resilience.StateClosed {
+					t.Fatalf("Failures must be consecutive to open the breaker")
+				}
+				_ = guard.Do(false, fail)
+				if guard.State() != resilience.StateOpen {
+					t.Fatalf("Expected open breaker, got %s", guard.State())
+				}
+				err := guard.Do(false, ok)
+				if !errors.Is(err, resilience.ErrCircuitOpen) {
+					t.Fatalf("Expected ErrCircuitOpen, got %v", err)
+				}
+				if _, healthy := guard.Health(); healthy {
+					t.Errorf("Open breaker must be reported unhealthy")
+				}
+
+				time.Sleep(30 * time.Millisecond)
+				_ = guard.Do(false, fail)
+				if guard.State() != resilience.StateOpen {
+					t.Fatalf("Failed probe must reopen the breaker, got %s", guard.State())
+				}
+
+				time.Sleep(30 * time.Millisecond)
+				err = guard.Do(false, ok)
+				if err != nil || guard.State() != resilience.StateClosed {
+					t.Fatalf("Expected closed breaker after probe, got %v, %s", err, guard.State())
+				}
+			},
+		},
+		{
+			name: "concurrency is limited",
+			cfg:  resilience.Config{MaxInFlight: 1, AcquireTimeout: 10 * time.Millisecond},
+			run: func(t *testing.T, guard *resilience.Guard) {
+				started := make(chan struct{})
+				release := make(chan struct{})
+				var wg sync.WaitGroup
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_ = guard.Do(false, func() error {
+						close(started)
+						<-release
+						return nil
+					})
+				}()
+				<-started
+
+				err := guard.Do(false, func() error { return nil })
+				if !errors.Is(err, resilience.ErrOverloaded) {
+					t.Errorf("Expected ErrOverloaded, got %v", err)
+				}
+				close(release)
+				wg.Wait()
+
+				err = guard.Do(false, func() error { return nil })
+				if err != nil {
+					t.Errorf("Expected a free slot, got %v", err)
+				}
+			},
+		},
+		{
+			name: "nil guard runs calls directly",
+			run: func(t *testing.T, _ *resilience.Guard) {
+				var guard *resilience.Guard
+				err := guard.Do(true, errRejectedCall)
+				if !errors.Is(err, errRejected) {
+					t.Errorf("Expected call error, got %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, resilience.NewGuard(tc.cfg))
+		})
+	}
+}
+
+func errRejectedCall() error {
+	return errRejected
+}
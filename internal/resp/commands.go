@@ -0,0 +1,848 @@
+package resp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"kvManager/internal/audit"
+	"kvManager/internal/handlers"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/pkg/resilience"
+	"kvManager/internal/storage"
+)
+
+// Error replies. Their wording follows Redis, which some clients match on.
+const (
+	errSyntax       = "ERR syntax error"
+	errNotInteger   = "ERR value is not an integer or out of range"
+	errOverflow     = "ERR increment or decrement would overflow"
+	errNoAuth       = "NOAUTH Authentication required."
+	errWrongPass    = "WRONGPASS invalid username-password pair or user is disabled."
+	errNoPassword   = "ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?"
+	errInvalidDB    = "ERR DB index is out of range"
+	errInvalidTTL   = "ERR invalid expire time in 'set' command"
+	errInvalidCur   = "ERR invalid cursor"
+	errUnavailable  = "ERR storage temporarily unavailable"
+	errInternal     = "ERR internal error"
+	errContention   = "ERR too many concurrent updates, try again"
+	errEmptyKey     = "ERR empty key"
+	errKeyTooLong   = "ERR key is too long"
+	errInvalidKey   = "ERR key is not valid UTF-8"
+	errNoProto      = "NOPROTO unsupported protocol version"
+	errUnknownCmd   = "ERR unknown command '%s'"
+	errWrongArgs    = "ERR wrong number of arguments for '%s' command"
+	errUnknownSubCm = "ERR unknown subcommand '%s'"
+)
+
+// maxIncrAttempts bounds the compare-and-set retries of INCR under
+// contention.
+const maxIncrAttempts = 16
+
+// Limits of SCAN pages.
+const (
+	defaultScanCount = 10
+	maxScanCount     = 1000
+)
+
+type command struct {
+	run func(s *session, args [][]byte)
+	// arity is the exact number of arguments including the command name
+	// when positive, and the minimum number when negative, as in Redis.
+	arity int
+	// noAuth commands are allowed before authentication.
+	noAuth bool
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"PING":    {run: cmdPing, arity: -1, noAuth: true},
+		"ECHO":    {run: cmdEcho, arity: 2},
+		"QUIT":    {run: cmdQuit, arity: -1, noAuth: true},
+		"AUTH":    {run: cmdAuth, arity: -2, noAuth: true},
+		"HELLO":   {run: cmdHello, arity: -1, noAuth: true},
+		"SELECT":  {run: cmdSelect, arity: 2},
+		"CLIENT":  {run: cmdClient, arity: -2},
+		"COMMAND": {run: cmdCommand, arity: -1},
+		"GET":     {run: cmdGet, arity: 2},
+		"SET":     {run: cmdSet, arity: -3},
+		"SETNX":   {run: cmdSetNX, arity: 3},
+		"MGET":    {run: cmdMGet, arity: -2},
+		"MSET":    {run: cmdMSet, arity: -3},
+		"DEL":     {run: cmdDel, arity: -2},
+		"UNLINK":  {run: cmdDel, arity: -2},
+		"EXISTS":  {run: cmdExists, arity: -2},
+		"EXPIRE":  {run: cmdExpire(time.Second), arity: 3},
+		"PEXPIRE": {run: cmdExpire(time.Millisecond), arity: 3},
+		"PERSIST": {run: cmdPersist, arity: 2},
+		"TTL":     {run: cmdTTL(time.Second), arity: 2},
+		"PTTL":    {run: cmdTTL(time.Millisecond), arity: 2},
+		"INCR":    {run: cmdIncrBy(1), arity: 2},
+		"DECR":    {run: cmdIncrBy(-1), arity: 2},
+		"INCRBY":  {run: cmdIncrBy(0), arity: 3},
+		"DECRBY":  {run: cmdIncrBy(0), arity: 3},
+		"SCAN":    {run: cmdScan, arity: -2},
+	}
+}
+
+// dispatch runs one command and writes its reply.
+func (s *session) dispatch(args [][]byte) {
+	name := strings.ToUpper(string(args[0]))
+	cmd, ok := commands[name]
+	if !ok {
+		s.wr.error(fmt.Sprintf(errUnknownCmd, string(args[0])))
+		return
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		s.wr.error(fmt.Sprintf(errWrongArgs, strings.ToLower(name)))
+		return
+	}
+	if !cmd.noAuth && !s.authenticated {
+		s.wr.error(errNoAuth)
+		return
+	}
+	log.Logger.Debugw("RESP command", "client_id", s.id, "command", name)
+	cmd.run(s, args)
+}
+
+// checkKey writes an error reply and returns false when key can not be
+// stored.
+func (s *session) checkKey(key []byte) bool {
+	switch {
+	case len(key) == 0:
+		s.wr.error(errEmptyKey)
+	case len(key) > s.srv.cfg.MaxKeyLength:
+		s.wr.error(errKeyTooLong)
+	case !utf8.Valid(key):
+		s.wr.error(errInvalidKey)
+	default:
+		return true
+	}
+	return false
+}
+
+func (s *session) checkKeys(keys [][]byte) bool {
+	for _, key := range keys {
+		if !s.checkKey(key) {
+			return false
+		}
+	}
+	return true
+}
+
+// storageError replies to a failed storage call.
+func (s *session) storageError(err error) {
+	if isUnavailable(err) {
+		log.Logger.Warnw("Storage unavailable", "client_id", s.id, "error", err.Error())
+		s.wr.error(errUnavailable)
+		return
+	}
+	log.Logger.Errorw("RESP command failed", "client_id", s.id, "error", err.Error())
+	s.wr.error(errInternal)
+}
+
+// writeError replies to a failed write with the reason of a value
+// refused by a check, or as a storage failure.
+func (s *session) writeError(err error) {
+	if msg, ok := handlers.Rejection(err); ok {
+		log.Logger.Debugw("RESP write rejected", "client_id", s.id, "reason", msg)
+		s.wr.error("ERR " + msg)
+		return
+	}
+	s.storageError(err)
+}
+
+// value writes a stored value: strings as they are and anything else,
+// such as JSON documents written through the HTTP API, as JSON.
+func (s *session) value(value any) {
+	if str, ok := value.(string); ok {
+		s.wr.bulkString(str)
+		return
+	}
+	converted, err := storage.JSONValue(value)
+	if err == nil {
+		var data []byte
+		data, err = json.Marshal(converted)
+		if err == nil {
+			s.wr.bulk(data)
+			return
+		}
+	}
+	log.Logger.Errorw("Converting value failed", "client_id", s.id, "error", err.Error())
+	s.wr.error(errInternal)
+}
+
+func keyStrings(keys [][]byte) []string {
+	result := make([]string, len(keys))
+	for i, key := range keys {
+		result[i] = string(key)
+	}
+	return result
+}
+
+// tuplesByKey indexes the tuples returned by GetValues.
+func tuplesByKey(tuples []any) map[string][]any {
+	result := make(map[string][]any, len(tuples))
+	for _, data := range tuples {
+		tuple, ok := data.([]any)
+		if !ok || len(tuple) < 2 {
+			continue
+		}
+		key, _ := tuple[0].(string)
+		result[key] = tuple
+	}
+	return result
+}
+
+func cmdPing(s *session, args [][]byte) {
+	switch len(args) {
+	case 1:
+		s.wr.simple("PONG")
+	case 2:
+		s.wr.bulk(args[1])
+	default:
+		s.wr.error(fmt.Sprintf(errWrongArgs, "ping"))
+	}
+}
+
+func cmdEcho(s *session, args [][]byte) {
+	s.wr.bulk(args[1])
+}
+
+func cmdQuit(s *session, _ [][]byte) {
+	s.wr.simple("OK")
+	s.quit = true
+}
+
+// cmdAuth accepts AUTH password and AUTH default password. There are no
+// other users.
+func cmdAuth(s *session, args [][]byte) {
+	if len(args) > 3 {
+		s.wr.error(errSyntax)
+		return
+	}
+	if s.srv.cfg.Password == "" {
+		s.wr.error(errNoPassword)
+		return
+	}
+	if !s.auth(args[1:]) {
+		s.wr.error(errWrongPass)
+		return
+	}
+	s.wr.simple("OK")
+}
+
+func (s *session) auth(credentials [][]byte) bool {
+	user, password := "default", string(credentials[len(credentials)-1])
+	if len(credentials) == 2 {
+		user = string(credentials[0])
+	}
+	s.authenticated = user == "default" && s.srv.checkPassword(password)
+	if !s.authenticated {
+		log.Logger.Warnw("RESP authentication failed", "client_id", s.id, "remote", s.remote)
+	}
+	return s.authenticated
+}
+
+// cmdHello implements HELLO [protover [AUTH username password] [SETNAME
+// clientname]], switching the connection to RESP3 on HELLO 3.
+func cmdHello(s *session, args [][]byte) {
+	proto := s.wr.proto
+	if len(args) > 1 {
+		version, err := strconv.Atoi(string(args[1]))
+		if err != nil {
+			s.wr.error("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if version != 2 && version != 3 {
+			s.wr.error(errNoProto)
+			return
+		}
+		proto = version
+	}
+
+	name := s.name
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "AUTH":
+			if i+2 >= len(args) {
+				s.wr.error(errSyntax)
+				return
+			}
+			if s.srv.cfg.Password == "" || !s.auth(args[i+1:i+3]) {
+				s.wr.error(errWrongPass)
+				return
+			}
+			i += 2
+		case "SETNAME":
+			if i+1 >= len(args) {
+				s.wr.error(errSyntax)
+				return
+			}
+			name = string(args[i+1])
+			i++
+		default:
+			s.wr.error(errSyntax)
+			return
+		}
+	}
+	if !s.authenticated {
+		s.wr.error("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+		return
+	}
+
+	s.name = name
+	s.wr.proto = proto
+	s.wr.mapHeader(7)
+	s.wr.bulkString("server")
+	s.wr.bulkString("kvstorage")
+	s.wr.bulkString("version")
+	s.wr.bulkString("7.2.0")
+	s.wr.bulkString("proto")
+	s.wr.integer(int64(proto))
+	s.wr.bulkString("id")
+	s.wr.integer(s.id)
+	s.wr.bulkString("mode")
+	s.wr.bulkString("standalone")
+	s.wr.bulkString("role")
+	s.wr.bulkString("master")
+	s.wr.bulkString("modules")
+	s.wr.array(0)
+}
+
+// cmdSelect accepts database 0 only, the single key space.
+func cmdSelect(s *session, args [][]byte) {
+	if string(args[1]) != "0" {
+		s.wr.error(errInvalidDB)
+		return
+	}
+	s.wr.simple("OK")
+}
+
+func cmdClient(s *session, args [][]byte) {
+	switch strings.ToUpper(string(args[1])) {
+	case "SETNAME":
+		if len(args) != 3 {
+			s.wr.error(fmt.Sprintf(errWrongArgs, "client|setname"))
+			return
+		}
+		s.name = string(args[2])
+		s.wr.simple("OK")
+	case "GETNAME":
+		if s.name == "" {
+			s.wr.null()
+			return
+		}
+		s.wr.bulkString(s.name)
+	case "ID":
+		s.wr.integer(s.id)
+	case "SETINFO":
+		s.wr.simple("OK")
+	default:
+		s.wr.error(fmt.Sprintf(errUnknownSubCm, string(args[1])))
+	}
+}
+
+// cmdCommand answers COMMAND with no command documentation, which
+// redis-cli accepts.
+func cmdCommand(s *session, _ [][]byte) {
+	s.wr.array(0)
+}
+
+func cmdGet(s *session, args [][]byte) {
+	if !s.checkKey(args[1]) {
+		return
+	}
+	data, err := s.srv.repo.GetValue(string(args[1]))
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		s.wr.null()
+		return
+	}
+	if err != nil {
+		s.storageError(err)
+		return
+	}
+	s.value(data[0].([]any)[1])
+}
+
+type setOptions struct {
+	ttl     time.Duration
+	nx      bool
+	xx      bool
+	keepTTL bool
+}
+
+func parseSetOptions(args [][]byte) (setOptions, string) {
+	var opts setOptions
+	for i := 0; i < len(args); i++ {
+		switch option := strings.ToUpper(string(args[i])); option {
+		case "NX":
+			opts.nx = true
+		case "XX":
+			opts.xx = true
+		case "KEEPTTL":
+			opts.keepTTL = true
+		case "EX", "PX":
+			if i+1 >= len(args) || opts.ttl != 0 {
+				return opts, errSyntax
+			}
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return opts, errNotInteger
+			}
+			unit := time.Second
+			if option == "PX" {
+				unit = time.Millisecond
+			}
+			if n <= 0 || n > math.MaxInt64/int64(unit) {
+				return opts, errInvalidTTL
+			}
+			opts.ttl = time.Duration(n) * unit
+			i++
+		default:
+			return opts, errSyntax
+		}
+	}
+	if (opts.nx && opts.xx) || (opts.keepTTL && opts.ttl != 0) {
+		return opts, errSyntax
+	}
+	return opts, ""
+}
+
+// cmdSet implements SET key value [NX | XX] [EX seconds | PX milliseconds
+// | KEEPTTL]. Values are stored as strings, in the same storage call as
+// their TTL. Like in Redis, SET XX without KEEPTTL drops the TTL.
+func cmdSet(s *session, args [][]byte) {
+	if !s.checkKey(args[1]) {
+		return
+	}
+	opts, msg := parseSetOptions(args[3:])
+	if msg != "" {
+		s.wr.error(msg)
+		return
+	}
+	key, value := string(args[1]), string(args[2])
+	writes, actor := s.srv.writes, s.actor()
+	if opts.ttl != 0 || (opts.xx && !opts.keepTTL) {
+		writes = writes.WithTTL(opts.ttl)
+	}
+
+	var err error
+	switch {
+	case opts.nx:
+		err = writes.Add(actor, key, value)
+	case opts.xx:
+		err = writes.Update(actor, key, value)
+	case opts.keepTTL:
+		err = writes.Update(actor, key, value)
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			_, err = writes.Put(actor, key, value)
+		}
+	default:
+		_, err = writes.Put(actor, key, value)
+	}
+	if errors.Is(err, storage.ErrKeyExists) || errors.Is(err, storage.ErrKeyNotFound) {
+		s.wr.null()
+		return
+	}
+	if err != nil {
+		s.writeError(err)
+		return
+	}
+	s.wr.simple("OK")
+}
+
+// cmdSetNX implements the legacy SETNX key value, replying 1 when the
+// key was created.
+func cmdSetNX(s *session, args [][]byte) {
+	if !s.checkKey(args[1]) {
+		return
+	}
+	err := s.srv.writes.Add(s.actor(), string(args[1]), string(args[2]))
+	switch {
+	case err == nil:
+		s.wr.integer(1)
+	case errors.Is(err, storage.ErrKeyExists):
+		s.wr.integer(0)
+	default:
+		s.writeError(err)
+	}
+}
+
+func cmdMGet(s *session, args [][]byte) {
+	if !s.checkKeys(args[1:]) {
+		return
+	}
+	tuples, err := s.srv.repo.GetValues(keyStrings(args[1:]))
+	if err != nil {
+		s.storageError(err)
+		return
+	}
+	found := tuplesByKey(tuples)
+	s.wr.array(len(args) - 1)
+	for _, key := range args[1:] {
+		tuple, ok := found[string(key)]
+		if !ok {
+			s.wr.null()
+			continue
+		}
+		s.value(tuple[1])
+	}
+}
+
+// cmdMSet writes the pairs one by one. Unlike Redis, MSET is not atomic:
+// a storage failure or a value refused by a check may leave some of the
+// pairs written.
+func cmdMSet(s *session, args [][]byte) {
+	if len(args)%2 != 1 {
+		s.wr.error(fmt.Sprintf(errWrongArgs, "mset"))
+		return
+	}
+	for i := 1; i < len(args); i += 2 {
+		if !s.checkKey(args[i]) {
+			return
+		}
+		if err := s.srv.writes.CheckKey(string(args[i])); err != nil {
+			s.writeError(err)
+			return
+		}
+	}
+	actor := s.actor()
+	for i := 1; i < len(args); i += 2 {
+		_, err := s.srv.writes.Put(actor, string(args[i]), string(args[i+1]))
+		if err != nil {
+			s.writeError(err)
+			return
+		}
+	}
+	s.wr.simple("OK")
+}
+
+func cmdDel(s *session, args [][]byte) {
+	if !s.checkKeys(args[1:]) {
+		return
+	}
+	deleted, err := s.srv.writes.Delete(s.actor(), keyStrings(args[1:]))
+	if err != nil {
+		s.writeError(err)
+		return
+	}
+	s.wr.integer(int64(len(deleted)))
+}
+
+// cmdExists counts the given keys that exist, a key given twice counting
+// twice.
+func cmdExists(s *session, args [][]byte) {
+	if !s.checkKeys(args[1:]) {
+		return
+	}
+	tuples, err := s.srv.repo.GetValues(keyStrings(args[1:]))
+	if err != nil {
+		s.storageError(err)
+		return
+	}
+	found := tuplesByKey(tuples)
+	var count int64
+	for _, key := range args[1:] {
+		if _, ok := found[string(key)]; ok {
+			count++
+		}
+	}
+	s.wr.integer(count)
+}
+
+// cmdExpire sets a TTL in unit. A TTL that is not positive deletes the
+// key, as in Redis.
+func cmdExpire(unit time.Duration) func(s *session, args [][]byte) {
+	return func(s *session, args [][]byte) {
+		if !s.checkKey(args[1]) {
+			return
+		}
+		n, err := strconv.ParseInt(string(args[2]), 10, 64)
+		if err != nil || n > math.MaxInt64/int64(unit) {
+			s.wr.error(errNotInteger)
+			return
+		}
+		key := string(args[1])
+		if n > 0 {
+			s.integerResult(s.srv.writes.Expire(key, time.Duration(n)*unit))
+			return
+		}
+		deleted, err := s.srv.writes.Delete(s.actor(), []string{key})
+		if err != nil {
+			s.writeError(err)
+			return
+		}
+		s.wr.integer(int64(len(deleted)))
+	}
+}
+
+// integerResult replies 1 on success and 0 for a missing key.
+func (s *session) integerResult(err error) {
+	switch {
+	case err == nil:
+		s.wr.integer(1)
+	case errors.Is(err, storage.ErrKeyNotFound):
+		s.wr.integer(0)
+	default:
+		s.storageError(err)
+	}
+}
+
+func cmdPersist(s *session, args [][]byte) {
+	if !s.checkKey(args[1]) {
+		return
+	}
+	key := string(args[1])
+	data, err := s.srv.repo.GetValue(key)
+	if err != nil {
+		s.integerResult(err)
+		return
+	}
+	if _, ok := storage.TupleExpiry(data[0].([]any)); !ok {
+		s.wr.integer(0)
+		return
+	}
+	s.integerResult(s.srv.writes.Expire(key, 0))
+}
+
+// cmdTTL replies the remaining TTL in unit, -1 for keys without one and
+// -2 for missing keys.
+func cmdTTL(unit time.Duration) func(s *session, args [][]byte) {
+	return func(s *session, args [][]byte) {
+		if !s.checkKey(args[1]) {
+			return
+		}
+		data, err := s.srv.repo.GetValue(string(args[1]))
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			s.wr.integer(-2)
+			return
+		}
+		if err != nil {
+			s.storageError(err)
+			return
+		}
+		expiresAt, ok := storage.TupleExpiry(data[0].([]any))
+		if !ok {
+			s.wr.integer(-1)
+			return
+		}
+		remaining := time.Until(expiresAt)
+		if remaining < 0 {
+			remaining = 0
+		}
+		s.wr.integer(int64((remaining + unit/2) / unit))
+	}
+}
+
+// cmdIncrBy adds delta, or the argument of INCRBY and DECRBY when delta
+// is 0, to an integer value. Missing keys start at 0.
+func cmdIncrBy(delta int64) func(s *session, args [][]byte) {
+	return func(s *session, args [][]byte) {
+		if !s.checkKey(args[1]) {
+			return
+		}
+		by := delta
+		if by == 0 {
+			n, err := strconv.ParseInt(string(args[2]), 10, 64)
+			if err != nil {
+				s.wr.error(errNotInteger)
+				return
+			}
+			by = n
+			if strings.EqualFold(string(args[0]), "DECRBY") {
+				if n == math.MinInt64 {
+					s.wr.error(errOverflow)
+					return
+				}
+				by = -n
+			}
+		}
+		result, msg, err := s.srv.incrBy(s.actor(), string(args[1]), by)
+		switch {
+		case err != nil:
+			s.writeError(err)
+		case msg != "":
+			s.wr.error(msg)
+		default:
+			s.wr.integer(result)
+		}
+	}
+}
+
+// incrBy adds delta with compare-and-set so concurrent increments are not
+// lost. String values stay strings and numbers stay numbers; new keys are
+// stored as numbers. It returns an error reply for values that are not
+// integers.
+func (srv *Server) incrBy(actor audit.Actor, key string, delta int64) (int64, string, error) {
+	for attempt := 0; attempt < maxIncrAttempts; attempt++ {
+		data, err := srv.repo.GetValue(key)
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			err = srv.writes.Add(actor, key, delta)
+			if err == nil {
+				return delta, "", nil
+			}
+			if !errors.Is(err, storage.ErrKeyExists) {
+				return 0, "", err
+			}
+			// Created concurrently.
+			continue
+		}
+		if err != nil {
+			return 0, "", err
+		}
+
+		current := data[0].([]any)[1]
+		n, ok := integerValue(current)
+		if !ok {
+			return 0, errNotInteger, nil
+		}
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			return 0, errOverflow, nil
+		}
+		var next any = n + delta
+		if _, ok := current.(string); ok {
+			next = strconv.FormatInt(n+delta, 10)
+		}
+		err = srv.writes.CompareAndSet(actor, key, current, next)
+		if err == nil {
+			return n + delta, "", nil
+		}
+		if !errors.Is(err, storage.ErrValueMismatch) && !errors.Is(err, storage.ErrKeyNotFound) {
+			return 0, "", err
+		}
+	}
+	log.Logger.Warnw("INCR gave up under contention", "key", key)
+	return 0, errContention, nil
+}
+
+// integerValue reads a stored value as a 64-bit integer. Strings must be
+// decimal integers and floats must have no fraction.
+func integerValue(value any) (int64, bool) {
+	switch v := value.(type) {
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), uint64(v) <= math.MaxInt64
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case float64:
+		return int64(v), v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64
+	}
+	return 0, false
+}
+
+// cmdScan implements SCAN cursor [MATCH pattern] [COUNT count]. Each call
+// reads up to COUNT keys in key order, so fewer may be returned once
+// MATCH filters them.
+func cmdScan(s *session, args [][]byte) {
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		s.wr.error(errInvalidCur)
+		return
+	}
+	pattern := "*"
+	count := defaultScanCount
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			s.wr.error(errSyntax)
+			return
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = string(args[i+1])
+		case "COUNT":
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				s.wr.error(errNotInteger)
+				return
+			}
+			if count < 1 {
+				s.wr.error(errSyntax)
+				return
+			}
+			count = min(count, maxScanCount)
+		case "TYPE":
+			if !strings.EqualFold(string(args[i+1]), "string") {
+				pattern = ""
+			}
+		default:
+			s.wr.error(errSyntax)
+			return
+		}
+	}
+
+	query := storage.ScanQuery{Prefix: globPrefix(pattern), Limit: uint32(count)}
+	if cursor != 0 {
+		var ok bool
+		query.After, ok = s.srv.cursors.load(cursor)
+		if !ok {
+			s.wr.error(errInvalidCur)
+			return
+		}
+	}
+	var tuples []any
+	if pattern != "" {
+		tuples, err = s.srv.repo.ScanValues(query)
+		if err != nil {
+			s.storageError(err)
+			return
+		}
+	}
+
+	var keys []string
+	last := ""
+	for _, data := range tuples {
+		tuple, ok := data.([]any)
+		if !ok || len(tuple) == 0 {
+			continue
+		}
+		key, _ := tuple[0].(string)
+		last = key
+		if globMatch(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	next := uint64(0)
+	if len(tuples) == count {
+		next = s.srv.cursors.save(last)
+	}
+
+	s.wr.array(2)
+	s.wr.bulkString(strconv.FormatUint(next, 10))
+	s.wr.array(len(keys))
+	for _, key := range keys {
+		s.wr.bulkString(key)
+	}
+}
+
+func isUnavailable(err error) bool {
+	return errors.Is(err, resilience.ErrCircuitOpen) || errors.Is(err, resilience.ErrOverloaded)
+}
@@ -0,0 +1,191 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// maxArgs is the largest number of arguments accepted in one command.
+const maxArgs = 1 << 20
+
+// maxInlineLength is the longest inline command line accepted.
+const maxInlineLength = 64 << 10
+
+// errProtocol is returned for malformed input. The connection is closed
+// after replying, as Redis does.
+var errProtocol = errors.New("Protocol error")
+
+// reader parses client commands, sent either as RESP arrays of bulk
+// strings or as inline commands typed by hand into telnet.
+type reader struct {
+	r       *bufio.Reader
+	maxBulk int
+}
+
+func newReader(r io.Reader, maxBulk int) *reader {
+	return &reader{r: bufio.NewReader(r), maxBulk: maxBulk}
+}
+
+// readCommand returns the arguments of the next command. Empty inline
+// lines are skipped.
+func (rd *reader) readCommand() ([][]byte, error) {
+	for {
+		line, err := rd.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] != '*' {
+			args := bytes.Fields(line)
+			if len(args) == 0 {
+				continue
+			}
+			return args, nil
+		}
+
+		count, err := strconv.Atoi(string(line[1:]))
+		if err != nil || count > maxArgs {
+			return nil, fmt.Errorf("%w: invalid multibulk length", errProtocol)
+		}
+		if count <= 0 {
+			continue
+		}
+		args := make([][]byte, count)
+		for i := range args {
+			args[i], err = rd.readBulk()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return args, nil
+	}
+}
+
+func (rd *reader) readBulk() ([]byte, error) {
+	line, err := rd.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return nil, fmt.Errorf("%w: expected '$', got '%s'", errProtocol, firstByte(line))
+	}
+	size, err := strconv.Atoi(string(line[1:]))
+	if err != nil || size < 0 || size > rd.maxBulk {
+		return nil, fmt.Errorf("%w: invalid bulk length", errProtocol)
+	}
+	data := make([]byte, size+2)
+	_, err = io.ReadFull(rd.r, data)
+	if err != nil {
+		return nil, err
+	}
+	if data[size] != '\r' || data[size+1] != '\n' {
+		return nil, fmt.Errorf("%w: bulk string not terminated by CRLF", errProtocol)
+	}
+	return data[:size], nil
+}
+
+// readLine reads up to LF and strips the line terminator.
+func (rd *reader) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := rd.r.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, chunk...)
+		if len(line) > maxInlineLength {
+			return nil, fmt.Errorf("%w: too big inline request", errProtocol)
+		}
+		if !isPrefix {
+			return line, nil
+		}
+	}
+}
+
+func firstByte(line []byte) string {
+	if len(line) == 0 {
+		return ""
+	}
+	return string(line[:1])
+}
+
+// writer encodes replies in RESP2 or, after HELLO 3, in RESP3.
+type writer struct {
+	w     *bufio.Writer
+	proto int
+}
+
+func newWriter(w io.Writer) *writer {
+	return &writer{w: bufio.NewWriter(w), proto: 2}
+}
+
+func (wr *writer) simple(s string) {
+	wr.w.WriteByte('+')
+	wr.w.WriteString(s)
+	wr.w.WriteString("\r\n")
+}
+
+func (wr *writer) error(msg string) {
+	wr.w.WriteByte('-')
+	wr.w.WriteString(msg)
+	wr.w.WriteString("\r\n")
+}
+
+func (wr *writer) integer(n int64) {
+	wr.w.WriteByte(':')
+	wr.w.WriteString(strconv.FormatInt(n, 10))
+	wr.w.WriteString("\r\n")
+}
+
+func (wr *writer) bulk(data []byte) {
+	wr.header('$', len(data))
+	wr.w.Write(data)
+	wr.w.WriteString("\r\n")
+}
+
+func (wr *writer) bulkString(s string) {
+	wr.header('$', len(s))
+	wr.w.WriteString(s)
+	wr.w.WriteString("\r\n")
+}
+
+// null writes a missing value: the RESP3 null or the RESP2 null bulk
+// string.
+func (wr *writer) null() {
+	if wr.proto >= 3 {
+		wr.w.WriteString("_\r\n")
+		return
+	}
+	wr.w.WriteString("$-1\r\n")
+}
+
+// array starts an array of n elements, which the caller writes next.
+func (wr *writer) array(n int) {
+	wr.header('*', n)
+}
+
+// mapHeader starts a map of n pairs. RESP2 has no maps, so they are sent
+// as flat arrays of keys and values.
+func (wr *writer) mapHeader(n int) {
+	if wr.proto >= 3 {
+		wr.header('%', n)
+		return
+	}
+	wr.header('*', 2*n)
+}
+
+func (wr *writer) header(prefix byte, n int) {
+	wr.w.WriteByte(prefix)
+	wr.w.WriteString(strconv.Itoa(n))
+	wr.w.WriteString("\r\n")
+}
+
+func (wr *writer) flush() error {
+	return wr.w.Flush()
+}
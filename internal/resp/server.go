@@ -0,0 +1,252 @@
+// Package resp serves the key-value storage over the Redis protocol
+// (RESP2 and RESP3), so redis-cli and Redis client libraries can use it.
+package resp
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"kvManager/internal/audit"
+	"kvManager/internal/handlers"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+// Defaults used when Config leaves a limit unset.
+const (
+	DefaultMaxValueBytes = 1 << 20
+	DefaultMaxKeyLength  = 1024
+)
+
+// Principals recorded in the audit log and the metadata of RESP writes.
+const (
+	defaultPrincipal   = "resp:default"
+	anonymousPrincipal = "anonymous"
+)
+
+// ErrServerClosed is returned by Serve after Close.
+var ErrServerClosed = errors.New("resp: server closed")
+
+// Config configures a Server.
+type Config struct {
+	// Password is required through AUTH or HELLO before any data command.
+	// Authentication is disabled when empty.
+	Password string
+	// MaxValueBytes limits the size of a single argument.
+	MaxValueBytes int
+	// MaxKeyLength limits key length in bytes.
+	MaxKeyLength int
+}
+
+// Server translates Redis commands into KvRepository calls. Writes go
+// through the checked write path of the HTTP API, so they are validated,
+// counted against quotas and audited the same way.
+type Server struct {
+	repo    storage.KvRepository
+	writes  *handlers.Writes
+	cfg     Config
+	cursors *cursorTable
+
+	nextID atomic.Int64
+
+	mu       sync.Mutex
+	closed   bool
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+}
+
+func NewServer(repo storage.KvRepository, writes *handlers.Writes, cfg Config) *Server {
+	if cfg.MaxValueBytes <= 0 {
+		cfg.MaxValueBytes = DefaultMaxValueBytes
+	}
+	if cfg.MaxKeyLength <= 0 {
+		cfg.MaxKeyLength = DefaultMaxKeyLength
+	}
+	return &Server{
+		repo:    repo,
+		writes:  writes,
+		cfg:     cfg,
+		cursors: newCursorTable(maxCursors),
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts connections on listener until Close is called.
+func (srv *Server) Serve(listener net.Listener) error {
+	srv.mu.Lock()
+	if srv.closed {
+		srv.mu.Unlock()
+		return ErrServerClosed
+	}
+	srv.listener = listener
+	srv.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if srv.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if !srv.track(conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		go srv.serveConn(conn)
+	}
+}
+
+// Close stops accepting connections and closes the open ones.
+func (srv *Server) Close() error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.closed = true
+	var err error
+	if srv.listener != nil {
+		err = srv.listener.Close()
+	}
+	for conn := range srv.conns {
+		conn.Close()
+	}
+	return err
+}
+
+func (srv *Server) isClosed() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.closed
+}
+
+func (srv *Server) track(conn net.Conn) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.closed {
+		return false
+	}
+	srv.conns[conn] = struct{}{}
+	return true
+}
+
+func (srv *Server) untrack(conn net.Conn) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	delete(srv.conns, conn)
+}
+
+// session is the state of one client connection.
+type session struct {
+	srv           *Server
+	id            int64
+	remote        string
+	rd            *reader
+	wr            *writer
+	authenticated bool
+	name          string
+	quit          bool
+}
+
+func (srv *Server) serveConn(conn net.Conn) {
+	defer srv.untrack(conn)
+	defer conn.Close()
+
+	s := &session{
+		srv:           srv,
+		id:            srv.nextID.Add(1),
+		remote:        conn.RemoteAddr().String(),
+		rd:            newReader(conn, srv.cfg.MaxValueBytes),
+		wr:            newWriter(conn),
+		authenticated: srv.cfg.Password == "",
+	}
+	log.Logger.Debugw("RESP connection opened", "client_id", s.id, "remote", s.remote)
+	defer log.Logger.Debugw("RESP connection closed", "client_id", s.id, "remote", s.remote)
+
+	for !s.quit {
+		args, err := s.rd.readCommand()
+		if errors.Is(err, errProtocol) {
+			log.Logger.Warnw("RESP protocol error", "client_id", s.id, "remote", s.remote, "error", err)
+			s.wr.error("ERR " + err.Error())
+			s.wr.flush()
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !srv.isClosed() {
+				log.Logger.Debugw("RESP read failed", "client_id", s.id, "error", err)
+			}
+			return
+		}
+
+		s.dispatch(args)
+		// Pipelined commands are answered together once the client
+		// stops sending.
+		if s.rd.r.Buffered() > 0 && !s.quit {
+			continue
+		}
+		if err := s.wr.flush(); err != nil {
+			return
+		}
+	}
+}
+
+// actor returns who the writes of the session are audited as: the
+// default user once authenticated with the password, anonymous when no
+// password is configured.
+func (s *session) actor() audit.Actor {
+	principal := anonymousPrincipal
+	if s.srv.cfg.Password != "" {
+		principal = defaultPrincipal
+	}
+	host, _, err := net.SplitHostPort(s.remote)
+	if err != nil {
+		host = s.remote
+	}
+	return audit.Actor{Principal: principal, ClientIP: host}
+}
+
+// checkPassword compares password with the configured one in constant time.
+func (srv *Server) checkPassword(password string) bool {
+	return subtle.ConstantTimeCompare([]byte(password), []byte(srv.cfg.Password)) == 1
+}
+
+// maxCursors bounds the number of SCAN cursors remembered at once. The
+// oldest are forgotten first, so an abandoned scan does not leak memory.
+const maxCursors = 10000
+
+// cursorTable maps the numeric cursors returned by SCAN to the last key
+// they returned. Keys do not fit in the 64-bit cursors clients expect.
+type cursorTable struct {
+	mu   sync.Mutex
+	next uint64
+	keys map[uint64]string
+	ring []uint64
+	pos  int
+}
+
+func newCursorTable(size int) *cursorTable {
+	return &cursorTable{keys: make(map[uint64]string, size), ring: make([]uint64, size)}
+}
+
+// save returns a new cursor resuming after key.
+func (t *cursorTable) save(key string) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.next++
+	delete(t.keys, t.ring[t.pos])
+	t.ring[t.pos] = t.next
+	t.pos = (t.pos + 1) % len(t.ring)
+	t.keys[t.next] = key
+	return t.next
+}
+
+func (t *cursorTable) load(cursor uint64) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key, ok := t.keys[cursor]
+	return key, ok
+}
@@ -0,0 +1,475 @@
+package resp_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/mock/gomock"
+
+	"kvManager/internal/audit"
+	"kvManager/internal/handlers"
+	"kvManager/internal/mocks"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/pkg/resilience"
+	"kvManager/internal/resp"
+	"kvManager/internal/storage"
+)
+
+// serve starts a server on a local port and returns its address. A repo
+// that keeps metadata takes the TTL of writes in the same call.
+func serve(t *testing.T, repo storage.KvRepository, cfg resp.Config) string {
+	t.Helper()
+	handler := &handlers.Handler{Repo: repo}
+	if meta, ok := repo.(storage.MetadataRepository); ok {
+		handler.Metadata = meta
+	}
+	return serveHandler(t, handler, cfg)
+}
+
+// serveHandler starts a server writing through the checks of handler.
+func serveHandler(t *testing.T, handler *handlers.Handler, cfg resp.Config) string {
+	t.Helper()
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	server := resp.NewServer(handler.Repo, handler.Writes(), cfg)
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return listener.Addr().String()
+}
+
+func newClient(t *testing.T, opts *redis.Options) *redis.Client {
+	t.Helper()
+	client := redis.NewClient(opts)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestRESPCommands(t *testing.T) {
+	for _, protocol := range []int{2, 3} {
+		t.Run(fmt.Sprintf("RESP%d", protocol), func(t *testing.T) {
+			mem := storage.NewMemoryRepository()
+			err := mem.AddValue("doc", map[string]any{"a": int64(1)})
+			if err != nil {
+				t.Fatalf("AddValue: %v", err)
+			}
+			addr := serve(t, mem, resp.Config{})
+			client := newClient(t, &redis.Options{Addr: addr, Protocol: protocol})
+			ctx := context.Background()
+
+			testCases := []struct {
+				name     string
+				cmd      func() redis.Cmder
+				expected string
+			}{
+				{name: "ping", cmd: func() redis.Cmder { return client.Ping(ctx) }, expected: "PONG"},
+				{name: "get missing", cmd: func() redis.Cmder { return client.Get(ctx, "k") }, expected: "redis: nil"},
+				{name: "set", cmd: func() redis.Cmder { return client.Set(ctx, "k", "v", 0) }, expected: "OK"},
+				{name: "get", cmd: func() redis.Cmder { return client.Get(ctx, "k") }, expected: "v"},
+				{name: "get json document", cmd: func() redis.Cmder { return client.Get(ctx, "doc") }, expected: `{"a":1}`},
+				{name: "set nx existing", cmd: func() redis.Cmder { return client.SetNX(ctx, "k", "w", 0) }, expected: "false"},
+				{name: "set nx new", cmd: func() redis.Cmder { return client.SetNX(ctx, "n", "1", 0) }, expected: "true"},
+				{name: "set xx missing", cmd: func() redis.Cmder { return client.SetXX(ctx, "x", "1", 0) }, expected: "false"},
+				{name: "set xx existing", cmd: func() redis.Cmder { return client.SetXX(ctx, "k", "w", 0) }, expected: "true"},
+				{name: "set ex", cmd: func() redis.Cmder { return client.Set(ctx, "t", "1", time.Hour) }, expected: "OK"},
+				{name: "ttl", cmd: func() redis.Cmder { return client.TTL(ctx, "t") }, expected: "1h0m0s"},
+				{name: "ttl without expiry", cmd: func() redis.Cmder { return client.TTL(ctx, "k") }, expected: "-1ns"},
+				{name: "ttl missing", cmd: func() redis.Cmder { return client.TTL(ctx, "x") }, expected: "-2ns"},
+				{name: "set keepttl", cmd: func() redis.Cmder { return client.Set(ctx, "t", "2", redis.KeepTTL) }, expected: "OK"},
+				{name: "ttl kept", cmd: func() redis.Cmder { return client.TTL(ctx, "t") }, expected: "1h0m0s"},
+				{name: "set drops ttl", cmd: func() redis.Cmder { return client.Set(ctx, "t", "3", 0) }, expected: "OK"},
+				{name: "ttl dropped", cmd: func() redis.Cmder { return client.TTL(ctx, "t") }, expected: "-1ns"},
+				{name: "set xx ex", cmd: func() redis.Cmder { return client.SetXX(ctx, "t", "4", time.Hour) }, expected: "true"},
+				{name: "ttl set with xx", cmd: func() redis.Cmder { return client.TTL(ctx, "t") }, expected: "1h0m0s"},
+				{name: "set xx drops ttl", cmd: func() redis.Cmder { return client.SetXX(ctx, "t", "5", 0) }, expected: "true"},
+				{name: "ttl dropped by xx", cmd: func() redis.Cmder { return client.TTL(ctx, "t") }, expected: "-1ns"},
+				{name: "expire", cmd: func() redis.Cmder { return client.Expire(ctx, "t", time.Minute) }, expected: "true"},
+				{name: "pttl", cmd: func() redis.Cmder { return client.PTTL(ctx, "t") }, expected: "1m0s"},
+				{name: "persist", cmd: func() redis.Cmder { return client.Persist(ctx, "t") }, expected: "true"},
+				{name: "expire missing", cmd: func() redis.Cmder { return client.Expire(ctx, "x", time.Minute) }, expected: "false"},
+				{name: "mset", cmd: func() redis.Cmder { return client.MSet(ctx, "m1", "a", "m2", "b") }, expected: "OK"},
+				{name: "mget", cmd: func() redis.Cmder { return client.MGet(ctx, "m1", "x", "m2") }, expected: "[a <nil> b]"},
+				{name: "exists", cmd: func() redis.Cmder { return client.Exists(ctx, "m1", "m1", "x") }, expected: "2"},
+				{name: "del", cmd: func() redis.Cmder { return client.Del(ctx, "m1", "m2", "x") }, expected: "2"},
+				{name: "exists deleted", cmd: func() redis.Cmder { return client.Exists(ctx, "m1") }, expected: "0"},
+				{name: "incr missing", cmd: func() redis.Cmder { return client.Incr(ctx, "c") }, expected: "1"},
+				{name: "incrby", cmd: func() redis.Cmder { return client.IncrBy(ctx, "c", 10) }, expected: "11"},
+				{name: "decr", cmd: func() redis.Cmder { return client.Decr(ctx, "c") }, expected: "10"},
+				{name: "decrby", cmd: func() redis.Cmder { return client.DecrBy(ctx, "c", 20) }, expected: "-10"},
+				{name: "incr string", cmd: func() redis.Cmder { return client.Incr(ctx, "n") }, expected: "2"},
+				{name: "get incremented string", cmd: func() redis.Cmder { return client.Get(ctx, "n") }, expected: "2"},
+				{name: "incr not integer", cmd: func() redis.Cmder { return client.Incr(ctx, "k") }, expected: "ERR value is not an integer or out of range"},
+				{name: "expire zero deletes", cmd: func() redis.Cmder { return client.Expire(ctx, "k", 0) }, expected: "true"},
+				{name: "get expired", cmd: func() redis.Cmder { return client.Get(ctx, "k") }, expected: "redis: nil"},
+				{name: "empty key", cmd: func() redis.Cmder { return client.Get(ctx, "") }, expected: "ERR empty key"},
+				{name: "set syntax error", cmd: func() redis.Cmder { return client.Do(ctx, "SET", "k", "v", "NX", "XX") }, expected: "ERR syntax error"},
+				{name: "unknown command", cmd: func() redis.Cmder { return client.Do(ctx, "LPUSH", "l", "v") }, expected: "ERR unknown command 'LPUSH'"},
+				{name: "wrong arity", cmd: func() redis.Cmder { return client.Do(ctx, "GET") }, expected: "ERR wrong number of arguments for 'get' command"},
+			}
+
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					cmd := tc.cmd()
+					result := ""
+					if err := cmd.Err(); err != nil {
+						result = err.Error()
+					} else {
+						result = cmdResult(cmd)
+					}
+					if result != tc.expected {
+						t.Errorf("Expected %s, got %s", tc.expected, result)
+					}
+				})
+			}
+
+			value, err := mem.GetValue("c")
+			if err != nil {
+				t.Fatalf("GetValue: %v", err)
+			}
+			if stored := value[0].([]any)[1]; stored != int64(-10) {
+				t.Errorf("Expected counter stored as a number, got %#v", stored)
+			}
+		})
+	}
+}
+
+// cmdResult formats a reply, rounding durations so TTLs compare exactly.
+func cmdResult(cmd redis.Cmder) string {
+	switch c := cmd.(type) {
+	case *redis.DurationCmd:
+		if c.Val() > 0 {
+			return c.Val().Round(time.Minute).String()
+		}
+		return c.Val().String()
+	case *redis.StatusCmd:
+		return c.Val()
+	case *redis.StringCmd:
+		return c.Val()
+	case *redis.BoolCmd:
+		return fmt.Sprint(c.Val())
+	case *redis.IntCmd:
+		return fmt.Sprint(c.Val())
+	case *redis.SliceCmd:
+		return fmt.Sprint(c.Val())
+	}
+	return fmt.Sprint(cmd.(*redis.Cmd).Val())
+}
+
+func TestRESPAuth(t *testing.T) {
+	mem := storage.NewMemoryRepository()
+	addr := serve(t, mem, resp.Config{Password: "secret"})
+	ctx := context.Background()
+
+	testCases := []struct {
+		name     string
+		opts     redis.Options
+		expected string
+	}{
+		{name: "no password", opts: redis.Options{Addr: addr}, expected: "NOAUTH Authentication required."},
+		{name: "wrong password", opts: redis.Options{Addr: addr, Password: "wrong"}, expected: "WRONGPASS invalid username-password pair or user is disabled."},
+		{name: "wrong user", opts: redis.Options{Addr: addr, Username: "admin", Password: "secret"}, expected: "WRONGPASS invalid username-password pair or user is disabled."},
+		{name: "password with RESP3", opts: redis.Options{Addr: addr, Password: "secret", Protocol: 3}},
+		{name: "password with RESP2", opts: redis.Options{Addr: addr, Password: "secret", Protocol: 2}},
+		{name: "default user", opts: redis.Options{Addr: addr, Username: "default", Password: "secret"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newClient(t, &tc.opts)
+			err := client.Set(ctx, "k", "v", 0).Err()
+			result := ""
+			if err != nil {
+				result = err.Error()
+			}
+			if result != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+
+	t.Run("AUTH command", func(t *testing.T) {
+		client := newClient(t, &redis.Options{Addr: addr, PoolSize: 1})
+		err := client.Do(ctx, "AUTH", "wrong").Err()
+		if err == nil || !strings.HasPrefix(err.Error(), "WRONGPASS") {
+			t.Fatalf("Expected WRONGPASS, got %v", err)
+		}
+		err = client.Do(ctx, "AUTH", "secret").Err()
+		if err != nil {
+			t.Fatalf("AUTH: %v", err)
+		}
+		value, err := client.Get(ctx, "k").Result()
+		if err != nil || value != "v" {
+			t.Errorf("Expected v, got %q, %v", value, err)
+		}
+	})
+}
+
+func TestRESPScan(t *testing.T) {
+	mem := storage.NewMemoryRepository()
+	var expected []string
+	for i := 0; i < 25; i++ {
+		key := fmt.Sprintf("user:%02d", i)
+		expected = append(expected, key)
+		err := mem.AddValue(key, "v")
+		if err != nil {
+			t.Fatalf("AddValue: %v", err)
+		}
+	}
+	for _, key := range []string{"order:1", "user-x", "zone"} {
+		err := mem.AddValue(key, "v")
+		if err != nil {
+			t.Fatalf("AddValue: %v", err)
+		}
+	}
+	client := newClient(t, &redis.Options{Addr: serve(t, mem, resp.Config{})})
+	ctx := context.Background()
+
+	testCases := []struct {
+		name     string
+		match    string
+		count    int64
+		expected []string
+	}{
+		{name: "prefix", match: "user:*", count: 7, expected: expected},
+		{name: "class", match: "user:1[0-2]", count: 3, expected: []string{"user:10", "user:11", "user:12"}},
+		{name: "single character", match: "user?x", count: 100, expected: []string{"user-x"}},
+		{name: "everything", match: "", count: 0, expected: append(append([]string{"order:1"}, expected...), "user-x", "zone")},
+		{name: "negated class", match: "[^u]*", count: 2, expected: []string{"order:1", "zone"}},
+		{name: "escape", match: `user\-x`, count: 10, expected: []string{"user-x"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var keys []string
+			iter := client.Scan(ctx, 0, tc.match, tc.count).Iterator()
+			for iter.Next(ctx) {
+				keys = append(keys, iter.Val())
+			}
+			if err := iter.Err(); err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+			sort.Strings(keys)
+			sort.Strings(tc.expected)
+			if fmt.Sprint(keys) != fmt.Sprint(tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, keys)
+			}
+		})
+	}
+
+	err := client.Scan(ctx, 12345, "", 0).Err()
+	if err == nil || err.Error() != "ERR invalid cursor" {
+		t.Errorf("Expected invalid cursor, got %v", err)
+	}
+}
+
+func TestRESPIncrConcurrent(t *testing.T) {
+	mem := storage.NewMemoryRepository()
+	client := newClient(t, &redis.Options{Addr: serve(t, mem, resp.Config{}), PoolSize: 8})
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8*25)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				errs <- client.Incr(ctx, "counter").Err()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Incr: %v", err)
+		}
+	}
+
+	value, err := client.Get(ctx, "counter").Result()
+	if err != nil || value != "200" {
+		t.Errorf("Expected 200, got %q, %v", value, err)
+	}
+}
+
+func TestRESPUnavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockKvRepository(ctrl)
+	client := newClient(t, &redis.Options{Addr: serve(t, mockRepo, resp.Config{})})
+
+	mockRepo.EXPECT().GetValue("k").Return(nil, resilience.ErrCircuitOpen).Times(1)
+	err := client.Get(context.Background(), "k").Err()
+	if err == nil || err.Error() != "ERR storage temporarily unavailable" {
+		t.Errorf("Expected unavailable error, got %v", err)
+	}
+}
+
+func TestRESPInline(t *testing.T) {
+	mem := storage.NewMemoryRepository()
+	conn, err := net.Dial("tcp", serve(t, mem, resp.Config{}))
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("SET greeting hello\r\nGET greeting\r\nQUIT\r\n"))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var reply strings.Builder
+	buf := make([]byte, 256)
+	for {
+		n, err := conn.Read(buf)
+		reply.Write(buf[:n])
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) && err.Error() != "EOF" {
+				t.Logf("Read: %v", err)
+			}
+			break
+		}
+	}
+	expected := "+OK\r\n$5\r\nhello\r\n+OK\r\n"
+	if reply.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, reply.String())
+	}
+}
+
+func TestRESPWriteChecks(t *testing.T) {
+	mem := storage.NewMemoryRepository()
+	sink, err := audit.OpenFile(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer sink.Close()
+	handler := &handlers.Handler{
+		Repo:   mem,
+		Usage:  mem,
+		Quotas: &handlers.Quotas{Default: handlers.Quota{MaxKeys: 2}},
+		Audit:  &handlers.Audit{Logger: audit.NewLogger(sink, false)},
+	}
+	client := newClient(t, &redis.Options{Addr: serveHandler(t, handler, resp.Config{})})
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		cmd      []any
+		expected string
+	}{
+		{"reserved key", []any{"SET", "_query", "v"}, "ERR " + handlers.ErrReservedKey},
+		{"reserved key in mset", []any{"MSET", "a", "1", "_export", "2"}, "ERR " + handlers.ErrReservedKey},
+		{"set", []any{"SET", "a", "1"}, ""},
+		{"incr", []any{"INCR", "b"}, ""},
+		{"over quota", []any{"SET", "c", "3"}, "ERR " + handlers.ErrQuotaExceeded},
+		{"setnx over quota", []any{"SETNX", "c", "3"}, "ERR " + handlers.ErrQuotaExceeded},
+		{"replace within quota", []any{"SET", "a", "2"}, ""},
+		{"delete", []any{"DEL", "a", "missing"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := client.Do(ctx, tt.cmd...).Err()
+			actual := ""
+			if err != nil {
+				actual = err.Error()
+			}
+			if !strings.HasPrefix(actual, tt.expected) || (tt.expected == "" && actual != "") {
+				t.Errorf("Expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+
+	records, err := sink.Query(audit.Query{})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var actual []string
+	for _, record := range records {
+		actual = append(actual, fmt.Sprintf("%s %s %s", record.Principal, record.Operation, record.Key))
+	}
+	expected := []string{"anonymous add a", "anonymous add b", "anonymous update a", "anonymous delete a"}
+	if strings.Join(actual, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Expected records %v, got %v", expected, actual)
+	}
+}
+
+func TestRESPSetNXErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockKvRepository(ctrl)
+	client := newClient(t, &redis.Options{Addr: serve(t, mockRepo, resp.Config{})})
+	ctx := context.Background()
+
+	mockRepo.EXPECT().AddValue("k", "v").Return(storage.ErrKeyExists).Times(2)
+	mockRepo.EXPECT().AddValue("k", "v").Return(errors.New("connection reset")).Times(2)
+
+	ok, err := client.SetNX(ctx, "k", "v", 0).Result()
+	if err != nil || ok {
+		t.Errorf("SET NX on an existing key: expected false, got %v, %v", ok, err)
+	}
+	ok, err = client.Do(ctx, "SETNX", "k", "v").Bool()
+	if err != nil || ok {
+		t.Errorf("SETNX on an existing key: expected false, got %v, %v", ok, err)
+	}
+	err = client.SetNX(ctx, "k", "v", 0).Err()
+	if err == nil || err.Error() != "ERR internal error" {
+		t.Errorf("SET NX on a failing storage: expected internal error, got %v", err)
+	}
+	err = client.Do(ctx, "SETNX", "k", "v").Err()
+	if err == nil || err.Error() != "ERR internal error" {
+		t.Errorf("SETNX on a failing storage: expected internal error, got %v", err)
+	}
+}
+
+// TestRESPSetTTL checks that SET writes the TTL in the same storage call
+// as the value, so a failed write leaves no key without its TTL.
+func TestRESPSetTTL(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockKvRepository(ctrl)
+	mockMeta := mocks.NewMockMetadataRepository(ctrl)
+	mockWrites := mocks.NewMockAnnotatedRepository(ctrl)
+	handler := &handlers.Handler{Repo: mockRepo, Metadata: mockMeta}
+	client := newClient(t, &redis.Options{Addr: serveHandler(t, handler, resp.Config{})})
+	ctx := context.Background()
+
+	hour, none := time.Hour, time.Duration(0)
+	withTTL := storage.Annotation{Writer: "anonymous", TTL: &hour}
+	withoutTTL := storage.Annotation{Writer: "anonymous", TTL: &none}
+	gomock.InOrder(
+		mockMeta.EXPECT().Annotated(withTTL).Return(mockWrites),
+		mockWrites.EXPECT().PutValue("k", "v").Return(false, errors.New("connection reset")),
+		mockMeta.EXPECT().Annotated(withTTL).Return(mockWrites),
+		mockWrites.EXPECT().PutValue("k", "v").Return(true, nil),
+		mockMeta.EXPECT().Annotated(withoutTTL).Return(mockWrites),
+		mockWrites.EXPECT().UpdateValue("k", "w").Return(nil),
+	)
+
+	err := client.Set(ctx, "k", "v", time.Hour).Err()
+	if err == nil || err.Error() != "ERR internal error" {
+		t.Errorf("SET EX on a failing storage: expected internal error, got %v", err)
+	}
+	err = client.Set(ctx, "k", "v", time.Hour).Err()
+	if err != nil {
+		t.Errorf("SET EX: %v", err)
+	}
+	err = client.SetXX(ctx, "k", "w", 0).Err()
+	if err != nil {
+		t.Errorf("SET XX: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package sharding
+
+import "hash/crc32"
+
+// DefaultBucketCount matches the vshard default bucket_count.
+const DefaultBucketCount uint64 = 3000
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// BucketID maps key to a bucket in [1, count] the same way
+// vshard.router.bucket_id_strcrc32 does, so data sharded by this service
+// stays addressable by a vshard router with the same bucket count.
+func BucketID(key string, count uint64) uint64 {
+	// Tarantool's digest.crc32 skips the final inversion done by Go.
+	sum := ^crc32.Checksum([]byte(key), castagnoli)
+	return uint64(sum)%count + 1
+}
+
+// Assignment returns the owning shard of every bucket for the given number
+// of shards: owners[bucketID-1] is a shard index. The layout for n shards
+// is derived from the layout for n-1 shards by moving as few buckets as
+// possible, so adding a shard only relocates about 1/n of the data and the
+// result needs no external storage.
+func Assignment(buckets uint64, shards int) []int {
+	owners := make([]int, buckets)
+	for n := 2; n <= shards; n++ {
+		owners = spread(owners, n)
+	}
+	return owners
+}
+
+// spread redistributes owners over n shards. Every shard keeps buckets up
+// to its target share; the surplus goes to the shards that lack buckets.
+func spread(owners []int, n int) []int {
+	buckets := len(owners)
+	target := make([]int, n)
+	for i := range target {
+		target[i] = buckets / n
+		if i < buckets%n {
+			target[i]++
+		}
+	}
+
+	kept := make([]int, n)
+	next := make([]int, buckets)
+	var moved []int
+	for bucket, shard := range owners {
+		if shard < n && kept[shard] < target[shard] {
+			kept[shard]++
+			next[bucket] = shard
+			continue
+		}
+		moved = append(moved, bucket)
+	}
+
+	shard := 0
+	for _, bucket := range moved {
+		for kept[shard] >= target[shard] {
+			shard++
+		}
+		kept[shard]++
+		next[bucket] = shard
+	}
+	return next
+}
@@ -0,0 +1,158 @@
+package sharding
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+var ErrInvalidRebalance = errors.New("invalid rebalance")
+
+// DefaultRebalanceBatch is the number of keys read per scan request.
+const DefaultRebalanceBatch uint32 = 500
+
+// Rebalancer moves keys whose bucket changed owner when the number of
+// shards goes from From to To. Shards must hold at least max(From, To)
+// backends in the same order the service is configured with.
+//
+// Every moved key is first copied to its new shard, whole and only when
+// the key is not there yet, and then deleted from the old one only if its
+// value did not change meanwhile. A crash leaves a duplicate rather than a
+// loss and the rebalance can simply be run again. A key whose copies
+// differ is left on both shards and counted as a conflict to be resolved
+// by hand; writers should be paused to avoid them. Moves bypass the trash
+// and history and keep the TTL and metadata of the entries.
+type Rebalancer struct {
+	Shards  []Shard
+	From    int
+	To      int
+	Buckets uint64
+	Batch   uint32
+}
+
+// RebalanceStats summarizes a finished rebalance.
+type RebalanceStats struct {
+	Scanned   int
+	Moved     int
+	Conflicts int
+}
+
+// MovedBuckets returns how many buckets change owner.
+func (r *Rebalancer) MovedBuckets() int {
+	from := Assignment(r.buckets(), r.From)
+	to := Assignment(r.buckets(), r.To)
+	var moved int
+	for bucket := range from {
+		if from[bucket] != to[bucket] {
+			moved++
+		}
+	}
+	return moved
+}
+
+func (r *Rebalancer) buckets() uint64 {
+	if r.Buckets == 0 {
+		return DefaultBucketCount
+	}
+	return r.Buckets
+}
+
+// Run scans every old shard and moves keys to their new owners.
+func (r *Rebalancer) Run() (RebalanceStats, error) {
+	var stats RebalanceStats
+	if r.From < 1 || r.To < 1 || len(r.Shards) < max(r.From, r.To) ||
+		r.buckets() < uint64(max(r.From, r.To)) {
+		return stats, fmt.Errorf("%w: %d -> %d shards with %d backends",
+			ErrInvalidRebalance, r.From, r.To, len(r.Shards))
+	}
+
+	owners := Assignment(r.buckets(), r.To)
+	for source := 0; source < r.From; source++ {
+		shard, err := r.drain(source, owners)
+		stats.Scanned += shard.Scanned
+		stats.Moved += shard.Moved
+		stats.Conflicts += shard.Conflicts
+		if err != nil {
+			return stats, err
+		}
+		log.Logger.Infow("Shard rebalanced", "shard", source,
+			"scanned", shard.Scanned, "moved", shard.Moved, "conflicts", shard.Conflicts)
+	}
+	return stats, nil
+}
+
+// drain moves the keys of the source shard that belong elsewhere.
+func (r *Rebalancer) drain(source int, owners []int) (RebalanceStats, error) {
+	batch := r.Batch
+	if batch == 0 {
+		batch = DefaultRebalanceBatch
+	}
+
+	var stats RebalanceStats
+	query := storage.ScanQuery{Limit: batch}
+	for {
+		tuples, err := r.Shards[source].ScanValues(query)
+		if err != nil {
+			return stats, err
+		}
+		if len(tuples) == 0 {
+			return stats, nil
+		}
+
+		for _, item := range tuples {
+			tuple := item.([]any)
+			key := tupleKey(tuple)
+			stats.Scanned++
+			target := owners[BucketID(key, r.buckets())-1]
+			if target == source || expired(tuple) {
+				continue
+			}
+			moved, err := r.move(r.Shards[source], r.Shards[target], tuple)
+			if err != nil {
+				return stats, fmt.Errorf("move %q to shard %d: %w", key, target, err)
+			}
+			if moved {
+				stats.Moved++
+			} else {
+				stats.Conflicts++
+				log.Logger.Warnw("Key differs between shards, left on both", "key", key,
+					"source", source, "target", target)
+			}
+		}
+
+		query.After = tupleKey(tuples[len(tuples)-1])
+	}
+}
+
+// expired reports whether the TTL of tuple passed; such tuples are left to
+// expire on their old shard.
+func expired(tuple []any) bool {
+	expiresAt, ok := storage.TupleExpiry(tuple)
+	return ok && !time.Now().Before(expiresAt)
+}
+
+// move copies tuple to target and removes it from source. It reports
+// false when the key on target or source holds a different value, which
+// is left in place.
+func (r *Rebalancer) move(source Shard, target Shard, tuple []any) (bool, error) {
+	key, value := tupleKey(tuple), tupleValue(tuple)
+
+	copied, err := target.CopyTuple(tuple)
+	if err != nil {
+		return false, err
+	}
+	if !copied {
+		current, err := target.GetValue(key)
+		if err != nil && !errors.Is(err, storage.ErrKeyNotFound) {
+			return false, err
+		}
+		if err != nil || !reflect.DeepEqual(tupleValue(current[0]), value) {
+			return false, nil
+		}
+	}
+	return source.RemoveTuple(key, value)
+}
@@ -0,0 +1,524 @@
+package sharding
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"kvManager/internal/storage"
+)
+
+var ErrNoShards = errors.New("no shards configured")
+
+// Shard is a single storage backend holding a part of the keys.
+// TarantoolRepository and MemoryRepository both satisfy it.
+type Shard interface {
+	storage.KvRepository
+	storage.IndexRepository
+	storage.SchemaRepository
+	storage.UsageRepository
+	storage.HistoryRepository
+	storage.TrashRepository
+	storage.MetadataRepository
+	storage.MoveRepository
+	storage.VersionRepository
+	storage.BackupRepository
+}
+
+// Repository routes every key to one of several shards by its vshard
+// bucket, along with its history. Batches are split per shard and scans,
+// queries and index management fan out to all of them. Schemas are written to every shard
+// and read from the first one.
+type Repository struct {
+	shards []Shard
+	owners []int
+
+	// annotation is stored with every value written through a view
+	// returned by Annotated.
+	annotation *storage.Annotation
+}
+
+var (
+	_ storage.KvRepository       = (*Repository)(nil)
+	_ storage.IndexRepository    = (*Repository)(nil)
+	_ storage.SchemaRepository   = (*Repository)(nil)
+	_ storage.UsageRepository    = (*Repository)(nil)
+	_ storage.HistoryRepository  = (*Repository)(nil)
+	_ storage.TrashRepository    = (*Repository)(nil)
+	_ storage.MetadataRepository = (*Repository)(nil)
+	_ storage.VersionRepository  = (*Repository)(nil)
+	_ storage.BackupRepository   = (*Repository)(nil)
+)
+
+func NewRepository(shards []Shard) (*Repository, error) {
+	return NewRepositoryWithBuckets(shards, DefaultBucketCount)
+}
+
+func NewRepositoryWithBuckets(shards []Shard, buckets uint64) (*Repository, error) {
+	if len(shards) == 0 || buckets < uint64(len(shards)) {
+		return nil, ErrNoShards
+	}
+	return &Repository{shards: shards, owners: Assignment(buckets, len(shards))}, nil
+}
+
+// ShardFor returns the index of the shard that owns key.
+func (repo *Repository) ShardFor(key string) int {
+	return repo.owners[BucketID(key, uint64(len(repo.owners)))-1]
+}
+
+func (repo *Repository) shard(key string) Shard {
+	return repo.shards[repo.ShardFor(key)]
+}
+
+// writer returns where the values of key are written: the owning shard,
+// or its annotated view when repo is one.
+func (repo *Repository) writer(key string) storage.AnnotatedRepository {
+	if repo.annotation == nil {
+		return repo.shard(key)
+	}
+	return repo.shard(key).Annotated(*repo.annotation)
+}
+
+// each runs fn for every shard concurrently and joins the errors.
+func (repo *Repository) each(fn func(i int, shard Shard) error) error {
+	errs := make([]error, len(repo.shards))
+	var wg sync.WaitGroup
+	for i, shard := range repo.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(i, shard)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// groupKeys splits keys by owning shard, keeping their relative order.
+func (repo *Repository) groupKeys(keys []string) [][]string {
+	groups := make([][]string, len(repo.shards))
+	for _, key := range keys {
+		i := repo.ShardFor(key)
+		groups[i] = append(groups[i], key)
+	}
+	return groups
+}
+
+func (repo *Repository) AddValue(key string, value any) error {
+	return repo.writer(key).AddValue(key, value)
+}
+
+func (repo *Repository) GetValue(key string) ([]any, error) {
+	return repo.shard(key).GetValue(key)
+}
+
+func (repo *Repository) UpdateValue(key string, value any) error {
+	return repo.writer(key).UpdateValue(key, value)
+}
+
+func (repo *Repository) DeleteValue(key string) error {
+	return repo.shard(key).DeleteValue(key)
+}
+
+func (repo *Repository) PutValue(key string, value any) (bool, error) {
+	return repo.writer(key).PutValue(key, value)
+}
+
+func (repo *Repository) CompareAndSet(key string, expected any, value any) error {
+	return repo.writer(key).CompareAndSet(key, expected, value)
+}
+
+func (repo *Repository) CompareVersionAndSet(key string, version uint64, value any) error {
+	return repo.writer(key).CompareVersionAndSet(key, version, value)
+}
+
+func (repo *Repository) MergeValue(key string, patch any) ([]any, error) {
+	return repo.writer(key).MergeValue(key, patch)
+}
+
+func (repo *Repository) ExpireValue(key string, ttl time.Duration) error {
+	return repo.shard(key).ExpireValue(key, ttl)
+}
+
+func (repo *Repository) GetValues(keys []string) ([]any, error) {
+	groups := repo.groupKeys(keys)
+	results := make([][]any, len(repo.shards))
+	err := repo.each(func(i int, shard Shard) error {
+		if len(groups[i]) == 0 {
+			return nil
+		}
+		tuples, err := shard.GetValues(groups[i])
+		results[i] = tuples
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merge(results), nil
+}
+
+func (repo *Repository) DeleteValues(keys []string) ([]string, error) {
+	groups := repo.groupKeys(keys)
+	results := make([][]string, len(repo.shards))
+	err := repo.each(func(i int, shard Shard) error {
+		if len(groups[i]) == 0 {
+			return nil
+		}
+		deleted, err := shard.DeleteValues(groups[i])
+		results[i] = deleted
+		return err
+	})
+
+	deleted := make([]string, 0, len(keys))
+	for _, result := range results {
+		deleted = append(deleted, result...)
+	}
+	return deleted, err
+}
+
+// ScanValues asks every shard for a full page and merges them in key
+// order, so paging with After works the same as on a single instance.
+func (repo *Repository) ScanValues(query storage.ScanQuery) ([]any, error) {
+	results := make([][]any, len(repo.shards))
+	err := repo.each(func(i int, shard Shard) error {
+		tuples, err := shard.ScanValues(query)
+		results[i] = tuples
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tuples := merge(results)
+	sort.SliceStable(tuples, func(i, j int) bool {
+		return tupleKey(tuples[i]) < tupleKey(tuples[j])
+	})
+	return truncate(tuples, query.Limit, storage.DefaultScanLimit), nil
+}
+
+// QueryIndex runs the query on every shard and merges the results in
+// index order, breaking ties by key.
+func (repo *Repository) QueryIndex(query storage.IndexQuery) ([]any, error) {
+	def, err := repo.findIndex(query.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([][]any, len(repo.shards))
+	err = repo.each(func(i int, shard Shard) error {
+		tuples, err := shard.QueryIndex(query)
+		results[i] = tuples
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tuples := merge(results)
+	sort.SliceStable(tuples, func(i, j int) bool {
+		a, _ := def.Extract(tupleValue(tuples[i]))
+		b, _ := def.Extract(tupleValue(tuples[j]))
+		if cmp, ok := storage.CompareKeys(a, b); ok && cmp != 0 {
+			return cmp < 0
+		}
+		return tupleKey(tuples[i]) < tupleKey(tuples[j])
+	})
+	return truncate(tuples, query.Limit, storage.DefaultQueryLimit), nil
+}
+
+func (repo *Repository) findIndex(name string) (*storage.IndexDefinition, error) {
+	defs, err := repo.shards[0].ListIndexes()
+	if err != nil {
+		return nil, err
+	}
+	for i := range defs {
+		if defs[i].Name == name {
+			return &defs[i], nil
+		}
+	}
+	return nil, storage.ErrIndexNotFound
+}
+
+func (repo *Repository) CreateIndex(def storage.IndexDefinition) error {
+	return repo.each(func(_ int, shard Shard) error {
+		return shard.CreateIndex(def)
+	})
+}
+
+// DropIndex drops the index everywhere. It reports ErrIndexNotFound only
+// when no shard had the index.
+func (repo *Repository) DropIndex(name string) error {
+	var (
+		mu      sync.Mutex
+		dropped bool
+	)
+	err := repo.each(func(_ int, shard Shard) error {
+		err := shard.DropIndex(name)
+		if errors.Is(err, storage.ErrIndexNotFound) {
+			return nil
+		}
+		if err == nil {
+			mu.Lock()
+			dropped = true
+			mu.Unlock()
+		}
+		return err
+	})
+	if err == nil && !dropped {
+		return storage.ErrIndexNotFound
+	}
+	return err
+}
+
+func (repo *Repository) ListIndexes() ([]storage.IndexDefinition, error) {
+	return repo.shards[0].ListIndexes()
+}
+
+func (repo *Repository) PutSchema(prefix string, schema string) error {
+	return repo.each(func(_ int, shard Shard) error {
+		return shard.PutSchema(prefix, schema)
+	})
+}
+
+func (repo *Repository) GetSchemas() (map[string]string, error) {
+	return repo.shards[0].GetSchemas()
+}
+
+func (repo *Repository) DeleteSchema(prefix string) error {
+	err := repo.shards[0].DeleteSchema(prefix)
+	if err != nil {
+		return err
+	}
+	return repo.each(func(i int, shard Shard) error {
+		if i == 0 {
+			return nil
+		}
+		err := shard.DeleteSchema(prefix)
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			return nil
+		}
+		return err
+	})
+}
+
+// GetUsage sums the usage of namespace over all shards.
+func (repo *Repository) GetUsage(namespace string) (storage.Usage, error) {
+	results := make([]storage.Usage, len(repo.shards))
+	err := repo.each(func(i int, shard Shard) error {
+		usage, err := shard.GetUsage(namespace)
+		results[i] = usage
+		return err
+	})
+	if err != nil {
+		return storage.Usage{}, err
+	}
+
+	var usage storage.Usage
+	for _, result := range results {
+		usage.Keys += result.Keys
+		usage.Bytes += result.Bytes
+	}
+	return usage, nil
+}
+
+func (repo *Repository) GetHistory(query storage.HistoryQuery) ([]storage.Revision, error) {
+	return repo.shard(query.Key).GetHistory(query)
+}
+
+func (repo *Repository) GetRevision(key string, revision uint64) (storage.Revision, error) {
+	return repo.shard(key).GetRevision(key, revision)
+}
+
+func (repo *Repository) GetRevisionAt(key string, at time.Time) (storage.Revision, error) {
+	return repo.shard(key).GetRevisionAt(key, at)
+}
+
+// ListTrash merges a full page of every shard in key order, like
+// ScanValues.
+func (repo *Repository) ListTrash(query storage.ScanQuery) ([]storage.TrashEntry, error) {
+	results := make([][]storage.TrashEntry, len(repo.shards))
+	err := repo.each(func(i int, shard Shard) error {
+		entries, err := shard.ListTrash(query)
+		results[i] = entries
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]storage.TrashEntry, 0)
+	for _, result := range results {
+		entries = append(entries, result...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	limit := query.Limit
+	if limit == 0 {
+		limit = storage.DefaultScanLimit
+	}
+	if uint32(len(entries)) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+func (repo *Repository) Undelete(key string) error {
+	return repo.shard(key).Undelete(key)
+}
+
+func (repo *Repository) Annotate(key string, writer string, labels map[string]string) error {
+	return repo.shard(key).Annotate(key, writer, labels)
+}
+
+// Annotated returns a view of repo whose writes store annotation on the
+// owning shard along with the value.
+func (repo *Repository) Annotated(annotation storage.Annotation) storage.AnnotatedRepository {
+	view := *repo
+	view.annotation = &annotation
+	return &view
+}
+
+func (repo *Repository) CopyTuple(tuple []any) (bool, error) {
+	return repo.shard(tupleKey(tuple)).CopyTuple(tuple)
+}
+
+func (repo *Repository) RemoveTuple(key string, value any) (bool, error) {
+	return repo.shard(key).RemoveTuple(key, value)
+}
+
+// PurgeTrash purges up to limit entries on every shard and returns the
+// total.
+func (repo *Repository) PurgeTrash(now time.Time, limit uint32) (int, error) {
+	counts := make([]int, len(repo.shards))
+	err := repo.each(func(i int, shard Shard) error {
+		purged, err := shard.PurgeTrash(now, limit)
+		counts[i] = purged
+		return err
+	})
+	total := 0
+	for _, purged := range counts {
+		total += purged
+	}
+	return total, err
+}
+
+// FreezeBackup freezes every shard and returns the total. Each shard is
+// copied in its own transaction, so writes to different shards made
+// meanwhile may be in one copy and not in another.
+func (repo *Repository) FreezeBackup() (int64, error) {
+	counts := make([]int64, len(repo.shards))
+	err := repo.each(func(i int, shard Shard) error {
+		count, err := shard.FreezeBackup()
+		counts[i] = count
+		return err
+	})
+	var total int64
+	for _, count := range counts {
+		total += count
+	}
+	return total, err
+}
+
+// ScanBackup merges the backup pages of every shard like ScanValues.
+func (repo *Repository) ScanBackup(query storage.ScanQuery) ([]any, error) {
+	results := make([][]any, len(repo.shards))
+	err := repo.each(func(i int, shard Shard) error {
+		tuples, err := shard.ScanBackup(query)
+		results[i] = tuples
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tuples := merge(results)
+	sort.SliceStable(tuples, func(i, j int) bool {
+		return tupleKey(tuples[i]) < tupleKey(tuples[j])
+	})
+	return truncate(tuples, query.Limit, storage.DefaultScanLimit), nil
+}
+
+// StageBackup stages every tuple on the shard that owns its key.
+func (repo *Repository) StageBackup(tuples []any) error {
+	groups := make([][]any, len(repo.shards))
+	for _, tuple := range tuples {
+		i := repo.ShardFor(tupleKey(tuple))
+		groups[i] = append(groups[i], tuple)
+	}
+	return repo.each(func(i int, shard Shard) error {
+		if len(groups[i]) == 0 {
+			return nil
+		}
+		return shard.StageBackup(groups[i])
+	})
+}
+
+// CommitBackup checks that every shard is empty before committing any of
+// them, then commits them one by one. A commit is atomic per shard only:
+// after a failure the shards committed before keep their entries.
+func (repo *Repository) CommitBackup() (int64, error) {
+	tuples, err := repo.ScanValues(storage.ScanQuery{Limit: 1})
+	if err != nil {
+		return 0, err
+	}
+	if len(tuples) > 0 {
+		return 0, storage.ErrNotEmpty
+	}
+
+	var total int64
+	for _, shard := range repo.shards {
+		count, err := shard.CommitBackup()
+		total += count
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (repo *Repository) ClearBackup() error {
+	return repo.each(func(_ int, shard Shard) error {
+		return shard.ClearBackup()
+	})
+}
+
+func merge(results [][]any) []any {
+	var total int
+	for _, result := range results {
+		total += len(result)
+	}
+	tuples := make([]any, 0, total)
+	for _, result := range results {
+		tuples = append(tuples, result...)
+	}
+	return tuples
+}
+
+func truncate(tuples []any, limit uint32, def uint32) []any {
+	if limit == 0 {
+		limit = def
+	}
+	if uint32(len(tuples)) > limit {
+		return tuples[:limit]
+	}
+	return tuples
+}
+
+func tupleKey(item any) string {
+	tuple, ok := item.([]any)
+	if !ok || len(tuple) == 0 {
+		return ""
+	}
+	key, _ := tuple[0].(string)
+	return key
+}
+
+func tupleValue(item any) any {
+	tuple, ok := item.([]any)
+	if !ok || len(tuple) < 2 {
+		return nil
+	}
+	return tuple[1]
+}
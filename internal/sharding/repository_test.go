@@ -0,0 +1,385 @@
+package sharding_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/sharding"
+	"kvManager/internal/storage"
+)
+
+func memoryShards(n int) []sharding.Shard {
+	shards := make([]sharding.Shard, n)
+	for i := range shards {
+		shards[i] = storage.NewMemoryRepository()
+	}
+	return shards
+}
+
+func keys(tuples []any) []string {
+	result := make([]string, 0, len(tuples))
+	for _, item := range tuples {
+		result = append(result, item.([]any)[0].(string))
+	}
+	return result
+}
+
+func TestBuckets(t *testing.T) {
+	for _, key := range []string{"", "a", "user:1", "order:42"} {
+		id := sharding.BucketID(key, sharding.DefaultBucketCount)
+		if id < 1 || id > sharding.DefaultBucketCount {
+			t.Errorf("Bucket of %q out of range: %d", key, id)
+		}
+		if id != sharding.BucketID(key, sharding.DefaultBucketCount) {
+			t.Errorf("Bucket of %q is not stable", key)
+		}
+	}
+
+	for shards := 1; shards <= 5; shards++ {
+		owners := sharding.Assignment(sharding.DefaultBucketCount, shards)
+		counts := make([]int, shards)
+		for _, owner := range owners {
+			counts[owner]++
+		}
+		for i, count := range counts {
+			if count < 3000/shards || count > 3000/shards+1 {
+				t.Errorf("%d shards: shard %d owns %d buckets", shards, i, count)
+			}
+		}
+		if shards == 1 {
+			continue
+		}
+
+		previous := sharding.Assignment(sharding.DefaultBucketCount, shards-1)
+		var moved int
+		for bucket := range owners {
+			if owners[bucket] != previous[bucket] {
+				moved++
+				if owners[bucket] != shards-1 {
+					t.Errorf("%d shards: bucket %d moved between old shards", shards, bucket+1)
+				}
+			}
+		}
+		if moved != counts[shards-1] {
+			t.Errorf("%d shards: moved %d buckets, new shard owns %d", shards, moved, counts[shards-1])
+		}
+	}
+}
+
+func TestShardedRepository(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Errorf("failed to initialize logger: %v", err)
+		return
+	}
+
+	shards := memoryShards(3)
+	repo, err := sharding.NewRepository(shards)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	var all []string
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("user:%02d", i)
+		all = append(all, key)
+		err = repo.AddValue(key, map[string]any{"age": int64(i)})
+		if err != nil {
+			t.Fatalf("Failed to add %s: %v", key, err)
+		}
+	}
+
+	t.Run("keys are routed to their shard", func(t *testing.T) {
+		used := make(map[int]bool)
+		for _, key := range all {
+			owner := repo.ShardFor(key)
+			used[owner] = true
+			for i, shard := range shards {
+				_, err := shard.GetValue(key)
+				if (i == owner) != (err == nil) {
+					t.Errorf("Key %s on shard %d: %v, owner %d", key, i, err, owner)
+				}
+			}
+		}
+		if len(used) != len(shards) {
+			t.Errorf("Expected keys on every shard, got %v", used)
+		}
+	})
+
+	t.Run("batches fan out", func(t *testing.T) {
+		tuples, err := repo.GetValues([]string{"user:01", "user:17", "none", "user:29"})
+		if err != nil || len(tuples) != 3 {
+			t.Fatalf("Expected 3 tuples, got %v, %v", tuples, err)
+		}
+		deleted, err := repo.DeleteValues([]string{"user:28", "user:29", "none"})
+		if err != nil || len(deleted) != 2 {
+			t.Fatalf("Expected 2 deleted keys, got %v, %v", deleted, err)
+		}
+		all = all[:28]
+	})
+
+	t.Run("scan merges shards in key order", func(t *testing.T) {
+		var scanned []string
+		query := storage.ScanQuery{Prefix: "user:", Limit: 7}
+		for {
+			tuples, err := repo.ScanValues(query)
+			if err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+			if len(tuples) == 0 {
+				break
+			}
+			page := keys(tuples)
+			scanned = append(scanned, page...)
+			query.After = page[len(page)-1]
+		}
+		if fmt.Sprint(scanned) != fmt.Sprint(all) {
+			t.Errorf("Expected %v, got %v", all, scanned)
+		}
+	})
+
+	t.Run("index query merges shards in index order", func(t *testing.T) {
+		err := repo.CreateIndex(storage.IndexDefinition{Name: "by_age", Path: "age", Type: "integer"})
+		if err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+		tuples, err := repo.QueryIndex(storage.IndexQuery{
+			Index: "by_age",
+			From:  &storage.Bound{Value: "10", Inclusive: true},
+			To:    &storage.Bound{Value: "15"},
+			Limit: 3,
+		})
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if got := fmt.Sprint(keys(tuples)); got != "[user:10 user:11 user:12]" {
+			t.Errorf("Unexpected query result %s", got)
+		}
+
+		err = repo.DropIndex("by_age")
+		if err != nil {
+			t.Fatalf("Failed to drop index: %v", err)
+		}
+		err = repo.DropIndex("by_age")
+		if !errors.Is(err, storage.ErrIndexNotFound) {
+			t.Errorf("Expected ErrIndexNotFound, got %v", err)
+		}
+	})
+
+	t.Run("schemas are stored on every shard", func(t *testing.T) {
+		err := repo.PutSchema("user:", `{"type":"object"}`)
+		if err != nil {
+			t.Fatalf("Failed to put schema: %v", err)
+		}
+		for i, shard := range shards {
+			schemas, _ := shard.GetSchemas()
+			if len(schemas) != 1 {
+				t.Errorf("Shard %d has schemas %v", i, schemas)
+			}
+		}
+	})
+}
+
+func TestRebalance(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Errorf("failed to initialize logger: %v", err)
+		return
+	}
+
+	shards := memoryShards(3)
+	before, err := sharding.NewRepository(shards[:2])
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	for i := 0; i < 200; i++ {
+		err = before.AddValue(fmt.Sprintf("k%d", i), int64(i))
+		if err != nil {
+			t.Fatalf("Failed to add value: %v", err)
+		}
+	}
+	err = before.ExpireValue("k7", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to set TTL: %v", err)
+	}
+
+	rebalancer := sharding.Rebalancer{Shards: shards, From: 2, To: 3}
+	stats, err := rebalancer.Run()
+	if err != nil {
+		t.Fatalf("Rebalance failed: %v", err)
+	}
+	if stats.Scanned != 200 || stats.Moved == 0 || stats.Moved == 200 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	after, err := sharding.NewRepository(shards)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("k%d", i)
+		owner := after.ShardFor(key)
+		for j, shard := range shards {
+			_, err := shard.GetValue(key)
+			if (j == owner) != (err == nil) {
+				t.Errorf("Key %s on shard %d: %v, owner %d", key, j, err, owner)
+			}
+		}
+	}
+
+	tuples, err := after.GetValue("k7")
+	if err != nil {
+		t.Fatalf("Failed to get moved value: %v", err)
+	}
+	if _, ok := storage.TupleExpiry(tuples[0].([]any)); !ok {
+		t.Errorf("TTL was lost: %v", tuples)
+	}
+
+	_, err = (&sharding.Rebalancer{Shards: shards, From: 4, To: 3}).Run()
+	if !errors.Is(err, sharding.ErrInvalidRebalance) {
+		t.Errorf("Expected ErrInvalidRebalance, got %v", err)
+	}
+}
+
+func TestRebalanceMove(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Errorf("failed to initialize logger: %v", err)
+		return
+	}
+
+	history := storage.HistoryConfig{Revisions: 10}
+	shards := make([]sharding.Shard, 2)
+	for i := range shards {
+		shards[i] = storage.NewMemoryRepository().WithHistory(history).WithTrash(time.Hour)
+	}
+	after, err := sharding.NewRepository(shards)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	// Keys owned by the second shard once there are two.
+	var moving []string
+	for i := 0; len(moving) < 3; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if after.ShardFor(key) == 1 {
+			moving = append(moving, key)
+		}
+	}
+	for _, key := range moving {
+		if err := shards[0].AddValue(key, "old"); err != nil {
+			t.Fatalf("Failed to add value: %v", err)
+		}
+	}
+	if err := shards[0].Annotate(moving[0], "alice", map[string]string{"team": "core"}); err != nil {
+		t.Fatalf("Failed to annotate: %v", err)
+	}
+	// A copy left by an interrupted run and a key written since.
+	if err := shards[1].AddValue(moving[1], "old"); err != nil {
+		t.Fatalf("Failed to add value: %v", err)
+	}
+	if err := shards[1].AddValue(moving[2], "new"); err != nil {
+		t.Fatalf("Failed to add value: %v", err)
+	}
+	source, err := shards[0].GetValue(moving[0])
+	if err != nil {
+		t.Fatalf("Failed to get value: %v", err)
+	}
+
+	stats, err := (&sharding.Rebalancer{Shards: shards, From: 1, To: 2}).Run()
+	if err != nil {
+		t.Fatalf("Rebalance failed: %v", err)
+	}
+	if stats.Moved != 2 || stats.Conflicts != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	moved, err := shards[1].GetValue(moving[0])
+	if err != nil {
+		t.Fatalf("Failed to get moved value: %v", err)
+	}
+	want, got := storage.TupleMetadata(source[0].([]any)), storage.TupleMetadata(moved[0].([]any))
+	if got.Writer != "alice" || got.Labels["team"] != "core" || !got.CreatedAt.Equal(want.CreatedAt) {
+		t.Errorf("Metadata was lost: %+v, want %+v", got, want)
+	}
+	revisions, err := shards[1].GetHistory(storage.HistoryQuery{Key: moving[0]})
+	if err != nil || len(revisions) != 0 {
+		t.Errorf("Expected no history on the target, got %v, %v", revisions, err)
+	}
+	trash, err := shards[0].ListTrash(storage.ScanQuery{})
+	if err != nil || len(trash) != 0 {
+		t.Errorf("Expected an empty trash on the source, got %v, %v", trash, err)
+	}
+	if _, err := shards[0].GetValue(moving[1]); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Errorf("Expected %s removed from the source, got %v", moving[1], err)
+	}
+	for i, shard := range shards {
+		if _, err := shard.GetValue(moving[2]); err != nil {
+			t.Errorf("Expected conflicting %s kept on shard %d, got %v", moving[2], i, err)
+		}
+	}
+}
+
+func TestShardedBackup(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+
+	source, err := sharding.NewRepository(memoryShards(2))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		err = source.AddValue(fmt.Sprintf("k%02d", i), int64(i))
+		if err != nil {
+			t.Fatalf("Failed to add value: %v", err)
+		}
+	}
+	frozen, err := source.FreezeBackup()
+	if err != nil || frozen != 50 {
+		t.Fatalf("Expected 50 frozen tuples, got %d, %v", frozen, err)
+	}
+	err = source.AddValue("k99", int64(99))
+	if err != nil {
+		t.Fatalf("Failed to add value: %v", err)
+	}
+	page, err := source.ScanBackup(storage.ScanQuery{After: "k09", Limit: 3})
+	if err != nil || fmt.Sprint(keys(page)) != "[k10 k11 k12]" {
+		t.Fatalf("Expected the second page in key order, got %v, %v", keys(page), err)
+	}
+	tuples, err := source.ScanBackup(storage.ScanQuery{Limit: 100})
+	if err != nil || len(tuples) != 50 {
+		t.Fatalf("Expected the 50 frozen tuples, got %d, %v", len(tuples), err)
+	}
+
+	target, err := sharding.NewRepository(memoryShards(2))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	err = target.StageBackup(tuples)
+	if err != nil {
+		t.Fatalf("Failed to stage: %v", err)
+	}
+	restored, err := target.CommitBackup()
+	if err != nil || restored != 50 {
+		t.Fatalf("Expected 50 restored tuples, got %d, %v", restored, err)
+	}
+	for _, key := range []string{"k00", "k49"} {
+		if _, err := target.GetValue(key); err != nil {
+			t.Errorf("Key %s was not restored: %v", key, err)
+		}
+	}
+
+	err = target.StageBackup(tuples)
+	if err != nil {
+		t.Fatalf("Failed to stage: %v", err)
+	}
+	_, err = target.CommitBackup()
+	if !errors.Is(err, storage.ErrNotEmpty) {
+		t.Errorf("Expected ErrNotEmpty, got %v", err)
+	}
+}
@@ -1,9 +1,121 @@
 package storage
 
-//go:generate mockgen -destination=../mocks/storage_mock.go -package=mocks . KvRepository
+import "time"
+
+//go:generate mockgen -destination=../mocks/storage_mock.go -package=mocks . KvRepository,SchemaRepository,IndexRepository,UsageRepository,HistoryRepository,TrashRepository,MetadataRepository,AnnotatedRepository,MoveRepository,VersionRepository,BackupRepository
 type KvRepository interface {
 	AddValue(key string, value any) error
 	GetValue(key string) ([]any, error)
 	UpdateValue(key string, value any) error
 	DeleteValue(key string) error
+	PutValue(key string, value any) (bool, error)
+	QueryIndex(query IndexQuery) ([]any, error)
+	CompareAndSet(key string, expected any, value any) error
+	MergeValue(key string, patch any) ([]any, error)
+	ExpireValue(key string, ttl time.Duration) error
+	GetValues(keys []string) ([]any, error)
+	DeleteValues(keys []string) ([]string, error)
+	ScanValues(query ScanQuery) ([]any, error)
+}
+
+// SchemaRepository persists JSON Schemas registered for key prefixes.
+type SchemaRepository interface {
+	PutSchema(prefix string, schema string) error
+	GetSchemas() (map[string]string, error)
+	DeleteSchema(prefix string) error
+}
+
+// IndexRepository manages secondary indexes on paths inside stored values.
+type IndexRepository interface {
+	CreateIndex(def IndexDefinition) error
+	DropIndex(name string) error
+	ListIndexes() ([]IndexDefinition, error)
+}
+
+// UsageRepository reports how much storage each key namespace uses.
+type UsageRepository interface {
+	GetUsage(namespace string) (Usage, error)
+}
+
+// HistoryRepository reads the past values of keys. GetRevisionAt returns
+// the revision that was current at the given time.
+type HistoryRepository interface {
+	GetHistory(query HistoryQuery) ([]Revision, error)
+	GetRevision(key string, revision uint64) (Revision, error)
+	GetRevisionAt(key string, at time.Time) (Revision, error)
+}
+
+// TrashRepository manages keys removed by DeleteValue and DeleteValues
+// while soft delete is enabled. Trashed keys are invisible to reads until
+// Undelete puts them back as they were deleted, with their TTL and
+// metadata, which fails with ErrKeyExists when the key was written
+// again. PurgeTrash removes up to limit entries whose retention ended
+// before now.
+type TrashRepository interface {
+	ListTrash(query ScanQuery) ([]TrashEntry, error)
+	Undelete(key string) error
+	PurgeTrash(now time.Time, limit uint32) (int, error)
+}
+
+// MetadataRepository records who last wrote an entry and its labels. The
+// timestamps and size are kept by the storage on every write and are
+// read from the tuples of GetValue with TupleMetadata. Annotate keeps the
+// current labels when labels is nil. Annotated returns a view of the
+// storage whose writes store annotation in the same request as the value.
+type MetadataRepository interface {
+	Annotate(key string, writer string, labels map[string]string) error
+	Annotated(annotation Annotation) AnnotatedRepository
+}
+
+// Annotation is the writer, labels and TTL stored along with a value. A
+// value written without a writer drops the previous one, since it no
+// longer wrote the entry; nil Labels keep the current labels. A nil TTL
+// leaves the TTL to the write, which keeps it on UpdateValue and drops it
+// on PutValue. Otherwise the value expires TTL from now, already expired
+// when TTL is negative, and a zero TTL removes it.
+type Annotation struct {
+	Writer string
+	Labels map[string]string
+	TTL    *time.Duration
+}
+
+// AnnotatedRepository writes values along with an Annotation.
+type AnnotatedRepository interface {
+	KvRepository
+	VersionRepository
+}
+
+// VersionRepository writes conditionally on the version of an entry, read
+// from the tuples of GetValue with TupleVersion. Unlike CompareAndSet it
+// fails with ErrValueMismatch when the value changed and was written
+// back since.
+type VersionRepository interface {
+	CompareVersionAndSet(key string, version uint64, value any) error
+}
+
+// MoveRepository moves tuples between shards. CopyTuple inserts a tuple
+// read from another shard as is, with its TTL and metadata, unless its
+// key exists. RemoveTuple deletes key, bypassing the trash, only when its
+// value still equals value. Neither records history; both report whether
+// they wrote.
+type MoveRepository interface {
+	CopyTuple(tuple []any) (bool, error)
+	RemoveTuple(key string, value any) (bool, error)
+}
+
+// BackupRepository copies whole tuples between the data space and the
+// backup space, each copy in one transaction. FreezeBackup replaces the
+// backup space with the live tuples as they are at that point in time and
+// returns their number; ScanBackup pages through it like ScanValues,
+// keeping tuples whose TTL passed since. StageBackup adds tuples read back
+// from a backup, with their TTL and metadata, and CommitBackup moves the
+// live ones into the data space and returns their number, failing with
+// ErrNotEmpty when it holds a live key. ClearBackup empties the backup
+// space.
+type BackupRepository interface {
+	FreezeBackup() (int64, error)
+	ScanBackup(query ScanQuery) ([]any, error)
+	StageBackup(tuples []any) error
+	CommitBackup() (int64, error)
+	ClearBackup() error
 }
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"github.com/tarantool/go-tarantool/v2"
+	"github.com/tarantool/go-tarantool/v2/pool"
+)
+
+type InstanceHealth struct {
+	Connected bool   `json:"connected"`
+	Role      string `json:"role,omitempty"`
+}
+
+// ConnectionHealth reports the state of a single Tarantool connection.
+type ConnectionHealth struct {
+	Conn *tarantool.Connection
+}
+
+func (h ConnectionHealth) Health() (any, bool) {
+	connected := h.Conn.ConnectedNow()
+	return InstanceHealth{Connected: connected}, connected
+}
+
+// PoolHealth reports every instance of a connection pool. The pool is
+// healthy while a master is connected.
+type PoolHealth struct {
+	Pool *pool.ConnectionPool
+}
+
+func (h PoolHealth) Health() (any, bool) {
+	instances := make(map[string]InstanceHealth)
+	healthy := false
+	for name, info := range h.Pool.GetInfo() {
+		instances[name] = InstanceHealth{Connected: info.ConnectedNow, Role: info.ConnRole.String()}
+		if info.ConnectedNow && info.ConnRole == pool.MasterRole {
+			healthy = true
+		}
+	}
+	return instances, healthy
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultHistoryLimit is used when a HistoryQuery does not set Limit.
+const DefaultHistoryLimit uint32 = 100
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// HistoryConfig bounds the revisions kept per key. A revision is pruned
+// once it is not among the last Revisions ones or is older than
+// Retention, but the latest revision of a key is always kept. Zero
+// disables a bound; history is off when both are zero.
+type HistoryConfig struct {
+	Revisions int
+	Retention time.Duration
+}
+
+func (cfg HistoryConfig) Enabled() bool {
+	return cfg.Revisions > 0 || cfg.Retention > 0
+}
+
+// Revision is a value a key had. Revisions are numbered per key from 1
+// and a deletion is recorded as a Deleted revision without a value.
+type Revision struct {
+	Revision  uint64
+	Value     any
+	ChangedAt time.Time
+	Deleted   bool
+}
+
+// HistoryQuery pages through the revisions of Key newest first. Only
+// revisions below Before are returned unless it is zero.
+type HistoryQuery struct {
+	Key    string
+	Before uint64
+	Limit  uint32
+}
+
+func (query HistoryQuery) limit() uint32 {
+	if query.Limit == 0 {
+		return DefaultHistoryLimit
+	}
+	return query.Limit
+}
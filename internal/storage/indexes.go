@@ -0,0 +1,363 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tarantool/go-tarantool/v2"
+	"github.com/tarantool/go-tarantool/v2/decimal"
+)
+
+var (
+	ErrIndexNotFound    = errors.New("index not found")
+	ErrInvalidIndex     = errors.New("invalid index definition")
+	ErrInvalidIndexKey  = errors.New("invalid index key")
+	ErrInvalidIndexCond = errors.New("invalid index condition")
+)
+
+// Field types a secondary index may be declared with.
+const (
+	IndexTypeString   string = "string"
+	IndexTypeUnsigned string = "unsigned"
+	IndexTypeInteger  string = "integer"
+	IndexTypeNumber   string = "number"
+	IndexTypeBoolean  string = "boolean"
+)
+
+var (
+	indexNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+	indexPathRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+)
+
+// IndexDefinition describes a secondary index on a JSON path inside the
+// stored value, e.g. {Name: "by_user", Path: "user_id", Type: "unsigned"}.
+type IndexDefinition struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+	Unique bool   `json:"unique"`
+}
+
+// Normalize strips the optional "value." prefix from the path and checks
+// that the definition can be created in Tarantool.
+func (def *IndexDefinition) Normalize() error {
+	def.Path = strings.TrimPrefix(def.Path, "value.")
+	if !indexNameRe.MatchString(def.Name) || def.Name == PrimaryIndex {
+		return fmt.Errorf("%w: bad name %q", ErrInvalidIndex, def.Name)
+	}
+	if !indexPathRe.MatchString(def.Path) {
+		return fmt.Errorf("%w: bad path %q", ErrInvalidIndex, def.Path)
+	}
+	switch def.Type {
+	case IndexTypeString, IndexTypeUnsigned, IndexTypeInteger, IndexTypeNumber, IndexTypeBoolean:
+	default:
+		return fmt.Errorf("%w: unsupported type %q", ErrInvalidIndex, def.Type)
+	}
+	return nil
+}
+
+// ParseKey converts a raw query parameter into a key of the index type.
+func (def *IndexDefinition) ParseKey(raw string) (any, error) {
+	var (
+		key any
+		err error
+	)
+	switch def.Type {
+	case IndexTypeString:
+		key = raw
+	case IndexTypeUnsigned:
+		key, err = strconv.ParseUint(raw, 10, 64)
+	case IndexTypeInteger:
+		key, err = strconv.ParseInt(raw, 10, 64)
+	case IndexTypeNumber:
+		if i, intErr := strconv.ParseInt(raw, 10, 64); intErr == nil {
+			key = i
+		} else {
+			key, err = strconv.ParseFloat(raw, 64)
+		}
+	case IndexTypeBoolean:
+		key, err = strconv.ParseBool(raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q is not %s", ErrInvalidIndexKey, raw, def.Type)
+	}
+	return key, nil
+}
+
+// Bound is one side of a range condition.
+type Bound struct {
+	Value     string
+	Inclusive bool
+}
+
+// IndexQuery selects tuples by a secondary index. Either Eq or any of
+// From/To may be set; values are raw strings converted to the index type.
+type IndexQuery struct {
+	Index string
+	Eq    *string
+	From  *Bound
+	To    *Bound
+	Limit uint32
+}
+
+// DefaultQueryLimit is used when an IndexQuery does not set Limit.
+const DefaultQueryLimit uint32 = 100
+
+// queryPlan is an IndexQuery translated into a single index iteration
+// plus an optional upper bound checked on the client side.
+type queryPlan struct {
+	iter           tarantool.Iter
+	key            []any
+	upper          any
+	upperInclusive bool
+	limit          uint32
+}
+
+func planQuery(def *IndexDefinition, query IndexQuery) (*queryPlan, error) {
+	plan := &queryPlan{iter: tarantool.IterAll, key: []any{}, limit: query.Limit}
+	if plan.limit == 0 {
+		plan.limit = DefaultQueryLimit
+	}
+
+	if query.Eq != nil {
+		if query.From != nil || query.To != nil {
+			return nil, fmt.Errorf("%w: eq can not be combined with a range", ErrInvalidIndexCond)
+		}
+		key, err := def.ParseKey(*query.Eq)
+		if err != nil {
+			return nil, err
+		}
+		plan.iter = tarantool.IterEq
+		plan.key = []any{key}
+		return plan, nil
+	}
+	if query.From == nil && query.To == nil {
+		return nil, fmt.Errorf("%w: no condition given", ErrInvalidIndexCond)
+	}
+
+	if query.From != nil {
+		key, err := def.ParseKey(query.From.Value)
+		if err != nil {
+			return nil, err
+		}
+		plan.iter = tarantool.IterGt
+		if query.From.Inclusive {
+			plan.iter = tarantool.IterGe
+		}
+		plan.key = []any{key}
+	}
+	if query.To != nil {
+		key, err := def.ParseKey(query.To.Value)
+		if err != nil {
+			return nil, err
+		}
+		plan.upper = key
+		plan.upperInclusive = query.To.Inclusive
+	}
+	return plan, nil
+}
+
+// matchesLower reports whether a key compared to plan.key with result cmp
+// satisfies the plan iterator. It is used where the iteration is not
+// performed by Tarantool itself.
+func (plan *queryPlan) matchesLower(cmp int) bool {
+	switch plan.iter {
+	case tarantool.IterEq:
+		return cmp == 0
+	case tarantool.IterGt:
+		return cmp > 0
+	case tarantool.IterGe:
+		return cmp >= 0
+	}
+	return true
+}
+
+// withinUpper reports whether a tuple returned by the plan iteration is
+// still below the upper bound. Tuples are ordered by the index, so the
+// scan can stop at the first one that is not.
+func (plan *queryPlan) withinUpper(def *IndexDefinition, tuple []any) bool {
+	if plan.upper == nil {
+		return true
+	}
+	if len(tuple) < 2 {
+		return false
+	}
+	field, ok := def.Extract(tuple[1])
+	if !ok {
+		return false
+	}
+	cmp, ok := CompareKeys(field, plan.upper)
+	if !ok {
+		return false
+	}
+	return cmp < 0 || (cmp == 0 && plan.upperInclusive)
+}
+
+// Extract returns the value stored at the index path of a tuple value.
+func (def *IndexDefinition) Extract(value any) (any, bool) {
+	current := value
+	for _, part := range strings.Split(def.Path, ".") {
+		switch m := current.(type) {
+		case map[any]any:
+			next, ok := m[part]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case map[string]any:
+			next, ok := m[part]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		default:
+			return nil, false
+		}
+	}
+	return current, current != nil
+}
+
+// CompareKeys orders two index keys the way a Tarantool TREE index does
+// for scalar types. Decimals, which hold the fractional numbers of stored
+// values, are compared exactly with other numbers. It returns false as the
+// second result when the values are not comparable.
+func CompareKeys(a, b any) (int, bool) {
+	switch av := a.(type) {
+	case string:
+		bv, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(av, bv), true
+	case bool:
+		bv, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case av == bv:
+			return 0, true
+		case !av:
+			return -1, true
+		default:
+			return 1, true
+		}
+	}
+
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+	if !aok || !bok {
+		return 0, false
+	}
+	if isDecimal(a) || isDecimal(b) {
+		ad, aok := toDecimal(a)
+		bd, bok := toDecimal(b)
+		if aok && bok {
+			return ad.Cmp(bd.Decimal), true
+		}
+	}
+	ai, aint := toInt(a)
+	bi, bint := toInt(b)
+	if aint && bint {
+		switch {
+		case ai < bi:
+			return -1, true
+		case ai > bi:
+			return 1, true
+		}
+		return 0, true
+	}
+	switch {
+	case af < bf:
+		return -1, true
+	case af > bf:
+		return 1, true
+	}
+	return 0, true
+}
+
+func toInt(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		if n > 1<<63-1 {
+			return 0, false
+		}
+		return int64(n), true
+	}
+	return 0, false
+}
+
+func toFloat(v any) (float64, bool) {
+	if i, ok := toInt(v); ok {
+		return float64(i), true
+	}
+	switch n := v.(type) {
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case decimal.Decimal:
+		return n.InexactFloat64(), true
+	case *decimal.Decimal:
+		return n.InexactFloat64(), true
+	}
+	return 0, false
+}
+
+func isDecimal(v any) bool {
+	switch v.(type) {
+	case decimal.Decimal, *decimal.Decimal:
+		return true
+	}
+	return false
+}
+
+// toDecimal converts a number to a decimal. Doubles that are not finite
+// have no decimal form.
+func toDecimal(v any) (decimal.Decimal, bool) {
+	var str string
+	switch n := v.(type) {
+	case decimal.Decimal:
+		return n, true
+	case *decimal.Decimal:
+		return *n, true
+	case uint64:
+		str = strconv.FormatUint(n, 10)
+	case float32:
+		str = strconv.FormatFloat(float64(n), 'f', -1, 32)
+	case float64:
+		str = strconv.FormatFloat(n, 'f', -1, 64)
+	default:
+		i, ok := toInt(v)
+		if !ok {
+			return decimal.Decimal{}, false
+		}
+		str = strconv.FormatInt(i, 10)
+	}
+	dec, err := decimal.MakeDecimalFromString(str)
+	if err != nil {
+		return decimal.Decimal{}, false
+	}
+	return dec, true
+}
@@ -0,0 +1,741 @@
+-- kv_api: server-side operations of the kvStorage service.
+--
+-- The module is pushed by the Go service with eval and receives the names
+-- of the data, usage, history and trash spaces, of the trash purge index
+-- and of the backup space as arguments. The service user calls the functions through
+-- grants on kv_api.* (see migrations.GrantAccess); the ones that run DDL
+-- are registered setuid. Bump VERSION whenever a function
+-- signature or result changes: the major part must match the Go client,
+-- the minor part only grows with backward compatible additions.
+
+local clock = require('clock')
+local msgpack = require('msgpack')
+
+local space_name, usage_space_name, history_space_name, trash_space_name, purge_index_name,
+    backup_space_name = ...
+
+local KEY = 1
+local VALUE = 2
+local EXPIRES_AT = 3
+local CREATED_AT = 4
+local UPDATED_AT = 5
+local SIZE = 6
+local WRITER = 7
+local LABELS = 8
+local VERSION = 9
+
+-- Fields of a history tuple: {key, revision, value, changed_at, deleted}.
+local REVISION = 2
+local CHANGED_AT = 4
+
+-- A trash tuple is {key, value, expires_at, deleted_at, purge_at, tuple},
+-- so the data tuple fields keep their positions; tuple is the whole
+-- deleted data tuple with its metadata, nil in entries trashed before it
+-- was kept.
+local DELETED_TUPLE = 6
+
+local api = rawget(_G, 'kv_api') or {}
+api.VERSION = '1.14'
+
+local function space()
+    return box.space[space_name]
+end
+
+-- nullable turns nil into box.NULL, so tuples built from Lua tables keep
+-- their field positions.
+local function nullable(value)
+    if value == nil then
+        return box.NULL
+    end
+    return value
+end
+
+local function new_array()
+    return setmetatable({}, {__serialize = 'array'})
+end
+
+local function is_map(value)
+    if type(value) ~= 'table' then
+        return false
+    end
+    local mt = getmetatable(value)
+    if mt ~= nil and mt.__serialize ~= nil then
+        return mt.__serialize == 'map' or mt.__serialize == 'mapping'
+    end
+    return next(value) ~= nil and #value == 0
+end
+
+local function equal(a, b)
+    if type(a) == 'table' and type(b) == 'table' then
+        for k, v in pairs(a) do
+            if not equal(v, b[k]) then
+                return false
+            end
+        end
+        for k in pairs(b) do
+            if a[k] == nil then
+                return false
+            end
+        end
+        return true
+    end
+    if type(a) == 'table' or type(b) == 'table' then
+        return false
+    end
+    return a == b
+end
+
+-- merge_patch applies patch to target following JSON Merge Patch
+-- (RFC 7396): maps are merged recursively and null removes a member.
+local function merge_patch(target, patch)
+    if not is_map(patch) then
+        return patch
+    end
+    local result = setmetatable({}, {__serialize = 'map'})
+    if is_map(target) then
+        for k, v in pairs(target) do
+            result[k] = v
+        end
+    end
+    for k, v in pairs(patch) do
+        if v == nil then
+            result[k] = nil
+        else
+            result[k] = merge_patch(result[k], v)
+        end
+    end
+    return result
+end
+
+-- live returns the tuple unless its TTL has passed. Expired tuples are
+-- removed lazily when the instance is writable.
+local function live(tuple)
+    if tuple == nil then
+        return nil
+    end
+    local expires_at = tuple[EXPIRES_AT]
+    if expires_at == nil or expires_at > clock.time() then
+        return tuple
+    end
+    if not box.info.ro then
+        space():delete(tuple[KEY])
+    end
+    return nil
+end
+
+-- namespace is the part of key before the first ':'.
+local function namespace(key)
+    return key:match('^([^:]*):') or ''
+end
+
+local function account(key, keys, bytes)
+    local usage = box.space[usage_space_name]
+    if usage == nil then
+        return
+    end
+    usage:upsert({namespace(key), keys, bytes}, {{'+', 2, keys}, {'+', 3, bytes}})
+end
+
+local old_usage_trigger = api.usage_trigger
+
+-- usage_trigger keeps the number of keys and the encoded size of values
+-- per namespace. Rows applied by replication already carry the usage
+-- changes made on the master.
+function api.usage_trigger(old, new)
+    if box.session.type() == 'applier' then
+        return
+    end
+    if old ~= nil then
+        account(old[KEY], -1, -#msgpack.encode(old[VALUE]))
+    end
+    if new ~= nil then
+        account(new[KEY], 1, #msgpack.encode(new[VALUE]))
+    end
+end
+
+-- moving is set while copy_tuple and remove_tuple write, so the tuple
+-- keeps the metadata it had on the other shard and the move is not
+-- recorded as history. Writes do not yield, so no other fiber sees it.
+local moving = false
+
+-- move runs fn with moving set.
+local function move(fn, ...)
+    moving = true
+    local ok, result = pcall(fn, ...)
+    moving = false
+    if not ok then
+        error(result)
+    end
+    return result
+end
+
+-- restoring is set while undelete writes, so the tuple keeps the metadata
+-- it had when it was deleted. Unlike a move, the undelete is recorded as
+-- history.
+local restoring = false
+
+-- restore runs fn with restoring set.
+local function restore(fn, ...)
+    restoring = true
+    local ok, result = pcall(fn, ...)
+    restoring = false
+    if not ok then
+        error(result)
+    end
+    return result
+end
+
+-- last_version is the latest version given to a tuple by this instance.
+local last_version = 0
+
+-- next_version returns the version of a tuple whose value changes over
+-- old. Versions come from the clock in nanoseconds, raised past the last
+-- one given and the one of old, so they keep growing across restarts and
+-- a key deleted and written again does not get back a version it had.
+local function next_version(old)
+    local version = clock.realtime64()
+    if version <= last_version then
+        version = last_version + 1
+    end
+    if old ~= nil and old[VERSION] ~= nil and version <= old[VERSION] then
+        version = old[VERSION] + 1
+    end
+    last_version = version
+    return version
+end
+
+-- version_of returns the version of tuple, 0 for tuples written before
+-- versions were kept.
+local function version_of(tuple)
+    local version = tuple[VERSION]
+    if version == nil then
+        return 0
+    end
+    return version
+end
+
+local old_meta_trigger = api.meta_trigger
+
+-- meta_trigger fills in the metadata of every written tuple: created_at
+-- is kept from the previous tuple, updated_at and version change with the
+-- value and size is the encoded size of the value. A new value written
+-- without a writer drops the previous one, which did not write it; writes
+-- that keep the value, such as expire, keep the writer. Writes without
+-- labels keep the previous ones. Rows applied by replication already
+-- carry the metadata set on the master.
+function api.meta_trigger(old, new)
+    if new == nil or moving or restoring or box.session.type() == 'applier' then
+        return
+    end
+    local now = clock.time()
+    local created_at, updated_at = now, now
+    local writer, labels = new[WRITER], new[LABELS]
+    local same = old ~= nil and equal(old[VALUE], new[VALUE])
+    local version
+    if same then
+        version = old[VERSION]
+    else
+        version = next_version(old)
+    end
+    if old ~= nil then
+        if old[CREATED_AT] ~= nil then
+            created_at = old[CREATED_AT]
+        end
+        if old[UPDATED_AT] ~= nil and same then
+            updated_at = old[UPDATED_AT]
+        end
+        if writer == nil and same then
+            writer = old[WRITER]
+        end
+        if labels == nil then
+            labels = old[LABELS]
+        end
+    end
+    return box.tuple.new({
+        new[KEY], new[VALUE], nullable(new[EXPIRES_AT]), created_at, updated_at,
+        #msgpack.encode(new[VALUE]), nullable(writer), nullable(labels), nullable(version),
+    })
+end
+
+local function history()
+    return box.space[history_space_name]
+end
+
+api.history_config = api.history_config or {revisions = 0, retention = 0}
+
+-- configure_history sets how many revisions of a key are kept and for
+-- how many seconds. Zero disables a bound; both zero stop recording.
+function api.configure_history(revisions, retention)
+    api.history_config = {revisions = revisions, retention = retention}
+    return true
+end
+
+-- prune removes the revisions of key older than revision that are outside
+-- the configured bounds.
+local function prune(key, revision, now)
+    local config = api.history_config
+    local outdated = {}
+    for _, tuple in history():pairs({key}, {iterator = 'EQ'}) do
+        local old = tuple[REVISION]
+        if old >= revision then
+            break
+        end
+        local excess = config.revisions > 0 and revision - old >= config.revisions
+        local stale = config.retention > 0 and tuple[CHANGED_AT] < now - config.retention
+        if not excess and not stale then
+            break
+        end
+        table.insert(outdated, old)
+    end
+    for _, old in ipairs(outdated) do
+        history():delete({key, old})
+    end
+end
+
+local function record(key, value, deleted)
+    local last = history().index[0]:max({key})
+    local revision = 1
+    if last ~= nil then
+        revision = last[REVISION] + 1
+    end
+    local now = clock.time()
+    history():insert({key, revision, value, now, deleted})
+    prune(key, revision, now)
+end
+
+local old_history_trigger = api.history_trigger
+
+-- history_trigger records every new value of a key as a revision and a
+-- deletion as a tombstone. TTL changes alone are not revisions.
+function api.history_trigger(old, new)
+    if moving or box.session.type() == 'applier' or history() == nil then
+        return
+    end
+    local config = api.history_config
+    if config.revisions <= 0 and config.retention <= 0 then
+        return
+    end
+    if new == nil then
+        record(old[KEY], box.NULL, true)
+    elseif old == nil or not equal(old[VALUE], new[VALUE]) then
+        record(new[KEY], new[VALUE], false)
+    end
+end
+
+-- set_trigger replaces old with new among the kind triggers of the data
+-- space. The old trigger is gone when the space was recreated since the
+-- previous push.
+local function set_trigger(kind, new, old)
+    local ok = pcall(space()[kind], space(), new, old)
+    if not ok then
+        space()[kind](space(), new)
+    end
+end
+
+if space() ~= nil then
+    set_trigger('before_replace', api.meta_trigger, old_meta_trigger)
+    set_trigger('on_replace', api.usage_trigger, old_usage_trigger)
+    set_trigger('on_replace', api.history_trigger, old_history_trigger)
+end
+
+function api.version()
+    return api.VERSION
+end
+
+function api.get(key)
+    local tuple = live(space():get(key))
+    if tuple == nil then
+        return
+    end
+    return tuple
+end
+
+-- written returns the tuple of value written under key by writer with
+-- labels, both optional, over a tuple expiring at expires_at. A ttl in
+-- seconds replaces expires_at: the value expires ttl from now, already
+-- expired when ttl is negative, and a zero ttl removes it. meta_trigger
+-- fills in the rest of the metadata.
+local function written(key, value, expires_at, writer, labels, ttl)
+    if ttl ~= nil then
+        expires_at = nil
+        if ttl ~= 0 then
+            expires_at = clock.time() + ttl
+        end
+    end
+    return {
+        key, value, nullable(expires_at), box.NULL, box.NULL, box.NULL,
+        nullable(writer), nullable(labels), box.NULL,
+    }
+end
+
+-- The write functions below take the writer of the value, its labels and
+-- its TTL as optional trailing arguments, so they are stored in the same
+-- transaction as the value.
+
+-- insert adds key unless a live tuple holds it; an expired one that was
+-- not reaped yet is replaced. Returns 'ok' or 'exists'.
+function api.insert(key, value, writer, labels, ttl)
+    return box.atomic(function()
+        if live(space():get(key)) ~= nil then
+            return 'exists'
+        end
+        space():insert(written(key, value, nil, writer, labels, ttl))
+        return 'ok'
+    end)
+end
+
+-- update replaces the value of a live key and keeps its TTL unless ttl
+-- is given. Returns 'ok' or 'not_found'.
+function api.update(key, value, writer, labels, ttl)
+    return box.atomic(function()
+        local tuple = live(space():get(key))
+        if tuple == nil then
+            return 'not_found'
+        end
+        space():replace(written(key, value, tuple[EXPIRES_AT], writer, labels, ttl))
+        return 'ok'
+    end)
+end
+
+-- put stores value under key with replace and reports whether the key
+-- was created. A TTL set on the previous value is dropped, or replaced by
+-- ttl.
+function api.put(key, value, writer, labels, ttl)
+    return box.atomic(function()
+        local created = live(space():get(key)) == nil
+        space():replace(written(key, value, nil, writer, labels, ttl))
+        return created
+    end)
+end
+
+-- cas replaces the value of key with value only when the current value
+-- equals expected. Returns 'ok', 'mismatch' or 'not_found'.
+function api.cas(key, expected, value, writer, labels, ttl)
+    return box.atomic(function()
+        local tuple = live(space():get(key))
+        if tuple == nil then
+            return 'not_found'
+        end
+        if not equal(tuple[VALUE], expected) then
+            return 'mismatch'
+        end
+        space():replace(written(key, value, tuple[EXPIRES_AT], writer, labels, ttl))
+        return 'ok'
+    end)
+end
+
+-- cas_version replaces the value of key with value only when the version
+-- of its tuple is still version, so a value written back after a change
+-- does not match. Returns 'ok', 'mismatch' or 'not_found'.
+function api.cas_version(key, version, value, writer, labels, ttl)
+    return box.atomic(function()
+        local tuple = live(space():get(key))
+        if tuple == nil then
+            return 'not_found'
+        end
+        if version_of(tuple) ~= version then
+            return 'mismatch'
+        end
+        space():replace(written(key, value, tuple[EXPIRES_AT], writer, labels, ttl))
+        return 'ok'
+    end)
+end
+
+-- merge applies patch to the stored value, creating the key when it is
+-- missing, and returns the resulting tuple.
+function api.merge(key, patch, writer, labels, ttl)
+    return box.atomic(function()
+        local tuple = live(space():get(key))
+        if tuple == nil then
+            return space():insert(written(key, merge_patch(nil, patch), nil, writer, labels, ttl))
+        end
+        return space():replace(written(key, merge_patch(tuple[VALUE], patch), tuple[EXPIRES_AT],
+            writer, labels, ttl))
+    end)
+end
+
+-- expire sets the TTL of key in seconds; a non-positive ttl removes it.
+function api.expire(key, ttl)
+    local tuple = live(space():get(key))
+    if tuple == nil then
+        return
+    end
+    local expires_at = box.NULL
+    if ttl ~= nil and ttl > 0 then
+        expires_at = clock.time() + ttl
+    end
+    return space():update(key, {{'=', EXPIRES_AT, expires_at}})
+end
+
+-- annotate sets the writer of key and, unless labels is nil, its labels.
+-- The value, TTL and timestamps are kept.
+function api.annotate(key, writer, labels)
+    local tuple = live(space():get(key))
+    if tuple == nil then
+        return
+    end
+    return space():replace({
+        key, tuple[VALUE], nullable(tuple[EXPIRES_AT]), box.NULL, box.NULL, box.NULL,
+        writer, nullable(labels), box.NULL,
+    })
+end
+
+function api.bulk_get(keys)
+    local result = new_array()
+    for _, key in ipairs(keys) do
+        local tuple = live(space():get(key))
+        if tuple ~= nil then
+            table.insert(result, tuple)
+        end
+    end
+    return result
+end
+
+local function trash()
+    return box.space[trash_space_name]
+end
+
+-- remove deletes a live key and, when retention is positive, keeps the
+-- whole tuple in the trash for retention seconds. A key deleted again replaces
+-- its previous trash entry. An expired key is reaped without going to the
+-- trash and reported as missing.
+local function remove(key, retention)
+    local tuple = live(space():get(key))
+    if tuple == nil then
+        return nil
+    end
+    space():delete(key)
+    if retention ~= nil and retention > 0 and trash() ~= nil then
+        local now = clock.time()
+        trash():replace({key, tuple[VALUE], tuple[EXPIRES_AT] or box.NULL, now, now + retention,
+            tuple:totable()})
+    end
+    return tuple
+end
+
+-- delete removes key like remove and returns the deleted tuple.
+function api.delete(key, retention)
+    local tuple = box.atomic(remove, key, retention)
+    if tuple == nil then
+        return
+    end
+    return tuple
+end
+
+function api.bulk_delete(keys, retention)
+    local deleted = new_array()
+    box.atomic(function()
+        for _, key in ipairs(keys) do
+            if remove(key, retention) ~= nil then
+                table.insert(deleted, key)
+            end
+        end
+    end)
+    return deleted
+end
+
+-- copy_tuple inserts a tuple read from another shard as is, with its TTL
+-- and metadata, unless its key holds a live tuple. Returns whether it was
+-- inserted.
+function api.copy_tuple(tuple)
+    return box.atomic(function()
+        if live(space():get(tuple[KEY])) ~= nil then
+            return false
+        end
+        move(space().insert, space(), tuple)
+        return true
+    end)
+end
+
+-- remove_tuple deletes key without trash or history when its value still
+-- equals value, the one copied to another shard. Returns whether it was
+-- deleted.
+function api.remove_tuple(key, value)
+    return box.atomic(function()
+        local tuple = live(space():get(key))
+        if tuple == nil or not equal(tuple[VALUE], value) then
+            return false
+        end
+        move(space().delete, space(), key)
+        return true
+    end)
+end
+
+-- undelete moves key back from the trash as it was deleted, with its TTL
+-- and metadata. Returns
+-- 'ok', 'exists' when the key was written again since, or 'not_found'
+-- when it is not in the trash or its TTL passed meanwhile.
+function api.undelete(key)
+    return box.atomic(function()
+        if trash() == nil then
+            return 'not_found'
+        end
+        local trashed = trash():get(key)
+        if trashed == nil then
+            return 'not_found'
+        end
+        if live(space():get(key)) ~= nil then
+            return 'exists'
+        end
+        trash():delete(key)
+        local expires_at = trashed[EXPIRES_AT]
+        if expires_at ~= nil and expires_at <= clock.time() then
+            return 'not_found'
+        end
+        local deleted = trashed[DELETED_TUPLE]
+        if deleted == nil then
+            space():replace({key, trashed[VALUE], expires_at})
+        else
+            restore(space().replace, space(), deleted)
+        end
+        return 'ok'
+    end)
+end
+
+-- purge_trash removes up to limit trash entries whose retention ended
+-- before now and returns their number.
+function api.purge_trash(now, limit)
+    if trash() == nil then
+        return 0
+    end
+    local purged = {}
+    for _, tuple in trash().index[purge_index_name]:pairs({now}, {iterator = 'LE'}) do
+        if #purged >= limit then
+            break
+        end
+        table.insert(purged, tuple[KEY])
+    end
+    box.atomic(function()
+        for _, key in ipairs(purged) do
+            trash():delete(key)
+        end
+    end)
+    return #purged
+end
+
+local function backup()
+    return box.space[backup_space_name]
+end
+
+-- expired reports whether the TTL of tuple has passed, without reaping it
+-- like live does.
+local function expired(tuple)
+    local expires_at = tuple[EXPIRES_AT]
+    return expires_at ~= nil and expires_at <= clock.time()
+end
+
+-- clear deletes every tuple of the backup space.
+local function clear()
+    local keys = {}
+    for _, tuple in backup():pairs() do
+        table.insert(keys, tuple[KEY])
+    end
+    for _, key in ipairs(keys) do
+        backup():delete(key)
+    end
+end
+
+-- freeze_backup replaces the backup space with a copy of every live tuple
+-- and returns their number. The copy is one transaction, which does not
+-- yield, so it holds the entries as they were at a single point in time
+-- and writes wait until it is done.
+function api.freeze_backup()
+    return box.atomic(function()
+        clear()
+        local count = 0
+        for _, tuple in space():pairs() do
+            if not expired(tuple) then
+                backup():insert(tuple)
+                count = count + 1
+            end
+        end
+        return count
+    end)
+end
+
+-- stage_backup adds tuples read back from a backup to the backup space as
+-- they are, with the size of their value filled in.
+function api.stage_backup(tuples)
+    box.atomic(function()
+        for _, tuple in ipairs(tuples) do
+            tuple[SIZE] = #msgpack.encode(tuple[VALUE])
+            backup():replace(tuple)
+        end
+    end)
+    return true
+end
+
+-- commit_backup moves the live tuples of the backup space into the data
+-- space in one transaction, keeping their TTL and metadata, and empties
+-- the backup space. Returns 'ok' and the number of tuples moved, or
+-- 'not_empty' when the data space holds a live tuple.
+function api.commit_backup()
+    return box.atomic(function()
+        for _, tuple in space():pairs() do
+            if not expired(tuple) then
+                return 'not_empty', 0
+            end
+        end
+        local count = 0
+        for _, tuple in backup():pairs() do
+            if not expired(tuple) then
+                move(space().replace, space(), tuple)
+                count = count + 1
+            end
+        end
+        clear()
+        return 'ok', count
+    end)
+end
+
+-- clear_backup empties the backup space.
+function api.clear_backup()
+    box.atomic(clear)
+    return true
+end
+
+-- revision_at returns the revision of key that was current at the given
+-- time in seconds, or nothing when it is not in the history.
+function api.revision_at(key, at)
+    if history() == nil then
+        return
+    end
+    for _, tuple in history():pairs({key}, {iterator = 'REQ'}) do
+        if tuple[CHANGED_AT] <= at then
+            return tuple
+        end
+    end
+end
+
+-- create_index adds a secondary index on path inside the values. Values
+-- without the path are left out of the index.
+function api.create_index(name, path, field_type, unique)
+    space():create_index(name, {
+        type = 'TREE',
+        unique = unique,
+        parts = {{field = VALUE, type = field_type, path = path,
+                  is_nullable = true, exclude_null = true}},
+    })
+    return true
+end
+
+-- drop_index removes a secondary index and reports whether it existed.
+function api.drop_index(name)
+    local index = space().index[name]
+    if index == nil then
+        return false
+    end
+    index:drop()
+    return true
+end
+
+-- snapshot writes a checkpoint of the instance and returns its vclock
+-- signature, which names the .snap file in the memtx directory.
+function api.snapshot()
+    box.snapshot()
+    local checkpoints = box.info.gc().checkpoints
+    return checkpoints[#checkpoints].signature
+end
+
+rawset(_G, 'kv_api', api)
+return api.VERSION
@@ -0,0 +1,921 @@
+package storage
+
+import (
+	"bytes"
+	"maps"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type memoryEntry struct {
+	value     any
+	expiresAt time.Time
+
+	createdAt time.Time
+	updatedAt time.Time
+	size      int64
+	writer    string
+	labels    map[string]string
+	version   uint64
+}
+
+// MemoryRepository is an in-process KvRepository, IndexRepository,
+// SchemaRepository, UsageRepository, HistoryRepository, TrashRepository,
+// MetadataRepository, MoveRepository, VersionRepository and
+// BackupRepository. It mirrors the
+// behaviour of TarantoolRepository and is meant for tests and local runs
+// without Tarantool.
+type MemoryRepository struct {
+	mu      sync.RWMutex
+	data    map[string]memoryEntry
+	indexes map[string]IndexDefinition
+	schemas map[string]string
+
+	historyConfig HistoryConfig
+	history       map[string][]Revision
+
+	trashRetention time.Duration
+	trash          map[string]memoryTrash
+
+	backup map[string]memoryEntry
+
+	lastVersion uint64
+}
+
+// memoryTrash is a deleted entry kept until purgeAt.
+type memoryTrash struct {
+	entry     memoryEntry
+	deletedAt time.Time
+	purgeAt   time.Time
+}
+
+var (
+	_ KvRepository       = (*MemoryRepository)(nil)
+	_ IndexRepository    = (*MemoryRepository)(nil)
+	_ SchemaRepository   = (*MemoryRepository)(nil)
+	_ UsageRepository    = (*MemoryRepository)(nil)
+	_ HistoryRepository  = (*MemoryRepository)(nil)
+	_ TrashRepository    = (*MemoryRepository)(nil)
+	_ MetadataRepository = (*MemoryRepository)(nil)
+	_ MoveRepository     = (*MemoryRepository)(nil)
+	_ VersionRepository  = (*MemoryRepository)(nil)
+	_ BackupRepository   = (*MemoryRepository)(nil)
+)
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		data:    make(map[string]memoryEntry),
+		indexes: make(map[string]IndexDefinition),
+		schemas: make(map[string]string),
+		history: make(map[string][]Revision),
+		trash:   make(map[string]memoryTrash),
+		backup:  make(map[string]memoryEntry),
+	}
+}
+
+// WithHistory records the revisions of each key within cfg.
+func (repo *MemoryRepository) WithHistory(cfg HistoryConfig) *MemoryRepository {
+	repo.historyConfig = cfg
+	return repo
+}
+
+// WithTrash keeps deleted keys for retention, like soft delete in
+// TarantoolRepository.
+func (repo *MemoryRepository) WithTrash(retention time.Duration) *MemoryRepository {
+	repo.trashRetention = retention
+	return repo
+}
+
+// lookup returns the live entry for key, removing it when expired.
+// The caller must hold the write lock.
+func (repo *MemoryRepository) lookup(key string) (memoryEntry, bool) {
+	e, ok := repo.data[key]
+	if !ok {
+		return e, false
+	}
+	if !e.expiresAt.IsZero() && !time.Now().Before(e.expiresAt) {
+		delete(repo.data, key)
+		repo.recordDelete(key)
+		return e, false
+	}
+	return e, true
+}
+
+func (e memoryEntry) live() bool {
+	return e.expiresAt.IsZero() || time.Now().Before(e.expiresAt)
+}
+
+// written returns the entry of value written with annotation over an
+// entry expiring at expiresAt.
+func written(value any, expiresAt time.Time, annotation Annotation) memoryEntry {
+	if annotation.TTL != nil {
+		expiresAt = time.Time{}
+		if *annotation.TTL != 0 {
+			expiresAt = time.Now().Add(*annotation.TTL)
+		}
+	}
+	return memoryEntry{
+		value:     value,
+		expiresAt: expiresAt,
+		writer:    annotation.Writer,
+		labels:    maps.Clone(annotation.Labels),
+	}
+}
+
+// stamp sets the metadata of e written over before like the kv_api
+// metadata trigger: created_at is kept, updated_at and the version change
+// with the value. A new value without a writer drops the previous one and
+// an entry without labels keeps the previous ones. The caller must hold
+// the write lock.
+func (repo *MemoryRepository) stamp(e memoryEntry, before memoryEntry, existed bool) memoryEntry {
+	now := time.Now()
+	e.createdAt, e.updatedAt = now, now
+	e.version = 0
+	if existed {
+		e.createdAt = before.createdAt
+		if reflect.DeepEqual(before.value, e.value) {
+			e.updatedAt, e.version = before.updatedAt, before.version
+			if e.writer == "" {
+				e.writer = before.writer
+			}
+		}
+		if e.labels == nil {
+			e.labels = before.labels
+		}
+	}
+	if e.version == 0 {
+		repo.lastVersion++
+		e.version = repo.lastVersion
+	}
+	e.size = encodedSize(e.value)
+	return e
+}
+
+// encodedSize is the size of value in MessagePack with integers packed
+// like Tarantool packs them.
+func encodedSize(value any) int64 {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseCompactInts(true)
+	_ = enc.Encode(value)
+	return int64(buf.Len())
+}
+
+// memoryTuple lays an entry out like a json_data tuple.
+func memoryTuple(key string, e memoryEntry) []any {
+	var expiresAt any
+	if !e.expiresAt.IsZero() {
+		expiresAt = unixSeconds(e.expiresAt)
+	}
+	var writer, labels any
+	if e.writer != "" {
+		writer = e.writer
+	}
+	if e.labels != nil {
+		tupleLabels := make(map[string]any, len(e.labels))
+		for name, value := range e.labels {
+			tupleLabels[name] = value
+		}
+		labels = tupleLabels
+	}
+	return []any{key, e.value, expiresAt, unixSeconds(e.createdAt), unixSeconds(e.updatedAt),
+		e.size, writer, labels, e.version}
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+func (repo *MemoryRepository) AddValue(key string, value any) error {
+	return repo.addValue(key, value, Annotation{})
+}
+
+func (repo *MemoryRepository) addValue(key string, value any, annotation Annotation) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.lookup(key); ok {
+		return ErrKeyExists
+	}
+	repo.data[key] = repo.stamp(written(value, time.Time{}, annotation), memoryEntry{}, false)
+	repo.recordChange(key, nil, false, value)
+	return nil
+}
+
+func (repo *MemoryRepository) GetValue(key string) ([]any, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	e, ok := repo.lookup(key)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return []any{memoryTuple(key, e)}, nil
+}
+
+func (repo *MemoryRepository) UpdateValue(key string, value any) error {
+	return repo.updateValue(key, value, Annotation{})
+}
+
+func (repo *MemoryRepository) updateValue(key string, value any, annotation Annotation) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	e, ok := repo.lookup(key)
+	if !ok {
+		return ErrKeyNotFound
+	}
+	repo.recordChange(key, e.value, true, value)
+	repo.data[key] = repo.stamp(written(value, e.expiresAt, annotation), e, true)
+	return nil
+}
+
+func (repo *MemoryRepository) DeleteValue(key string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.lookup(key); !ok {
+		return ErrKeyNotFound
+	}
+	repo.remove(key)
+	return nil
+}
+
+// remove deletes key, moving it to the trash when soft delete is enabled.
+// The caller must hold the write lock.
+func (repo *MemoryRepository) remove(key string) {
+	if repo.trashRetention > 0 {
+		now := time.Now()
+		repo.trash[key] = memoryTrash{entry: repo.data[key], deletedAt: now, purgeAt: now.Add(repo.trashRetention)}
+	}
+	delete(repo.data, key)
+	repo.recordDelete(key)
+}
+
+func (repo *MemoryRepository) PutValue(key string, value any) (bool, error) {
+	return repo.putValue(key, value, Annotation{})
+}
+
+func (repo *MemoryRepository) putValue(key string, value any, annotation Annotation) (bool, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	e, exists := repo.lookup(key)
+	repo.data[key] = repo.stamp(written(value, time.Time{}, annotation), e, exists)
+	repo.recordChange(key, e.value, exists, value)
+	return !exists, nil
+}
+
+func (repo *MemoryRepository) CompareAndSet(key string, expected any, value any) error {
+	return repo.compareAndSet(key, expected, value, Annotation{})
+}
+
+func (repo *MemoryRepository) compareAndSet(key string, expected any, value any, annotation Annotation) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	e, ok := repo.lookup(key)
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if !reflect.DeepEqual(e.value, expected) {
+		return ErrValueMismatch
+	}
+	repo.recordChange(key, e.value, true, value)
+	repo.data[key] = repo.stamp(written(value, e.expiresAt, annotation), e, true)
+	return nil
+}
+
+func (repo *MemoryRepository) CompareVersionAndSet(key string, version uint64, value any) error {
+	return repo.compareVersionAndSet(key, version, value, Annotation{})
+}
+
+func (repo *MemoryRepository) compareVersionAndSet(key string, version uint64, value any,
+	annotation Annotation) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	e, ok := repo.lookup(key)
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if e.version != version {
+		return ErrValueMismatch
+	}
+	repo.recordChange(key, e.value, true, value)
+	repo.data[key] = repo.stamp(written(value, e.expiresAt, annotation), e, true)
+	return nil
+}
+
+func (repo *MemoryRepository) MergeValue(key string, patch any) ([]any, error) {
+	return repo.mergeValue(key, patch, Annotation{})
+}
+
+func (repo *MemoryRepository) mergeValue(key string, patch any, annotation Annotation) ([]any, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	before, ok := repo.lookup(key)
+	if !ok {
+		before = memoryEntry{}
+	}
+	e := repo.stamp(written(MergePatch(before.value, patch), before.expiresAt, annotation), before, ok)
+	repo.data[key] = e
+	repo.recordChange(key, before.value, ok, e.value)
+	return []any{memoryTuple(key, e)}, nil
+}
+
+func (repo *MemoryRepository) ExpireValue(key string, ttl time.Duration) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	e, ok := repo.lookup(key)
+	if !ok {
+		return ErrKeyNotFound
+	}
+	e.expiresAt = time.Time{}
+	if ttl > 0 {
+		e.expiresAt = time.Now().Add(ttl)
+	}
+	repo.data[key] = e
+	return nil
+}
+
+func (repo *MemoryRepository) Annotate(key string, writer string, labels map[string]string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	e, ok := repo.lookup(key)
+	if !ok {
+		return ErrKeyNotFound
+	}
+	e.writer = writer
+	if labels != nil {
+		e.labels = maps.Clone(labels)
+	}
+	repo.data[key] = e
+	return nil
+}
+
+// annotatedMemory is the view of a MemoryRepository returned by Annotated.
+type annotatedMemory struct {
+	*MemoryRepository
+	annotation Annotation
+}
+
+// Annotated returns a view of repo whose writes store annotation along
+// with the value.
+func (repo *MemoryRepository) Annotated(annotation Annotation) AnnotatedRepository {
+	return &annotatedMemory{MemoryRepository: repo, annotation: annotation}
+}
+
+func (view *annotatedMemory) AddValue(key string, value any) error {
+	return view.addValue(key, value, view.annotation)
+}
+
+func (view *annotatedMemory) UpdateValue(key string, value any) error {
+	return view.updateValue(key, value, view.annotation)
+}
+
+func (view *annotatedMemory) PutValue(key string, value any) (bool, error) {
+	return view.putValue(key, value, view.annotation)
+}
+
+func (view *annotatedMemory) CompareAndSet(key string, expected any, value any) error {
+	return view.compareAndSet(key, expected, value, view.annotation)
+}
+
+func (view *annotatedMemory) CompareVersionAndSet(key string, version uint64, value any) error {
+	return view.compareVersionAndSet(key, version, value, view.annotation)
+}
+
+func (view *annotatedMemory) MergeValue(key string, patch any) ([]any, error) {
+	return view.mergeValue(key, patch, view.annotation)
+}
+
+func (repo *MemoryRepository) CopyTuple(tuple []any) (bool, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	key, _ := tuple[0].(string)
+	if _, ok := repo.lookup(key); ok {
+		return false, nil
+	}
+	repo.data[key] = repo.tupleEntry(tuple)
+	return true, nil
+}
+
+// tupleEntry reads an entry from a json_data tuple as is, with its TTL
+// and metadata. The caller must hold the write lock.
+func (repo *MemoryRepository) tupleEntry(tuple []any) memoryEntry {
+	var value any
+	if len(tuple) > 1 {
+		value = tuple[1]
+	}
+	meta := TupleMetadata(tuple)
+	repo.lastVersion = max(repo.lastVersion, TupleVersion(tuple))
+	return memoryEntry{
+		value:     value,
+		expiresAt: meta.ExpiresAt,
+		createdAt: meta.CreatedAt,
+		updatedAt: meta.UpdatedAt,
+		size:      encodedSize(value),
+		writer:    meta.Writer,
+		labels:    meta.Labels,
+		version:   TupleVersion(tuple),
+	}
+}
+
+func (repo *MemoryRepository) RemoveTuple(key string, value any) (bool, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	e, ok := repo.lookup(key)
+	if !ok || !reflect.DeepEqual(e.value, value) {
+		return false, nil
+	}
+	delete(repo.data, key)
+	return true, nil
+}
+
+func (repo *MemoryRepository) GetValues(keys []string) ([]any, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	tuples := make([]any, 0, len(keys))
+	for _, key := range keys {
+		if e, ok := repo.lookup(key); ok {
+			tuples = append(tuples, memoryTuple(key, e))
+		}
+	}
+	return tuples, nil
+}
+
+func (repo *MemoryRepository) DeleteValues(keys []string) ([]string, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	deleted := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := repo.lookup(key); ok {
+			repo.remove(key)
+			deleted = append(deleted, key)
+		}
+	}
+	return deleted, nil
+}
+
+func (repo *MemoryRepository) ScanValues(query ScanQuery) ([]any, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	_, start, limit := query.plan()
+	keys := repo.sortedKeys()
+	pos := sort.SearchStrings(keys, start)
+
+	tuples := make([]any, 0, limit)
+	for _, key := range keys[pos:] {
+		if uint32(len(tuples)) >= limit {
+			break
+		}
+		if key == query.After {
+			continue
+		}
+		if !strings.HasPrefix(key, query.Prefix) {
+			break
+		}
+		if e := repo.data[key]; e.live() {
+			tuples = append(tuples, memoryTuple(key, e))
+		}
+	}
+	return tuples, nil
+}
+
+func (repo *MemoryRepository) sortedKeys() []string {
+	keys := make([]string, 0, len(repo.data))
+	for key := range repo.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (repo *MemoryRepository) QueryIndex(query IndexQuery) ([]any, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	def, ok := repo.indexes[query.Index]
+	if !ok {
+		return nil, ErrIndexNotFound
+	}
+	plan, err := planQuery(&def, query)
+	if err != nil {
+		return nil, err
+	}
+
+	type indexed struct {
+		field any
+		tuple []any
+	}
+	var entries []indexed
+	for _, key := range repo.sortedKeys() {
+		e := repo.data[key]
+		if !e.live() {
+			continue
+		}
+		field, ok := def.Extract(e.value)
+		if !ok {
+			continue
+		}
+		entries = append(entries, indexed{field: field, tuple: memoryTuple(key, e)})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		cmp, _ := CompareKeys(entries[i].field, entries[j].field)
+		return cmp < 0
+	})
+
+	tuples := make([]any, 0)
+	for _, entry := range entries {
+		if uint32(len(tuples)) >= plan.limit {
+			break
+		}
+		if len(plan.key) > 0 {
+			cmp, ok := CompareKeys(entry.field, plan.key[0])
+			if !ok || !plan.matchesLower(cmp) {
+				continue
+			}
+		}
+		if !plan.withinUpper(&def, entry.tuple) {
+			break
+		}
+		tuples = append(tuples, entry.tuple)
+	}
+	return tuples, nil
+}
+
+func (repo *MemoryRepository) CreateIndex(def IndexDefinition) error {
+	err := def.Normalize()
+	if err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.indexes[def.Name] = def
+	return nil
+}
+
+func (repo *MemoryRepository) DropIndex(name string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.indexes[name]; !ok {
+		return ErrIndexNotFound
+	}
+	delete(repo.indexes, name)
+	return nil
+}
+
+func (repo *MemoryRepository) ListIndexes() ([]IndexDefinition, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	defs := make([]IndexDefinition, 0, len(repo.indexes))
+	for _, def := range repo.indexes {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs, nil
+}
+
+func (repo *MemoryRepository) PutSchema(prefix string, schema string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.schemas[prefix] = schema
+	return nil
+}
+
+func (repo *MemoryRepository) GetSchemas() (map[string]string, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	schemas := make(map[string]string, len(repo.schemas))
+	for prefix, schema := range repo.schemas {
+		schemas[prefix] = schema
+	}
+	return schemas, nil
+}
+
+func (repo *MemoryRepository) DeleteSchema(prefix string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.schemas[prefix]; !ok {
+		return ErrKeyNotFound
+	}
+	delete(repo.schemas, prefix)
+	return nil
+}
+
+func (repo *MemoryRepository) GetUsage(namespace string) (Usage, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	var usage Usage
+	for key, e := range repo.data {
+		if Namespace(key) != namespace || !e.live() {
+			continue
+		}
+		size, err := ValueSize(e.value)
+		if err != nil {
+			return Usage{}, err
+		}
+		usage.Keys++
+		usage.Bytes += size
+	}
+	return usage, nil
+}
+
+func (repo *MemoryRepository) ListTrash(query ScanQuery) ([]TrashEntry, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	_, start, limit := query.plan()
+	keys := make([]string, 0, len(repo.trash))
+	for key := range repo.trash {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pos := sort.SearchStrings(keys, start)
+
+	entries := make([]TrashEntry, 0, limit)
+	for _, key := range keys[pos:] {
+		if uint32(len(entries)) >= limit {
+			break
+		}
+		if key == query.After {
+			continue
+		}
+		if !strings.HasPrefix(key, query.Prefix) {
+			break
+		}
+		if trashed := repo.trash[key]; trashed.entry.live() {
+			entries = append(entries, TrashEntry{
+				Key:       key,
+				Value:     trashed.entry.value,
+				DeletedAt: trashed.deletedAt,
+				PurgeAt:   trashed.purgeAt,
+			})
+		}
+	}
+	return entries, nil
+}
+
+func (repo *MemoryRepository) Undelete(key string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	trashed, ok := repo.trash[key]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if _, exists := repo.lookup(key); exists {
+		return ErrKeyExists
+	}
+	delete(repo.trash, key)
+	if !trashed.entry.live() {
+		return ErrKeyNotFound
+	}
+	repo.data[key] = trashed.entry
+	repo.recordChange(key, nil, false, trashed.entry.value)
+	return nil
+}
+
+func (repo *MemoryRepository) PurgeTrash(now time.Time, limit uint32) (int, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	purged := 0
+	for key, trashed := range repo.trash {
+		if uint32(purged) >= limit {
+			break
+		}
+		if !trashed.purgeAt.After(now) {
+			delete(repo.trash, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (repo *MemoryRepository) FreezeBackup() (int64, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.backup = make(map[string]memoryEntry, len(repo.data))
+	for key, e := range repo.data {
+		if e.live() {
+			repo.backup[key] = e
+		}
+	}
+	return int64(len(repo.backup)), nil
+}
+
+func (repo *MemoryRepository) ScanBackup(query ScanQuery) ([]any, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	_, start, limit := query.plan()
+	keys := make([]string, 0, len(repo.backup))
+	for key := range repo.backup {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pos := sort.SearchStrings(keys, start)
+
+	tuples := make([]any, 0, limit)
+	for _, key := range keys[pos:] {
+		if uint32(len(tuples)) >= limit {
+			break
+		}
+		if key == query.After {
+			continue
+		}
+		if !strings.HasPrefix(key, query.Prefix) {
+			break
+		}
+		tuples = append(tuples, memoryTuple(key, repo.backup[key]))
+	}
+	return tuples, nil
+}
+
+func (repo *MemoryRepository) StageBackup(tuples []any) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for _, item := range tuples {
+		tuple, ok := item.([]any)
+		if !ok || len(tuple) == 0 {
+			continue
+		}
+		key, _ := tuple[0].(string)
+		repo.backup[key] = repo.tupleEntry(tuple)
+	}
+	return nil
+}
+
+func (repo *MemoryRepository) CommitBackup() (int64, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for _, e := range repo.data {
+		if e.live() {
+			return 0, ErrNotEmpty
+		}
+	}
+	var count int64
+	for key, e := range repo.backup {
+		if e.live() {
+			repo.data[key] = e
+			count++
+		}
+	}
+	repo.backup = make(map[string]memoryEntry)
+	return count, nil
+}
+
+func (repo *MemoryRepository) ClearBackup() error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.backup = make(map[string]memoryEntry)
+	return nil
+}
+
+// recordChange records value as a new revision of key unless it equals
+// the value the key already had, like the kv_api history trigger. The
+// caller must hold the write lock.
+func (repo *MemoryRepository) recordChange(key string, before any, existed bool, value any) {
+	if existed && reflect.DeepEqual(before, value) {
+		return
+	}
+	repo.record(key, Revision{Value: value})
+}
+
+// recordDelete records a tombstone of key. The caller must hold the write
+// lock.
+func (repo *MemoryRepository) recordDelete(key string) {
+	repo.record(key, Revision{Deleted: true})
+}
+
+func (repo *MemoryRepository) record(key string, revision Revision) {
+	if !repo.historyConfig.Enabled() {
+		return
+	}
+	revisions := repo.history[key]
+	revision.Revision = 1
+	if len(revisions) > 0 {
+		revision.Revision = revisions[len(revisions)-1].Revision + 1
+	}
+	revision.ChangedAt = time.Now()
+	revisions = append(revisions, revision)
+
+	cfg := repo.historyConfig
+	keep := 0
+	for keep < len(revisions)-1 {
+		old := revisions[keep]
+		excess := cfg.Revisions > 0 && revision.Revision-old.Revision >= uint64(cfg.Revisions)
+		stale := cfg.Retention > 0 && revision.ChangedAt.Sub(old.ChangedAt) > cfg.Retention
+		if !excess && !stale {
+			break
+		}
+		keep++
+	}
+	repo.history[key] = append([]Revision(nil), revisions[keep:]...)
+}
+
+func (repo *MemoryRepository) GetHistory(query HistoryQuery) ([]Revision, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	revisions := repo.history[query.Key]
+	result := make([]Revision, 0)
+	for i := len(revisions) - 1; i >= 0 && uint32(len(result)) < query.limit(); i-- {
+		if query.Before == 0 || revisions[i].Revision < query.Before {
+			result = append(result, revisions[i])
+		}
+	}
+	return result, nil
+}
+
+func (repo *MemoryRepository) GetRevision(key string, revision uint64) (Revision, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	for _, found := range repo.history[key] {
+		if found.Revision == revision {
+			return found, nil
+		}
+	}
+	return Revision{}, ErrRevisionNotFound
+}
+
+func (repo *MemoryRepository) GetRevisionAt(key string, at time.Time) (Revision, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	revisions := repo.history[key]
+	for i := len(revisions) - 1; i >= 0; i-- {
+		if !revisions[i].ChangedAt.After(at) {
+			return revisions[i], nil
+		}
+	}
+	return Revision{}, ErrRevisionNotFound
+}
+
+// MergePatch applies patch to target following JSON Merge Patch
+// (RFC 7396), the same semantics as kv_api.merge.
+func MergePatch(target any, patch any) any {
+	patchMap, ok := asStringMap(patch)
+	if !ok {
+		return patch
+	}
+
+	result := make(map[string]any)
+	if targetMap, ok := asStringMap(target); ok {
+		for k, v := range targetMap {
+			result[k] = v
+		}
+	}
+	for k, v := range patchMap {
+		if v == nil {
+			delete(result, k)
+			continue
+		}
+		result[k] = MergePatch(result[k], v)
+	}
+	return result
+}
+
+func asStringMap(value any) (map[string]any, bool) {
+	switch m := value.(type) {
+	case map[string]any:
+		return m, true
+	case map[any]any:
+		converted := make(map[string]any, len(m))
+		for k, v := range m {
+			strKey, ok := k.(string)
+			if !ok {
+				return nil, false
+			}
+			converted[strKey] = v
+		}
+		return converted, true
+	}
+	return nil, false
+}
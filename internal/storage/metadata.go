@@ -0,0 +1,78 @@
+package storage
+
+import "time"
+
+// Fields of a json_data tuple after the key, value and expires_at.
+const (
+	createdAtField = iota + expiresAtField + 1
+	updatedAtField
+	sizeField
+	writerField
+	labelsField
+	versionField
+)
+
+// Metadata describes a stored entry. CreatedAt and UpdatedAt are zero
+// for entries not written since metadata is kept. UpdatedAt changes only
+// with the value, not with the TTL or the annotations.
+type Metadata struct {
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ExpiresAt time.Time
+	Size      int64
+	Writer    string
+	Labels    map[string]string
+}
+
+// TupleMetadata reads the metadata stored in a json_data tuple.
+func TupleMetadata(tuple []any) Metadata {
+	var meta Metadata
+	if expiresAt, ok := TupleExpiry(tuple); ok {
+		meta.ExpiresAt = expiresAt.UTC()
+	}
+	meta.CreatedAt = tupleTime(tuple, createdAtField)
+	meta.UpdatedAt = tupleTime(tuple, updatedAtField)
+	if len(tuple) > sizeField {
+		meta.Size, _ = toInt(tuple[sizeField])
+	}
+	if len(tuple) > writerField {
+		meta.Writer, _ = tuple[writerField].(string)
+	}
+	if len(tuple) > labelsField {
+		if labels, ok := asStringMap(tuple[labelsField]); ok {
+			meta.Labels = make(map[string]string, len(labels))
+			for name, value := range labels {
+				meta.Labels[name], _ = value.(string)
+			}
+		}
+	}
+	return meta
+}
+
+// TupleVersion reads the version of a json_data tuple, which changes with
+// every new value and never repeats for a key. It is 0 for entries not
+// written since versions are kept.
+func TupleVersion(tuple []any) uint64 {
+	if len(tuple) <= versionField {
+		return 0
+	}
+	switch version := tuple[versionField].(type) {
+	case uint64:
+		return version
+	case int64:
+		return uint64(version)
+	}
+	version, _ := toInt(tuple[versionField])
+	return uint64(version)
+}
+
+func tupleTime(tuple []any, field int) time.Time {
+	if len(tuple) <= field || tuple[field] == nil {
+		return time.Time{}
+	}
+	seconds, ok := toFloat(tuple[field])
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))).UTC()
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"strings"
+	"time"
+
+	"github.com/tarantool/go-tarantool/v2"
+)
+
+// DefaultScanLimit is used when a ScanQuery does not set Limit.
+const DefaultScanLimit uint32 = 100
+
+// expiresAtField is the tuple field holding the TTL deadline in seconds.
+const expiresAtField = 2
+
+// ScanQuery pages through entries in key order. Only keys greater than
+// After and starting with Prefix are returned.
+type ScanQuery struct {
+	After  string
+	Prefix string
+	Limit  uint32
+}
+
+func (query ScanQuery) plan() (tarantool.Iter, string, uint32) {
+	limit := query.Limit
+	if limit == 0 {
+		limit = DefaultScanLimit
+	}
+	if query.After != "" && query.After >= query.Prefix {
+		return tarantool.IterGt, query.After, limit
+	}
+	return tarantool.IterGe, query.Prefix, limit
+}
+
+// filter drops expired tuples unless keepExpired is set and stops at the
+// first key outside Prefix. The second result is false once the end of
+// the prefix was reached.
+func (query ScanQuery) filter(data []any, keepExpired bool) ([]any, bool) {
+	result := make([]any, 0, len(data))
+	for _, item := range data {
+		tuple, ok := item.([]any)
+		if !ok || len(tuple) == 0 {
+			continue
+		}
+		key, _ := tuple[0].(string)
+		if !strings.HasPrefix(key, query.Prefix) {
+			return result, false
+		}
+		if !keepExpired && TupleExpired(tuple) {
+			continue
+		}
+		result = append(result, tuple)
+	}
+	return result, true
+}
+
+// TupleExpired reports whether the TTL stored in the tuple has passed.
+func TupleExpired(tuple []any) bool {
+	expiresAt, ok := TupleExpiry(tuple)
+	return ok && !time.Now().Before(expiresAt)
+}
+
+// TupleExpiry returns the TTL deadline stored in the tuple, if any.
+func TupleExpiry(tuple []any) (time.Time, bool) {
+	if len(tuple) <= expiresAtField || tuple[expiresAtField] == nil {
+		return time.Time{}, false
+	}
+	seconds, ok := toFloat(tuple[expiresAtField])
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), true
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"fmt"
+
+	"kvManager/internal/pkg/log"
+)
+
+// FreezeBackup copies the live tuples to BackupSpace with
+// kv_api.freeze_backup, in one transaction that writes wait for.
+func (repo *TarantoolRepository) FreezeBackup() (int64, error) {
+	log.Logger.Debugw("Freeze backup in Tarantool")
+	data, err := repo.callFunction("kv_api.freeze_backup")
+	if err != nil {
+		return 0, err
+	}
+	count, ok := toInt(data[0])
+	if !ok {
+		return 0, fmt.Errorf("unexpected freeze result: %v", data[0])
+	}
+	return count, nil
+}
+
+// ScanBackup pages through BackupSpace in key order. It reads from the
+// master, since the replicas may not have the latest copy yet.
+func (repo *TarantoolRepository) ScanBackup(query ScanQuery) ([]any, error) {
+	log.Logger.Debugw("Scan backup in Tarantool",
+		"after", query.After, "prefix", query.Prefix)
+	return repo.scan(repo.conn, BackupSpace, query, true)
+}
+
+func (repo *TarantoolRepository) StageBackup(tuples []any) error {
+	log.Logger.Debugw("Stage backup in Tarantool",
+		"tuples", len(tuples))
+	_, err := repo.callFunction("kv_api.stage_backup", tuples)
+	return err
+}
+
+// CommitBackup moves the staged tuples to JsonDataSpace with
+// kv_api.commit_backup, in one transaction.
+func (repo *TarantoolRepository) CommitBackup() (int64, error) {
+	log.Logger.Debugw("Commit backup in Tarantool")
+	data, err := repo.callFunction("kv_api.commit_backup")
+	if err != nil {
+		return 0, err
+	}
+
+	switch data[0] {
+	case "ok":
+		if len(data) < 2 {
+			return 0, fmt.Errorf("unexpected commit result: %v", data)
+		}
+		count, ok := toInt(data[1])
+		if !ok {
+			return 0, fmt.Errorf("unexpected commit result: %v", data)
+		}
+		return count, nil
+	case "not_empty":
+		return 0, ErrNotEmpty
+	}
+	return 0, fmt.Errorf("unexpected commit result: %v", data[0])
+}
+
+func (repo *TarantoolRepository) ClearBackup() error {
+	log.Logger.Debugw("Clear backup in Tarantool")
+	_, err := repo.callFunction("kv_api.clear_backup")
+	return err
+}
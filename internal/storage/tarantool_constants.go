@@ -3,8 +3,24 @@ package storage
 import "errors"
 
 const (
-	JsonDataSpace string = "json_data"
-	PrimaryIndex  string = "primary"
+	JsonDataSpace  string = "json_data"
+	SchemaSpace    string = "json_schemas"
+	IndexSpace     string = "json_indexes"
+	MigrationSpace string = "schema_migrations"
+	UsageSpace     string = "namespace_usage"
+	AuditSpace     string = "audit_log"
+	HistorySpace   string = "json_history"
+	TrashSpace     string = "json_trash"
+	BackupSpace    string = "json_backup"
+	PrimaryIndex   string = "primary"
+	KeyIndex       string = "key"
+	PrincipalIndex string = "principal"
+	PurgeIndex     string = "purge_at"
 )
 
-var ErrKeyNotFound = errors.New("key not found")
+var (
+	ErrKeyNotFound   = errors.New("key not found")
+	ErrValueMismatch = errors.New("value does not match expected")
+	ErrKeyExists     = errors.New("key already exists")
+	ErrNotEmpty      = errors.New("storage is not empty")
+)
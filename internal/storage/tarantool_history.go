@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tarantool/go-tarantool/v2"
+
+	"kvManager/internal/pkg/log"
+)
+
+// GetHistory reads the revisions recorded by the kv_api history trigger.
+// Pages below Before start at {key, Before}, so the select may run into
+// the next key, which ends the history.
+func (repo *TarantoolRepository) GetHistory(query HistoryQuery) ([]Revision, error) {
+	log.Logger.Debugw("Get history from Tarantool",
+		"key", query.Key, "before", query.Before)
+	iter, key := tarantool.IterReq, []any{query.Key}
+	if query.Before > 0 {
+		iter, key = tarantool.IterLt, []any{query.Key, query.Before}
+	}
+	req := tarantool.NewSelectRequest(HistorySpace).Index(PrimaryIndex).
+		Iterator(iter).Key(key).Limit(query.limit())
+	data, err := repo.execRead(req)
+	if errors.Is(err, ErrKeyNotFound) {
+		return []Revision{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]Revision, 0, len(data))
+	for _, item := range data {
+		key, revision, err := historyRevision(item)
+		if err != nil {
+			return nil, err
+		}
+		if key != query.Key {
+			break
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, nil
+}
+
+func (repo *TarantoolRepository) GetRevision(key string, revision uint64) (Revision, error) {
+	log.Logger.Debugw("Get revision from Tarantool",
+		"key", key, "revision", revision)
+	req := tarantool.NewSelectRequest(HistorySpace).Index(PrimaryIndex).
+		Iterator(tarantool.IterEq).Key([]any{key, revision}).Limit(1)
+	data, err := repo.execRead(req)
+	if errors.Is(err, ErrKeyNotFound) {
+		return Revision{}, ErrRevisionNotFound
+	}
+	if err != nil {
+		return Revision{}, err
+	}
+	_, found, err := historyRevision(data[0])
+	return found, err
+}
+
+func (repo *TarantoolRepository) GetRevisionAt(key string, at time.Time) (Revision, error) {
+	log.Logger.Debugw("Get revision at time from Tarantool",
+		"key", key, "at", at)
+	data, err := repo.callReadFunction("kv_api.revision_at", key,
+		float64(at.UnixNano())/float64(time.Second))
+	if errors.Is(err, ErrKeyNotFound) {
+		return Revision{}, ErrRevisionNotFound
+	}
+	if err != nil {
+		return Revision{}, err
+	}
+	_, found, err := historyRevision(data[0])
+	return found, err
+}
+
+// historyRevision decodes a {key, revision, value, changed_at, deleted}
+// tuple.
+func historyRevision(item any) (string, Revision, error) {
+	tuple, ok := item.([]any)
+	if !ok || len(tuple) < 5 {
+		return "", Revision{}, fmt.Errorf("unexpected history tuple: %v", item)
+	}
+	key, _ := tuple[0].(string)
+	number, ok := toInt(tuple[1])
+	if !ok {
+		return "", Revision{}, fmt.Errorf("unexpected revision: %v", tuple[1])
+	}
+	seconds, ok := toFloat(tuple[3])
+	if !ok {
+		return "", Revision{}, fmt.Errorf("unexpected revision time: %v", tuple[3])
+	}
+	deleted, _ := tuple[4].(bool)
+	return key, Revision{
+		Revision:  uint64(number),
+		Value:     tuple[2],
+		ChangedAt: time.Unix(0, int64(seconds*float64(time.Second))).UTC(),
+		Deleted:   deleted,
+	}, nil
+}
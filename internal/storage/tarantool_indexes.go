@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tarantool/go-tarantool/v2"
+
+	"kvManager/internal/pkg/log"
+)
+
+func (repo *TarantoolRepository) CreateIndex(def IndexDefinition) error {
+	log.Logger.Debugw("Create index in Tarantool",
+		"name", def.Name, "path", def.Path, "type", def.Type)
+	err := def.Normalize()
+	if err != nil {
+		return err
+	}
+
+	_, err = repo.callFunction("kv_api.create_index", def.Name, def.Path, def.Type, def.Unique)
+	if err != nil {
+		return err
+	}
+
+	req2 := tarantool.NewReplaceRequest(IndexSpace).
+		Tuple([]any{def.Name, def.Path, def.Type, def.Unique})
+	_, err = repo.execRequest(req2)
+	return err
+}
+
+func (repo *TarantoolRepository) DropIndex(name string) error {
+	log.Logger.Debugw("Drop index in Tarantool",
+		"name", name)
+	req := tarantool.NewDeleteRequest(IndexSpace).Index(PrimaryIndex).Key([]any{name})
+	_, err := repo.execRequest(req)
+	if errors.Is(err, ErrKeyNotFound) {
+		return ErrIndexNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = repo.callFunction("kv_api.drop_index", name)
+	return err
+}
+
+func (repo *TarantoolRepository) ListIndexes() ([]IndexDefinition, error) {
+	log.Logger.Debugw("List indexes from Tarantool")
+	req := tarantool.NewSelectRequest(IndexSpace).Index(PrimaryIndex).Iterator(tarantool.IterAll)
+	data, err := repo.execRead(req)
+	if errors.Is(err, ErrKeyNotFound) {
+		return []IndexDefinition{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	defs := make([]IndexDefinition, 0, len(data))
+	for _, item := range data {
+		def, err := decodeIndexDefinition(item)
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, *def)
+	}
+	return defs, nil
+}
+
+func (repo *TarantoolRepository) getIndex(name string) (*IndexDefinition, error) {
+	req := tarantool.NewSelectRequest(IndexSpace).Index(PrimaryIndex).Key([]any{name})
+	data, err := repo.execRead(req)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, ErrIndexNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeIndexDefinition(data[0])
+}
+
+func (repo *TarantoolRepository) QueryIndex(query IndexQuery) ([]any, error) {
+	log.Logger.Debugw("Query index in Tarantool",
+		"index", query.Index)
+	def, err := repo.getIndex(query.Index)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planQuery(def, query)
+	if err != nil {
+		return nil, err
+	}
+
+	req := tarantool.NewSelectRequest(JsonDataSpace).Index(def.Name).
+		Iterator(plan.iter).Key(plan.key).Limit(plan.limit)
+	data, err := repo.execRead(req)
+	if errors.Is(err, ErrKeyNotFound) {
+		return []any{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]any, 0, len(data))
+	for _, item := range data {
+		tuple, ok := item.([]any)
+		if !ok || !plan.withinUpper(def, tuple) {
+			break
+		}
+		if TupleExpired(tuple) {
+			continue
+		}
+		result = append(result, tuple)
+	}
+	return result, nil
+}
+
+func decodeIndexDefinition(item any) (*IndexDefinition, error) {
+	tuple, ok := item.([]any)
+	if !ok || len(tuple) < 4 {
+		return nil, fmt.Errorf("unexpected index tuple: %v", item)
+	}
+	def := &IndexDefinition{}
+	def.Name, _ = tuple[0].(string)
+	def.Path, _ = tuple[1].(string)
+	def.Type, _ = tuple[2].(string)
+	def.Unique, _ = tuple[3].(bool)
+	return def, nil
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tarantool/go-tarantool/v2"
+
+	"kvManager/internal/pkg/log"
+)
+
+// LuaModuleVersion is the kv_api version this client was written against.
+// Servers with the same major version and the same or newer minor version
+// are compatible.
+const LuaModuleVersion = "1.14"
+
+var ErrModuleIncompatible = errors.New("tarantool lua module is incompatible")
+
+//go:embed lua/kv.lua
+var luaModule string
+
+// EnsureModule performs the handshake with the kv_api Lua module. The
+// bundled module is pushed when the server has none or an older
+// compatible one; a different major version is reported as
+// ErrModuleIncompatible. The history configuration is applied afterwards,
+// since module settings live in Lua globals.
+func (repo *TarantoolRepository) EnsureModule() error {
+	err := repo.handshake()
+	if err != nil {
+		return err
+	}
+	return repo.configureHistory()
+}
+
+func (repo *TarantoolRepository) handshake() error {
+	serverVersion, err := repo.moduleVersion()
+	if err != nil {
+		log.Logger.Infow("Lua module is not loaded, pushing it", "reason", err.Error())
+		return repo.pushModule()
+	}
+
+	cmp, err := compareModuleVersions(serverVersion, LuaModuleVersion)
+	if err != nil {
+		return err
+	}
+	if cmp < 0 {
+		log.Logger.Infow("Lua module is outdated, pushing it",
+			"server_version", serverVersion, "client_version", LuaModuleVersion)
+		return repo.pushModule()
+	}
+
+	log.Logger.Infow("Lua module handshake completed",
+		"server_version", serverVersion, "client_version", LuaModuleVersion)
+	return nil
+}
+
+func (repo *TarantoolRepository) pushModule() error {
+	req := tarantool.NewEvalRequest(luaModule).Args([]any{JsonDataSpace, UsageSpace, HistorySpace, TrashSpace, PurgeIndex,
+		BackupSpace})
+	_, err := repo.execRequest(req)
+	if err != nil {
+		log.Logger.Errorw("Failed to push Lua module", "error", err)
+		return err
+	}
+
+	serverVersion, err := repo.moduleVersion()
+	if err != nil {
+		return err
+	}
+	_, err = compareModuleVersions(serverVersion, LuaModuleVersion)
+	return err
+}
+
+func (repo *TarantoolRepository) configureHistory() error {
+	_, err := repo.callFunction("kv_api.configure_history",
+		repo.history.Revisions, repo.history.Retention.Seconds())
+	if err != nil {
+		log.Logger.Errorw("Failed to configure history", "error", err)
+	}
+	return err
+}
+
+func (repo *TarantoolRepository) moduleVersion() (string, error) {
+	data, err := repo.callFunction("kv_api.version")
+	if err != nil {
+		return "", err
+	}
+	version, ok := data[0].(string)
+	if !ok {
+		return "", fmt.Errorf("%w: unexpected version %v", ErrModuleIncompatible, data[0])
+	}
+	return version, nil
+}
+
+// compareModuleVersions returns the sign of server minus client minor
+// version, or ErrModuleIncompatible when the major versions differ.
+func compareModuleVersions(server string, client string) (int, error) {
+	serverMajor, serverMinor, err := parseModuleVersion(server)
+	if err != nil {
+		return 0, err
+	}
+	clientMajor, clientMinor, err := parseModuleVersion(client)
+	if err != nil {
+		return 0, err
+	}
+	if serverMajor != clientMajor {
+		log.Logger.Errorw("Lua module major version mismatch",
+			"server_version", server, "client_version", client)
+		return 0, fmt.Errorf("%w: server %s, client %s", ErrModuleIncompatible, server, client)
+	}
+
+	switch {
+	case serverMinor < clientMinor:
+		return -1, nil
+	case serverMinor > clientMinor:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func parseModuleVersion(version string) (int, int, error) {
+	major, minor, ok := strings.Cut(version, ".")
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: malformed version %q", ErrModuleIncompatible, version)
+	}
+	majorNum, err := strconv.Atoi(major)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: malformed version %q", ErrModuleIncompatible, version)
+	}
+	minorNum, err := strconv.Atoi(minor)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: malformed version %q", ErrModuleIncompatible, version)
+	}
+	return majorNum, minorNum, nil
+}
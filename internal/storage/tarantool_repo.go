@@ -1,24 +1,83 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
-	
+	"time"
+
 	"github.com/tarantool/go-tarantool/v2"
 
 	"kvManager/internal/pkg/log"
+	"kvManager/internal/pkg/resilience"
 )
 
+// TarantoolRepository sends writes to conn and reads to reader. Both are
+// usually the same *tarantool.Connection; with a pool.ConnectionPool they
+// are pool.NewConnectorAdapter instances for the master and the replicas.
 type TarantoolRepository struct {
-	conn *tarantool.Connection
+	conn    tarantool.Doer
+	reader  tarantool.Doer
+	guard   *resilience.Guard
+	history HistoryConfig
+	trash   time.Duration
+
+	// annotation is stored with every value written through a view
+	// returned by Annotated.
+	annotation *Annotation
 }
 
-func NewTarantoolRepository(conn *tarantool.Connection) *TarantoolRepository {
-	return &TarantoolRepository{conn: conn}
+func NewTarantoolRepository(conn tarantool.Doer) *TarantoolRepository {
+	return &TarantoolRepository{conn: conn, reader: conn}
+}
+
+// NewReplicatedRepository creates a repository that sends read-only
+// requests to reader, which may lag behind conn.
+func NewReplicatedRepository(conn tarantool.Doer, reader tarantool.Doer) *TarantoolRepository {
+	return &TarantoolRepository{conn: conn, reader: reader}
+}
+
+// WithGuard routes every request through guard, which limits concurrency,
+// fails fast while Tarantool is unavailable and retries idempotent
+// requests: reads and deletes.
+func (repo *TarantoolRepository) WithGuard(guard *resilience.Guard) *TarantoolRepository {
+	repo.guard = guard
+	return repo
+}
+
+// WithHistory sets the revisions of each key kept in HistorySpace. It
+// takes effect with the next EnsureModule.
+func (repo *TarantoolRepository) WithHistory(cfg HistoryConfig) *TarantoolRepository {
+	repo.history = cfg
+	return repo
+}
+
+// WithTrash enables soft delete: deleted keys are kept in TrashSpace for
+// retention before PurgeTrash removes them.
+func (repo *TarantoolRepository) WithTrash(retention time.Duration) *TarantoolRepository {
+	repo.trash = retention
+	return repo
 }
 
 func (repo *TarantoolRepository) execRequest(req tarantool.Request) ([]any, error) {
-	future := repo.conn.Do(req)
-	data, err := future.Get()
+	return repo.exec(repo.conn, req, false)
+}
+
+// execDelete sends a write request that is safe to repeat.
+func (repo *TarantoolRepository) execDelete(req tarantool.Request) ([]any, error) {
+	return repo.exec(repo.conn, req, true)
+}
+
+func (repo *TarantoolRepository) execRead(req tarantool.Request) ([]any, error) {
+	return repo.exec(repo.reader, req, true)
+}
+
+func (repo *TarantoolRepository) exec(doer tarantool.Doer, req tarantool.Request, idempotent bool) ([]any, error) {
+	var data []any
+	err := repo.guard.Do(idempotent, func() error {
+		var err error
+		data, err = doer.Do(req).Get()
+		return err
+	})
 	if err != nil {
 		log.Logger.Warnw("Duplicate key error",
 			"error", err.Error())
@@ -36,33 +95,362 @@ func (repo *TarantoolRepository) execRequest(req tarantool.Request) ([]any, erro
 	return data, nil
 }
 
+// IsTransient reports whether err means Tarantool could not serve the
+// request, as opposed to an error returned by the request itself.
+func IsTransient(err error) bool {
+	var boxErr tarantool.Error
+	if errors.As(err, &boxErr) {
+		return false
+	}
+	var boxErrPtr *tarantool.Error
+	return !errors.As(err, &boxErrPtr)
+}
+
+func (repo *TarantoolRepository) callFunction(name string, args ...any) ([]any, error) {
+	if args == nil {
+		args = []any{}
+	}
+	req := tarantool.NewCallRequest(name).Args(args)
+	return repo.execRequest(req)
+}
+
+func (repo *TarantoolRepository) callReadFunction(name string, args ...any) ([]any, error) {
+	req := tarantool.NewCallRequest(name).Args(args)
+	return repo.execRead(req)
+}
+
+// AddValue creates key with kv_api.insert, which treats an expired key
+// as missing like reads do.
 func (repo *TarantoolRepository) AddValue(key string, value any) error {
 	log.Logger.Debugw("Adding value to Tarantool",
 		"key", key)
-	req := tarantool.NewInsertRequest(JsonDataSpace).Tuple([]any{key, value})
-	_, err := repo.execRequest(req)
-	return err
+	data, err := repo.callFunction("kv_api.insert", repo.writeArgs(key, value)...)
+	if err != nil {
+		return err
+	}
+
+	switch data[0] {
+	case "ok":
+		return nil
+	case "exists":
+		return ErrKeyExists
+	}
+	return fmt.Errorf("unexpected insert result: %v", data[0])
 }
 
 func (repo *TarantoolRepository) GetValue(key string) ([]any, error) {
 	log.Logger.Debugw("Get value from Tarantool",
 		"key", key)
-	req := tarantool.NewSelectRequest(JsonDataSpace).Index(PrimaryIndex).Key([]any{key})
-	return repo.execRequest(req)
+	return repo.callReadFunction("kv_api.get", key)
 }
 
+// UpdateValue replaces the value of a live key with kv_api.update.
 func (repo *TarantoolRepository) UpdateValue(key string, value any) error {
 	log.Logger.Debugw("Update value in Tarantool",
 		"key", key)
-	req := tarantool.NewUpdateRequest(JsonDataSpace).Index(PrimaryIndex).Key([]any{key}).Operations(tarantool.NewOperations().Assign(1, value))
-	_, err := repo.execRequest(req)
-	return err
+	data, err := repo.callFunction("kv_api.update", repo.writeArgs(key, value)...)
+	if err != nil {
+		return err
+	}
+
+	switch data[0] {
+	case "ok":
+		return nil
+	case "not_found":
+		return ErrKeyNotFound
+	}
+	return fmt.Errorf("unexpected update result: %v", data[0])
+}
+
+// PutValue replaces or creates key and reports whether it was created.
+func (repo *TarantoolRepository) PutValue(key string, value any) (bool, error) {
+	log.Logger.Debugw("Put value to Tarantool",
+		"key", key)
+	data, err := repo.callFunction("kv_api.put", repo.writeArgs(key, value)...)
+	if err != nil {
+		return false, err
+	}
+	created, ok := data[0].(bool)
+	if !ok {
+		return false, fmt.Errorf("unexpected put result: %v", data[0])
+	}
+	return created, nil
+}
+
+// CopyTuple inserts tuple with kv_api.copy_tuple.
+func (repo *TarantoolRepository) CopyTuple(tuple []any) (bool, error) {
+	log.Logger.Debugw("Copy tuple to Tarantool", "key", tuple[0])
+	return repo.callBool("kv_api.copy_tuple", tuple)
+}
+
+// RemoveTuple deletes key with kv_api.remove_tuple.
+func (repo *TarantoolRepository) RemoveTuple(key string, value any) (bool, error) {
+	log.Logger.Debugw("Remove tuple from Tarantool", "key", key)
+	return repo.callBool("kv_api.remove_tuple", key, value)
+}
+
+func (repo *TarantoolRepository) callBool(name string, args ...any) (bool, error) {
+	data, err := repo.callFunction(name, args...)
+	if err != nil {
+		return false, err
+	}
+	result, ok := data[0].(bool)
+	if !ok {
+		return false, fmt.Errorf("unexpected %s result: %v", name, data[0])
+	}
+	return result, nil
 }
 
+// DeleteValue removes a live key with kv_api.delete, moving it to the
+// trash when soft delete is enabled. An expired key is ErrKeyNotFound.
 func (repo *TarantoolRepository) DeleteValue(key string) error {
 	log.Logger.Debugw("Delete value from Tarantool",
+		"key", key, "soft", repo.trash > 0)
+	req := tarantool.NewCallRequest("kv_api.delete").Args([]any{key, repo.trash.Seconds()})
+	_, err := repo.execDelete(req)
+	return err
+}
+
+func (repo *TarantoolRepository) CompareAndSet(key string, expected any, value any) error {
+	log.Logger.Debugw("Compare and set value in Tarantool",
 		"key", key)
-	req := tarantool.NewDeleteRequest(JsonDataSpace).Index(PrimaryIndex).Key([]any{key})
+	data, err := repo.callFunction("kv_api.cas", repo.writeArgs(key, expected, value)...)
+	if err != nil {
+		return err
+	}
+
+	switch data[0] {
+	case "ok":
+		return nil
+	case "mismatch":
+		return ErrValueMismatch
+	case "not_found":
+		return ErrKeyNotFound
+	}
+	return fmt.Errorf("unexpected cas result: %v", data[0])
+}
+
+func (repo *TarantoolRepository) CompareVersionAndSet(key string, version uint64, value any) error {
+	log.Logger.Debugw("Compare version and set value in Tarantool",
+		"key", key, "version", version)
+	data, err := repo.callFunction("kv_api.cas_version", repo.writeArgs(key, version, value)...)
+	if err != nil {
+		return err
+	}
+
+	switch data[0] {
+	case "ok":
+		return nil
+	case "mismatch":
+		return ErrValueMismatch
+	case "not_found":
+		return ErrKeyNotFound
+	}
+	return fmt.Errorf("unexpected cas_version result: %v", data[0])
+}
+
+func (repo *TarantoolRepository) MergeValue(key string, patch any) ([]any, error) {
+	log.Logger.Debugw("Merge value in Tarantool",
+		"key", key)
+	return repo.callFunction("kv_api.merge", repo.writeArgs(key, patch)...)
+}
+
+func (repo *TarantoolRepository) ExpireValue(key string, ttl time.Duration) error {
+	log.Logger.Debugw("Expire value in Tarantool",
+		"key", key, "ttl", ttl)
+	_, err := repo.callFunction("kv_api.expire", key, ttl.Seconds())
+	return err
+}
+
+// Annotated returns a view of repo that passes annotation to the kv_api
+// write functions along with each value.
+func (repo *TarantoolRepository) Annotated(annotation Annotation) AnnotatedRepository {
+	view := *repo
+	view.annotation = &annotation
+	return &view
+}
+
+// writeArgs appends the writer, labels and TTL in seconds of an annotated
+// view to the arguments of a kv_api write function. An empty writer, nil
+// labels or a nil TTL are passed as nil, like for a write that carries
+// none.
+func (repo *TarantoolRepository) writeArgs(args ...any) []any {
+	if repo.annotation == nil {
+		return args
+	}
+	var writer, labels, ttl any
+	if repo.annotation.Writer != "" {
+		writer = repo.annotation.Writer
+	}
+	if repo.annotation.Labels != nil {
+		labels = repo.annotation.Labels
+	}
+	if repo.annotation.TTL != nil {
+		ttl = repo.annotation.TTL.Seconds()
+	}
+	return append(args, writer, labels, ttl)
+}
+
+// Annotate sets the writer and labels of key with kv_api.annotate.
+func (repo *TarantoolRepository) Annotate(key string, writer string, labels map[string]string) error {
+	log.Logger.Debugw("Annotate value in Tarantool",
+		"key", key, "writer", writer)
+	var labelsArg any
+	if labels != nil {
+		labelsArg = labels
+	}
+	_, err := repo.callFunction("kv_api.annotate", key, writer, labelsArg)
+	return err
+}
+
+func (repo *TarantoolRepository) GetValues(keys []string) ([]any, error) {
+	log.Logger.Debugw("Get values from Tarantool",
+		"keys_count", len(keys))
+	data, err := repo.callReadFunction("kv_api.bulk_get", keys)
+	if err != nil {
+		return nil, err
+	}
+	tuples, ok := data[0].([]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected bulk_get result: %v", data[0])
+	}
+	return tuples, nil
+}
+
+func (repo *TarantoolRepository) DeleteValues(keys []string) ([]string, error) {
+	log.Logger.Debugw("Delete values from Tarantool",
+		"keys_count", len(keys))
+	req := tarantool.NewCallRequest("kv_api.bulk_delete").Args([]any{keys, repo.trash.Seconds()})
+	data, err := repo.execDelete(req)
+	if err != nil {
+		return nil, err
+	}
+	deletedData, ok := data[0].([]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected bulk_delete result: %v", data[0])
+	}
+
+	deleted := make([]string, 0, len(deletedData))
+	for _, key := range deletedData {
+		strKey, _ := key.(string)
+		deleted = append(deleted, strKey)
+	}
+	return deleted, nil
+}
+
+func (repo *TarantoolRepository) PutSchema(prefix string, schema string) error {
+	log.Logger.Debugw("Put schema to Tarantool",
+		"prefix", prefix)
+	req := tarantool.NewReplaceRequest(SchemaSpace).Tuple([]any{prefix, schema})
 	_, err := repo.execRequest(req)
 	return err
 }
+
+func (repo *TarantoolRepository) GetSchemas() (map[string]string, error) {
+	log.Logger.Debugw("Get schemas from Tarantool")
+	req := tarantool.NewSelectRequest(SchemaSpace).Index(PrimaryIndex).Iterator(tarantool.IterAll)
+	data, err := repo.execRead(req)
+	if errors.Is(err, ErrKeyNotFound) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	schemas := make(map[string]string, len(data))
+	for _, item := range data {
+		tuple, ok := item.([]any)
+		if !ok || len(tuple) < 2 {
+			return nil, fmt.Errorf("unexpected schema tuple: %v", item)
+		}
+		prefix, _ := tuple[0].(string)
+		schema, _ := tuple[1].(string)
+		schemas[prefix] = schema
+	}
+	return schemas, nil
+}
+
+func (repo *TarantoolRepository) DeleteSchema(prefix string) error {
+	log.Logger.Debugw("Delete schema from Tarantool",
+		"prefix", prefix)
+	req := tarantool.NewDeleteRequest(SchemaSpace).Index(PrimaryIndex).Key([]any{prefix})
+	_, err := repo.execDelete(req)
+	return err
+}
+
+// ScanValues pages through the primary index in key order. Expired
+// tuples are skipped, so more than one select may be needed to fill a page.
+func (repo *TarantoolRepository) ScanValues(query ScanQuery) ([]any, error) {
+	log.Logger.Debugw("Scan values in Tarantool",
+		"after", query.After, "prefix", query.Prefix)
+	return repo.scan(repo.reader, JsonDataSpace, query, false)
+}
+
+// scan pages through the primary index of space on doer in key order,
+// skipping expired tuples unless keepExpired is set.
+func (repo *TarantoolRepository) scan(doer tarantool.Doer, space string, query ScanQuery,
+	keepExpired bool) ([]any, error) {
+	iter, key, limit := query.plan()
+	result := make([]any, 0, limit)
+	for {
+		req := tarantool.NewSelectRequest(space).Index(PrimaryIndex).
+			Iterator(iter).Key([]any{key}).Limit(limit)
+		data, err := repo.exec(doer, req, true)
+		if errors.Is(err, ErrKeyNotFound) {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		page, more := query.filter(data, keepExpired)
+		for _, tuple := range page {
+			if uint32(len(result)) == limit {
+				return result, nil
+			}
+			result = append(result, tuple)
+		}
+		if !more || uint32(len(data)) < limit {
+			return result, nil
+		}
+		iter, key = tarantool.IterGt, data[len(data)-1].([]any)[0].(string)
+	}
+}
+
+// GetUsage reads the usage of namespace maintained by the kv_api trigger.
+func (repo *TarantoolRepository) GetUsage(namespace string) (Usage, error) {
+	log.Logger.Debugw("Get usage from Tarantool",
+		"namespace", namespace)
+	req := tarantool.NewSelectRequest(UsageSpace).Index(PrimaryIndex).
+		Iterator(tarantool.IterEq).Key([]any{namespace}).Limit(1)
+	data, err := repo.execRead(req)
+	if errors.Is(err, ErrKeyNotFound) {
+		return Usage{}, nil
+	}
+	if err != nil {
+		return Usage{}, err
+	}
+
+	tuple, ok := data[0].([]any)
+	if !ok || len(tuple) < 3 {
+		return Usage{}, fmt.Errorf("unexpected usage tuple: %v", data[0])
+	}
+	keys, _ := toInt(tuple[1])
+	bytes, _ := toInt(tuple[2])
+	return Usage{Keys: keys, Bytes: bytes}, nil
+}
+
+// Snapshot makes the instance write a checkpoint with box.snapshot() and
+// returns the name of the .snap file holding it.
+func (repo *TarantoolRepository) Snapshot() (string, error) {
+	log.Logger.Debugw("Snapshot Tarantool")
+	data, err := repo.callFunction("kv_api.snapshot")
+	if err != nil {
+		return "", err
+	}
+	signature, ok := toInt(data[0])
+	if !ok {
+		return "", fmt.Errorf("unexpected snapshot result: %v", data[0])
+	}
+	return fmt.Sprintf("%020d.snap", signature), nil
+}
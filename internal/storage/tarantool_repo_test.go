@@ -2,11 +2,17 @@ package storage_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/tarantool/go-tarantool/v2"
 
+	"kvManager/internal/migrations"
 	"kvManager/internal/pkg/log"
 	"kvManager/internal/storage"
 )
@@ -19,11 +25,22 @@ type Case struct {
 	expectedError error
 }
 
-func TestTarantoolRepo(t *testing.T) {
-	dialer := tarantool.NetDialer{
-		Address: ":3301",
-		User:    "guest",
+// testDialer connects as TARANTOOL_ADMIN_USER, since the tests migrate
+// and push the Lua module, and as guest when it is not set.
+func testDialer() tarantool.NetDialer {
+	user := os.Getenv("TARANTOOL_ADMIN_USER")
+	if user == "" {
+		user = "guest"
+	}
+	return tarantool.NetDialer{
+		Address:  ":3301",
+		User:     user,
+		Password: os.Getenv("TARANTOOL_ADMIN_PASSWORD"),
 	}
+}
+
+func TestTarantoolRepo(t *testing.T) {
+	dialer := testDialer()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -44,7 +61,17 @@ func TestTarantoolRepo(t *testing.T) {
 		t.Errorf("failed to initialize logger: %v", err)
 		return
 	}
+	err = migrations.NewMigrator(conn, migrations.All).Up()
+	if err != nil {
+		t.Errorf("failed to migrate: %v", err)
+		return
+	}
 	repo := storage.NewTarantoolRepository(conn)
+	err = repo.EnsureModule()
+	if err != nil {
+		t.Errorf("failed to load lua module: %v", err)
+		return
+	}
 	cases := []Case{
 		{
 			key:           "test",
@@ -120,3 +147,507 @@ func TestTarantoolRepo(t *testing.T) {
 		})
 	}
 }
+
+func TestTarantoolIndexes(t *testing.T) {
+	dialer := testDialer()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := tarantool.Connect(ctx, dialer, tarantool.Opts{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Errorf("Failed to connect: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	err = log.SetupLogger()
+	if err != nil {
+		t.Errorf("failed to initialize logger: %v", err)
+		return
+	}
+	err = migrations.NewMigrator(conn, migrations.All).Up()
+	if err != nil {
+		t.Errorf("failed to migrate: %v", err)
+		return
+	}
+	repo := storage.NewTarantoolRepository(conn)
+	err = repo.EnsureModule()
+	if err != nil {
+		t.Errorf("failed to load lua module: %v", err)
+		return
+	}
+
+	def := storage.IndexDefinition{Name: "test_by_age", Path: "value.age", Type: "unsigned"}
+	err = repo.CreateIndex(def)
+	if err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	defer func() {
+		_ = repo.DropIndex(def.Name)
+	}()
+
+	for i, age := range []uint64{10, 20, 30, 40} {
+		key := fmt.Sprintf("idx_test_%d", i)
+		err = repo.AddValue(key, map[string]any{"age": age})
+		if err != nil {
+			t.Fatalf("Failed to add %s: %v", key, err)
+		}
+		defer repo.DeleteValue(key)
+	}
+
+	eq := "20"
+	cases := []struct {
+		name     string
+		query    storage.IndexQuery
+		expected int
+	}{
+		{"eq", storage.IndexQuery{Index: def.Name, Eq: &eq}, 1},
+		{"ge", storage.IndexQuery{Index: def.Name, From: &storage.Bound{Value: "20", Inclusive: true}}, 3},
+		{"gt and le", storage.IndexQuery{Index: def.Name,
+			From: &storage.Bound{Value: "10"}, To: &storage.Bound{Value: "30", Inclusive: true}}, 2},
+		{"lt", storage.IndexQuery{Index: def.Name, To: &storage.Bound{Value: "30"}}, 2},
+	}
+
+	prices := storage.IndexDefinition{Name: "test_by_price", Path: "value.price", Type: "number"}
+	err = repo.CreateIndex(prices)
+	if err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	defer func() {
+		_ = repo.DropIndex(prices.Name)
+	}()
+	for i, raw := range []string{`{"price": 1.5}`, `{"price": 2}`, `{"price": 2.25}`, `{"price": 3.5}`} {
+		key := fmt.Sprintf("idx_price_%d", i)
+		value, err := storage.DecodeJSON([]byte(raw))
+		if err != nil {
+			t.Fatalf("Failed to decode %s: %v", raw, err)
+		}
+		err = repo.AddValue(key, value)
+		if err != nil {
+			t.Fatalf("Failed to add %s: %v", key, err)
+		}
+		defer repo.DeleteValue(key)
+	}
+	cases = append(cases, []struct {
+		name     string
+		query    storage.IndexQuery
+		expected int
+	}{
+		{"le with decimals", storage.IndexQuery{Index: prices.Name,
+			To: &storage.Bound{Value: "2.25", Inclusive: true}}, 3},
+		{"lt with decimals", storage.IndexQuery{Index: prices.Name, To: &storage.Bound{Value: "2.25"}}, 2},
+		{"ge and lt with decimals", storage.IndexQuery{Index: prices.Name,
+			From: &storage.Bound{Value: "1.5", Inclusive: true}, To: &storage.Bound{Value: "3"}}, 3},
+	}...)
+
+	for _, q := range cases {
+		t.Run(q.name, func(t *testing.T) {
+			data, err := repo.QueryIndex(q.query)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(data) != q.expected {
+				t.Errorf("Expected %d tuples, got %d", q.expected, len(data))
+			}
+		})
+	}
+}
+
+func TestTarantoolProcedures(t *testing.T) {
+	dialer := testDialer()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := tarantool.Connect(ctx, dialer, tarantool.Opts{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Errorf("Failed to connect: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	err = log.SetupLogger()
+	if err != nil {
+		t.Errorf("failed to initialize logger: %v", err)
+		return
+	}
+	err = migrations.NewMigrator(conn, migrations.All).Up()
+	if err != nil {
+		t.Errorf("failed to migrate: %v", err)
+		return
+	}
+	repo := storage.NewTarantoolRepository(conn).WithHistory(storage.HistoryConfig{Revisions: 2}).WithTrash(time.Hour)
+	err = repo.EnsureModule()
+	if err != nil {
+		t.Errorf("failed to load lua module: %v", err)
+		return
+	}
+
+	cases := []Case{
+		{
+			key:       "proc",
+			value:     map[string]any{"a": 1, "b": map[string]any{"c": 2}},
+			method:    "Add",
+			operation: repo.AddValue,
+		},
+		{
+			key:           "proc",
+			value:         "other",
+			method:        "CompareAndSet mismatch",
+			expectedError: storage.ErrValueMismatch,
+			operation: func(key string, value any) error {
+				return repo.CompareAndSet(key, "nope", value)
+			},
+		},
+		{
+			key:    "proc",
+			value:  map[string]any{"b": map[string]any{"c": nil, "d": 3}},
+			method: "Merge",
+			operation: func(key string, value any) error {
+				_, err := repo.MergeValue(key, value)
+				return err
+			},
+		},
+		{
+			key:    "proc",
+			value:  map[string]any{"a": 2},
+			method: "CompareAndSet",
+			operation: func(key string, value any) error {
+				return repo.CompareAndSet(key, map[string]any{"a": 1, "b": map[string]any{"d": 3}}, value)
+			},
+		},
+		{
+			key:    "proc",
+			method: "Expire",
+			operation: func(key string, value any) error {
+				return repo.ExpireValue(key, 10*time.Millisecond)
+			},
+		},
+		{
+			key:           "proc",
+			method:        "Get expired",
+			expectedError: storage.ErrKeyNotFound,
+			operation: func(key string, value any) error {
+				time.Sleep(20 * time.Millisecond)
+				_, err := repo.GetValue(key)
+				return err
+			},
+		},
+		{
+			key:           "proc",
+			value:         "new",
+			method:        "CompareAndSet missing",
+			expectedError: storage.ErrKeyNotFound,
+			operation: func(key string, value any) error {
+				return repo.CompareAndSet(key, "any", value)
+			},
+		},
+		{
+			key:    "proc",
+			value:  "put",
+			method: "Put",
+			operation: func(key string, value any) error {
+				created, err := repo.PutValue(key, value)
+				if err == nil && !created {
+					return fmt.Errorf("expected key to be created")
+				}
+				created, err = repo.PutValue(key, value)
+				if err == nil && created {
+					return fmt.Errorf("expected key to be replaced")
+				}
+				if err != nil {
+					return err
+				}
+				return repo.DeleteValue(key)
+			},
+		},
+		{
+			key:    "proc",
+			method: "Bulk",
+			operation: func(key string, value any) error {
+				for _, k := range []string{"proc_1", "proc_2"} {
+					err := repo.AddValue(k, k)
+					if err != nil {
+						return err
+					}
+				}
+				tuples, err := repo.GetValues([]string{"proc_1", "proc_2", "proc_3"})
+				if err != nil {
+					return err
+				}
+				if len(tuples) != 2 {
+					return fmt.Errorf("expected 2 tuples, got %d", len(tuples))
+				}
+				deleted, err := repo.DeleteValues([]string{"proc_1", "proc_2", "proc_3"})
+				if err != nil {
+					return err
+				}
+				if len(deleted) != 2 {
+					return fmt.Errorf("expected 2 deleted keys, got %v", deleted)
+				}
+				return nil
+			},
+		},
+		{
+			key:    "proc",
+			method: "Scan",
+			operation: func(key string, value any) error {
+				for _, k := range []string{"scan:1", "scan:2", "scan:3"} {
+					_, err := repo.PutValue(k, k)
+					if err != nil {
+						return err
+					}
+				}
+				defer repo.DeleteValues([]string{"scan:1", "scan:2", "scan:3"})
+
+				tuples, err := repo.ScanValues(storage.ScanQuery{Prefix: "scan:", After: "scan:1", Limit: 5})
+				if err != nil {
+					return err
+				}
+				if len(tuples) != 2 {
+					return fmt.Errorf("expected 2 tuples, got %v", tuples)
+				}
+				return nil
+			},
+		},
+		{
+			key:    "history",
+			method: "History",
+			operation: func(key string, value any) error {
+				for _, v := range []string{"v1", "v2", "v2", "v3"} {
+					_, err := repo.PutValue(key, v)
+					if err != nil {
+						return err
+					}
+				}
+				defer repo.DeleteValue(key)
+
+				revisions, err := repo.GetHistory(storage.HistoryQuery{Key: key})
+				if err != nil {
+					return err
+				}
+				if len(revisions) != 2 || revisions[0].Value != "v3" || revisions[1].Value != "v2" {
+					return fmt.Errorf("expected the last 2 revisions, got %+v", revisions)
+				}
+				revision, err := repo.GetRevisionAt(key, time.Now())
+				if err != nil {
+					return err
+				}
+				if revision.Revision != revisions[0].Revision {
+					return fmt.Errorf("expected revision %d, got %+v", revisions[0].Revision, revision)
+				}
+				_, err = repo.GetRevision(key, revisions[1].Revision-1)
+				if !errors.Is(err, storage.ErrRevisionNotFound) {
+					return fmt.Errorf("expected a pruned revision, got %v", err)
+				}
+				return nil
+			},
+		},
+		{
+			key:    "trash",
+			value:  "trashed",
+			method: "Trash",
+			operation: func(key string, value any) error {
+				_, err := repo.PutValue(key, value)
+				if err != nil {
+					return err
+				}
+				err = repo.Annotate(key, "tester", map[string]string{"team": "core"})
+				if err != nil {
+					return err
+				}
+				before, err := repo.GetValue(key)
+				if err != nil {
+					return err
+				}
+				err = repo.DeleteValue(key)
+				if err != nil {
+					return err
+				}
+				_, err = repo.GetValue(key)
+				if !errors.Is(err, storage.ErrKeyNotFound) {
+					return fmt.Errorf("expected a trashed key to be hidden, got %v", err)
+				}
+				entries, err := repo.ListTrash(storage.ScanQuery{Prefix: key})
+				if err != nil {
+					return err
+				}
+				if len(entries) != 1 || entries[0].Value != value {
+					return fmt.Errorf("expected the key in the trash, got %+v", entries)
+				}
+				err = repo.Undelete(key)
+				if err != nil {
+					return err
+				}
+				after, err := repo.GetValue(key)
+				if err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(after, before) {
+					return fmt.Errorf("expected the tuple to be undeleted as is, got %v, want %v", after, before)
+				}
+				err = repo.DeleteValue(key)
+				if err != nil {
+					return err
+				}
+				purged, err := repo.PurgeTrash(time.Now().Add(2*time.Hour), storage.DefaultPurgeBatch)
+				if err != nil {
+					return err
+				}
+				if purged == 0 {
+					return fmt.Errorf("expected the key to be purged")
+				}
+				return repo.Undelete(key)
+			},
+			expectedError: storage.ErrKeyNotFound,
+		},
+		{
+			key:    "meta",
+			value:  "v1",
+			method: "Metadata",
+			operation: func(key string, value any) error {
+				_, err := repo.PutValue(key, value)
+				if err != nil {
+					return err
+				}
+				defer repo.DeleteValue(key)
+				err = repo.Annotate(key, "tester", map[string]string{"team": "core"})
+				if err != nil {
+					return err
+				}
+				_, err = repo.PutValue(key, "v2")
+				if err != nil {
+					return err
+				}
+
+				data, err := repo.GetValue(key)
+				if err != nil {
+					return err
+				}
+				meta := storage.TupleMetadata(data[0].([]any))
+				if meta.CreatedAt.IsZero() || meta.UpdatedAt.Before(meta.CreatedAt) || meta.Size == 0 {
+					return fmt.Errorf("expected timestamps and size, got %+v", meta)
+				}
+				if meta.Writer != "" || meta.Labels["team"] != "core" {
+					return fmt.Errorf("expected the writer to be dropped and the labels kept, got %+v", meta)
+				}
+				err = repo.Annotated(storage.Annotation{Writer: "tester"}).UpdateValue(key, "v3")
+				if err != nil {
+					return err
+				}
+				data, err = repo.GetValue(key)
+				if err != nil {
+					return err
+				}
+				meta = storage.TupleMetadata(data[0].([]any))
+				if meta.Writer != "tester" || meta.Labels["team"] != "core" {
+					return fmt.Errorf("expected the writer to be set with the value, got %+v", meta)
+				}
+				return repo.Annotate("meta:missing", "tester", nil)
+			},
+			expectedError: storage.ErrKeyNotFound,
+		},
+		{
+			key:    "versioned",
+			value:  "a",
+			method: "CompareVersionAndSet",
+			operation: func(key string, value any) error {
+				err := repo.AddValue(key, value)
+				if err != nil {
+					return err
+				}
+				data, err := repo.GetValue(key)
+				if err != nil {
+					return err
+				}
+				version := storage.TupleVersion(data[0].([]any))
+				if version == 0 {
+					return fmt.Errorf("expected a version")
+				}
+				err = repo.UpdateValue(key, "b")
+				if err != nil {
+					return err
+				}
+				err = repo.UpdateValue(key, value)
+				if err != nil {
+					return err
+				}
+				err = repo.CompareVersionAndSet(key, version, "c")
+				if !errors.Is(err, storage.ErrValueMismatch) {
+					return fmt.Errorf("expected a mismatch after the value was written back, got %v", err)
+				}
+				data, err = repo.GetValue(key)
+				if err != nil {
+					return err
+				}
+				err = repo.CompareVersionAndSet(key, storage.TupleVersion(data[0].([]any)), "c")
+				if err != nil {
+					return err
+				}
+				return repo.DeleteValue(key)
+			},
+		},
+		{
+			key:    "backup",
+			value:  "a",
+			method: "FreezeBackup",
+			operation: func(key string, value any) error {
+				err := repo.AddValue(key, value)
+				if err != nil {
+					return err
+				}
+				defer repo.DeleteValue(key)
+				defer repo.ClearBackup()
+				frozen, err := repo.FreezeBackup()
+				if err != nil {
+					return err
+				}
+				if frozen == 0 {
+					return fmt.Errorf("expected frozen tuples")
+				}
+				tuples, err := repo.ScanBackup(storage.ScanQuery{Prefix: key, Limit: 1})
+				if err != nil {
+					return err
+				}
+				if len(tuples) != 1 || storage.TupleVersion(tuples[0].([]any)) == 0 {
+					return fmt.Errorf("expected the frozen tuple with its metadata, got %v", tuples)
+				}
+				err = repo.StageBackup(tuples)
+				if err != nil {
+					return err
+				}
+				_, err = repo.CommitBackup()
+				return err
+			},
+			expectedError: storage.ErrNotEmpty,
+		},
+		{
+			key:    "snapshot",
+			method: "Snapshot",
+			operation: func(key string, value any) error {
+				name, err := repo.Snapshot()
+				if err != nil {
+					return err
+				}
+				if !strings.HasSuffix(name, ".snap") {
+					return fmt.Errorf("unexpected snapshot name %q", name)
+				}
+				return nil
+			},
+		},
+	}
+
+	for _, q := range cases {
+		t.Run(q.key+" "+q.method, func(t *testing.T) {
+			err := q.operation(q.key, q.value)
+			if q.expectedError != nil {
+				if err == nil || err.Error() != q.expectedError.Error() {
+					t.Errorf("Expected error '%v', got '%v'", q.expectedError, err)
+				}
+			} else if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tarantool/go-tarantool/v2"
+
+	"kvManager/internal/pkg/log"
+)
+
+// ListTrash pages through TrashSpace in key order. Entries whose TTL
+// passed since the deletion cannot be undeleted and are skipped.
+func (repo *TarantoolRepository) ListTrash(query ScanQuery) ([]TrashEntry, error) {
+	log.Logger.Debugw("List trash in Tarantool",
+		"after", query.After, "prefix", query.Prefix)
+	iter, key, limit := query.plan()
+	entries := make([]TrashEntry, 0, limit)
+	for {
+		req := tarantool.NewSelectRequest(TrashSpace).Index(PrimaryIndex).
+			Iterator(iter).Key([]any{key}).Limit(limit)
+		data, err := repo.execRead(req)
+		if errors.Is(err, ErrKeyNotFound) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		page, more := query.filter(data, false)
+		for _, tuple := range page {
+			if uint32(len(entries)) == limit {
+				return entries, nil
+			}
+			entry, err := trashEntry(tuple)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+		if !more || uint32(len(data)) < limit {
+			return entries, nil
+		}
+		iter, key = tarantool.IterGt, data[len(data)-1].([]any)[0].(string)
+	}
+}
+
+func (repo *TarantoolRepository) Undelete(key string) error {
+	log.Logger.Debugw("Undelete value in Tarantool",
+		"key", key)
+	data, err := repo.callFunction("kv_api.undelete", key)
+	if err != nil {
+		return err
+	}
+
+	switch data[0] {
+	case "ok":
+		return nil
+	case "exists":
+		return ErrKeyExists
+	case "not_found":
+		return ErrKeyNotFound
+	}
+	return fmt.Errorf("unexpected undelete result: %v", data[0])
+}
+
+func (repo *TarantoolRepository) PurgeTrash(now time.Time, limit uint32) (int, error) {
+	log.Logger.Debugw("Purge trash in Tarantool",
+		"now", now, "limit", limit)
+	data, err := repo.callFunction("kv_api.purge_trash",
+		float64(now.UnixNano())/float64(time.Second), limit)
+	if err != nil {
+		return 0, err
+	}
+	purged, ok := toInt(data[0])
+	if !ok {
+		return 0, fmt.Errorf("unexpected purge_trash result: %v", data[0])
+	}
+	return int(purged), nil
+}
+
+// trashEntry decodes a {key, value, expires_at, deleted_at, purge_at,
+// tuple} tuple.
+func trashEntry(item any) (TrashEntry, error) {
+	tuple, ok := item.([]any)
+	if !ok || len(tuple) < 5 {
+		return TrashEntry{}, fmt.Errorf("unexpected trash tuple: %v", item)
+	}
+	key, _ := tuple[0].(string)
+	deletedAt, ok := toFloat(tuple[3])
+	if !ok {
+		return TrashEntry{}, fmt.Errorf("unexpected deletion time: %v", tuple[3])
+	}
+	purgeAt, ok := toFloat(tuple[4])
+	if !ok {
+		return TrashEntry{}, fmt.Errorf("unexpected purge time: %v", tuple[4])
+	}
+	return TrashEntry{
+		Key:       key,
+		Value:     tuple[1],
+		DeletedAt: time.Unix(0, int64(deletedAt*float64(time.Second))).UTC(),
+		PurgeAt:   time.Unix(0, int64(purgeAt*float64(time.Second))).UTC(),
+	}, nil
+}
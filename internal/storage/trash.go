@@ -0,0 +1,14 @@
+package storage
+
+import "time"
+
+// TrashEntry is a deleted key kept for undelete until PurgeAt.
+type TrashEntry struct {
+	Key       string
+	Value     any
+	DeletedAt time.Time
+	PurgeAt   time.Time
+}
+
+// DefaultPurgeBatch is the number of trash entries removed per request.
+const DefaultPurgeBatch uint32 = 1000
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Usage is the number of keys in a namespace and the total size of their
+// values in MessagePack encoding.
+type Usage struct {
+	Keys  int64 `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+// Namespace returns the part of key before the first ':', or "" for keys
+// without one.
+func Namespace(key string) string {
+	namespace, _, found := strings.Cut(key, ":")
+	if !found {
+		return ""
+	}
+	return namespace
+}
+
+// ValueSize returns the encoded size of value as accounted in Usage.
+func ValueSize(value any) (int64, error) {
+	data, err := msgpack.Marshal(value)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/tarantool/go-tarantool/v2/decimal"
+
+	"kvManager/internal/pkg/log"
+)
+
+// decimalPrecision is the number of significant digits a Tarantool
+// decimal can hold.
+const decimalPrecision = 38
+
+// JSONValue converts a value decoded from Tarantool into one that
+// encoding/json can marshal without losing precision: maps get string
+// keys and decimals become json.Number.
+func JSONValue(value any) (any, error) {
+	switch v := value.(type) {
+	case map[any]any:
+		converted := make(map[string]any, len(v))
+		for key, nested := range v {
+			strKey, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("map key %v is not a string", key)
+			}
+			nestedValue, err := JSONValue(nested)
+			if err != nil {
+				return nil, err
+			}
+			converted[strKey] = nestedValue
+		}
+		return converted, nil
+	case map[string]any:
+		converted := make(map[string]any, len(v))
+		for key, nested := range v {
+			nestedValue, err := JSONValue(nested)
+			if err != nil {
+				return nil, err
+			}
+			converted[key] = nestedValue
+		}
+		return converted, nil
+	case []any:
+		converted := make([]any, len(v))
+		for i, nested := range v {
+			nestedValue, err := JSONValue(nested)
+			if err != nil {
+				return nil, err
+			}
+			converted[i] = nestedValue
+		}
+		return converted, nil
+	case decimal.Decimal:
+		return json.Number(v.String()), nil
+	case *decimal.Decimal:
+		return json.Number(v.String()), nil
+	}
+	return value, nil
+}
+
+// DecodeJSON parses a JSON encoded value into types that keep their
+// precision in Tarantool. An empty raw value decodes to nil. Numbers that
+// cannot be stored without losing precision are rejected.
+func DecodeJSON(raw []byte) (any, error) {
+	var value any
+	if len(raw) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		err := decoder.Decode(&value)
+		if err != nil {
+			return nil, err
+		}
+		if decoder.More() {
+			return nil, errors.New("unexpected data after value")
+		}
+	}
+	return convertNumbers(value)
+}
+
+// convertNumbers replaces json.Number values produced by a UseNumber decoder
+// with types that survive a msgpack round trip: integers become int64 or
+// uint64 and everything else becomes a Tarantool decimal when it fits.
+func convertNumbers(val any) (any, error) {
+	switch v := val.(type) {
+	case json.Number:
+		return parseNumber(v)
+	case map[string]any:
+		for key, nested := range v {
+			converted, err := convertNumbers(nested)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = converted
+		}
+		return v, nil
+	case []any:
+		for i, nested := range v {
+			converted, err := convertNumbers(nested)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+		return v, nil
+	}
+	return val, nil
+}
+
+// parseNumber falls back to a double for numbers that do not fit a
+// decimal, as long as the double reads back as the same number. Others,
+// like 1e400 or integers with more digits than a decimal holds, would be
+// stored rounded or as an infinity and are an error.
+func parseNumber(num json.Number) (any, error) {
+	str := num.String()
+	if i, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return i, nil
+	}
+	if u, err := strconv.ParseUint(str, 10, 64); err == nil {
+		return u, nil
+	}
+	dec, err := decimal.MakeDecimalFromString(str)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %s: %w", str, err)
+	}
+	if fitsDecimal(dec) {
+		return dec, nil
+	}
+
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("number %s is out of range", str)
+	}
+	double, err := decimal.MakeDecimalFromString(strconv.FormatFloat(f, 'g', -1, 64))
+	if err != nil || !double.Equal(dec.Decimal) {
+		return nil, fmt.Errorf("number %s cannot be stored without losing precision", str)
+	}
+	log.Logger.Debugw("Number does not fit Tarantool decimal, storing as double",
+		"number", str)
+	return f, nil
+}
+
+// fitsDecimal reports whether dec can be stored as a Tarantool decimal,
+// which holds at most decimalPrecision significant digits.
+func fitsDecimal(dec decimal.Decimal) bool {
+	digits := len(dec.Coefficient().String())
+	if dec.Coefficient().Sign() < 0 {
+		digits--
+	}
+	exp := int(dec.Exponent())
+	if exp > 0 {
+		digits += exp
+	} else if -exp > digits {
+		digits = -exp
+	}
+	return digits <= decimalPrecision
+}
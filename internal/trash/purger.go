@@ -0,0 +1,57 @@
+// Package trash runs the job that removes soft deleted keys once their
+// retention ended.
+package trash
+
+import (
+	"context"
+	"time"
+
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+// Purger periodically purges the trash of a repository in batches of
+// storage.DefaultPurgeBatch entries.
+type Purger struct {
+	repo     storage.TrashRepository
+	interval time.Duration
+}
+
+func NewPurger(repo storage.TrashRepository, interval time.Duration) *Purger {
+	return &Purger{repo: repo, interval: interval}
+}
+
+// PurgeOnce removes every entry whose retention ended before now and
+// returns their number.
+func (purger *Purger) PurgeOnce(now time.Time) (int, error) {
+	total := 0
+	for {
+		purged, err := purger.repo.PurgeTrash(now, storage.DefaultPurgeBatch)
+		total += purged
+		if err != nil || uint32(purged) < storage.DefaultPurgeBatch {
+			return total, err
+		}
+	}
+}
+
+// Run purges the trash every interval until ctx is done. Failures are
+// logged and retried on the next tick.
+func (purger *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(purger.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			purged, err := purger.PurgeOnce(now)
+			if err != nil {
+				log.Logger.Warnw("Trash purge failed", "purged", purged, "error", err.Error())
+				continue
+			}
+			if purged > 0 {
+				log.Logger.Infow("Trash purged", "purged", purged)
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package trash_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+	"kvManager/internal/trash"
+)
+
+func TestPurger(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	repo := storage.NewMemoryRepository().WithTrash(time.Hour)
+	for _, key := range []string{"a", "b", "c"} {
+		err = repo.AddValue(key, key)
+		if err != nil {
+			t.Fatalf("AddValue: %v", err)
+		}
+	}
+	err = repo.DeleteValue("a")
+	if err != nil {
+		t.Fatalf("DeleteValue: %v", err)
+	}
+	_, err = repo.DeleteValues([]string{"b", "c"})
+	if err != nil {
+		t.Fatalf("DeleteValues: %v", err)
+	}
+
+	purger := trash.NewPurger(repo, time.Millisecond)
+	testCases := []struct {
+		name     string
+		now      time.Time
+		expected int
+		trash    int
+	}{
+		{name: "within retention", now: time.Now(), expected: 0, trash: 3},
+		{name: "after retention", now: time.Now().Add(2 * time.Hour), expected: 3, trash: 0},
+		{name: "empty", now: time.Now().Add(2 * time.Hour), expected: 0, trash: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			purged, err := purger.PurgeOnce(tc.now)
+			if err != nil {
+				t.Fatalf("PurgeOnce: %v", err)
+			}
+			if purged != tc.expected {
+				t.Errorf("Expected %d purged, got %d", tc.expected, purged)
+			}
+			entries, err := repo.ListTrash(storage.ScanQuery{})
+			if err != nil {
+				t.Fatalf("ListTrash: %v", err)
+			}
+			if len(entries) != tc.trash {
+				t.Errorf("Expected %d trash entries, got %d", tc.trash, len(entries))
+			}
+		})
+	}
+
+	err = repo.Undelete("a")
+	if !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Errorf("Expected purged key to be gone, got %v", err)
+	}
+
+	short := storage.NewMemoryRepository().WithTrash(time.Nanosecond)
+	err = short.AddValue("a", 1)
+	if err == nil {
+		err = short.DeleteValue("a")
+	}
+	if err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go trash.NewPurger(short, time.Millisecond).Run(ctx)
+	for {
+		entries, _ := short.ListTrash(storage.ScanQuery{})
+		if len(entries) == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Expected Run to purge the trash")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+)
+
+var ErrSchemaNotFound = errors.New("schema not found")
+
+// CompileError is returned by Set for a schema document that is not a
+// valid JSON Schema, as opposed to a failure to store it.
+type CompileError struct {
+	Err error
+}
+
+func (e *CompileError) Error() string { return e.Err.Error() }
+
+func (e *CompileError) Unwrap() error { return e.Err }
+
+type entry struct {
+	raw    string
+	schema *jsonschema.Schema
+}
+
+// Registry keeps compiled JSON Schemas for key prefixes. Schemas are
+// persisted through storage.SchemaRepository and cached in memory; Run
+// reloads them so changes made through other instances are picked up.
+type Registry struct {
+	repo    storage.SchemaRepository
+	mu      sync.RWMutex
+	schemas map[string]entry
+	// version counts the local changes so a Load that read the
+	// repository before one of them does not undo it.
+	version uint64
+}
+
+func NewRegistry(repo storage.SchemaRepository) *Registry {
+	return &Registry{repo: repo, schemas: make(map[string]entry)}
+}
+
+// Load replaces the cached schemas with the ones stored in the repository.
+func (reg *Registry) Load() error {
+	reg.mu.RLock()
+	version := reg.version
+	reg.mu.RUnlock()
+
+	stored, err := reg.repo.GetSchemas()
+	if err != nil {
+		return err
+	}
+
+	schemas := make(map[string]entry, len(stored))
+	for prefix, raw := range stored {
+		schema, err := compile(prefix, raw)
+		if err != nil {
+			log.Logger.Errorw("Stored schema is invalid", "prefix", prefix, "error", err)
+			return err
+		}
+		schemas[prefix] = entry{raw: raw, schema: schema}
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.version != version {
+		log.Logger.Debugw("Schemas changed while loading, keeping them")
+		return nil
+	}
+	reg.schemas = schemas
+	log.Logger.Debugw("Schemas loaded", "count", len(schemas))
+	return nil
+}
+
+// Run reloads the schemas every interval until ctx is done. A failed
+// reload keeps the current schemas and is retried on the next tick.
+func (reg *Registry) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := reg.Load()
+			if err != nil {
+				log.Logger.Warnw("Schema reload failed", "error", err.Error())
+			}
+		}
+	}
+}
+
+// Set compiles raw and registers it for prefix, replacing any previous schema.
+func (reg *Registry) Set(prefix string, raw string) error {
+	schema, err := compile(prefix, raw)
+	if err != nil {
+		return &CompileError{Err: err}
+	}
+	err = reg.repo.PutSchema(prefix, raw)
+	if err != nil {
+		return err
+	}
+
+	reg.mu.Lock()
+	reg.schemas[prefix] = entry{raw: raw, schema: schema}
+	reg.version++
+	reg.mu.Unlock()
+	return nil
+}
+
+func (reg *Registry) Delete(prefix string) error {
+	err := reg.repo.DeleteSchema(prefix)
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return ErrSchemaNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	reg.mu.Lock()
+	delete(reg.schemas, prefix)
+	reg.version++
+	reg.mu.Unlock()
+	return nil
+}
+
+// List returns the raw schema documents keyed by prefix.
+func (reg *Registry) List() map[string]string {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	schemas := make(map[string]string, len(reg.schemas))
+	for prefix, e := range reg.schemas {
+		schemas[prefix] = e.raw
+	}
+	return schemas
+}
+
+// Validate checks value against the schema registered for the longest
+// prefix of key. It returns the list of validation errors, or nil when
+// the value is valid or no schema applies.
+func (reg *Registry) Validate(key string, value any) []string {
+	reg.mu.RLock()
+	prefix, e, ok := reg.match(key)
+	reg.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	err := e.schema.Validate(value)
+	if err == nil {
+		return nil
+	}
+	log.Logger.Debugw("Value does not match schema", "key", key, "prefix", prefix)
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return []string{err.Error()}
+	}
+
+	var details []string
+	for _, unit := range validationErr.BasicOutput().Errors {
+		if unit.Error == nil {
+			continue
+		}
+		location := unit.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		details = append(details, fmt.Sprintf("%s: %s", location, unit.Error.String()))
+	}
+	if len(details) == 0 {
+		details = append(details, validationErr.Error())
+	}
+	sort.Strings(details)
+	return details
+}
+
+func (reg *Registry) match(key string) (string, entry, bool) {
+	var (
+		best    string
+		matched entry
+		found   bool
+	)
+	for prefix, e := range reg.schemas {
+		if strings.HasPrefix(key, prefix) && (!found || len(prefix) > len(best)) {
+			best, matched, found = prefix, e, true
+		}
+	}
+	return best, matched, found
+}
+
+func compile(prefix string, raw string) (*jsonschema.Schema, error) {
+	doc, err := jsonschema.UnmarshalJSON(strings.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("schema for prefix %q is not valid JSON: %w", prefix, err)
+	}
+
+	location := "kv:///schemas/" + url.PathEscape(prefix)
+	compiler := jsonschema.NewCompiler()
+	err = compiler.AddResource(location, doc)
+	if err != nil {
+		return nil, err
+	}
+	return compiler.Compile(location)
+}
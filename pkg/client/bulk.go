@@ -0,0 +1,186 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// ndjsonContentType is the media type of export and import bodies.
+const ndjsonContentType = "application/x-ndjson"
+
+// ExportOptions selects the entries of an export.
+type ExportOptions struct {
+	Prefix string
+	// After resumes an interrupted export after the last key received.
+	After string
+}
+
+// Export streams every entry matching opts in key order and calls fn for
+// each of them. An export cut short by the server or the network returns
+// an error; it can be resumed by setting After to the last key seen.
+func (c *Client) Export(ctx context.Context, opts ExportOptions, fn func(Item) error) error {
+	query := url.Values{}
+	setParam(query, "prefix", opts.Prefix)
+	setParam(query, "after", opts.After)
+
+	resp, err := c.open(ctx, http.MethodGet, "/kv/_export", query, nil, "", ndjsonContentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var item Item
+		err = decoder.Decode(&item)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("kvstorage: export: %w", err)
+		}
+		err = fn(item)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ImportMode tells Import what to do with keys that already exist.
+type ImportMode string
+
+const (
+	// ImportFail stops the import at the first existing key or rejected
+	// entry. It is the server default.
+	ImportFail ImportMode = "fail"
+	// ImportSkip keeps existing keys as they are.
+	ImportSkip ImportMode = "skip"
+	// ImportOverwrite replaces existing keys.
+	ImportOverwrite ImportMode = "overwrite"
+)
+
+// ImportOptions configures Import.
+type ImportOptions struct {
+	Mode ImportMode
+	// Progress, when set, is called with the number of lines sent so far
+	// as the body is uploaded.
+	Progress func(lines int64)
+	// Imported, when set, is called with the counts of the server as it
+	// imports, which then streams its progress.
+	Imported func(summary ImportSummary)
+}
+
+// ImportError is an entry the server did not import.
+type ImportError struct {
+	Line    int64    `json:"line"`
+	Key     string   `json:"key,omitempty"`
+	Error   string   `json:"error"`
+	Details []string `json:"details,omitempty"`
+}
+
+// ImportSummary counts the entries of an import. Error tells why the
+// import stopped early and Errors lists the first rejected lines.
+type ImportSummary struct {
+	Processed int64         `json:"processed"`
+	Created   int64         `json:"created"`
+	Replaced  int64         `json:"replaced"`
+	Skipped   int64         `json:"skipped"`
+	Failed    int64         `json:"failed"`
+	Errors    []ImportError `json:"errors,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Import streams r, NDJSON lines of {"key": ..., "value": ...} as written
+// by Export, to the server. It is not retried since r is read once. When
+// the import stops early the summary of what was done is returned along
+// with the *APIError.
+func (c *Client) Import(ctx context.Context, r io.Reader, opts ImportOptions) (*ImportSummary, error) {
+	query := url.Values{}
+	setParam(query, "mode", string(opts.Mode))
+	if opts.Progress != nil {
+		r = &lineCounter{r: r, progress: opts.Progress}
+	}
+
+	if opts.Imported != nil {
+		return c.importStream(ctx, query, r, opts.Imported)
+	}
+	resp, err := c.open(ctx, http.MethodPost, "/kv/_import", query, r, ndjsonContentType, "application/json")
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		var summary ImportSummary
+		if json.Unmarshal(apiErr.body, &summary) == nil && summary.Processed > 0 {
+			return &summary, err
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var summary ImportSummary
+	err = json.NewDecoder(bufio.NewReader(resp.Body)).Decode(&summary)
+	if err != nil {
+		return nil, fmt.Errorf("kvstorage: decode response: %w", err)
+	}
+	return &summary, nil
+}
+
+// importStream runs an import whose progress the server streams as NDJSON
+// lines, the last of them holding the summary and the status.
+func (c *Client) importStream(ctx context.Context, query url.Values, r io.Reader,
+	imported func(ImportSummary)) (*ImportSummary, error) {
+	resp, err := c.open(ctx, http.MethodPost, "/kv/_import", query, r, ndjsonContentType, ndjsonContentType)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var progress struct {
+			ImportSummary
+			Done   bool `json:"done"`
+			Status int  `json:"status"`
+		}
+		err = decoder.Decode(&progress)
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("kvstorage: import: response ended before the summary")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("kvstorage: decode response: %w", err)
+		}
+		if !progress.Done {
+			imported(progress.ImportSummary)
+			continue
+		}
+		summary := progress.ImportSummary
+		if progress.Status >= http.StatusBadRequest {
+			return &summary, &APIError{StatusCode: progress.Status, Message: summary.Error}
+		}
+		return &summary, nil
+	}
+}
+
+// lineCounter reports the number of lines read through it.
+type lineCounter struct {
+	r        io.Reader
+	lines    int64
+	progress func(lines int64)
+}
+
+func (lc *lineCounter) Read(p []byte) (int, error) {
+	n, err := lc.r.Read(p)
+	if count := bytes.Count(p[:n], []byte("\n")); count > 0 {
+		lc.lines += int64(count)
+		lc.progress(lc.lines)
+	}
+	return n, err
+}
@@ -0,0 +1,447 @@
+// Package client is a Go client for the kvStorage HTTP API.
+//
+//	c, err := client.New("http://localhost:8080", client.WithAPIKey("secret"))
+//	err = c.Add(ctx, "user:1", User{Name: "Ann"})
+//	user, err := client.GetAs[User](ctx, c, "user:1")
+//	if errors.Is(err, client.ErrKeyNotFound) { ... }
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIKeyHeader carries the API key set with WithAPIKey.
+const APIKeyHeader = "X-API-Key"
+
+// Client calls a kvStorage server. It is safe for concurrent use.
+type Client struct {
+	baseURL       *url.URL
+	httpClient    *http.Client
+	apiKey        string
+	retries       int
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+}
+
+type Option func(*Client)
+
+// WithHTTPClient replaces http.DefaultClient.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithAPIKey sends key in the X-API-Key header of every request.
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithRetries sets how many times idempotent requests are repeated after
+// network errors, 429 and 502-504 responses. Attempt n waits a random
+// duration up to delay*2^n or the Retry-After of the response, capped at
+// maxDelay. The default is 2 retries starting at 100ms up to 2s.
+func WithRetries(retries int, delay time.Duration, maxDelay time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.retryDelay = delay
+		c.maxRetryDelay = maxDelay
+	}
+}
+
+// New creates a client for the server at baseURL, e.g. http://kv:8080.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("kvstorage: base URL %q must be absolute", baseURL)
+	}
+
+	c := &Client{
+		baseURL:       u,
+		httpClient:    http.DefaultClient,
+		retries:       2,
+		retryDelay:    100 * time.Millisecond,
+		maxRetryDelay: 2 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Item is a stored entry with its value left encoded; use Decode or the
+// *As functions to unmarshal it.
+type Item struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+type valueBody struct {
+	Key   string `json:"key,omitempty"`
+	Value any    `json:"value"`
+}
+
+type valueResponse struct {
+	Value json.RawMessage `json:"value"`
+}
+
+type keysBody struct {
+	Keys []string `json:"keys"`
+}
+
+type batchResponse struct {
+	Items map[string]struct {
+		Found bool            `json:"found"`
+		Value json.RawMessage `json:"value"`
+	} `json:"items"`
+}
+
+// Get returns the encoded value of key.
+func (c *Client) Get(ctx context.Context, key string) (json.RawMessage, error) {
+	var resp valueResponse
+	_, err := c.do(ctx, http.MethodGet, keyPath(key), nil, nil, true, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Value, nil
+}
+
+// Add creates key. It fails with ErrConflict when the key exists.
+func (c *Client) Add(ctx context.Context, key string, value any) error {
+	_, err := c.do(ctx, http.MethodPost, keyPath(key), nil, valueBody{Value: value}, false, nil)
+	return err
+}
+
+// Update replaces the value of an existing key.
+func (c *Client) Update(ctx context.Context, key string, value any) error {
+	_, err := c.do(ctx, http.MethodPut, keyPath(key), nil, valueBody{Value: value}, true, nil)
+	return err
+}
+
+// Put creates or replaces key and reports whether it was created.
+func (c *Client) Put(ctx context.Context, key string, value any) (bool, error) {
+	query := url.Values{"upsert": {"true"}}
+	status, err := c.do(ctx, http.MethodPut, keyPath(key), query, valueBody{Value: value}, true, nil)
+	if err != nil {
+		return false, err
+	}
+	return status == http.StatusCreated, nil
+}
+
+// Delete removes key.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	_, err := c.do(ctx, http.MethodDelete, keyPath(key), nil, nil, true, nil)
+	return err
+}
+
+// MultiGet returns the encoded values of the keys that exist.
+func (c *Client) MultiGet(ctx context.Context, keys []string) (map[string]json.RawMessage, error) {
+	var resp batchResponse
+	_, err := c.do(ctx, http.MethodPost, "/kv/_mget", nil, keysBody{Keys: keys}, true, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]json.RawMessage, len(resp.Items))
+	for key, item := range resp.Items {
+		if item.Found {
+			values[key] = item.Value
+		}
+	}
+	return values, nil
+}
+
+// MultiDelete removes keys and returns the ones that existed.
+func (c *Client) MultiDelete(ctx context.Context, keys []string) ([]string, error) {
+	var resp batchResponse
+	_, err := c.do(ctx, http.MethodPost, "/kv/_mdelete", nil, keysBody{Keys: keys}, true, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := make([]string, 0, len(resp.Items))
+	for _, key := range keys {
+		if resp.Items[key].Found {
+			deleted = append(deleted, key)
+		}
+	}
+	return deleted, nil
+}
+
+// ListOptions selects a page of keys in key order.
+type ListOptions struct {
+	Prefix string
+	After  string
+	Limit  int
+}
+
+// Page is a page of entries. Next is the After of the following page and
+// is empty on the last one.
+type Page struct {
+	Items []Item `json:"items"`
+	Next  string `json:"next"`
+}
+
+// List returns one page of entries.
+func (c *Client) List(ctx context.Context, opts ListOptions) (*Page, error) {
+	query := url.Values{}
+	setParam(query, "prefix", opts.Prefix)
+	setParam(query, "after", opts.After)
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+
+	var page Page
+	_, err := c.do(ctx, http.MethodGet, "/kv", query, nil, true, &page)
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// ListAll calls fn for every entry matching opts, following pages until
+// the last one or until fn returns an error.
+func (c *Client) ListAll(ctx context.Context, opts ListOptions, fn func(Item) error) error {
+	for {
+		page, err := c.List(ctx, opts)
+		if err != nil {
+			return err
+		}
+		for _, item := range page.Items {
+			err = fn(item)
+			if err != nil {
+				return err
+			}
+		}
+		if page.Next == "" {
+			return nil
+		}
+		opts.After = page.Next
+	}
+}
+
+// QueryOptions selects entries by a secondary index. Set Eq or any of the
+// range bounds; empty fields are not sent.
+type QueryOptions struct {
+	Index string
+	Eq    string
+	Gt    string
+	Ge    string
+	Lt    string
+	Le    string
+	Limit int
+}
+
+// Query returns entries found through a secondary index.
+func (c *Client) Query(ctx context.Context, opts QueryOptions) ([]Item, error) {
+	query := url.Values{}
+	setParam(query, "index", opts.Index)
+	setParam(query, "eq", opts.Eq)
+	setParam(query, "gt", opts.Gt)
+	setParam(query, "ge", opts.Ge)
+	setParam(query, "lt", opts.Lt)
+	setParam(query, "le", opts.Le)
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+
+	var resp struct {
+		Items []Item `json:"items"`
+	}
+	_, err := c.do(ctx, http.MethodGet, "/kv/_query", query, nil, true, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+func setParam(query url.Values, name string, value string) {
+	if value != "" {
+		query.Set(name, value)
+	}
+}
+
+// keyPath escapes key so that '/' and other reserved characters stay
+// part of the key.
+func keyPath(key string) string {
+	return "/kv/" + url.PathEscape(key)
+}
+
+// do sends a request and decodes a JSON response into out. Idempotent
+// requests are retried on transient failures.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values,
+	body any, idempotent bool, out any) (int, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	attempts := 1
+	if idempotent {
+		attempts += c.retries
+	}
+
+	var (
+		status int
+		err    error
+	)
+	for attempt := 0; attempt < attempts; attempt++ {
+		var retryAfter time.Duration
+		status, retryAfter, err = c.send(ctx, method, path, query, payload, out)
+		if err == nil || !retryable(err) || attempt == attempts-1 {
+			break
+		}
+
+		timer := time.NewTimer(c.backoff(attempt, retryAfter))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return status, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return status, err
+}
+
+func (c *Client) send(ctx context.Context, method string, path string, query url.Values,
+	payload []byte, out any) (int, time.Duration, error) {
+	var bodyReader io.Reader
+	if payload != nil {
+		bodyReader = bytes.NewReader(payload)
+	}
+	resp, err := c.open(ctx, method, path, query, bodyReader, "application/json", "application/json")
+	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			return apiErr.StatusCode, apiErr.retryAfter, err
+		}
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, 0, err
+	}
+	if out != nil && len(data) > 0 {
+		err = json.Unmarshal(data, out)
+		if err != nil {
+			return resp.StatusCode, 0, fmt.Errorf("kvstorage: decode response: %w", err)
+		}
+	}
+	return resp.StatusCode, 0, nil
+}
+
+// open sends a request and returns the response for the caller to read
+// and close. Error responses are read and returned as *APIError.
+func (c *Client) open(ctx context.Context, method string, path string, query url.Values,
+	body io.Reader, contentType string, accept string) (*http.Response, error) {
+	u := *c.baseURL
+	u.RawPath = u.EscapedPath() + path
+	u.Path, _ = url.PathUnescape(u.RawPath)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", accept)
+	if c.apiKey != "" {
+		req.Header.Set(APIKeyHeader, c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusBadRequest {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	apiErr := parseAPIError(resp.StatusCode, resp.Header.Get("Content-Type"), data)
+	apiErr.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	return nil, apiErr
+}
+
+func parseAPIError(status int, contentType string, data []byte) *APIError {
+	apiErr := &APIError{StatusCode: status, body: data}
+	if strings.HasPrefix(contentType, "application/json") {
+		var body struct {
+			Error   string   `json:"error"`
+			Details []string `json:"details"`
+		}
+		if json.Unmarshal(data, &body) == nil {
+			apiErr.Message = body.Error
+			apiErr.Details = body.Details
+			return apiErr
+		}
+	}
+	apiErr.Message = strings.TrimSpace(string(data))
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(status)
+	}
+	return apiErr
+}
+
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// retryable reports whether a request may succeed when repeated.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return errors.Is(apiErr, ErrRateLimited) || errors.Is(apiErr, ErrUnavailable)
+	}
+	var netErr *url.Error
+	return errors.As(err, &netErr)
+}
+
+func (c *Client) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	delay := c.retryDelay << attempt
+	if delay > 0 {
+		delay = rand.N(delay) + 1
+	}
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	if c.maxRetryDelay > 0 && delay > c.maxRetryDelay {
+		delay = c.maxRetryDelay
+	}
+	return delay
+}
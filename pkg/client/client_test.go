@@ -0,0 +1,469 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"kvManager/internal/handlers"
+	"kvManager/internal/pkg/log"
+	"kvManager/internal/storage"
+	"kvManager/pkg/client"
+)
+
+type user struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	mem := storage.NewMemoryRepository()
+	server := httptest.NewServer(handlers.NewRouter(&handlers.Handler{
+		Repo:      mem,
+		Indexes:   mem,
+		Usage:     mem,
+		AdminKeys: []string{"admin"},
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newClient(t *testing.T, baseURL string, opts ...client.Option) *client.Client {
+	t.Helper()
+	c, err := client.New(baseURL, opts...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return c
+}
+
+func TestClientCRUD(t *testing.T) {
+	server := newServer(t)
+	c := newClient(t, server.URL)
+	ctx := context.Background()
+
+	err := c.Add(ctx, "user:1", user{Name: "Ann", Age: 30})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	err = c.Add(ctx, "user:1", user{Name: "Bob"})
+	if !errors.Is(err, client.ErrConflict) {
+		t.Errorf("Add existing key: expected ErrConflict, got %v", err)
+	}
+
+	got, err := client.GetAs[user](ctx, c, "user:1")
+	if err != nil {
+		t.Fatalf("GetAs: %v", err)
+	}
+	if got != (user{Name: "Ann", Age: 30}) {
+		t.Errorf("GetAs: got %+v", got)
+	}
+
+	err = c.Update(ctx, "user:1", user{Name: "Ann", Age: 31})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	err = c.Update(ctx, "user:2", user{Name: "Bob"})
+	if !errors.Is(err, client.ErrKeyNotFound) {
+		t.Errorf("Update missing key: expected ErrKeyNotFound, got %v", err)
+	}
+
+	created, err := c.Put(ctx, "user:2", user{Name: "Bob"})
+	if err != nil || !created {
+		t.Errorf("Put new key: created=%v err=%v", created, err)
+	}
+	created, err = c.Put(ctx, "user:2", user{Name: "Bob", Age: 40})
+	if err != nil || created {
+		t.Errorf("Put existing key: created=%v err=%v", created, err)
+	}
+
+	err = c.Delete(ctx, "user:1")
+	if err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	_, err = c.Get(ctx, "user:1")
+	if !errors.Is(err, client.ErrKeyNotFound) {
+		t.Errorf("Get deleted key: expected ErrKeyNotFound, got %v", err)
+	}
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Get deleted key: expected APIError 404, got %v", err)
+	}
+
+	err = c.Add(ctx, "_query", "value")
+	if !errors.Is(err, client.ErrInvalidRequest) {
+		t.Errorf("Add reserved key: expected ErrInvalidRequest, got %v", err)
+	}
+}
+
+func TestClientKeysWithReservedCharacters(t *testing.T) {
+	server := newServer(t)
+	c := newClient(t, server.URL)
+	ctx := context.Background()
+
+	for _, key := range []string{"files/a/b.txt", "q?x=1", "100%", "with space", "hash#tag"} {
+		t.Run(key, func(t *testing.T) {
+			err := c.Add(ctx, key, key)
+			if err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+			got, err := client.GetAs[string](ctx, c, key)
+			if err != nil || got != key {
+				t.Errorf("GetAs: got %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestClientBatch(t *testing.T) {
+	server := newServer(t)
+	c := newClient(t, server.URL)
+	ctx := context.Background()
+
+	for _, u := range []user{{Name: "a", Age: 1}, {Name: "b", Age: 2}} {
+		_, err := c.Put(ctx, "user:"+u.Name, u)
+		if err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+
+	users, err := client.MultiGetAs[user](ctx, c, []string{"user:a", "user:b", "user:c"})
+	if err != nil {
+		t.Fatalf("MultiGetAs: %v", err)
+	}
+	expected := map[string]user{"user:a": {Name: "a", Age: 1}, "user:b": {Name: "b", Age: 2}}
+	if !reflect.DeepEqual(users, expected) {
+		t.Errorf("MultiGetAs: got %+v", users)
+	}
+
+	deleted, err := c.MultiDelete(ctx, []string{"user:a", "user:c"})
+	if err != nil {
+		t.Fatalf("MultiDelete: %v", err)
+	}
+	if !reflect.DeepEqual(deleted, []string{"user:a"}) {
+		t.Errorf("MultiDelete: got %v", deleted)
+	}
+}
+
+func TestClientListAndQuery(t *testing.T) {
+	server := newServer(t)
+	c := newClient(t, server.URL)
+	ctx := context.Background()
+
+	keys := []string{"user:1", "user:2", "user:3", "user:4", "user:5", "zone:1"}
+	for i, key := range keys {
+		_, err := c.Put(ctx, key, user{Name: key, Age: 20 + i})
+		if err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+
+	page, err := c.List(ctx, client.ListOptions{Prefix: "user:", Limit: 2})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(page.Items) != 2 || page.Next != "user:2" {
+		t.Errorf("List: got %d items, next %q", len(page.Items), page.Next)
+	}
+
+	var listed []string
+	err = c.ListAll(ctx, client.ListOptions{Prefix: "user:", Limit: 2}, func(item client.Item) error {
+		listed = append(listed, item.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ListAll: %v", err)
+	}
+	if !reflect.DeepEqual(listed, keys[:5]) {
+		t.Errorf("ListAll: got %v", listed)
+	}
+
+	stop := errors.New("stop")
+	err = c.ListAll(ctx, client.ListOptions{}, func(client.Item) error { return stop })
+	if !errors.Is(err, stop) {
+		t.Errorf("ListAll: expected callback error, got %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/admin/indexes",
+		strings.NewReader(`{"name":"by_age","path":"value.age","type":"unsigned"}`))
+	if err != nil {
+		t.Fatalf("create index: %v", err)
+	}
+	req.Header.Set(client.APIKeyHeader, "admin")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("create index: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create index: status %d", resp.StatusCode)
+	}
+
+	items, err := c.Query(ctx, client.QueryOptions{Index: "by_age", Ge: "22", Lt: "24"})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var found []string
+	for _, item := range items {
+		found = append(found, item.Key)
+	}
+	if !reflect.DeepEqual(found, []string{"user:3", "user:4"}) {
+		t.Errorf("Query: got %v", found)
+	}
+
+	_, err = c.Query(ctx, client.QueryOptions{Index: "missing", Eq: "1"})
+	if !errors.Is(err, client.ErrKeyNotFound) {
+		t.Errorf("Query missing index: expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	testCases := []struct {
+		name          string
+		failures      int32
+		status        int
+		call          func(ctx context.Context, c *client.Client) error
+		expectedCalls int32
+		expectedErr   error
+	}{
+		{
+			name:     "get retried after 503",
+			failures: 2,
+			status:   http.StatusServiceUnavailable,
+			call: func(ctx context.Context, c *client.Client) error {
+				_, err := c.Get(ctx, "k")
+				return err
+			},
+			expectedCalls: 3,
+		},
+		{
+			name:     "get retried after 429",
+			failures: 1,
+			status:   http.StatusTooManyRequests,
+			call: func(ctx context.Context, c *client.Client) error {
+				_, err := c.Get(ctx, "k")
+				return err
+			},
+			expectedCalls: 2,
+		},
+		{
+			name:     "retries exhausted",
+			failures: 10,
+			status:   http.StatusServiceUnavailable,
+			call: func(ctx context.Context, c *client.Client) error {
+				_, err := c.Get(ctx, "k")
+				return err
+			},
+			expectedCalls: 3,
+			expectedErr:   client.ErrUnavailable,
+		},
+		{
+			name:     "add is not retried",
+			failures: 1,
+			status:   http.StatusServiceUnavailable,
+			call: func(ctx context.Context, c *client.Client) error {
+				return c.Add(ctx, "k", 1)
+			},
+			expectedCalls: 1,
+			expectedErr:   client.ErrUnavailable,
+		},
+		{
+			name:     "client errors are not retried",
+			failures: 1,
+			status:   http.StatusNotFound,
+			call: func(ctx context.Context, c *client.Client) error {
+				_, err := c.Get(ctx, "k")
+				return err
+			},
+			expectedCalls: 1,
+			expectedErr:   client.ErrKeyNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= tc.failures {
+					http.Error(w, http.StatusText(tc.status), tc.status)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"value":1}`))
+			}))
+			defer server.Close()
+
+			c := newClient(t, server.URL, client.WithRetries(2, time.Millisecond, 5*time.Millisecond))
+			err := tc.call(context.Background(), c)
+			if tc.expectedErr == nil && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Expected %v, got %v", tc.expectedErr, err)
+			}
+			if calls.Load() != tc.expectedCalls {
+				t.Errorf("Expected %d calls, got %d", tc.expectedCalls, calls.Load())
+			}
+		})
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	c := newClient(t, server.URL, client.WithRetries(5, time.Second, time.Minute))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.Get(ctx, "k")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Get returned after %v", elapsed)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, baseURL := range []string{"", "localhost:8080", "/kv"} {
+		_, err := client.New(baseURL)
+		if err == nil {
+			t.Errorf("New(%q): expected error", baseURL)
+		}
+	}
+}
+
+type downReporter struct{}
+
+func (downReporter) Health() (any, bool) { return "open", false }
+
+func TestClientServerInfo(t *testing.T) {
+	err := log.SetupLogger()
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	mem := storage.NewMemoryRepository()
+	server := httptest.NewServer(handlers.NewRouter(&handlers.Handler{
+		Repo:         mem,
+		Usage:        mem,
+		Quotas:       &handlers.Quotas{Default: handlers.Quota{MaxKeys: 10}},
+		HealthChecks: map[string]handlers.HealthReporter{"tarantool": downReporter{}},
+		AdminKeys:    []string{"admin"},
+	}))
+	defer server.Close()
+	c := newClient(t, server.URL, client.WithAPIKey("admin"))
+	ctx := context.Background()
+
+	health, err := c.Health(ctx)
+	if err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+	if health.Status != "unavailable" || health.Checks["tarantool"].Healthy {
+		t.Errorf("Health: got %+v", health)
+	}
+
+	_, err = c.Put(ctx, "user:1", "Ann")
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	usage, err := c.Usage(ctx, "user")
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	if usage.Namespace != "user" || usage.Usage.Keys != 1 || usage.MaxKeys != 10 {
+		t.Errorf("Usage: got %+v", usage)
+	}
+
+	vars, err := c.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if _, ok := vars["memstats"]; !ok {
+		t.Errorf("Stats: memstats missing from %d variables", len(vars))
+	}
+}
+
+func TestClientExportImport(t *testing.T) {
+	source := newClient(t, newServer(t).URL)
+	ctx := context.Background()
+	for i, name := range []string{"a", "b", "c"} {
+		_, err := source.Put(ctx, "user:"+name, user{Name: name, Age: i})
+		if err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+
+	var dump bytes.Buffer
+	encoder := json.NewEncoder(&dump)
+	err := source.Export(ctx, client.ExportOptions{Prefix: "user:", After: "user:a"}, func(item client.Item) error {
+		return encoder.Encode(item)
+	})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if lines := strings.Count(dump.String(), "\n"); lines != 2 {
+		t.Fatalf("Export: expected 2 lines, got %d", lines)
+	}
+
+	target := newClient(t, newServer(t).URL)
+	_, err = target.Put(ctx, "user:b", user{Name: "old"})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	var progress int64
+	summary, err := target.Import(ctx, bytes.NewReader(dump.Bytes()), client.ImportOptions{
+		Mode:     client.ImportSkip,
+		Progress: func(lines int64) { progress = lines },
+	})
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if summary.Processed != 2 || summary.Created != 1 || summary.Skipped != 1 || progress != 2 {
+		t.Errorf("Import: got %+v after %d lines", summary, progress)
+	}
+
+	summary, err = target.Import(ctx, bytes.NewReader(dump.Bytes()), client.ImportOptions{Mode: client.ImportFail})
+	if !errors.Is(err, client.ErrConflict) {
+		t.Errorf("Import: expected ErrConflict, got %v", err)
+	}
+	if summary == nil || summary.Failed != 1 || summary.Errors[0].Key != "user:b" {
+		t.Errorf("Import: got summary %+v", summary)
+	}
+
+	for _, imported := range []func(client.ImportSummary){nil, func(client.ImportSummary) {}} {
+		summary, err = target.Import(ctx, bytes.NewReader(dump.Bytes()), client.ImportOptions{
+			Mode:     client.ImportFail,
+			Imported: imported,
+		})
+		if !errors.Is(err, client.ErrConflict) {
+			t.Errorf("Import: expected ErrConflict, got %v", err)
+		}
+		if summary == nil || summary.Failed != 1 || summary.Errors[0].Key != "user:b" {
+			t.Errorf("Import: got summary %+v", summary)
+		}
+	}
+
+	got, err := client.GetAs[user](ctx, target, "user:b")
+	if err != nil || got.Name != "old" {
+		t.Errorf("GetAs: got %+v, %v", got, err)
+	}
+}
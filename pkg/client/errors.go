@@ -0,0 +1,60 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Errors matched by APIError through errors.Is.
+var (
+	ErrKeyNotFound    = errors.New("key not found")
+	ErrConflict       = errors.New("key already exists")
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrTooLarge       = errors.New("request too large")
+	ErrQuotaExceeded  = errors.New("quota exceeded")
+	ErrRateLimited    = errors.New("rate limited")
+	ErrUnavailable    = errors.New("service unavailable")
+)
+
+// APIError is a non-successful response of the server.
+type APIError struct {
+	StatusCode int
+	Message    string
+	Details    []string
+
+	body       []byte
+	retryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("kvstorage: %d %s", e.StatusCode, e.Message)
+	if len(e.Details) > 0 {
+		msg += ": " + strings.Join(e.Details, "; ")
+	}
+	return msg
+}
+
+// Is maps the status code to one of the sentinel errors, so callers can
+// write errors.Is(err, client.ErrKeyNotFound).
+func (e *APIError) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusNotFound:
+		return target == ErrKeyNotFound
+	case http.StatusConflict:
+		return target == ErrConflict
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return target == ErrInvalidRequest
+	case http.StatusRequestEntityTooLarge:
+		return target == ErrTooLarge || target == ErrInvalidRequest
+	case http.StatusForbidden:
+		return target == ErrQuotaExceeded
+	case http.StatusTooManyRequests:
+		return target == ErrRateLimited
+	case http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return target == ErrUnavailable
+	}
+	return false
+}
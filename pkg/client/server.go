@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// Health is the state of the server and its dependencies.
+type Health struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+type HealthCheck struct {
+	Healthy bool            `json:"healthy"`
+	Status  json.RawMessage `json:"status"`
+}
+
+// Health returns the server health. An unhealthy server is reported in
+// the result rather than as an error.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var health Health
+	_, err := c.do(ctx, http.MethodGet, "/health", nil, nil, false, &health)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusServiceUnavailable &&
+		json.Unmarshal(apiErr.body, &health) == nil && health.Status != "" {
+		return &health, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// Usage is the storage used by a namespace and its quota. Zero limits are
+// unlimited.
+type Usage struct {
+	Namespace string `json:"namespace"`
+	Usage     struct {
+		Keys  int64 `json:"keys"`
+		Bytes int64 `json:"bytes"`
+	} `json:"usage"`
+	MaxKeys  int64 `json:"max_keys"`
+	MaxBytes int64 `json:"max_bytes"`
+}
+
+// Usage returns the usage of namespace, the part of keys before the
+// first ':'. It needs an API key listed in the server's ADMIN_API_KEYS.
+func (c *Client) Usage(ctx context.Context, namespace string) (*Usage, error) {
+	var usage Usage
+	_, err := c.do(ctx, http.MethodGet, "/admin/usage/"+url.PathEscape(namespace), nil, nil, true, &usage)
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// Stats returns the expvar variables of the server by name, e.g.
+// "resilience" and "kv_cache".
+func (c *Client) Stats(ctx context.Context) (map[string]json.RawMessage, error) {
+	var vars map[string]json.RawMessage
+	_, err := c.do(ctx, http.MethodGet, "/debug/vars", nil, nil, true, &vars)
+	if err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Decode unmarshals an encoded value into T.
+func Decode[T any](raw json.RawMessage) (T, error) {
+	var value T
+	err := json.Unmarshal(raw, &value)
+	return value, err
+}
+
+// GetAs returns the value of key decoded into T.
+func GetAs[T any](ctx context.Context, c *Client, key string) (T, error) {
+	raw, err := c.Get(ctx, key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return Decode[T](raw)
+}
+
+// MultiGetAs returns the values of the keys that exist decoded into T.
+func MultiGetAs[T any](ctx context.Context, c *Client, keys []string) (map[string]T, error) {
+	raws, err := c.MultiGet(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]T, len(raws))
+	for key, raw := range raws {
+		value, err := Decode[T](raw)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// ListAs returns one page of entries with values decoded into T and the
+// cursor of the next page.
+func ListAs[T any](ctx context.Context, c *Client, opts ListOptions) (map[string]T, string, error) {
+	page, err := c.List(ctx, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	values := make(map[string]T, len(page.Items))
+	for _, item := range page.Items {
+		value, err := Decode[T](item.Value)
+		if err != nil {
+			return nil, "", err
+		}
+		values[item.Key] = value
+	}
+	return values, page.Next, nil
+}
@@ -0,0 +1,5 @@
+// Package kvpb holds the protobuf messages and gRPC stubs of the
+// kvStorage gRPC API defined in kv.proto.
+package kvpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative kv.proto